@@ -0,0 +1,67 @@
+// repaircounters 根据 wifi_config、scan_log 和 coupon_log 重新计算门店的计数器
+// （wifi_count、scan_count、success_scan_count、coupon_issued_count），用于修复不一致的数据。
+// 服务运行期间也可以执行，重新计算时会锁定正在处理的门店行。
+//
+//	repaircounters                  # 重新计算所有门店
+//	repaircounters -store 1000001,1000002
+//
+// 与服务端一样通过环境变量 CONFIG_PATH 指定配置文件。
+package main
+
+import (
+	"app/internal/models"
+	"app/internal/service"
+	"app/pkg/database"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	stores := flag.String("store", "", "只重新计算指定的门店，多个门店ID以逗号分隔")
+	batchSize := flag.Int("batch", 200, "重新计算所有门店时每批处理的门店数量")
+	flag.Parse()
+
+	storeIDs, err := parseStoreIDs(*stores)
+	if err != nil {
+		log.Fatalf("无效的门店ID: %v", err)
+	}
+	if *batchSize <= 0 {
+		log.Fatalf("无效的批次大小: %d", *batchSize)
+	}
+
+	database.Init()
+	// 确保计数器字段已经存在
+	database.Migrate(models.AllModels()...)
+
+	counterService := &service.StoreCounterService{}
+	var fixed int
+	if len(storeIDs) > 0 {
+		fixed, err = counterService.RecomputeStoreCounters(storeIDs)
+	} else {
+		fixed, err = counterService.RecomputeAllStoreCounters(*batchSize)
+	}
+	if err != nil {
+		log.Fatalf("重新计算门店计数器失败（已修正 %d 个门店）: %v", fixed, err)
+	}
+	log.Printf("重新计算完成，已修正 %d 个门店的计数器", fixed)
+}
+
+// parseStoreIDs 解析以逗号分隔的门店ID列表
+func parseStoreIDs(s string) ([]uint, error) {
+	var ids []uint
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", part, err)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
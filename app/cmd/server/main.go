@@ -2,10 +2,15 @@ package main
 
 import (
 	"app/config"
+	"app/internal/models"
 	"app/internal/router"
+	"app/internal/service"
 	"app/pkg/database"
-	"fmt"
+	"app/pkg/security"
+	"context"
 	"log"
+	"net"
+	"time"
 )
 
 func main() {
@@ -14,11 +19,38 @@ func main() {
 	// 所以我们在这里直接使用 database.Init()
 	database.Init()
 
+	// 同步数据表结构
+	database.Migrate(models.AllModels()...)
+
+	// 加密服务端加密之前保存的明文WIFI密码
+	if n, err := (&service.WifiConfigService{}).SealLegacyWifiPasswords(500); err != nil {
+		log.Printf("WARNING: 加密旧的WIFI密码失败: %v", err)
+	} else if n > 0 {
+		log.Printf("已加密 %d 个旧的WIFI密码", n)
+	}
+
+	// 定期关闭超时未上报结果的扫码连接会话
+	(&service.ConnectSessionService{}).StartSweeper(context.Background(), time.Minute)
+
+	// 定期处理过期的优惠券，多个实例通过数据库租约协调
+	if config.Cfg.Jobs.CouponExpiryInterval > 0 {
+		(&service.CouponExpiryService{}).StartScheduler(context.Background(), config.Cfg.Jobs.CouponExpiryInterval, config.Cfg.Jobs.CouponExpiryBatchSize)
+	}
+
 	// 设置并获取 Gin 路由引擎
 	r := router.SetupRouter()
 
+	// 调试明文模式只允许在本地开发环境中开启
+	if config.Cfg.Server.DebugPlaintext {
+		if err := security.EnablePlaintextDebug(config.Cfg.Server.Host); err != nil {
+			log.Printf("WARNING: 未开启调试明文模式: %v", err)
+		} else {
+			log.Printf("WARNING: 调试明文模式已开启，响应将不加密，切勿在生产环境使用")
+		}
+	}
+
 	// 启动服务器
-	serverAddr := fmt.Sprintf(":%s", config.Cfg.Server.Port)
+	serverAddr := net.JoinHostPort(config.Cfg.Server.Host, config.Cfg.Server.Port)
 	log.Printf("服务器正在启动，监听地址: %s", serverAddr)
 
 	// 记录域名信息
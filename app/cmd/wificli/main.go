@@ -0,0 +1,212 @@
+// wificli 是用于本地调试的命令行工具，可以签名并发送请求、解密响应，以及单独解密一个加密信封。
+//
+// 发送请求（路径相对于 /api/v1）：
+//
+//	wificli -secret 1234567890123456 GET '/stores/?page=1'
+//	wificli -app-id demo -key-id k20250101-1a2b3c4d -secret ... PATCH /stores/1000001/status '{"status":0}'
+//
+// 解密信封（协议版本 3 及以上需要提供请求的方法、路径、时间戳和 nonce）：
+//
+//	wificli decrypt -secret ... -method GET -path /api/v1/stores/ -timestamp 1700000000 -nonce abc12345 '{"data":...}'
+//
+// 密钥等参数也可以通过环境变量 WIFICITY_URL、WIFICITY_APP_ID、WIFICITY_KEY_ID、WIFICITY_SECRET
+// 和 WIFICITY_USER_TOKEN 提供。
+package main
+
+import (
+	"app/pkg/protocol"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == "decrypt" {
+		err = runDecrypt(os.Args[2:])
+	} else {
+		err = runRequest(os.Args[1:])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "错误:", err)
+		os.Exit(1)
+	}
+}
+
+// parseSecret 解析密钥参数：以 "hex:" 开头时按十六进制解码（密钥轮换接口返回的格式），否则按原始字节使用
+func parseSecret(s string) ([]byte, error) {
+	if s == "" {
+		return nil, errors.New("缺少密钥，请使用 -secret 或环境变量 WIFICITY_SECRET")
+	}
+	if hexSecret, ok := strings.CutPrefix(s, "hex:"); ok {
+		return hex.DecodeString(hexSecret)
+	}
+	return []byte(s), nil
+}
+
+// runRequest 签名并发送一个请求，然后打印解密后的响应
+func runRequest(args []string) error {
+	fs := flag.NewFlagSet("wificli", flag.ExitOnError)
+	baseURL := fs.String("url", envOr("WIFICITY_URL", "http://127.0.0.1:8080"), "服务地址")
+	appID := fs.String("app-id", os.Getenv("WIFICITY_APP_ID"), "调用方标识 (X-App-Id)，为空表示使用全局密钥")
+	keyID := fs.String("key-id", os.Getenv("WIFICITY_KEY_ID"), "密钥ID (X-Key-Id)")
+	secret := fs.String("secret", os.Getenv("WIFICITY_SECRET"), "主密钥，以 hex: 开头时按十六进制解码")
+	aesBits := fs.Int("aes-bits", 256, "AES 密钥长度，必须与服务端的 aes_key_bits 一致")
+	userToken := fs.String("user-token", os.Getenv("WIFICITY_USER_TOKEN"), "用户令牌 (X-User-Token)，由 POST /users/login 签发")
+	plain := fs.Bool("plain", false, "以明文发送请求体，要求服务端开启调试明文模式")
+	verbose := fs.Bool("v", false, "打印请求头和原始响应")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: wificli [参数] METHOD PATH [BODY]")
+		fmt.Fprintln(fs.Output(), "      wificli decrypt [参数] ENVELOPE")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 2 || fs.NArg() > 3 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	key, err := parseSecret(*secret)
+	if err != nil {
+		return err
+	}
+	signer := &protocol.Signer{AppID: *appID, KeyID: *keyID, Secret: key, AESKeyBits: *aesBits, Plaintext: *plain}
+
+	method := strings.ToUpper(fs.Arg(0))
+	req, err := http.NewRequest(method, strings.TrimRight(*baseURL, "/")+"/api/v1"+fs.Arg(1), nil)
+	if err != nil {
+		return err
+	}
+	var body []byte
+	if fs.NArg() == 3 {
+		body = []byte(fs.Arg(2))
+		if !json.Valid(body) {
+			return errors.New("请求体不是有效的 JSON")
+		}
+	}
+	if *userToken != "" {
+		req.Header.Set("X-User-Token", *userToken)
+	}
+	signed, err := signer.Sign(req, body)
+	if err != nil {
+		return err
+	}
+	if *verbose {
+		fmt.Fprintf(os.Stderr, "> %s %s\n", req.Method, req.URL)
+		for k, v := range req.Header {
+			fmt.Fprintf(os.Stderr, "> %s: %s\n", k, strings.Join(v, ", "))
+		}
+	}
+
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "< %s\n", resp.Status)
+	if *verbose && len(respBody) > 0 {
+		fmt.Fprintf(os.Stderr, "< %s\n", respBody)
+	}
+	if len(respBody) == 0 {
+		return nil
+	}
+
+	// 调试明文模式的响应和中间件直接返回的错误都不加密
+	var envelope protocol.EncryptedData
+	if resp.Header.Get(protocol.DebugPlaintextHeader) == "1" || json.Unmarshal(respBody, &envelope) != nil || envelope.Data == "" {
+		return printJSON(respBody)
+	}
+	if envelope.KID != signer.KeyID {
+		return fmt.Errorf("响应使用了密钥 %q 加密，请使用 -key-id 指定该密钥", envelope.KID)
+	}
+	decrypted, err := signer.Open(signed, &envelope)
+	if err != nil {
+		return fmt.Errorf("无法解密响应: %w", err)
+	}
+	return printJSON(decrypted)
+}
+
+// runDecrypt 解密一个加密信封
+func runDecrypt(args []string) error {
+	fs := flag.NewFlagSet("wificli decrypt", flag.ExitOnError)
+	secret := fs.String("secret", os.Getenv("WIFICITY_SECRET"), "主密钥，以 hex: 开头时按十六进制解码")
+	version := fs.Int("version", protocol.Latest, "协议版本")
+	aesBits := fs.Int("aes-bits", 256, "AES 密钥长度，协议版本 2 及以上使用")
+	method := fs.String("method", "", "请求方法，协议版本 3 及以上使用")
+	path := fs.String("path", "", "请求路径（包含 /api/v1），协议版本 3 及以上使用")
+	timestamp := fs.String("timestamp", "", "请求头 X-Timestamp，协议版本 3 及以上使用")
+	nonce := fs.String("nonce", "", "请求头 X-Nonce，协议版本 3 及以上使用")
+	request := fs.Bool("request", false, "解密的是请求体而不是响应")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法: wificli decrypt [参数] ENVELOPE")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	master, err := parseSecret(*secret)
+	if err != nil {
+		return err
+	}
+	var envelope protocol.EncryptedData
+	if err := json.Unmarshal([]byte(fs.Arg(0)), &envelope); err != nil {
+		return fmt.Errorf("无效的加密信封: %w", err)
+	}
+
+	key := master
+	if *version >= protocol.V2 {
+		if key, err = protocol.DeriveEncryptionKey(master, *aesBits); err != nil {
+			return err
+		}
+	}
+	var aad []byte
+	if *version >= protocol.V3 {
+		if *method == "" || *path == "" || *timestamp == "" || *nonce == "" {
+			return errors.New("协议版本 3 及以上需要提供 -method、-path、-timestamp 和 -nonce")
+		}
+		if *request {
+			aad = protocol.RequestAAD(strings.ToUpper(*method), *path, *timestamp, *nonce)
+		} else {
+			aad = protocol.ResponseAAD(strings.ToUpper(*method), *path, *timestamp, *nonce)
+		}
+	}
+	decrypted, err := protocol.DecryptWithAAD(&envelope, key, aad)
+	if err != nil {
+		return fmt.Errorf("解密失败: %w", err)
+	}
+	return printJSON(decrypted)
+}
+
+// printJSON 格式化输出 JSON，不是 JSON 时原样输出
+func printJSON(data []byte) error {
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(os.Stdout)
+	return err
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"time"
@@ -16,13 +17,20 @@ type Config struct {
 	Server   ServerConfig   `yaml:"server"`
 	Database DatabaseConfig `yaml:"database"`
 	Security SecurityConfig `yaml:"security"`
+	QRCode   QRCodeConfig   `yaml:"qrcode"`
+	Jobs     JobsConfig     `yaml:"jobs"`
+	WeChat   WeChatConfig   `yaml:"wechat"`
 }
 
 // ServerConfig 定义了服务器相关的配置
 type ServerConfig struct {
+	Host     string `yaml:"host"` // 监听地址，为空表示监听所有网卡
 	Port     string `yaml:"port"`
 	Domain   string `yaml:"domain"`
 	UseHTTPS bool   `yaml:"use_https"`
+	// 调试明文模式：仍然校验签名，但响应不加密，请求体也可以明文发送。
+	// 仅在 gin 为 debug 模式且监听本机地址时生效，用于本地开发调试
+	DebugPlaintext bool `yaml:"debug_plaintext"`
 }
 
 // DatabaseConfig 定义了数据库连接配置
@@ -49,11 +57,61 @@ type DBSettings struct {
 type SecurityConfig struct {
 	APISecret       string        `yaml:"api_secret"`
 	TimestampWindow time.Duration `yaml:"timestamp_window"`
+	MaxClockSkew    time.Duration `yaml:"max_clock_skew"` // 允许客户端时间超前服务器的最大时长
+	// 是否允许未携带 X-App-Id 的请求使用全局 APISecret，仅用于旧客户端迁移期间
+	AllowLegacySecret bool `yaml:"allow_legacy_secret"`
+	// 使用全局 APISecret 的调用方的角色，默认为 mini_program
+	LegacySecretRole string `yaml:"legacy_secret_role"`
+	// 轮换后旧密钥仍可用于解密的宽限期，单位: 小时
+	KeyGraceHours int `yaml:"key_grace_hours"`
+	// 协议版本 2 派生的 AES 密钥长度，可选 128 或 256
+	AESKeyBits int `yaml:"aes_key_bits"`
+	// 终端用户令牌的签名密钥，为空时从 APISecret 派生
+	UserTokenSecret string `yaml:"user_token_secret"`
+	// 终端用户令牌的有效期，单位: 秒，默认 2 小时
+	UserTokenTTL time.Duration `yaml:"user_token_ttl"`
+	// WIFI 密码等敏感数据静态加密所用的主密钥（64 位十六进制字符串），为空时从 APISecret 派生。
+	// 更换主密钥后，已加密的数据将无法解密
+	DataMasterKey string `yaml:"data_master_key"`
+	// 扫码后获取WIFI密码的超时时长，单位: 秒，默认 5 分钟。
+	// 连接票据在此期间内有效，超时未获取密码的会话将被自动关闭
+	ConnectSessionTimeout time.Duration `yaml:"connect_session_timeout"`
+	// 获取WIFI密码后上报连接结果的超时时长，单位: 秒，默认 5 分钟；从获取密码时重新计时，
+	// 超时未上报结果的会话将被自动关闭
+	ConnectReportTimeout time.Duration `yaml:"connect_report_timeout"`
+	// 连接成功后占用 WIFI 连接数的时长，单位: 秒，默认 2 小时；用户主动断开时提前释放
+	WifiConnectionTTL time.Duration `yaml:"wifi_connection_ttl"`
+	// 允许的最低协议版本，默认配置为 4；版本 1 至 3 的签名不覆盖 PATCH 请求体，仅为兼容旧客户端保留
+	MinProtocolVersion int `yaml:"min_protocol_version"`
+}
+
+// QRCodeConfig 定义了门店二维码相关的配置
+type QRCodeConfig struct {
+	// 二维码内容的 URL 前缀，内容为前缀加二维码ID；为空时使用 {scheme}://{domain}/q/
+	ContentURLPrefix string `yaml:"content_url_prefix"`
+	// 叠加在二维码中心的 logo 图片（PNG 或 JPEG）路径，为空表示不支持叠加 logo
+	LogoPath string `yaml:"logo_path"`
+}
+
+// JobsConfig 定义了后台任务相关的配置
+type JobsConfig struct {
+	// 处理过期优惠券的间隔，单位: 秒，默认 1 分钟；小于 0 表示不在本实例运行
+	CouponExpiryInterval time.Duration `yaml:"coupon_expiry_interval"`
+	// 每批处理的优惠券数量，默认 500
+	CouponExpiryBatchSize int `yaml:"coupon_expiry_batch_size"`
+}
+
+// WeChatConfig 定义了微信小程序相关的配置，用于登录时校验用户身份
+type WeChatConfig struct {
+	AppID     string `yaml:"app_id"`
+	AppSecret string `yaml:"app_secret"`
+	// 微信服务端接口地址，为空时使用 https://api.weixin.qq.com
+	APIBase string `yaml:"api_base"`
 }
 
 // init 在包被导入时自动执行，用于加载配置
 func init() {
-	// 在测试环境中运行时，可能不需要加载配置文件
+	// 在测试环境中运行时，可能不需要加载配置文件；go test 需要设置 GIN_MODE=test
 	if os.Getenv("GIN_MODE") == "test" {
 		// 为测试环境设置默认配置
 		Cfg = &Config{
@@ -67,7 +125,8 @@ func init() {
 				Slaves:   []DBSource{{DSN: "user:pass@tcp(127.0.0.1:3306)/test_db?charset=utf8mb4&parseTime=True&loc=Local"}},
 				Settings: DBSettings{MaxIdleConns: 1, MaxOpenConns: 2, ConnMaxIdleTime: time.Minute, ConnMaxLifetime: time.Hour},
 			},
-			Security: SecurityConfig{APISecret: "1234567890123456", TimestampWindow: 300 * time.Second},
+			Security: SecurityConfig{APISecret: "1234567890123456", TimestampWindow: 300 * time.Second, MaxClockSkew: 60 * time.Second, AllowLegacySecret: true, LegacySecretRole: "mini_program", KeyGraceHours: 168, AESKeyBits: 256, UserTokenTTL: 2 * time.Hour, ConnectSessionTimeout: 5 * time.Minute, ConnectReportTimeout: 5 * time.Minute, WifiConnectionTTL: 2 * time.Hour, MinProtocolVersion: 1},
+			Jobs:     JobsConfig{CouponExpiryInterval: time.Minute, CouponExpiryBatchSize: 500},
 		}
 		return
 	}
@@ -101,6 +160,39 @@ func LoadConfig(path string) error {
 
 	// 将秒转换为 time.Duration
 	Cfg.Security.TimestampWindow = Cfg.Security.TimestampWindow * time.Second
+	Cfg.Security.MaxClockSkew = Cfg.Security.MaxClockSkew * time.Second
+	Cfg.Security.UserTokenTTL = Cfg.Security.UserTokenTTL * time.Second
+	if Cfg.Security.UserTokenTTL == 0 {
+		Cfg.Security.UserTokenTTL = 2 * time.Hour
+	}
+	Cfg.Security.ConnectSessionTimeout = Cfg.Security.ConnectSessionTimeout * time.Second
+	if Cfg.Security.ConnectSessionTimeout == 0 {
+		Cfg.Security.ConnectSessionTimeout = 5 * time.Minute
+	}
+	Cfg.Security.ConnectReportTimeout = Cfg.Security.ConnectReportTimeout * time.Second
+	if Cfg.Security.ConnectReportTimeout == 0 {
+		Cfg.Security.ConnectReportTimeout = 5 * time.Minute
+	}
+	Cfg.Security.WifiConnectionTTL = Cfg.Security.WifiConnectionTTL * time.Second
+	if Cfg.Security.WifiConnectionTTL == 0 {
+		Cfg.Security.WifiConnectionTTL = 2 * time.Hour
+	}
+	Cfg.Jobs.CouponExpiryInterval = Cfg.Jobs.CouponExpiryInterval * time.Second
+	if Cfg.Jobs.CouponExpiryInterval == 0 {
+		Cfg.Jobs.CouponExpiryInterval = time.Minute
+	}
+	if Cfg.Jobs.CouponExpiryBatchSize <= 0 {
+		Cfg.Jobs.CouponExpiryBatchSize = 500
+	}
+
+	// 校验 AES 密钥长度配置
+	switch Cfg.Security.AESKeyBits {
+	case 0:
+		Cfg.Security.AESKeyBits = 256
+	case 128, 256:
+	default:
+		return fmt.Errorf("无效的 aes_key_bits: %d，只支持 128 或 256", Cfg.Security.AESKeyBits)
+	}
 
 	// 允许从环境变量覆盖域名配置
 	if domain := os.Getenv("API_DOMAIN"); domain != "" {
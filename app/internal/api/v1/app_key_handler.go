@@ -0,0 +1,135 @@
+package v1
+
+import (
+	"app/internal/service"
+	"app/pkg/security"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AppKeyHandler 负责处理调用方密钥轮换相关的API请求
+type AppKeyHandler struct {
+	service *service.AppKeyService
+}
+
+// NewAppKeyHandler 创建一个新的 AppKeyHandler
+func NewAppKeyHandler() *AppKeyHandler {
+	return &AppKeyHandler{
+		service: &service.AppKeyService{},
+	}
+}
+
+// ListKeys godoc
+// @Summary 查询调用方密钥列表
+// @Description 获取指定调用方的全部加密密钥及其状态（不包含密钥内容）
+// @Tags Admin
+// @Produce  json
+// @Param appId path string true "调用方标识"
+// @Success 200 {object} object{keys=[]models.AppKey}
+// @Failure 500 {object} security.ErrorResponse
+// @Router /admin/apps/{appId}/keys [get]
+func (h *AppKeyHandler) ListKeys(c *gin.Context) {
+	keys, err := h.service.ListKeys(c.Param("appId"))
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, gin.H{"keys": keys})
+}
+
+// CreateKey godoc
+// @Summary 新增调用方密钥
+// @Description 生成一个新的可用密钥，密钥内容只在本次响应中返回。分发给客户端后再设为当前密钥。
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param appId path string true "调用方标识"
+// @Param key body service.CreateKeyInput false "密钥参数"
+// @Success 201 {object} object{key=models.AppKey,secret=string}
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Failure 500 {object} security.ErrorResponse
+// @Router /admin/apps/{appId}/keys [post]
+func (h *AppKeyHandler) CreateKey(c *gin.Context) {
+	var input service.CreateKeyInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	key, secret, err := h.service.CreateKey(c.Param("appId"), &input)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "调用方未找到"})
+		} else {
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusCreated, gin.H{"key": key, "secret": secret})
+}
+
+// PromoteKey godoc
+// @Summary 设为当前密钥
+// @Description 将指定密钥设为当前密钥，原当前密钥在宽限期内仍可用于解密
+// @Tags Admin
+// @Produce  json
+// @Param appId path string true "调用方标识"
+// @Param keyId path string true "密钥ID"
+// @Success 200 {object} models.AppKey
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Failure 500 {object} security.ErrorResponse
+// @Router /admin/apps/{appId}/keys/{keyId}/promote [patch]
+func (h *AppKeyHandler) PromoteKey(c *gin.Context) {
+	key, err := h.service.PromoteKey(c.Param("appId"), c.Param("keyId"))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "密钥未找到"})
+		case errors.Is(err, service.ErrKeyNotPromotable):
+			security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		default:
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, key)
+}
+
+// RetireKey godoc
+// @Summary 退役密钥
+// @Description 立即停止接受使用该密钥加密的请求，不能退役当前密钥
+// @Tags Admin
+// @Produce  json
+// @Param appId path string true "调用方标识"
+// @Param keyId path string true "密钥ID"
+// @Success 200 {object} models.AppKey
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Failure 500 {object} security.ErrorResponse
+// @Router /admin/apps/{appId}/keys/{keyId}/retire [patch]
+func (h *AppKeyHandler) RetireKey(c *gin.Context) {
+	key, err := h.service.RetireKey(c.Param("appId"), c.Param("keyId"))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "密钥未找到"})
+		case errors.Is(err, service.ErrRetireCurrentKey):
+			security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		default:
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, key)
+}
@@ -0,0 +1,215 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"app/internal/models"
+	"app/internal/service"
+	"app/pkg/security"
+)
+
+// CampaignHandler 负责处理营销活动相关的API请求
+type CampaignHandler struct {
+	service *service.CampaignService
+}
+
+// NewCampaignHandler 创建一个新的 CampaignHandler
+func NewCampaignHandler() *CampaignHandler {
+	return &CampaignHandler{
+		service: &service.CampaignService{},
+	}
+}
+
+// loadCampaign 查询营销活动并校验门店运营是否可以访问：必须属于其所属门店，全部门店的活动只有平台管理员可以操作。
+// 返回 nil 时已发送错误响应。
+func (h *CampaignHandler) loadCampaign(c *gin.Context) *models.Campaign {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的活动ID"})
+		return nil
+	}
+	campaign, err := h.service.GetCampaignByID(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "活动未找到"})
+		} else {
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return nil
+	}
+	if !security.CanAccessOptionalStore(c, campaign.StoreID) {
+		security.AbortForbiddenStore(c)
+		return nil
+	}
+	return campaign
+}
+
+// sendCampaignError 将营销活动相关的业务错误转换为响应
+func sendCampaignError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "活动未找到"})
+	case errors.Is(err, service.ErrInvalidCampaignTrigger), errors.Is(err, service.ErrInvalidCampaignPeriod),
+		errors.Is(err, service.ErrCampaignCouponMismatch), errors.Is(err, service.ErrCampaignQrCodeMismatch):
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, service.ErrCampaignPlatformCoupon):
+		security.SendEncryptedResponse(c, http.StatusForbidden, security.ErrorResponse{Error: err.Error()})
+	default:
+		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+	}
+}
+
+// CreateCampaign godoc
+// @Summary 创建营销活动
+// @Description 配置用户连接WIFI成功时自动发放优惠券的规则。触发条件：FIRST_CONNECT 门店首次连接成功；NTH_VISIT 第 N 次到店（同一天多次连接算一次）；
+// @Description FIRST_IN_DAYS 最近若干天内首次到店；QR_CODE 通过指定类型或指定的二维码扫码连接成功。
+// @Description 优惠券通过与用户领取相同的流程发放，受库存和每人限领数量限制；budget 限制活动最多发放的数量。
+// @Description 门店活动发放全平台通用的优惠券需要平台管理员创建
+// @Tags Campaigns
+// @Accept json
+// @Produce json
+// @Param campaign body service.CreateCampaignInput true "活动信息"
+// @Success 201 {object} models.Campaign
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 403 {object} security.ErrorResponse
+// @Failure 500 {object} security.ErrorResponse
+// @Router /campaigns [post]
+func (h *CampaignHandler) CreateCampaign(c *gin.Context) {
+	var input service.CreateCampaignInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if !security.CanAccessOptionalStore(c, input.StoreID) {
+		security.AbortForbiddenStore(c)
+		return
+	}
+
+	input.AllowPlatformCoupon = security.HasRole(c, security.RolePlatformAdmin)
+	campaign, err := h.service.CreateCampaign(&input)
+	if err != nil {
+		sendCampaignError(c, err)
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusCreated, campaign)
+}
+
+// GetCampaigns godoc
+// @Summary 查询营销活动列表
+// @Tags Campaigns
+// @Produce json
+// @Param store_id query int false "门店ID"
+// @Param trigger_type query string false "触发条件"
+// @Param status query int false "活动状态"
+// @Param page query int false "页码" default(1)
+// @Param pageSize query int false "每页数量" default(10)
+// @Success 200 {object} object{campaigns=[]models.Campaign, total=int64}
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 500 {object} security.ErrorResponse
+// @Router /campaigns [get]
+func (h *CampaignHandler) GetCampaigns(c *gin.Context) {
+	var input service.GetCampaignsInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的查询参数: " + err.Error()})
+		return
+	}
+
+	// 门店运营只能查询所属门店的活动
+	if storeID, scoped := security.StoreScope(c); scoped {
+		input.StoreID = &storeID
+	}
+
+	campaigns, total, err := h.service.GetCampaigns(&input)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, gin.H{
+		"campaigns": campaigns,
+		"total":     total,
+	})
+}
+
+// GetCampaign godoc
+// @Summary 查询营销活动详情
+// @Tags Campaigns
+// @Produce json
+// @Param id path int true "活动ID"
+// @Success 200 {object} models.Campaign
+// @Failure 404 {object} security.ErrorResponse
+// @Router /campaigns/{id} [get]
+func (h *CampaignHandler) GetCampaign(c *gin.Context) {
+	campaign := h.loadCampaign(c)
+	if campaign == nil {
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, campaign)
+}
+
+// UpdateCampaign godoc
+// @Summary 更新营销活动
+// @Description 活动的门店和触发条件类型不能修改，只能修改触发条件的参数；status 为 0 时停用活动。
+// @Description 发放全平台通用优惠券的门店活动只有平台管理员可以修改优惠券和预算
+// @Tags Campaigns
+// @Accept json
+// @Produce json
+// @Param id path int true "活动ID"
+// @Param campaign body service.UpdateCampaignInput true "要更新的活动信息"
+// @Success 200 {object} models.Campaign
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 403 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Router /campaigns/{id} [put]
+func (h *CampaignHandler) UpdateCampaign(c *gin.Context) {
+	campaign := h.loadCampaign(c)
+	if campaign == nil {
+		return
+	}
+
+	var input service.UpdateCampaignInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	input.AllowPlatformCoupon = security.HasRole(c, security.RolePlatformAdmin)
+	updated, err := h.service.UpdateCampaign(campaign.CampaignID, &input)
+	if err != nil {
+		sendCampaignError(c, err)
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, updated)
+}
+
+// DeleteCampaign godoc
+// @Summary 删除营销活动
+// @Description 删除后不再发放优惠券，已发放的优惠券不受影响
+// @Tags Campaigns
+// @Produce json
+// @Param id path int true "活动ID"
+// @Success 204
+// @Failure 404 {object} security.ErrorResponse
+// @Router /campaigns/{id} [delete]
+func (h *CampaignHandler) DeleteCampaign(c *gin.Context) {
+	campaign := h.loadCampaign(c)
+	if campaign == nil {
+		return
+	}
+
+	if err := h.service.DeleteCampaign(campaign.CampaignID); err != nil {
+		sendCampaignError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
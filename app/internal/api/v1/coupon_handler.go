@@ -9,6 +9,7 @@ import (
 	"gorm.io/gorm"
 
 	"app/internal/service"
+	"app/pkg/couponcode"
 	"app/pkg/security"
 )
 
@@ -24,6 +25,28 @@ func NewCouponHandler() *CouponHandler {
 	}
 }
 
+// authorizeCoupon 校验门店运营是否可以操作指定的优惠券：必须属于其所属门店，全平台通用的优惠券只有平台管理员可以操作。
+// 返回 false 时已发送错误响应。
+func (h *CouponHandler) authorizeCoupon(c *gin.Context, id uint) bool {
+	if _, scoped := security.StoreScope(c); !scoped {
+		return true
+	}
+	coupon, err := h.service.GetCouponByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "优惠券未找到"})
+		} else {
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return false
+	}
+	if !security.CanAccessOptionalStore(c, coupon.StoreID) {
+		security.AbortForbiddenStore(c)
+		return false
+	}
+	return true
+}
+
 // CreateCoupon
 // @Summary 创建优惠券
 // @Accept json
@@ -38,9 +61,18 @@ func (h *CouponHandler) CreateCoupon(c *gin.Context) {
 		return
 	}
 
+	if !security.CanAccessOptionalStore(c, input.StoreID) {
+		security.AbortForbiddenStore(c)
+		return
+	}
+
 	coupon, err := h.service.CreateCoupon(&input)
 	if err != nil {
-		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		if errors.Is(err, service.ErrInvalidCouponValue) {
+			security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		} else {
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
 		return
 	}
 
@@ -65,6 +97,13 @@ func (h *CouponHandler) CreateBatchCoupons(c *gin.Context) {
 		return
 	}
 
+	for _, input := range inputs {
+		if !security.CanAccessOptionalStore(c, input.StoreID) {
+			security.AbortForbiddenStore(c)
+			return
+		}
+	}
+
 	if len(inputs) == 0 {
 		security.SendEncryptedResponse(c, http.StatusBadRequest, gin.H{"error": "请求体不能为空数组"})
 		return
@@ -72,7 +111,11 @@ func (h *CouponHandler) CreateBatchCoupons(c *gin.Context) {
 
 	createdCoupons, err := h.service.CreateBatchCoupons(inputs)
 	if err != nil {
-		security.SendEncryptedResponse(c, http.StatusInternalServerError, gin.H{"error": "批量创建失败: " + err.Error()})
+		if errors.Is(err, service.ErrInvalidCouponValue) {
+			security.SendEncryptedResponse(c, http.StatusBadRequest, gin.H{"error": "批量创建失败: " + err.Error()})
+		} else {
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, gin.H{"error": "批量创建失败: " + err.Error()})
+		}
 		return
 	}
 
@@ -105,11 +148,63 @@ func (h *CouponHandler) GetCoupon(c *gin.Context) {
 	security.SendEncryptedResponse(c, http.StatusOK, coupon)
 }
 
+// QuoteCoupon
+// @Summary 试算优惠券抵扣金额
+// @Description 按优惠券规则预览订单的抵扣金额和应付金额，不领取也不核销优惠券，核销时使用相同的计算规则。
+// @Description DISCOUNT 的面值为折扣（8.5 表示八五折），按商品小计打折并向下取整到分；CASH 最多抵扣商品小计；
+// @Description SHIPPING 最多抵扣运费，面值为 0 时运费全免；GIFT 不抵扣金额。最低消费金额按商品小计判断，设置了最高抵扣金额时抵扣金额不超过该值。
+// @Tags Coupons
+// @Accept json
+// @Produce json
+// @Param id path int true "优惠券ID"
+// @Param input body service.QuoteCouponInput true "订单信息"
+// @Success 200 {object} pricing.Quote
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 403 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Router /coupons/{id}/quote [post]
+func (h *CouponHandler) QuoteCoupon(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的优惠券ID"})
+		return
+	}
+
+	var input service.QuoteCouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !security.CanAccessOptionalStore(c, input.StoreID) {
+		security.AbortForbiddenStore(c)
+		return
+	}
+
+	quote, err := h.service.QuoteCoupon(uint(id), &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "优惠券未找到"})
+		case errors.Is(err, service.ErrCouponDisabled), errors.Is(err, service.ErrCouponNotStarted),
+			errors.Is(err, service.ErrCouponStoreMismatch), errors.Is(err, service.ErrMinPurchaseNotMet),
+			errors.Is(err, service.ErrInvalidCouponValue), errors.Is(err, service.ErrInvalidOrder),
+			errors.Is(err, service.ErrCouponOutsideUsableTime), errors.Is(err, service.ErrCouponBlackoutDate):
+			security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		default:
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, quote)
+}
+
 // GetCoupons
 // @Summary 查询优惠券列表
 // @Produce json
 // @Param store_id query int false "适用门店ID"
 // @Param status query int false "状态 (1:启用, 0:禁用)"
+// @Param include_deleted query bool false "是否包含已删除的优惠券，仅平台管理员和门店运营可用"
 // @Param page query int false "页码"
 // @Param pageSize query int false "每页数量"
 // @Success 200 {object} gin.H{"coupons": []models.Coupon, "total": int64}
@@ -120,6 +215,10 @@ func (h *CouponHandler) GetCoupons(c *gin.Context) {
 		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
 		return
 	}
+	if input.IncludeDeleted && !security.CanViewDeleted(c) {
+		security.AbortForbiddenDeleted(c)
+		return
+	}
 
 	coupons, total, err := h.service.GetCoupons(&input)
 	if err != nil {
@@ -135,11 +234,13 @@ func (h *CouponHandler) GetCoupons(c *gin.Context) {
 
 // UpdateCoupon
 // @Summary 更新优惠券
+// @Description 库存已分桶时不能修改总发行量，总发行量不能小于已发行数量
 // @Accept json
 // @Produce json
 // @Param id path int true "优惠券ID"
 // @Param coupon body service.UpdateCouponInput true "要更新的优惠券信息"
 // @Success 200 {object} models.Coupon
+// @Failure 409 {object} security.ErrorResponse
 // @Router /coupons/{id} [put]
 func (h *CouponHandler) UpdateCoupon(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -148,17 +249,30 @@ func (h *CouponHandler) UpdateCoupon(c *gin.Context) {
 		return
 	}
 
+	if !h.authorizeCoupon(c, uint(id)) {
+		return
+	}
+
 	var input service.UpdateCouponInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	// 门店运营不能将优惠券转移到其他门店
+	if input.StoreID != nil && !security.CanAccessStore(c, *input.StoreID) {
+		security.AbortForbiddenStore(c)
+		return
+	}
+
 	coupon, err := h.service.UpdateCoupon(uint(id), &input)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
 			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "优惠券未找到"})
-		} else {
+		case errors.Is(err, service.ErrCouponStockSharded), errors.Is(err, service.ErrCouponTotalBelowIssued):
+			security.SendEncryptedResponse(c, http.StatusConflict, security.ErrorResponse{Error: err.Error()})
+		default:
 			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
 		}
 		return
@@ -180,6 +294,10 @@ func (h *CouponHandler) DeleteCoupon(c *gin.Context) {
 		return
 	}
 
+	if !h.authorizeCoupon(c, uint(id)) {
+		return
+	}
+
 	err = h.service.DeleteCoupon(uint(id))
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -193,9 +311,51 @@ func (h *CouponHandler) DeleteCoupon(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// RestoreCoupon
+// @Summary 恢复已删除的优惠券
+// @Description 门店专属的优惠券要求所属门店未被删除，门店已删除时请恢复门店
+// @Produce json
+// @Param id path int true "优惠券ID"
+// @Success 200 {object} models.Coupon
+// @Failure 404 {object} security.ErrorResponse
+// @Failure 409 {object} security.ErrorResponse
+// @Router /coupons/{id}/restore [post]
+func (h *CouponHandler) RestoreCoupon(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的优惠券ID"})
+		return
+	}
+
+	// 门店运营只能恢复所属门店的优惠券
+	if _, scoped := security.StoreScope(c); scoped {
+		coupon, err := h.service.GetCouponByIDWithDeleted(uint(id))
+		if err == nil && !security.CanAccessOptionalStore(c, coupon.StoreID) {
+			security.AbortForbiddenStore(c)
+			return
+		}
+	}
+
+	coupon, err := h.service.RestoreCoupon(uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "优惠券未找到"})
+		case errors.Is(err, service.ErrStoreDeleted):
+			security.SendEncryptedResponse(c, http.StatusConflict, security.ErrorResponse{Error: err.Error()})
+		default:
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, coupon)
+}
+
 // GetAvailableCouponsForUser 获取用户可领取的优惠券列表
 // @Summary 获取用户可领取的优惠券
-// @Description 查询指定用户可领取的优惠券列表，支持按门店筛选
+// @Description 查询指定用户可领取的优惠券列表，支持按门店筛选。领取不受可用时段限制，当前不在可用时段内的优惠券同样返回，
+// @Description 每个优惠券附带 schedule：可用星期、每日时段、今天及以后的不可用日期和当前是否可用，领取后只能在可用时段内核销
 // @Tags Coupons
 // @Accept  json
 // @Produce  json
@@ -203,7 +363,7 @@ func (h *CouponHandler) DeleteCoupon(c *gin.Context) {
 // @Param store_id query int false "门店ID"
 // @Param page query int false "页码"
 // @Param pageSize query int false "每页数量"
-// @Success 200 {object} object{coupons=[]models.Coupon, total=int64}
+// @Success 200 {object} object{coupons=[]service.AvailableCoupon, total=int64}
 // @Failure 400 {object} security.ErrorResponse
 // @Failure 500 {object} security.ErrorResponse
 // @Router /coupons/available-for-user [get]
@@ -214,6 +374,12 @@ func (h *CouponHandler) GetAvailableCouponsForUser(c *gin.Context) {
 		return
 	}
 
+	unionID, ok := security.ResolveUserUnionID(c, input.UserID)
+	if !ok {
+		return
+	}
+	input.UserID = unionID
+
 	coupons, total, err := h.service.GetAvailableCouponsForUser(&input)
 	if err != nil {
 		security.SendEncryptedResponse(c, http.StatusInternalServerError, gin.H{"error": "查询可领取优惠券失败: " + err.Error()})
@@ -246,6 +412,10 @@ func (h *CouponHandler) UpdateCouponValidity(c *gin.Context) {
 		return
 	}
 
+	if !h.authorizeCoupon(c, uint(id)) {
+		return
+	}
+
 	var input service.UpdateCouponValidityInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
@@ -285,6 +455,10 @@ func (h *CouponHandler) UpdateCouponLimit(c *gin.Context) {
 		return
 	}
 
+	if !h.authorizeCoupon(c, uint(id)) {
+		return
+	}
+
 	var input service.UpdateCouponLimitInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
@@ -315,6 +489,7 @@ func (h *CouponHandler) UpdateCouponLimit(c *gin.Context) {
 // @Success 200 {object} models.Coupon
 // @Failure 400 {object} security.ErrorResponse
 // @Failure 404 {object} security.ErrorResponse
+// @Failure 409 {object} security.ErrorResponse
 // @Failure 500 {object} security.ErrorResponse
 // @Router /coupons/{id}/quantity [patch]
 func (h *CouponHandler) UpdateCouponQuantity(c *gin.Context) {
@@ -324,17 +499,74 @@ func (h *CouponHandler) UpdateCouponQuantity(c *gin.Context) {
 		return
 	}
 
+	if !h.authorizeCoupon(c, uint(id)) {
+		return
+	}
+
 	var input service.UpdateCouponQuantityInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	// 已发行数量由领券流程维护，只有平台管理员可以修正
+	if input.IssuedQuantity != nil && !security.HasRole(c, security.RolePlatformAdmin) {
+		security.SendEncryptedResponse(c, http.StatusForbidden, security.ErrorResponse{Error: "只有平台管理员可以修改已发行数量"})
+		return
+	}
+
 	coupon, err := h.service.UpdateCouponQuantity(uint(id), &input)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
 			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "优惠券未找到"})
-		} else {
+		case errors.Is(err, service.ErrCouponStockSharded), errors.Is(err, service.ErrCouponTotalBelowIssued):
+			security.SendEncryptedResponse(c, http.StatusConflict, security.ErrorResponse{Error: err.Error()})
+		default:
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, coupon)
+}
+
+// UpdateCouponStockBuckets
+// @Summary 设置优惠券库存分桶
+// @Description 将热门优惠券的剩余库存平均拆分到多个分桶中，领取时随机扣减其中一个分桶，减少并发领取时对同一行的争用。
+// @Description buckets 为 0 时取消分桶。分桶期间已发行数量为 issued_quantity 加上各分桶已发行的数量，修改分桶数量或取消分桶时合并；
+// @Description 分桶期间不能修改发行量。只能用于限量发行的优惠券。
+// @Accept json
+// @Produce json
+// @Param id path int true "优惠券ID"
+// @Param input body object{buckets=int} true "分桶数量（0 到 64）"
+// @Success 200 {object} models.Coupon
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Router /coupons/{id}/stock-buckets [patch]
+func (h *CouponHandler) UpdateCouponStockBuckets(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的优惠券ID"})
+		return
+	}
+
+	var input struct {
+		Buckets *int `json:"buckets" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	coupon, err := h.service.UpdateCouponStockBuckets(uint(id), *input.Buckets)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "优惠券未找到"})
+		case errors.Is(err, service.ErrInvalidStockBuckets), errors.Is(err, service.ErrCouponStockUnlimited):
+			security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		default:
 			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
 		}
 		return
@@ -343,9 +575,98 @@ func (h *CouponHandler) UpdateCouponQuantity(c *gin.Context) {
 	security.SendEncryptedResponse(c, http.StatusOK, coupon)
 }
 
+// GenerateCouponCodes
+// @Summary 批量生成券码
+// @Description 为优惠券生成一批不可猜测的唯一券码并开启券码池，之后用户领取该优惠券时从券码池中分配券码，券码分配完即视为领完。
+// @Description 券码由前缀、随机部分和一位校验字符组成，核销时可以发现输错的券码。限量发行的优惠券的券码总数不能超过总发行量。
+// @Accept json
+// @Produce json
+// @Param id path int true "优惠券ID"
+// @Param input body service.GenerateCouponCodesInput true "生成参数"
+// @Success 201 {object} models.CouponCodeBatch
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Router /coupons/{id}/codes [post]
+func (h *CouponHandler) GenerateCouponCodes(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的优惠券ID"})
+		return
+	}
+
+	if !h.authorizeCoupon(c, uint(id)) {
+		return
+	}
+
+	var input service.GenerateCouponCodesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	batch, err := h.service.GenerateCouponCodes(uint(id), &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "优惠券未找到"})
+		case errors.Is(err, couponcode.ErrInvalidAlphabet), errors.Is(err, couponcode.ErrInvalidLength),
+			errors.Is(err, couponcode.ErrInvalidPrefix), errors.Is(err, service.ErrCodePoolExceedsStock),
+			errors.Is(err, service.ErrCodeSpaceExhausted):
+			security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		default:
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusCreated, batch)
+}
+
+// ExportCouponCodes
+// @Summary 导出券码
+// @Description 将优惠券的券码导出为 CSV 文件（base64 编码），列依次为券码、批次ID、状态、用户优惠券ID、分配时间和生成时间，用于线下印制或分发。
+// @Produce json
+// @Param id path int true "优惠券ID"
+// @Param batch_id query int false "批次ID"
+// @Param status query string false "available: 未分配；assigned: 已分配；voided: 退款退回库存时已作废"
+// @Success 200 {object} service.ExportedCouponCodes
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Router /coupons/{id}/codes/export [get]
+func (h *CouponHandler) ExportCouponCodes(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的优惠券ID"})
+		return
+	}
+
+	if !h.authorizeCoupon(c, uint(id)) {
+		return
+	}
+
+	var input service.ExportCouponCodesInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	exported, err := h.service.ExportCouponCodes(uint(id), &input)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "优惠券未找到"})
+			return
+		}
+		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, exported)
+}
+
 // UpdateCouponStore godoc
 // @Summary 更新优惠券适用门店
-// @Description 仅更新优惠券的适用门店（特定门店或全平台通用）
+// @Description 仅更新优惠券的适用门店（特定门店或全平台通用）。改为特定门店时清除优惠券的适用范围，
+// @Description 之后改回全平台时全部门店通用，需要通过 PATCH /coupons/{id}/scopes 重新设置适用范围
 // @Tags Coupons
 // @Accept  json
 // @Produce  json
@@ -363,12 +684,21 @@ func (h *CouponHandler) UpdateCouponStore(c *gin.Context) {
 		return
 	}
 
+	if !h.authorizeCoupon(c, uint(id)) {
+		return
+	}
+
 	var input service.UpdateCouponStoreInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	if !security.CanAccessOptionalStore(c, input.StoreID) {
+		security.AbortForbiddenStore(c)
+		return
+	}
+
 	coupon, err := h.service.UpdateCouponStore(uint(id), &input)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -382,6 +712,131 @@ func (h *CouponHandler) UpdateCouponStore(c *gin.Context) {
 	security.SendEncryptedResponse(c, http.StatusOK, coupon)
 }
 
+// GetCouponRules godoc
+// @Summary 查询优惠券适用范围和可用时段
+// @Description 返回优惠券适用的门店、地区，可用的星期、每日时段和不可用日期
+// @Tags Coupons
+// @Produce  json
+// @Param id path int true "优惠券ID"
+// @Success 200 {object} service.CouponRules
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Failure 500 {object} security.ErrorResponse
+// @Router /coupons/{id}/rules [get]
+func (h *CouponHandler) GetCouponRules(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的优惠券ID"})
+		return
+	}
+
+	rules, err := h.service.GetCouponRules(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "优惠券未找到"})
+		} else {
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, rules)
+}
+
+// UpdateCouponScopes godoc
+// @Summary 更新优惠券适用范围
+// @Description 替换未限定单一门店的优惠券的适用门店和地区，门店在任意一个门店或地区范围内即可使用；门店和地区均为空时全部门店通用。
+// @Description 地区只指定省份时适用于整个省份，同时指定城市时只适用于该城市。门店专属的优惠券不能设置适用范围
+// @Tags Coupons
+// @Accept  json
+// @Produce  json
+// @Param id path int true "优惠券ID"
+// @Param scopes body service.UpdateCouponScopesInput true "适用范围"
+// @Success 200 {object} service.CouponRules
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Failure 500 {object} security.ErrorResponse
+// @Router /coupons/{id}/scopes [patch]
+func (h *CouponHandler) UpdateCouponScopes(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的优惠券ID"})
+		return
+	}
+
+	if !h.authorizeCoupon(c, uint(id)) {
+		return
+	}
+
+	var input service.UpdateCouponScopesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	rules, err := h.service.UpdateCouponScopes(uint(id), &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "优惠券未找到"})
+		case errors.Is(err, service.ErrCouponStoreExclusive), errors.Is(err, service.ErrInvalidCouponScope):
+			security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		default:
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, rules)
+}
+
+// UpdateCouponSchedule godoc
+// @Summary 更新优惠券可用时段
+// @Description 替换优惠券可用的星期、每日时段和不可用日期，按服务器时区判断。结束时间早于开始时间时时段跨过零点，例如 22:00 到 02:00。
+// @Description 不在可用时段内的优惠券不出现在可用优惠券列表中，也不能核销
+// @Tags Coupons
+// @Accept  json
+// @Produce  json
+// @Param id path int true "优惠券ID"
+// @Param schedule body service.UpdateCouponScheduleInput true "可用时段"
+// @Success 200 {object} service.CouponRules
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Failure 500 {object} security.ErrorResponse
+// @Router /coupons/{id}/schedule [patch]
+func (h *CouponHandler) UpdateCouponSchedule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的优惠券ID"})
+		return
+	}
+
+	if !h.authorizeCoupon(c, uint(id)) {
+		return
+	}
+
+	var input service.UpdateCouponScheduleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	rules, err := h.service.UpdateCouponSchedule(uint(id), &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "优惠券未找到"})
+		case errors.Is(err, service.ErrInvalidCouponSchedule):
+			security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		default:
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, rules)
+}
+
 // UpdateCouponStatus godoc
 // @Summary 更新优惠券状态
 // @Description 更新优惠券的状态（启用/停用/已过期等）
@@ -402,6 +857,10 @@ func (h *CouponHandler) UpdateCouponStatus(c *gin.Context) {
 		return
 	}
 
+	if !h.authorizeCoupon(c, uint(id)) {
+		return
+	}
+
 	var input struct {
 		Status int8 `json:"status" binding:"required,oneof=0 1 2"`
 	}
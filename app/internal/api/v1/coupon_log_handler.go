@@ -3,6 +3,7 @@ package v1
 import (
 	"app/internal/service"
 	"app/pkg/security"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -22,13 +23,14 @@ func NewCouponLogHandler() *CouponLogHandler {
 
 // CreateCouponLog godoc
 // @Summary      记录优惠券行为日志
-// @Description  用于记录用户领取、使用、核销优惠券等行为
+// @Description  用于记录用户领取、过期优惠券等行为，领取时同时生成用户优惠券，指定 store_id 时门店必须在优惠券的适用范围内。核销优惠券请使用 POST /coupons/redeem，订单退款时退还优惠券请使用 POST /coupons/refund
 // @Tags         CouponLogs
 // @Accept       json
 // @Produce      json
 // @Param        log   body      service.LogActionInput  true  "日志信息"
 // @Success      201  {object}  security.EncryptedData
 // @Failure      400  {object}  security.EncryptedData
+// @Failure      409  {object}  security.EncryptedData "优惠券已领完或已达到领取上限"
 // @Failure      500  {object}  security.EncryptedData
 // @Router       /coupon-logs [post]
 func (h *CouponLogHandler) CreateCouponLog(c *gin.Context) {
@@ -38,9 +40,28 @@ func (h *CouponLogHandler) CreateCouponLog(c *gin.Context) {
 		return
 	}
 
+	unionID, ok := security.ResolveUserUnionID(c, input.UserUnionID)
+	if !ok {
+		return
+	}
+	input.UserUnionID = unionID
+	if !security.CanAccessOptionalStore(c, input.StoreID) {
+		security.AbortForbiddenStore(c)
+		return
+	}
+
 	logEntry, err := h.service.CreateCouponLog(&input)
 	if err != nil {
-		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		switch {
+		case errors.Is(err, service.ErrUseRequiresRedeem), errors.Is(err, service.ErrRefundRequiresRefund),
+			errors.Is(err, service.ErrCouponDisabled), errors.Is(err, service.ErrCouponOutOfPeriod),
+			errors.Is(err, service.ErrCouponStoreMismatch):
+			security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, service.ErrCouponSoldOut), errors.Is(err, service.ErrClaimLimitReached):
+			security.SendEncryptedResponse(c, http.StatusConflict, security.ErrorResponse{Error: err.Error()})
+		default:
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
 		return
 	}
 
@@ -70,6 +91,11 @@ func (h *CouponLogHandler) GetCouponLogs(c *gin.Context) {
 		return
 	}
 
+	// 门店运营只能查询所属门店的数据
+	if storeID, scoped := security.StoreScope(c); scoped {
+		input.StoreID = &storeID
+	}
+
 	logs, total, err := h.service.GetCouponLogs(&input)
 	if err != nil {
 		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
@@ -106,6 +132,11 @@ func (h *CouponLogHandler) GetCouponClaimLogs(c *gin.Context) {
 		return
 	}
 
+	// 门店运营只能查询所属门店的数据
+	if storeID, scoped := security.StoreScope(c); scoped {
+		input.StoreID = &storeID
+	}
+
 	logs, total, err := h.service.GetCouponClaimLogs(&input)
 	if err != nil {
 		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
@@ -142,6 +173,11 @@ func (h *CouponLogHandler) GetCouponUseLogs(c *gin.Context) {
 		return
 	}
 
+	// 门店运营只能查询所属门店的数据
+	if storeID, scoped := security.StoreScope(c); scoped {
+		input.StoreID = &storeID
+	}
+
 	logs, total, err := h.service.GetCouponUseLogs(&input)
 	if err != nil {
 		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
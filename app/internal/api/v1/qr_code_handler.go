@@ -0,0 +1,229 @@
+package v1
+
+import (
+	"app/internal/models"
+	"app/internal/service"
+	"app/pkg/security"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// QrCodeHandler 负责处理门店二维码相关的API请求
+type QrCodeHandler struct {
+	service *service.QrCodeService
+}
+
+// NewQrCodeHandler 创建一个新的 QrCodeHandler
+func NewQrCodeHandler() *QrCodeHandler {
+	return &QrCodeHandler{
+		service: &service.QrCodeService{},
+	}
+}
+
+// loadQrCode 查询二维码并校验门店运营是否可以访问（必须属于其所属门店）。
+// 返回 nil 时已发送错误响应。
+func (h *QrCodeHandler) loadQrCode(c *gin.Context) *models.QrCode {
+	qrCode, err := h.service.GetQrCodeByID(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "二维码未找到"})
+		} else {
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return nil
+	}
+	if !security.CanAccessStore(c, qrCode.StoreID) {
+		security.AbortForbiddenStore(c)
+		return nil
+	}
+	return qrCode
+}
+
+// sendQrCodeError 将二维码相关的业务错误转换为响应
+func sendQrCodeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "二维码未找到"})
+	case errors.Is(err, service.ErrQrCodeWifiMismatch), errors.Is(err, service.ErrQrCodeCouponMismatch),
+		errors.Is(err, service.ErrQrCodeLogoUnavailable):
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+	default:
+		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+	}
+}
+
+// CreateQrCode godoc
+// @Summary 登记二维码
+// @Description 为门店登记一个二维码，可关联WIFI配置和优惠券，二维码ID由服务端生成
+// @Tags QrCodes
+// @Accept json
+// @Produce json
+// @Param qr_code body service.CreateQrCodeInput true "二维码信息"
+// @Success 201 {object} models.QrCode
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 500 {object} security.ErrorResponse
+// @Router /qrcodes [post]
+func (h *QrCodeHandler) CreateQrCode(c *gin.Context) {
+	var input service.CreateQrCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if !security.CanAccessStore(c, input.StoreID) {
+		security.AbortForbiddenStore(c)
+		return
+	}
+
+	qrCode, err := h.service.CreateQrCode(&input)
+	if err != nil {
+		sendQrCodeError(c, err)
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusCreated, qrCode)
+}
+
+// GetQrCodes godoc
+// @Summary 查询二维码列表
+// @Tags QrCodes
+// @Produce json
+// @Param store_id query int false "门店ID"
+// @Param qr_code_type query string false "二维码类型"
+// @Param status query int false "二维码状态"
+// @Param page query int false "页码" default(1)
+// @Param pageSize query int false "每页数量" default(10)
+// @Success 200 {object} object{qr_codes=[]models.QrCode, total=int64}
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 500 {object} security.ErrorResponse
+// @Router /qrcodes [get]
+func (h *QrCodeHandler) GetQrCodes(c *gin.Context) {
+	var input service.GetQrCodesInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的查询参数: " + err.Error()})
+		return
+	}
+
+	// 门店运营只能查询所属门店的二维码
+	if storeID, scoped := security.StoreScope(c); scoped {
+		input.StoreID = storeID
+	}
+
+	qrCodes, total, err := h.service.GetQrCodes(&input)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, gin.H{
+		"qr_codes": qrCodes,
+		"total":    total,
+	})
+}
+
+// GetQrCode godoc
+// @Summary 查询二维码详情
+// @Description 小程序扫码后根据二维码ID获取所属门店以及关联的WIFI配置和优惠券
+// @Tags QrCodes
+// @Produce json
+// @Param id path string true "二维码ID"
+// @Success 200 {object} models.QrCode
+// @Failure 404 {object} security.ErrorResponse
+// @Router /qrcodes/{id} [get]
+func (h *QrCodeHandler) GetQrCode(c *gin.Context) {
+	qrCode := h.loadQrCode(c)
+	if qrCode == nil {
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, qrCode)
+}
+
+// UpdateQrCode godoc
+// @Summary 更新二维码
+// @Tags QrCodes
+// @Accept json
+// @Produce json
+// @Param id path string true "二维码ID"
+// @Param qr_code body service.UpdateQrCodeInput true "要更新的二维码信息"
+// @Success 200 {object} models.QrCode
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Router /qrcodes/{id} [put]
+func (h *QrCodeHandler) UpdateQrCode(c *gin.Context) {
+	if h.loadQrCode(c) == nil {
+		return
+	}
+
+	var input service.UpdateQrCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	qrCode, err := h.service.UpdateQrCode(c.Param("id"), &input)
+	if err != nil {
+		sendQrCodeError(c, err)
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, qrCode)
+}
+
+// DeleteQrCode godoc
+// @Summary 删除二维码
+// @Tags QrCodes
+// @Produce json
+// @Param id path string true "二维码ID"
+// @Success 204
+// @Failure 404 {object} security.ErrorResponse
+// @Router /qrcodes/{id} [delete]
+func (h *QrCodeHandler) DeleteQrCode(c *gin.Context) {
+	if h.loadQrCode(c) == nil {
+		return
+	}
+
+	if err := h.service.DeleteQrCode(c.Param("id")); err != nil {
+		sendQrCodeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RenderQrCode godoc
+// @Summary 生成二维码图片
+// @Description 将二维码渲染为 PNG 或 SVG 图片，图片内容以 base64 编码返回
+// @Tags QrCodes
+// @Produce json
+// @Param id path string true "二维码ID"
+// @Param format query string false "图片格式，png 或 svg" default(png)
+// @Param size query int false "图片边长（像素），范围 64 到 2048" default(512)
+// @Param margin query int false "静区宽度（模块数）" default(4)
+// @Param logo query bool false "是否在中心叠加 logo"
+// @Success 200 {object} service.RenderedQrCode
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Router /qrcodes/{id}/image [get]
+func (h *QrCodeHandler) RenderQrCode(c *gin.Context) {
+	if h.loadQrCode(c) == nil {
+		return
+	}
+
+	var input service.RenderQrCodeInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的查询参数: " + err.Error()})
+		return
+	}
+
+	rendered, err := h.service.RenderQrCode(c.Param("id"), &input)
+	if err != nil {
+		sendQrCodeError(c, err)
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, rendered)
+}
@@ -25,6 +25,7 @@ func NewScanLogHandler() *ScanLogHandler {
 
 // CreateScanLog
 // @Summary 记录用户扫码连接日志
+// @Description 同时创建连接会话并在响应中返回连接票据 connect_ticket，获取WIFI密码和上报连接结果时必须携带该票据
 // @Accept json
 // @Produce json
 // @Param log body service.CreateScanLogInput true "扫码日志信息"
@@ -36,12 +37,24 @@ func (h *ScanLogHandler) CreateScanLog(c *gin.Context) {
 		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
 		return
 	}
+
+	unionID, ok := security.ResolveUserUnionID(c, input.UserUnionID)
+	if !ok {
+		return
+	}
+	input.UserUnionID = unionID
 	// 补充IP地址
 	input.IPAddress = c.ClientIP()
 
 	logEntry, err := h.service.CreateScanLog(&input)
 	if err != nil {
-		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		switch {
+		case errors.Is(err, service.ErrQrCodeNotFound), errors.Is(err, service.ErrQrCodeStoreMismatch),
+			errors.Is(err, service.ErrQrCodeDisabled):
+			security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		default:
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
 		return
 	}
 
@@ -70,6 +83,11 @@ func (h *ScanLogHandler) GetScanLogs(c *gin.Context) {
 		return
 	}
 
+	// 门店运营只能查询所属门店的数据
+	if storeID, scoped := security.StoreScope(c); scoped {
+		input.StoreID = storeID
+	}
+
 	logs, total, err := h.service.GetScanLogs(&input)
 	if err != nil {
 		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
@@ -84,19 +102,23 @@ func (h *ScanLogHandler) GetScanLogs(c *gin.Context) {
 
 // UpdateScanLogResult
 // @Summary 更新扫码日志连接结果
-// @Description 更新指定扫码日志的WIFI连接结果
+// @Description 使用创建扫码日志时签发的连接票据上报WIFI连接结果，并结束连接会话。
+// @Description 连接成功时按营销活动规则自动发放优惠券，rewards 为满足触发条件的活动的发放结果，没有满足条件的活动时为空
 // @Tags scan-logs
 // @Accept  json
 // @Produce  json
 // @Param id path int true "扫码日志ID"
 // @Param result body service.UpdateScanLogResultInput true "连接结果"
-// @Success 200 {object} models.ScanLog "成功响应"
+// @Success 200 {object} object{message=string,rewards=[]service.CampaignReward} "成功响应"
 // @Failure 400 {object} security.ErrorResponse "请求参数错误"
+// @Failure 403 {object} security.ErrorResponse "连接票据无效"
 // @Failure 404 {object} security.ErrorResponse "日志未找到"
+// @Failure 409 {object} security.ErrorResponse "会话已结束或尚未获取WIFI密码"
+// @Failure 410 {object} security.ErrorResponse "会话已超时"
 // @Failure 500 {object} security.ErrorResponse "服务器内部错误"
 // @Router /api/v1/scan-logs/{id}/result [patch]
 func (h *ScanLogHandler) UpdateScanLogResult(c *gin.Context) {
-	logId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	logId, err := strconv.ParseUint(c.Param("logId"), 10, 64)
 	if err != nil {
 		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的日志ID"})
 		return
@@ -108,17 +130,74 @@ func (h *ScanLogHandler) UpdateScanLogResult(c *gin.Context) {
 		return
 	}
 
-	err = h.service.UpdateScanLogResult(logId, &input)
+	// 携带用户令牌时只能更新该用户自己的扫码日志
+	rewards, err := h.service.UpdateScanLogResult(logId, security.CurrentUserUnionID(c), &input)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
 			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "扫码日志未找到"})
-		} else {
+		case errors.Is(err, service.ErrInvalidConnectTicket):
+			security.SendEncryptedResponse(c, http.StatusForbidden, security.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, service.ErrConnectSessionClosed), errors.Is(err, service.ErrCredentialNotIssued):
+			security.SendEncryptedResponse(c, http.StatusConflict, security.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, service.ErrConnectSessionTimedOut):
+			security.SendEncryptedResponse(c, http.StatusGone, security.ErrorResponse{Error: err.Error()})
+		default:
 			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
 		}
 		return
 	}
 
-	security.SendEncryptedResponse(c, http.StatusOK, gin.H{"message": "更新成功"})
+	security.SendEncryptedResponse(c, http.StatusOK, gin.H{
+		"message": "更新成功",
+		"rewards": rewards,
+	})
+}
+
+// DisconnectScanLog
+// @Summary 断开WIFI连接
+// @Description 用户断开WIFI后使用连接票据上报，提前释放占用的WIFI连接数；未上报时连接在占用时长（wifi_connection_ttl）后自动释放
+// @Tags scan-logs
+// @Accept  json
+// @Produce  json
+// @Param id path int true "扫码日志ID"
+// @Param input body service.DisconnectInput true "连接票据"
+// @Success 200 {object} object{message=string} "成功响应"
+// @Failure 400 {object} security.ErrorResponse "请求参数错误"
+// @Failure 403 {object} security.ErrorResponse "连接票据无效"
+// @Failure 404 {object} security.ErrorResponse "日志未找到"
+// @Failure 409 {object} security.ErrorResponse "没有连接成功的记录"
+// @Failure 500 {object} security.ErrorResponse "服务器内部错误"
+// @Router /api/v1/scan-logs/{id}/disconnect [post]
+func (h *ScanLogHandler) DisconnectScanLog(c *gin.Context) {
+	logId, err := strconv.ParseUint(c.Param("logId"), 10, 64)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的日志ID"})
+		return
+	}
+
+	var input service.DisconnectInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	err = h.service.Disconnect(logId, security.CurrentUserUnionID(c), &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "扫码日志未找到"})
+		case errors.Is(err, service.ErrInvalidConnectTicket):
+			security.SendEncryptedResponse(c, http.StatusForbidden, security.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, service.ErrNotConnected):
+			security.SendEncryptedResponse(c, http.StatusConflict, security.ErrorResponse{Error: err.Error()})
+		default:
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, gin.H{"message": "已断开连接"})
 }
 
 // GetDailyScanCountByStore
@@ -140,6 +219,11 @@ func (h *ScanLogHandler) GetDailyScanCountByStore(c *gin.Context) {
 		return
 	}
 
+	if !security.CanAccessStore(c, uint(storeId)) {
+		security.AbortForbiddenStore(c)
+		return
+	}
+
 	days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
 
 	stats, err := h.service.GetDailyScanCountByStore(uint(storeId), days)
@@ -175,6 +259,11 @@ func (h *ScanLogHandler) GetFailedScanLogs(c *gin.Context) {
 		return
 	}
 
+	// 门店运营只能查询所属门店的数据
+	if storeID, scoped := security.StoreScope(c); scoped {
+		input.StoreID = &storeID
+	}
+
 	logs, total, err := h.service.GetFailedScanLogs(&input)
 	if err != nil {
 		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
@@ -210,10 +299,11 @@ func (h *ScanLogHandler) GetUserScanLogs(c *gin.Context) {
 		return
 	}
 
-	if input.UserUnionID == "" {
-		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "用户ID不能为空"})
+	unionID, ok := security.ResolveUserUnionID(c, input.UserUnionID)
+	if !ok {
 		return
 	}
+	input.UserUnionID = unionID
 
 	logs, total, err := h.service.GetUserScanLogs(&input)
 	if err != nil {
@@ -57,6 +57,10 @@ func (h *StatsHandler) GetWifiUsageStats(c *gin.Context) {
 			storeID = &u_id
 		}
 	}
+	// 门店运营只能查询所属门店的数据
+	if scope, scoped := security.StoreScope(c); scoped {
+		storeID = &scope
+	}
 
 	stats, err := h.service.GetWifiUsageStats(storeID)
 	if err != nil {
@@ -112,6 +116,11 @@ func (h *StatsHandler) GetCouponStats(c *gin.Context) {
 		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
 		return
 	}
+
+	// 门店运营只能查询所属门店的数据
+	if storeID, scoped := security.StoreScope(c); scoped {
+		input.StoreID = &storeID
+	}
 	stats, err := h.service.GetCouponStats(&input)
 	if err != nil {
 		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
@@ -141,6 +150,11 @@ func (h *StatsHandler) GetPopularWifi(c *gin.Context) {
 		return
 	}
 
+	// 门店运营只能查询所属门店的数据
+	if storeID, scoped := security.StoreScope(c); scoped {
+		input.StoreID = &storeID
+	}
+
 	stats, err := h.service.GetPopularWifi(&input)
 	if err != nil {
 		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
@@ -170,6 +184,11 @@ func (h *StatsHandler) GetScanTimeDistribution(c *gin.Context) {
 		return
 	}
 
+	// 门店运营只能查询所属门店的数据
+	if storeID, scoped := security.StoreScope(c); scoped {
+		input.StoreID = &storeID
+	}
+
 	stats, err := h.service.GetScanTimeDistribution(&input)
 	if err != nil {
 		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
@@ -113,8 +113,10 @@ func (h *StoreHandler) GetStore(c *gin.Context) {
 // @Param lat query number false "纬度"
 // @Param lng query number false "经度"
 // @Param radius query number false "半径（公里）"
+// @Param include_deleted query bool false "是否包含已删除的门店，仅平台管理员和门店运营可用"
 // @Success 200 {object} object{stores=[]models.Store, total=int64}
 // @Failure 400 {object} security.ErrorResponse
+// @Failure 403 {object} security.ErrorResponse
 // @Failure 500 {object} security.ErrorResponse
 // @Router /stores [get]
 func (h *StoreHandler) GetStores(c *gin.Context) {
@@ -123,6 +125,10 @@ func (h *StoreHandler) GetStores(c *gin.Context) {
 		security.SendEncryptedResponse(c, http.StatusBadRequest, gin.H{"error": "无效的查询参数: " + err.Error()})
 		return
 	}
+	if input.IncludeDeleted && !security.CanViewDeleted(c) {
+		security.AbortForbiddenDeleted(c)
+		return
+	}
 
 	stores, total, err := h.service.GetStores(&input)
 	if err != nil {
@@ -151,6 +157,11 @@ func (h *StoreHandler) UpdateStore(c *gin.Context) {
 		return
 	}
 
+	if !security.CanAccessStore(c, uint(id)) {
+		security.AbortForbiddenStore(c)
+		return
+	}
+
 	var input service.UpdateStoreInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
@@ -171,7 +182,8 @@ func (h *StoreHandler) UpdateStore(c *gin.Context) {
 }
 
 // DeleteStore
-// @Summary 删除门店
+// @Summary 删除门店（软删除）
+// @Description 门店的WIFI配置和该门店专属的优惠券会一并删除，扫码日志和优惠券日志保持不变
 // @Produce json
 // @Param id path int true "门店ID"
 // @Success 204
@@ -196,6 +208,34 @@ func (h *StoreHandler) DeleteStore(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// RestoreStore
+// @Summary 恢复已删除的门店
+// @Description 同时恢复删除门店时一并删除的WIFI配置和优惠券
+// @Produce json
+// @Param storeId path int true "门店ID"
+// @Success 200 {object} models.Store
+// @Failure 404 {object} security.ErrorResponse
+// @Router /stores/{storeId}/restore [post]
+func (h *StoreHandler) RestoreStore(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("storeId"), 10, 32)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的门店ID格式"})
+		return
+	}
+
+	store, err := h.service.RestoreStore(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "门店未找到"})
+		} else {
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, store)
+}
+
 // UpdateStoreStatus godoc
 // @Summary 更新门店状态
 // @Description 仅更新门店的状态（启用/停用）
@@ -216,6 +256,11 @@ func (h *StoreHandler) UpdateStoreStatus(c *gin.Context) {
 		return
 	}
 
+	if !security.CanAccessStore(c, uint(id)) {
+		security.AbortForbiddenStore(c)
+		return
+	}
+
 	var input struct {
 		Status int8 `json:"status" binding:"required,oneof=0 1"`
 	}
@@ -257,6 +302,11 @@ func (h *StoreHandler) UpdateStorePhone(c *gin.Context) {
 		return
 	}
 
+	if !security.CanAccessStore(c, uint(id)) {
+		security.AbortForbiddenStore(c)
+		return
+	}
+
 	var input struct {
 		Phone string `json:"phone" binding:"required"`
 	}
@@ -298,6 +348,11 @@ func (h *StoreHandler) UpdateStoreLocation(c *gin.Context) {
 		return
 	}
 
+	if !security.CanAccessStore(c, uint(id)) {
+		security.AbortForbiddenStore(c)
+		return
+	}
+
 	var input service.UpdateStoreLocationInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的位置信息: " + err.Error()})
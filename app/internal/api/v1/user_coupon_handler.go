@@ -0,0 +1,200 @@
+package v1
+
+import (
+	"app/internal/service"
+	"app/pkg/security"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UserCouponHandler 负责处理用户券包相关的API请求
+type UserCouponHandler struct {
+	service *service.UserCouponService
+}
+
+// NewUserCouponHandler 创建一个新的 UserCouponHandler
+func NewUserCouponHandler() *UserCouponHandler {
+	return &UserCouponHandler{
+		service: &service.UserCouponService{},
+	}
+}
+
+// GetUserCoupons godoc
+// @Summary 查询用户券包
+// @Description 查询用户领取的优惠券，每张券有独立的券码、过期时间和状态，按领取时间倒序
+// @Tags Users
+// @Produce json
+// @Param user_union_id query string false "用户UnionID，携带用户令牌时可省略"
+// @Param status query string false "券状态 (UNUSED, USED, EXPIRED, REFUNDED)"
+// @Param coupon_id query int false "优惠券ID"
+// @Param store_id query int false "领取门店ID"
+// @Param page query int false "页码" default(1)
+// @Param pageSize query int false "每页数量" default(10)
+// @Success 200 {object} object{coupons=[]models.UserCoupon, total=int64}
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 500 {object} security.ErrorResponse
+// @Router /users/coupons [get]
+func (h *UserCouponHandler) GetUserCoupons(c *gin.Context) {
+	var input service.GetUserCouponsInput
+	if err := c.ShouldBindQuery(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的查询参数: " + err.Error()})
+		return
+	}
+
+	unionID, ok := security.ResolveUserUnionID(c, input.UserUnionID)
+	if !ok {
+		return
+	}
+	input.UserUnionID = unionID
+
+	userCoupons, total, err := h.service.GetUserCoupons(&input)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, gin.H{
+		"coupons": userCoupons,
+		"total":   total,
+	})
+}
+
+// GetUserCoupon godoc
+// @Summary 查询用户的一张优惠券
+// @Tags Users
+// @Produce json
+// @Param id path int true "用户优惠券ID"
+// @Param user_union_id query string false "用户UnionID，携带用户令牌时可省略"
+// @Success 200 {object} models.UserCoupon
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Router /users/coupons/{id} [get]
+func (h *UserCouponHandler) GetUserCoupon(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的用户优惠券ID"})
+		return
+	}
+
+	unionID, ok := security.ResolveUserUnionID(c, c.Query("user_union_id"))
+	if !ok {
+		return
+	}
+
+	userCoupon, err := h.service.GetUserCoupon(id, unionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "用户优惠券未找到"})
+		} else {
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, userCoupon)
+}
+
+// RedeemCoupon godoc
+// @Summary 核销用户优惠券
+// @Description 按订单金额校验并核销一张用户优惠券（通过用户优惠券ID或券码指定），抵扣金额的计算规则与试算接口相同。
+// @Description 同一门店的同一订单重复提交时返回首次核销的结果（replayed 为 true），已核销其他券时返回 409。
+// @Description 订单金额和门店由收银端提交，小程序无法证明订单真实存在，因此只有平台管理员和门店运营可以核销；
+// @Description 门店运营只能在所属门店核销，且券必须可在该门店使用。
+// @Tags Coupons
+// @Accept json
+// @Produce json
+// @Param input body service.RedeemCouponInput true "核销信息"
+// @Success 200 {object} service.RedeemCouponResult "重复提交，返回首次核销的结果"
+// @Success 201 {object} service.RedeemCouponResult
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 403 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Failure 409 {object} security.ErrorResponse
+// @Router /coupons/redeem [post]
+func (h *UserCouponHandler) RedeemCoupon(c *gin.Context) {
+	var input service.RedeemCouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if input.UserCouponID == 0 && input.Code == "" {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "用户优惠券ID和券码不能同时为空"})
+		return
+	}
+
+	if !security.CanAccessStore(c, input.StoreID) {
+		security.AbortForbiddenStore(c)
+		return
+	}
+	result, err := h.service.RedeemCoupon(&input)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "用户优惠券未找到"})
+		case errors.Is(err, service.ErrUserCouponUsed), errors.Is(err, service.ErrUserCouponRefunded),
+			errors.Is(err, service.ErrOrderAlreadyRedeemed), errors.Is(err, service.ErrOrderRefunded):
+			security.SendEncryptedResponse(c, http.StatusConflict, security.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, service.ErrUserCouponExpired), errors.Is(err, service.ErrCouponDisabled),
+			errors.Is(err, service.ErrCouponNotStarted), errors.Is(err, service.ErrCouponStoreMismatch),
+			errors.Is(err, service.ErrMinPurchaseNotMet), errors.Is(err, service.ErrInvalidCouponValue),
+			errors.Is(err, service.ErrInvalidOrder), errors.Is(err, service.ErrInvalidCouponCode),
+			errors.Is(err, service.ErrCouponOutsideUsableTime), errors.Is(err, service.ErrCouponBlackoutDate):
+			security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		default:
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	status := http.StatusCreated
+	if result.Replayed {
+		status = http.StatusOK
+	}
+	security.SendEncryptedResponse(c, status, result)
+}
+
+// RefundCoupon godoc
+// @Summary 订单退款时退还优惠券
+// @Description 撤销订单的优惠券核销，记录关联原核销日志的 REFUND 日志。券仍在有效期内时恢复为未使用，返还给用户；
+// @Description 否则标记为已退还，restore_stock 为 true 时将其退回优惠券库存，券码池分配给该券的券码随之作废，可以补充生成券码。
+// @Description 同一订单只能退款一次，退款后不能再次核销。
+// @Tags Coupons
+// @Accept json
+// @Produce json
+// @Param input body service.RefundCouponInput true "退款信息"
+// @Success 200 {object} service.RefundCouponResult
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 403 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Failure 409 {object} security.ErrorResponse
+// @Router /coupons/refund [post]
+func (h *UserCouponHandler) RefundCoupon(c *gin.Context) {
+	var input service.RefundCouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !security.CanAccessStore(c, input.StoreID) {
+		security.AbortForbiddenStore(c)
+		return
+	}
+
+	result, err := h.service.RefundCoupon(&input)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "未找到该订单的优惠券核销记录"})
+		case errors.Is(err, service.ErrRedemptionRefunded):
+			security.SendEncryptedResponse(c, http.StatusConflict, security.ErrorResponse{Error: err.Error()})
+		default:
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, result)
+}
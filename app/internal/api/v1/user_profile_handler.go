@@ -4,6 +4,7 @@ import (
 	"app/internal/models"
 	"app/internal/service"
 	"app/pkg/security"
+	"app/pkg/wechat"
 	"errors"
 	"net/http"
 	"strings"
@@ -24,6 +25,78 @@ func NewUserProfileHandler() *UserProfileHandler {
 	}
 }
 
+// Login godoc
+// @Summary      用户登录
+// @Description  小程序调用 wx.login 获取登录凭证 code 后调用，服务端通过微信 code2Session 接口校验 code 并换取用户的 UnionID，为用户签发短期令牌。
+// @Description  小程序未绑定微信开放平台时，按 OpenID 查找用户档案；首次登录的用户会以 OpenID 作为 UnionID 创建档案。平台管理员等后台调用方可以直接指定 user_union_id。
+// @Description  之后调用用户相关的接口时，通过请求头 X-User-Token 携带该令牌，服务端以令牌中的用户为准。
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        input body struct{code string "wx.login 获取的登录凭证"; user_union_id string "用户UnionID，仅平台管理员可用"} true "登录请求体"
+// @Success      200  {object}  security.EncryptedData
+// @Failure      400  {object}  security.EncryptedData
+// @Failure      401  {object}  security.EncryptedData
+// @Failure      403  {object}  security.EncryptedData
+// @Failure      500  {object}  security.EncryptedData
+// @Router       /users/login [post]
+func (h *UserProfileHandler) Login(c *gin.Context) {
+	var input struct {
+		Code        string `json:"code"`
+		UserUnionID string `json:"user_union_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的请求数据: " + err.Error()})
+		return
+	}
+
+	var unionID string
+	switch {
+	case input.Code != "":
+		session, err := wechat.Code2Session(c.Request.Context(), input.Code)
+		if err != nil {
+			if errors.Is(err, wechat.ErrInvalidCode) {
+				security.SendEncryptedResponse(c, http.StatusUnauthorized, security.ErrorResponse{Error: err.Error()})
+			} else {
+				security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+			}
+			return
+		}
+		unionID = session.UnionID
+		if unionID == "" {
+			// 小程序未绑定开放平台时没有 UnionID，按已校验的 OpenID 查找用户，首次登录时创建档案
+			user, err := h.service.GetOrCreateUserByOpenID(session.OpenID)
+			if err != nil {
+				security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+				return
+			}
+			unionID = user.UserUnionID
+		}
+	case input.UserUnionID != "":
+		// 只有可信的后台调用方可以不经微信校验直接指定用户
+		if !security.HasRole(c, security.RolePlatformAdmin) {
+			security.SendEncryptedResponse(c, http.StatusForbidden, security.ErrorResponse{Error: "只有平台管理员可以直接指定用户，小程序请使用 code 登录"})
+			return
+		}
+		unionID = input.UserUnionID
+	default:
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "缺少登录凭证 code"})
+		return
+	}
+
+	token, expiresAt, err := security.IssueUserToken(security.CurrentCredential(c).AppID, unionID)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: "签发用户令牌失败"})
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, gin.H{
+		"user_union_id": unionID,
+		"token":         token,
+		"expires_at":    expiresAt,
+	})
+}
+
 // CreateOrUpdateUser
 // @Summary 创建或更新用户档案
 // @Description 根据UnionID创建或更新用户。如果用户已存在，则更新信息；否则创建新用户。
@@ -40,6 +113,12 @@ func (h *UserProfileHandler) CreateOrUpdateUser(c *gin.Context) {
 		return
 	}
 
+	unionID, ok := security.ResolveUserUnionID(c, input.UserUnionID)
+	if !ok {
+		return
+	}
+	input.UserUnionID = unionID
+
 	user, err := h.service.CreateOrUpdateUserProfile(&input)
 	if err != nil {
 		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
@@ -63,6 +142,15 @@ func (h *UserProfileHandler) GetUser(c *gin.Context) {
 	openID := c.Query("open_id")
 	phone := c.Query("phone")
 
+	// 携带用户令牌时只能查询自己的档案
+	if security.CurrentUserUnionID(c) != "" {
+		var ok bool
+		if unionID, ok = security.ResolveUserUnionID(c, unionID); !ok {
+			return
+		}
+		openID, phone = "", ""
+	}
+
 	var user *models.UserProfile
 	var err error
 
@@ -72,6 +160,11 @@ func (h *UserProfileHandler) GetUser(c *gin.Context) {
 	case openID != "":
 		user, err = h.service.GetUserByOpenID(openID)
 	case phone != "":
+		// 按手机号查询可以用来枚举用户，只对平台管理员开放
+		if !security.HasRole(c, security.RolePlatformAdmin) {
+			security.SendEncryptedResponse(c, http.StatusForbidden, security.ErrorResponse{Error: "无权按手机号查询用户"})
+			return
+		}
 		user, err = h.service.GetUserByPhone(phone)
 	default:
 		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "必须提供 union_id, open_id 或 phone 中的至少一个查询参数"})
@@ -104,7 +197,7 @@ func (h *UserProfileHandler) GetUser(c *gin.Context) {
 // @Router       /users/bind-phone [post]
 func (h *UserProfileHandler) BindPhoneNumber(c *gin.Context) {
 	var input struct {
-		UserUnionID      string `json:"user_union_id" binding:"required"`
+		UserUnionID      string `json:"user_union_id"` // 携带用户令牌时可省略
 		PhoneNumber      string `json:"phone_number" binding:"required"`
 		PhoneCountryCode string `json:"phone_country_code" binding:"required"`
 	}
@@ -114,6 +207,12 @@ func (h *UserProfileHandler) BindPhoneNumber(c *gin.Context) {
 		return
 	}
 
+	unionID, ok := security.ResolveUserUnionID(c, input.UserUnionID)
+	if !ok {
+		return
+	}
+	input.UserUnionID = unionID
+
 	user, err := h.service.BindPhoneNumber(input.UserUnionID, input.PhoneNumber, input.PhoneCountryCode)
 	if err != nil {
 		status := http.StatusInternalServerError
@@ -144,7 +243,7 @@ func (h *UserProfileHandler) BindPhoneNumber(c *gin.Context) {
 // @Router       /users/unbind-phone [post]
 func (h *UserProfileHandler) UnbindPhoneNumber(c *gin.Context) {
 	var input struct {
-		UserUnionID string `json:"user_union_id" binding:"required"`
+		UserUnionID string `json:"user_union_id"` // 携带用户令牌时可省略
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -152,6 +251,12 @@ func (h *UserProfileHandler) UnbindPhoneNumber(c *gin.Context) {
 		return
 	}
 
+	unionID, ok := security.ResolveUserUnionID(c, input.UserUnionID)
+	if !ok {
+		return
+	}
+	input.UserUnionID = unionID
+
 	user, err := h.service.UnbindPhoneNumber(input.UserUnionID)
 	if err != nil {
 		status := http.StatusInternalServerError
@@ -189,10 +294,11 @@ func (h *UserProfileHandler) GetUserScanHistory(c *gin.Context) {
 		return
 	}
 
-	if input.UserUnionID == "" {
-		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "用户ID不能为空"})
+	unionID, ok := security.ResolveUserUnionID(c, input.UserUnionID)
+	if !ok {
 		return
 	}
+	input.UserUnionID = unionID
 
 	history, total, err := h.service.GetUserScanHistory(&input)
 	if err != nil {
@@ -23,6 +23,26 @@ func NewWifiConfigHandler() *WifiConfigHandler {
 	}
 }
 
+// authorizeWifis 校验门店运营是否可以操作指定的WIFI配置（必须属于其所属门店）。
+// 返回 false 时已发送错误响应。
+func (h *WifiConfigHandler) authorizeWifis(c *gin.Context, ids ...uint) bool {
+	if _, scoped := security.StoreScope(c); !scoped {
+		return true
+	}
+	wifiConfigs, err := h.service.GetWifiConfigsByIDs(ids)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	for _, wifi := range wifiConfigs {
+		if !security.CanAccessStore(c, wifi.StoreID) {
+			security.AbortForbiddenStore(c)
+			return false
+		}
+	}
+	return true
+}
+
 // CreateWifiConfig
 // @Summary 新增WIFI配置
 // @Accept json
@@ -37,6 +57,11 @@ func (h *WifiConfigHandler) CreateWifiConfig(c *gin.Context) {
 		return
 	}
 
+	if !security.CanAccessStore(c, input.StoreID) {
+		security.AbortForbiddenStore(c)
+		return
+	}
+
 	wifiConfig, err := h.service.CreateWifiConfig(&input)
 	if err != nil {
 		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
@@ -74,8 +99,10 @@ func (h *WifiConfigHandler) GetWifiConfig(c *gin.Context) {
 
 // GetWifiConfigsByStore
 // @Summary 查询门店所有WIFI配置列表
+// @Description 每个WIFI配置的 active_connections 为当前占用的连接数
 // @Produce json
 // @Param storeId path int true "门店ID"
+// @Param include_deleted query bool false "是否包含已删除的WIFI配置，仅平台管理员和门店运营可用"
 // @Success 200 {array} models.WifiConfig
 // @Router /stores/{storeId}/wifis [get]
 func (h *WifiConfigHandler) GetWifiConfigsByStore(c *gin.Context) {
@@ -85,7 +112,12 @@ func (h *WifiConfigHandler) GetWifiConfigsByStore(c *gin.Context) {
 		return
 	}
 
-	wifiConfigs, err := h.service.GetWifiConfigsByStoreID(uint(storeId))
+	includeDeleted, _ := strconv.ParseBool(c.Query("include_deleted"))
+	if includeDeleted && !security.CanViewDeleted(c) {
+		security.AbortForbiddenDeleted(c)
+		return
+	}
+	wifiConfigs, err := h.service.GetWifiConfigsByStoreID(uint(storeId), includeDeleted)
 	if err != nil {
 		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
 		return
@@ -109,6 +141,10 @@ func (h *WifiConfigHandler) UpdateWifiConfig(c *gin.Context) {
 		return
 	}
 
+	if !h.authorizeWifis(c, uint(id)) {
+		return
+	}
+
 	var input service.UpdateWifiConfigInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
@@ -129,7 +165,7 @@ func (h *WifiConfigHandler) UpdateWifiConfig(c *gin.Context) {
 }
 
 // DeleteWifiConfig
-// @Summary 删除WIFI配置
+// @Summary 删除WIFI配置（软删除）
 // @Produce json
 // @Param id path int true "WIFI配置ID"
 // @Success 204
@@ -141,6 +177,10 @@ func (h *WifiConfigHandler) DeleteWifiConfig(c *gin.Context) {
 		return
 	}
 
+	if !h.authorizeWifis(c, uint(id)) {
+		return
+	}
+
 	err = h.service.DeleteWifiConfig(uint(id))
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -154,6 +194,47 @@ func (h *WifiConfigHandler) DeleteWifiConfig(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// RestoreWifiConfig
+// @Summary 恢复已删除的WIFI配置
+// @Description 所属门店必须未被删除，门店已删除时请恢复门店
+// @Produce json
+// @Param id path int true "WIFI配置ID"
+// @Success 200 {object} models.WifiConfig
+// @Failure 404 {object} security.ErrorResponse
+// @Failure 409 {object} security.ErrorResponse
+// @Router /wifis/{id}/restore [post]
+func (h *WifiConfigHandler) RestoreWifiConfig(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的WIFI配置ID"})
+		return
+	}
+
+	// 门店运营只能恢复所属门店的WIFI配置
+	if _, scoped := security.StoreScope(c); scoped {
+		wifiConfig, err := h.service.GetWifiConfigByIDWithDeleted(uint(id))
+		if err == nil && !security.CanAccessStore(c, wifiConfig.StoreID) {
+			security.AbortForbiddenStore(c)
+			return
+		}
+	}
+
+	wifiConfig, err := h.service.RestoreWifiConfig(uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "WIFI配置未找到"})
+		case errors.Is(err, service.ErrStoreDeleted):
+			security.SendEncryptedResponse(c, http.StatusConflict, security.ErrorResponse{Error: err.Error()})
+		default:
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, wifiConfig)
+}
+
 // CreateBatchWifiConfigs 批量创建WIFI配置
 // @Summary 批量新增WIFI配置
 // @Description 一次性为门店添加多个WIFI配置
@@ -177,6 +258,13 @@ func (h *WifiConfigHandler) CreateBatchWifiConfigs(c *gin.Context) {
 		return
 	}
 
+	for _, input := range inputs {
+		if !security.CanAccessStore(c, input.StoreID) {
+			security.AbortForbiddenStore(c)
+			return
+		}
+	}
+
 	createdConfigs, err := h.service.CreateBatchWifiConfigs(inputs)
 	if err != nil {
 		security.SendEncryptedResponse(c, http.StatusInternalServerError, gin.H{"error": "批量创建失败: " + err.Error()})
@@ -209,6 +297,10 @@ func (h *WifiConfigHandler) DeleteBatchWifiConfigs(c *gin.Context) {
 		return
 	}
 
+	if !h.authorizeWifis(c, ids...) {
+		return
+	}
+
 	if err := h.service.DeleteBatchWifiConfigs(ids); err != nil {
 		security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: "批量删除失败: " + err.Error()})
 		return
@@ -254,3 +346,79 @@ func (h *WifiConfigHandler) GetWifiConfigsByStoreAndType(c *gin.Context) {
 
 	security.SendEncryptedResponse(c, http.StatusOK, wifiConfigs)
 }
+
+// ConnectWifi godoc
+// @Summary 获取WIFI连接凭证
+// @Description 用户扫码并创建扫码日志后，凭该日志和创建时签发的连接票据获取顾客WIFI的密码。
+// @Description 只有正常营业门店的顾客WIFI可以获取，扫码日志必须属于当前用户和同一门店，连接会话未超时，每个会话只能获取一次。
+// @Description WIFI连接数已满时返回 409，响应中的 alternatives 列出同一门店仍有空位的其他顾客WIFI。
+// @Tags WifiConfigs
+// @Accept json
+// @Produce json
+// @Param id path int true "WIFI配置ID"
+// @Param input body service.ConnectWifiInput true "扫码日志和连接票据"
+// @Success 200 {object} service.WifiCredential
+// @Failure 400 {object} security.ErrorResponse
+// @Failure 403 {object} security.ErrorResponse
+// @Failure 404 {object} security.ErrorResponse
+// @Failure 409 {object} object{error=string,alternatives=[]service.WifiAvailability}
+// @Failure 410 {object} security.ErrorResponse
+// @Router /wifis/{id}/connect [post]
+func (h *WifiConfigHandler) ConnectWifi(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: "无效的WIFI配置ID"})
+		return
+	}
+
+	var input service.ConnectWifiInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// 密码只下发给携带用户令牌的已认证用户
+	unionID := security.CurrentUserUnionID(c)
+	if unionID == "" {
+		security.SendEncryptedResponse(c, http.StatusUnauthorized, security.ErrorResponse{Error: "缺少用户令牌 (X-User-Token)"})
+		return
+	}
+
+	credential, err := h.service.ReleaseWifiCredential(&service.ReleaseWifiCredentialInput{
+		WifiID:      uint(id),
+		LogID:       input.LogID,
+		Ticket:      input.Ticket,
+		UserUnionID: unionID,
+		AppID:       security.CurrentCredential(c).AppID,
+		IPAddress:   c.ClientIP(),
+	})
+	if err != nil {
+		var fullErr *service.WifiFullError
+		switch {
+		case errors.As(err, &fullErr):
+			// 连接数已满时返回同一门店仍有空位的其他WIFI，供用户改连
+			security.SendEncryptedResponse(c, http.StatusConflict, gin.H{
+				"error":        fullErr.Error(),
+				"alternatives": fullErr.Alternatives,
+			})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: "WIFI配置未找到"})
+		case errors.Is(err, service.ErrScanLogNotFound):
+			security.SendEncryptedResponse(c, http.StatusNotFound, security.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, service.ErrWifiNotForCustomer), errors.Is(err, service.ErrStoreInactive),
+			errors.Is(err, service.ErrInvalidConnectTicket):
+			security.SendEncryptedResponse(c, http.StatusForbidden, security.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, service.ErrScanLogStoreMismatch):
+			security.SendEncryptedResponse(c, http.StatusBadRequest, security.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, service.ErrWifiAlreadyReleased), errors.Is(err, service.ErrConnectSessionClosed):
+			security.SendEncryptedResponse(c, http.StatusConflict, security.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, service.ErrConnectSessionTimedOut):
+			security.SendEncryptedResponse(c, http.StatusGone, security.ErrorResponse{Error: err.Error()})
+		default:
+			security.SendEncryptedResponse(c, http.StatusInternalServerError, security.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	security.SendEncryptedResponse(c, http.StatusOK, credential)
+}
@@ -2,27 +2,35 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Store 对应于 store 表的 GORM 模型
+// WifiCount 及各累计计数器与对应的写操作在同一事务中维护，数据不一致时可通过 cmd/repaircounters 重新计算
+// 门店、WIFI配置和优惠券均为软删除，历史的扫码日志和优惠券日志仍可关联到名称
 type Store struct {
-	StoreID     uint         `gorm:"primaryKey;autoIncrement;comment:门店ID，七位数起步"`
-	Name        string       `gorm:"type:varchar(100);not null;comment:门店名称"`
-	Country     string       `gorm:"type:varchar(64);comment:国家"`
-	Province    string       `gorm:"type:varchar(64);comment:省份"`
-	City        string       `gorm:"type:varchar(64);comment:城市"`
-	District    string       `gorm:"type:varchar(64);comment:区/县"`
-	Address     string       `gorm:"type:varchar(255);comment:详细地址"`
-	Latitude    float64      `gorm:"type:decimal(10,6);comment:门店纬度"`
-	Longitude   float64      `gorm:"type:decimal(10,6);comment:门店经度"`
-	Phone       string       `gorm:"type:varchar(20);comment:联系电话"`
-	WifiCount   int          `gorm:"default:0;comment:门店WIFI数量"`
-	Status      int8         `gorm:"type:tinyint;default:1;comment:门店状态，1正常，0停用"`
-	CreatedAt   time.Time    `gorm:"comment:创建时间"`
-	UpdatedAt   time.Time    `gorm:"comment:更新时间"`
-	WifiConfigs []WifiConfig `gorm:"foreignKey:StoreID"` // 一对多关系
-	ScanLogs    []ScanLog    `gorm:"foreignKey:StoreID"` // 一对多关系
-	Coupons     []Coupon     `gorm:"foreignKey:StoreID"` // 一对多关系
+	StoreID           uint           `gorm:"primaryKey;autoIncrement;comment:门店ID，七位数起步"`
+	Name              string         `gorm:"type:varchar(100);not null;comment:门店名称"`
+	Country           string         `gorm:"type:varchar(64);comment:国家"`
+	Province          string         `gorm:"type:varchar(64);comment:省份"`
+	City              string         `gorm:"type:varchar(64);comment:城市"`
+	District          string         `gorm:"type:varchar(64);comment:区/县"`
+	Address           string         `gorm:"type:varchar(255);comment:详细地址"`
+	Latitude          float64        `gorm:"type:decimal(10,6);comment:门店纬度"`
+	Longitude         float64        `gorm:"type:decimal(10,6);comment:门店经度"`
+	Phone             string         `gorm:"type:varchar(20);comment:联系电话"`
+	WifiCount         int            `gorm:"default:0;comment:门店WIFI数量"`
+	ScanCount         int64          `gorm:"default:0;not null;comment:累计扫码次数"`
+	SuccessScanCount  int64          `gorm:"default:0;not null;comment:累计连接成功次数"`
+	CouponIssuedCount int64          `gorm:"default:0;not null;comment:累计在本门店领取的优惠券数量"`
+	Status            int8           `gorm:"type:tinyint;default:1;comment:门店状态，1正常，0停用"`
+	CreatedAt         time.Time      `gorm:"comment:创建时间"`
+	UpdatedAt         time.Time      `gorm:"comment:更新时间"`
+	DeletedAt         gorm.DeletedAt `gorm:"index;comment:删除时间"`
+	WifiConfigs       []WifiConfig   `gorm:"foreignKey:StoreID"` // 一对多关系
+	ScanLogs          []ScanLog      `gorm:"foreignKey:StoreID"` // 一对多关系
+	Coupons           []Coupon       `gorm:"foreignKey:StoreID"` // 一对多关系
 }
 
 func (Store) TableName() string {
@@ -31,14 +39,20 @@ func (Store) TableName() string {
 
 // WifiConfig 对应于 wifi_config 表的 GORM 模型
 type WifiConfig struct {
-	WifiID            uint      `gorm:"primaryKey;autoIncrement;comment:主键ID"`
-	StoreID           uint      `gorm:"not null;comment:门店ID"`
-	SSID              string    `gorm:"type:varchar(64);not null;comment:WIFI名称"`
-	PasswordEncrypted string    `gorm:"type:varchar(256);not null;comment:加密后的WIFI密码"`
-	EncryptionType    string    `gorm:"type:enum('WPA2','WPA3','WEP','OPEN','UNKNOWN');default:'UNKNOWN';not null;comment:加密类型"`
-	WifiType          string    `gorm:"type:enum('CUSTOMER','STAFF','EVENT','OTHER');default:'CUSTOMER';not null;comment:WIFI类型"`
-	MaxConnections    int       `gorm:"default:50;comment:最大连接数限制"`
-	LastUpdated       time.Time `gorm:"autoUpdateTime;comment:最后更新时间"`
+	WifiID            uint           `gorm:"primaryKey;autoIncrement;comment:主键ID"`
+	StoreID           uint           `gorm:"not null;comment:门店ID"`
+	SSID              string         `gorm:"type:varchar(64);not null;comment:WIFI名称"`
+	PasswordEncrypted string         `gorm:"type:varchar(256);not null;comment:服务端加密后的WIFI密码" json:"-"`
+	PasswordDataKey   string         `gorm:"type:varchar(128);comment:经主密钥加密的数据密钥" json:"-"`
+	PasswordKeyID     string         `gorm:"type:varchar(32);comment:主密钥指纹，为空表示服务端加密前的旧数据" json:"-"`
+	EncryptionType    string         `gorm:"type:enum('WPA2','WPA3','WEP','OPEN','UNKNOWN');default:'UNKNOWN';not null;comment:加密类型"`
+	WifiType          string         `gorm:"type:enum('CUSTOMER','STAFF','EVENT','OTHER');default:'CUSTOMER';not null;comment:WIFI类型"`
+	MaxConnections    int            `gorm:"not null;default:0;comment:最大连接数限制，0 表示不限制"`
+	LastUpdated       time.Time      `gorm:"autoUpdateTime;comment:最后更新时间"`
+	DeletedAt         gorm.DeletedAt `gorm:"index;comment:删除时间，删除门店时一并删除"`
+
+	// 当前占用的连接数（已连接以及已获取密码正在连接的用户），仅在查询门店WIFI列表时返回
+	ActiveConnections *int `gorm:"-" json:"active_connections,omitempty"`
 }
 
 func (WifiConfig) TableName() string {
@@ -70,8 +84,8 @@ func (UserProfile) TableName() string {
 // ScanLog 对应于 scan_log 表的 GORM 模型
 type ScanLog struct {
 	LogID              uint64    `gorm:"primaryKey;autoIncrement;comment:主键ID"`
-	StoreID            uint      `gorm:"not null;comment:门店ID"`
-	UserUnionID        string    `gorm:"type:varchar(64);comment:微信UnionID"`
+	StoreID            uint      `gorm:"not null;index:idx_scan_log_store_user,priority:1;comment:门店ID"`
+	UserUnionID        string    `gorm:"type:varchar(64);index:idx_scan_log_store_user,priority:2;comment:微信UnionID"`
 	ScanTime           time.Time `gorm:"autoCreateTime;comment:扫码时间"`
 	DeviceInfo         string    `gorm:"type:varchar(255);comment:用户设备信息"`
 	IPAddress          string    `gorm:"type:varchar(45);comment:用户IP地址"`
@@ -86,7 +100,7 @@ type ScanLog struct {
 	WifiMac            string    `gorm:"type:varchar(64);comment:连接WiFi的MAC地址"`
 	WifiSignal         int8      `gorm:"type:tinyint;comment:WiFi信号强度"`
 	QrCodeType         string    `gorm:"type:enum('STORE','EVENT','POSTER','DESK','OTHER');comment:二维码类型"`
-	QrCodeID           string    `gorm:"type:varchar(64);comment:二维码ID"`
+	QrCodeID           string    `gorm:"type:varchar(64);comment:二维码ID，对应 qr_code 表"`
 	SystemInfo         string    `gorm:"type:varchar(128);comment:操作系统信息"`
 	Brand              string    `gorm:"type:varchar(64);comment:设备品牌"`
 	Model              string    `gorm:"type:varchar(64);comment:设备型号"`
@@ -94,6 +108,10 @@ type ScanLog struct {
 	Referer            string    `gorm:"type:varchar(255);comment:扫码来源URL或分享来源"`
 	Remark             string    `gorm:"type:varchar(255);comment:备注信息"`
 	CreatedAt          time.Time `gorm:"comment:创建时间"`
+
+	// 创建扫码日志时签发的连接票据，只在创建时返回一次，不保存明文
+	ConnectTicket          string     `gorm:"-" json:"connect_ticket,omitempty"`
+	ConnectTicketExpiresAt *time.Time `gorm:"-" json:"connect_ticket_expires_at,omitempty"`
 }
 
 func (ScanLog) TableName() string {
@@ -102,23 +120,30 @@ func (ScanLog) TableName() string {
 
 // Coupon 对应于 coupon 表的 GORM 模型
 type Coupon struct {
-	CouponID          uint      `gorm:"primaryKey;autoIncrement;comment:优惠券ID"`
-	CouponName        string    `gorm:"type:varchar(100);not null;comment:优惠券名称"`
-	CouponCode        string    `gorm:"type:varchar(32);unique;comment:优惠券兑换码"`
-	CouponType        string    `gorm:"type:enum('DISCOUNT','CASH','GIFT','SHIPPING');not null;comment:优惠券类型"`
-	Value             float64   `gorm:"type:decimal(10,2);not null;comment:优惠券面值"`
-	MinPurchaseAmount float64   `gorm:"type:decimal(10,2);default:0.00;comment:最低消费金额"`
-	UsageLimitPerUser int       `gorm:"default:1;comment:每个用户可领取的最大数量"`
-	TotalQuantity     int       `gorm:"default:0;comment:优惠券总发行量"`
-	IssuedQuantity    int       `gorm:"default:0;comment:已发行数量"`
-	StartTime         time.Time `gorm:"not null;comment:优惠券生效时间"`
-	EndTime           time.Time `gorm:"not null;comment:优惠券过期时间"`
-	ValidityDays      int       `gorm:"comment:领券后有效天数"`
-	StoreID           *uint     `gorm:"comment:适用门店ID"` // 使用指针以接受 NULL 值
-	Description       string    `gorm:"type:text;comment:优惠券详细描述"`
-	Status            int8      `gorm:"type:tinyint;default:1;comment:优惠券状态"`
-	CreatedAt         time.Time `gorm:"comment:创建时间"`
-	UpdatedAt         time.Time `gorm:"comment:更新时间"`
+	CouponID           uint           `gorm:"primaryKey;autoIncrement;comment:优惠券ID"`
+	CouponName         string         `gorm:"type:varchar(100);not null;comment:优惠券名称"`
+	CouponCode         string         `gorm:"type:varchar(32);unique;comment:优惠券兑换码"`
+	CouponType         string         `gorm:"type:enum('DISCOUNT','CASH','GIFT','SHIPPING');not null;comment:优惠券类型"`
+	Value              float64        `gorm:"type:decimal(10,2);not null;comment:优惠券面值"`
+	MinPurchaseAmount  float64        `gorm:"type:decimal(10,2);default:0.00;comment:最低消费金额"`
+	MaxDeductionAmount float64        `gorm:"type:decimal(10,2);default:0.00;comment:最高抵扣金额，0 表示不限"`
+	UsageLimitPerUser  int            `gorm:"default:1;comment:每个用户可领取的最大数量"`
+	TotalQuantity      int            `gorm:"default:0;comment:优惠券总发行量"`
+	IssuedQuantity     int            `gorm:"default:0;comment:已发行数量，分桶模式下不包括各库存分桶中已发行的数量"`
+	StockBuckets       int            `gorm:"default:0;comment:库存分桶数量，0 表示不分桶"`
+	CodePool           bool           `gorm:"default:false;comment:领取时是否从预生成的券码池分配券码"`
+	StartTime          time.Time      `gorm:"not null;comment:优惠券生效时间"`
+	EndTime            time.Time      `gorm:"not null;comment:优惠券过期时间"`
+	ValidityDays       int            `gorm:"comment:领券后有效天数"`
+	StoreID            *uint          `gorm:"comment:适用门店ID，为空时按 coupon_store_scope 确定适用门店"` // 使用指针以接受 NULL 值
+	UsableWeekdays     uint8          `gorm:"default:0;comment:可用的星期，按位表示，第 0 位为周一，0 表示不限"`
+	UsableTimeStart    string         `gorm:"type:varchar(5);not null;default:'';comment:每日可用开始时间 HH:MM，为空表示全天可用"`
+	UsableTimeEnd      string         `gorm:"type:varchar(5);not null;default:'';comment:每日可用结束时间 HH:MM（不含），早于开始时间表示跨过零点"`
+	Description        string         `gorm:"type:text;comment:优惠券详细描述"`
+	Status             int8           `gorm:"type:tinyint;default:1;comment:优惠券状态"`
+	CreatedAt          time.Time      `gorm:"comment:创建时间"`
+	UpdatedAt          time.Time      `gorm:"comment:更新时间"`
+	DeletedAt          gorm.DeletedAt `gorm:"index;comment:删除时间，删除门店时一并删除该门店的优惠券"`
 }
 
 func (Coupon) TableName() string {
@@ -137,17 +162,168 @@ type CouponLog struct {
 	AmountDeducted float64   `gorm:"type:decimal(10,2);comment:优惠券抵扣金额"`
 	Status         int8      `gorm:"type:tinyint;default:1;comment:日志状态"`
 	Remark         string    `gorm:"type:varchar(255);comment:备注信息"`
+	RelatedLogID   *uint64   `gorm:"index;comment:关联的原始日志ID，退款日志指向被撤销的核销日志"`
+
+	// 领取时生成的用户优惠券，仅在领取接口中返回
+	UserCoupon *UserCoupon `gorm:"-"`
 }
 
 func (CouponLog) TableName() string {
 	return "coupon_log"
 }
 
+// CouponLogReversed 表示核销日志已被退款撤销，正常的日志状态为 1
+const CouponLogReversed int8 = 2
+
+// 用户优惠券状态
+const (
+	UserCouponUnused   = "UNUSED"   // 未使用
+	UserCouponUsed     = "USED"     // 已使用
+	UserCouponExpired  = "EXPIRED"  // 已过期
+	UserCouponRefunded = "REFUNDED" // 已退还
+)
+
+// UserCoupon 对应于 user_coupon 表的 GORM 模型
+// 用户每领取一次优惠券生成一张券实例，拥有独立的券码、过期时间和状态
+type UserCoupon struct {
+	UserCouponID uint64     `gorm:"primaryKey;autoIncrement;comment:主键ID"`
+	CouponID     uint       `gorm:"not null;index;uniqueIndex:idx_user_coupon_claim,priority:1;comment:优惠券ID"`
+	UserUnionID  string     `gorm:"type:varchar(64);not null;index:idx_user_coupon_user_status,priority:1;uniqueIndex:idx_user_coupon_claim,priority:2;comment:用户UnionID"`
+	ClaimSeq     *int       `gorm:"uniqueIndex:idx_user_coupon_claim,priority:3;comment:用户第几次领取该优惠券，取值不超过每人限领数量；不限领时为空"`
+	StoreID      *uint      `gorm:"comment:领取门店ID"` // 使用指针以接受 NULL 值
+	Code         string     `gorm:"type:varchar(48);not null;uniqueIndex;comment:券码，核销时出示"`
+	Status       string     `gorm:"type:enum('UNUSED','USED','EXPIRED','REFUNDED');default:'UNUSED';not null;index:idx_user_coupon_user_status,priority:2;comment:券状态"`
+	ReceiveLogID uint64     `gorm:"not null;comment:领取日志ID"`
+	ReceivedAt   time.Time  `gorm:"not null;comment:领取时间"`
+	ExpiresAt    time.Time  `gorm:"not null;index;comment:过期时间，取优惠券结束时间与领取时间加有效天数中较早者"`
+	UsedAt       *time.Time `gorm:"comment:使用时间"`
+	OrderID      string     `gorm:"type:varchar(64);comment:使用时关联的订单ID"`
+	CreatedAt    time.Time  `gorm:"comment:创建时间"`
+	UpdatedAt    time.Time  `gorm:"comment:更新时间"`
+	Coupon       *Coupon    `gorm:"foreignKey:CouponID"` // 所属优惠券，查询券包时一并返回
+}
+
+func (UserCoupon) TableName() string {
+	return "user_coupon"
+}
+
+// CouponCodeBatch 对应于 coupon_code_batch 表的 GORM 模型
+// 每次为优惠券批量生成券码对应一个批次，记录生成券码所用的前缀、字母表和长度，用于校验券码
+type CouponCodeBatch struct {
+	BatchID   uint      `gorm:"primaryKey;autoIncrement;comment:批次ID"`
+	CouponID  uint      `gorm:"not null;index;comment:优惠券ID"`
+	Prefix    string    `gorm:"type:varchar(8);not null;default:'';comment:券码前缀"`
+	Alphabet  string    `gorm:"type:varchar(36);not null;comment:券码字母表"`
+	Length    int       `gorm:"not null;comment:券码随机部分的长度，不含前缀和校验字符"`
+	Quantity  int       `gorm:"not null;comment:生成的券码数量"`
+	CreatedAt time.Time `gorm:"comment:生成时间"`
+}
+
+func (CouponCodeBatch) TableName() string {
+	return "coupon_code_batch"
+}
+
+// CouponCode 对应于 coupon_code 表的 GORM 模型
+// 预生成的券码，用户领取时分配一个未分配的券码作为用户优惠券的券码，核销时按券码查找
+type CouponCode struct {
+	CodeID       uint64     `gorm:"primaryKey;autoIncrement;comment:主键ID"`
+	CouponID     uint       `gorm:"not null;index:idx_coupon_code_assign,priority:1;comment:优惠券ID"`
+	BatchID      uint       `gorm:"not null;index;comment:批次ID"`
+	Code         string     `gorm:"type:varchar(48);not null;uniqueIndex;comment:券码"`
+	UserCouponID *uint64    `gorm:"index:idx_coupon_code_assign,priority:2;comment:分配给的用户优惠券ID，为空表示未分配"`
+	AssignedAt   *time.Time `gorm:"comment:分配时间"`
+	VoidedAt     *time.Time `gorm:"comment:作废时间，已分配的券码在退款退回库存时作废，作废的券码不计入券码总数"`
+	CreatedAt    time.Time  `gorm:"comment:生成时间"`
+}
+
+func (CouponCode) TableName() string {
+	return "coupon_code"
+}
+
+// 优惠券适用范围的类型
+const (
+	CouponScopeStore    = "STORE"    // 指定门店
+	CouponScopeCity     = "CITY"     // 指定城市的全部门店
+	CouponScopeProvince = "PROVINCE" // 指定省份的全部门店
+)
+
+// CouponStoreScope 对应于 coupon_store_scope 表的 GORM 模型
+// 未限定单一门店（store_id 为空）的优惠券可以通过多条适用范围指定一组门店、城市或省份，满足任意一条即可使用；
+// 没有适用范围时全部门店通用。门店专属的优惠券不使用适用范围
+type CouponStoreScope struct {
+	ScopeID   uint64    `gorm:"primaryKey;autoIncrement;comment:主键ID"`
+	CouponID  uint      `gorm:"not null;index;comment:优惠券ID"`
+	ScopeType string    `gorm:"type:enum('STORE','CITY','PROVINCE');not null;comment:范围类型"`
+	StoreID   *uint     `gorm:"index;comment:STORE 的门店ID"`
+	Province  string    `gorm:"type:varchar(64);comment:CITY 和 PROVINCE 的省份，与门店的省份一致"`
+	City      string    `gorm:"type:varchar(64);comment:CITY 的城市，与门店的城市一致"`
+	CreatedAt time.Time `gorm:"comment:创建时间"`
+}
+
+func (CouponStoreScope) TableName() string {
+	return "coupon_store_scope"
+}
+
+// CouponBlackoutDate 对应于 coupon_blackout_date 表的 GORM 模型
+// 优惠券不可使用的日期，例如节假日
+type CouponBlackoutDate struct {
+	CouponID     uint      `gorm:"primaryKey;autoIncrement:false;comment:优惠券ID"`
+	BlackoutDate time.Time `gorm:"type:date;primaryKey;comment:不可用日期"`
+}
+
+func (CouponBlackoutDate) TableName() string {
+	return "coupon_blackout_date"
+}
+
+// CouponStockBucket 对应于 coupon_stock_bucket 表的 GORM 模型
+// 热门优惠券的剩余库存可以预先拆分到多个分桶中，领取时随机扣减其中一个分桶，避免所有请求争用优惠券的同一行。
+// 优惠券的已发行数量为 coupon.issued_quantity 加上各分桶的 issued
+type CouponStockBucket struct {
+	CouponID  uint      `gorm:"primaryKey;autoIncrement:false;comment:优惠券ID"`
+	BucketNo  int       `gorm:"primaryKey;autoIncrement:false;comment:分桶序号，从 0 开始"`
+	Quantity  int       `gorm:"not null;comment:分配到该分桶的库存"`
+	Issued    int       `gorm:"not null;default:0;comment:该分桶已发行的数量"`
+	UpdatedAt time.Time `gorm:"comment:更新时间"`
+}
+
+func (CouponStockBucket) TableName() string {
+	return "coupon_stock_bucket"
+}
+
+// CouponRedemption 对应于 coupon_redemption 表的 GORM 模型
+// 每一次成功的核销对应一条记录，同一门店的同一订单只能核销一张优惠券，重复提交时返回该记录。
+// 订单退款后记录保留并标记退款时间，该订单不能再次核销
+type CouponRedemption struct {
+	RedemptionID   uint64     `gorm:"primaryKey;autoIncrement;comment:主键ID"`
+	StoreID        uint       `gorm:"not null;uniqueIndex:idx_coupon_redemption_order,priority:1;comment:核销门店ID"`
+	OrderID        string     `gorm:"type:varchar(64);not null;uniqueIndex:idx_coupon_redemption_order,priority:2;comment:订单ID"`
+	UserCouponID   uint64     `gorm:"not null;index;comment:用户优惠券ID"`
+	CouponID       uint       `gorm:"not null;comment:优惠券ID"`
+	UserUnionID    string     `gorm:"type:varchar(64);not null;comment:用户UnionID"`
+	OrderAmount    float64    `gorm:"type:decimal(10,2);not null;comment:订单金额"`
+	AmountDeducted float64    `gorm:"type:decimal(10,2);not null;comment:优惠券抵扣金额"`
+	CouponLogID    uint64     `gorm:"not null;comment:核销日志ID"`
+	RefundedAt     *time.Time `gorm:"comment:退款时间，为空表示未退款"`
+	RefundLogID    *uint64    `gorm:"comment:退款日志ID"`
+	CreatedAt      time.Time  `gorm:"comment:核销时间"`
+}
+
+func (CouponRedemption) TableName() string {
+	return "coupon_redemption"
+}
+
 // AppConfig 对应于 app_config 表的 GORM 模型
+// 每一条记录代表一个 API 调用方（小程序、门店后台等），拥有独立的签名和加密密钥
 type AppConfig struct {
 	ConfigID      uint      `gorm:"primaryKey;autoIncrement"`
-	StoreID       uint      `gorm:"not null"`
+	StoreID       uint      `gorm:"not null;comment:所属门店ID，门店运营角色只能操作该门店的数据"`
 	MiniProgramID string    `gorm:"type:varchar(64);not null;comment:小程序AppID"`
+	AppID         string    `gorm:"type:varchar(64);uniqueIndex;comment:API调用方标识，对应请求头X-App-Id"`
+	AppName       string    `gorm:"type:varchar(100);comment:调用方名称"`
+	Role          string    `gorm:"type:varchar(32);not null;default:'mini_program';comment:调用方角色，platform_admin, store_operator 或 mini_program"`
+	SignSecret    string    `gorm:"type:varchar(128);comment:HMAC签名密钥" json:"-"`
+	EncryptSecret string    `gorm:"type:varchar(64);comment:AES加密密钥（16, 24或32位）" json:"-"`
+	Status        int8      `gorm:"type:tinyint;default:1;comment:调用方状态，1正常，0停用"`
 	AccessToken   string    `gorm:"type:varchar(255);comment:调用凭证"`
 	TokenExpiry   time.Time `gorm:"comment:令牌过期时间"`
 	CreatedAt     time.Time `gorm:"comment:创建时间"`
@@ -157,3 +333,185 @@ type AppConfig struct {
 func (AppConfig) TableName() string {
 	return "app_config"
 }
+
+// AppKey 对应于 app_key 表的 GORM 模型
+// 记录调用方用于加密信封的密钥，支持通过密钥ID (kid) 进行轮换
+type AppKey struct {
+	KeyID      string     `gorm:"primaryKey;type:varchar(32);comment:密钥ID (kid)"`
+	AppID      string     `gorm:"type:varchar(64);not null;index;comment:所属调用方标识"`
+	Secret     string     `gorm:"type:varchar(64);not null;comment:十六进制编码的AES密钥" json:"-"`
+	Status     string     `gorm:"type:enum('CURRENT','ACTIVE','RETIRED');default:'ACTIVE';not null;comment:密钥状态"`
+	GraceUntil *time.Time `gorm:"comment:旧密钥可用于解密的截止时间"`
+	Legacy     bool       `gorm:"not null;default:false;comment:是否由 app_config.encrypt_secret 迁移而来（用于解密不带 kid 的请求）"`
+	CreatedAt  time.Time  `gorm:"comment:创建时间"`
+	UpdatedAt  time.Time  `gorm:"comment:更新时间"`
+}
+
+func (AppKey) TableName() string {
+	return "app_key"
+}
+
+// WifiRelease 对应于 wifi_release 表的 GORM 模型
+// 记录每一次向用户下发WIFI密码的情况，每条扫码日志最多下发一次
+type WifiRelease struct {
+	ReleaseID   uint64    `gorm:"primaryKey;autoIncrement;comment:主键ID"`
+	LogID       uint64    `gorm:"not null;uniqueIndex;comment:扫码日志ID"`
+	WifiID      uint      `gorm:"not null;index;comment:WIFI配置ID"`
+	StoreID     uint      `gorm:"not null;comment:门店ID"`
+	UserUnionID string    `gorm:"type:varchar(64);not null;comment:用户UnionID"`
+	AppID       string    `gorm:"type:varchar(64);comment:调用方标识"`
+	IPAddress   string    `gorm:"type:varchar(45);comment:用户IP地址"`
+	CreatedAt   time.Time `gorm:"comment:下发时间"`
+}
+
+func (WifiRelease) TableName() string {
+	return "wifi_release"
+}
+
+// QrCode 对应于 qr_code 表的 GORM 模型
+// 每一个张贴在门店、桌台或海报上的二维码都需要在此登记，扫码日志中的二维码ID必须存在于该表
+type QrCode struct {
+	QrCodeID   string    `gorm:"primaryKey;type:varchar(64);comment:二维码ID，编码在二维码内容中"`
+	StoreID    uint      `gorm:"not null;index;comment:所属门店ID"`
+	QrCodeType string    `gorm:"type:enum('STORE','EVENT','POSTER','DESK','OTHER');default:'STORE';not null;comment:二维码类型"`
+	Name       string    `gorm:"type:varchar(100);not null;comment:二维码名称，例如桌号或海报位置"`
+	WifiID     *uint     `gorm:"comment:关联的WIFI配置ID"` // 使用指针以接受 NULL 值
+	CouponID   *uint     `gorm:"comment:关联的优惠券ID"`    // 使用指针以接受 NULL 值
+	Status     int8      `gorm:"type:tinyint;default:1;comment:二维码状态，1正常，0停用"`
+	Remark     string    `gorm:"type:varchar(255);comment:备注信息"`
+	CreatedAt  time.Time `gorm:"comment:创建时间"`
+	UpdatedAt  time.Time `gorm:"comment:更新时间"`
+}
+
+func (QrCode) TableName() string {
+	return "qr_code"
+}
+
+// 连接会话状态
+const (
+	ConnectSessionOpen             = "OPEN"              // 已扫码，尚未获取WIFI密码
+	ConnectSessionCredentialIssued = "CREDENTIAL_ISSUED" // 已获取WIFI密码，等待上报连接结果
+	ConnectSessionSucceeded        = "SUCCEEDED"         // 已上报连接成功
+	ConnectSessionFailed           = "FAILED"            // 已上报连接失败
+	ConnectSessionTimedOut         = "TIMED_OUT"         // 超时未上报结果，已自动关闭
+)
+
+// ConnectSession 对应于 connect_session 表的 GORM 模型
+// 将一次扫码连接的三个步骤（创建扫码日志、获取WIFI密码、上报连接结果）通过连接票据关联起来
+type ConnectSession struct {
+	SessionID      uint64     `gorm:"primaryKey;autoIncrement;comment:主键ID"`
+	LogID          uint64     `gorm:"not null;uniqueIndex;comment:扫码日志ID"`
+	TicketHash     string     `gorm:"type:char(64);not null;comment:连接票据的SHA-256摘要" json:"-"`
+	StoreID        uint       `gorm:"not null;comment:门店ID"`
+	UserUnionID    string     `gorm:"type:varchar(64);not null;comment:用户UnionID"`
+	WifiID         *uint      `gorm:"index;comment:已下发密码的WIFI配置ID"`
+	Status         string     `gorm:"type:enum('OPEN','CREDENTIAL_ISSUED','SUCCEEDED','FAILED','TIMED_OUT');default:'OPEN';not null;index:idx_connect_session_status_expires,priority:1;comment:会话状态"`
+	ExpiresAt      time.Time  `gorm:"not null;index:idx_connect_session_status_expires,priority:2;comment:当前阶段的截止时间，获取密码前为获取密码的截止时间，获取后为上报结果的截止时间"`
+	ClosedAt       *time.Time `gorm:"comment:会话结束时间"`
+	ConnectedUntil *time.Time `gorm:"comment:连接成功后占用WIFI连接数的截止时间，主动断开时更新为断开时间"`
+	CreatedAt      time.Time  `gorm:"comment:创建时间"`
+	UpdatedAt      time.Time  `gorm:"comment:更新时间"`
+}
+
+func (ConnectSession) TableName() string {
+	return "connect_session"
+}
+
+// JobLease 对应于 job_lease 表的 GORM 模型
+// 多个服务实例运行同一个后台任务时，只有持有未过期租约的实例执行，持有者宕机后租约过期，由其他实例接手。
+// 同时记录最近一次执行的进度
+type JobLease struct {
+	JobName        string     `gorm:"type:varchar(64);primaryKey;comment:任务名称"`
+	Owner          string     `gorm:"type:varchar(128);not null;comment:持有租约的实例"`
+	ExpiresAt      time.Time  `gorm:"not null;comment:租约过期时间"`
+	LastStartedAt  *time.Time `gorm:"comment:最近一次开始执行的时间"`
+	LastFinishedAt *time.Time `gorm:"comment:最近一次执行完成的时间"`
+	LastProcessed  int64      `gorm:"default:0;comment:最近一次执行处理的记录数"`
+	LastError      string     `gorm:"type:varchar(255);comment:最近一次执行的错误信息"`
+	UpdatedAt      time.Time  `gorm:"comment:更新时间"`
+}
+
+func (JobLease) TableName() string {
+	return "job_lease"
+}
+
+// 营销活动的触发条件
+const (
+	CampaignTriggerFirstConnect = "FIRST_CONNECT" // 用户在门店首次连接WIFI成功
+	CampaignTriggerNthVisit     = "NTH_VISIT"     // 用户第 N 次到店（按连接成功的自然日计算）
+	CampaignTriggerFirstInDays  = "FIRST_IN_DAYS" // 用户最近若干天内首次到店，从未到店的用户同样满足
+	CampaignTriggerQrCode       = "QR_CODE"       // 通过指定类型或指定的二维码扫码连接成功
+)
+
+// Campaign 对应于 campaign 表的 GORM 模型
+// 用户连接WIFI成功时按活动规则自动发放优惠券，发放数量受活动预算限制
+type Campaign struct {
+	CampaignID   uint           `gorm:"primaryKey;autoIncrement;comment:活动ID"`
+	CampaignName string         `gorm:"type:varchar(100);not null;comment:活动名称"`
+	StoreID      *uint          `gorm:"index;comment:适用门店ID，为空表示全部门店"` // 使用指针以接受 NULL 值
+	TriggerType  string         `gorm:"type:enum('FIRST_CONNECT','NTH_VISIT','FIRST_IN_DAYS','QR_CODE');not null;comment:触发条件"`
+	VisitCount   int            `gorm:"default:0;comment:NTH_VISIT 的到店次数"`
+	WithinDays   int            `gorm:"default:0;comment:FIRST_IN_DAYS 的天数"`
+	QrCodeType   string         `gorm:"type:varchar(16);comment:QR_CODE 的二维码类型，为空表示不限"`
+	QrCodeID     string         `gorm:"type:varchar(64);comment:QR_CODE 的二维码ID，为空表示不限"`
+	CouponID     uint           `gorm:"not null;index;comment:发放的优惠券ID"`
+	Budget       int            `gorm:"default:0;comment:活动预算，最多发放的优惠券数量，0 表示不限"`
+	IssuedCount  int            `gorm:"default:0;comment:已发放的优惠券数量"`
+	StartTime    *time.Time     `gorm:"comment:活动开始时间，为空表示立即开始"`
+	EndTime      *time.Time     `gorm:"comment:活动结束时间，为空表示长期有效"`
+	Status       int8           `gorm:"type:tinyint;default:1;comment:活动状态，1启用，0停用"`
+	Remark       string         `gorm:"type:varchar(255);comment:备注信息"`
+	CreatedAt    time.Time      `gorm:"comment:创建时间"`
+	UpdatedAt    time.Time      `gorm:"comment:更新时间"`
+	DeletedAt    gorm.DeletedAt `gorm:"index;comment:删除时间"`
+}
+
+func (Campaign) TableName() string {
+	return "campaign"
+}
+
+// CampaignIssue 对应于 campaign_issue 表的 GORM 模型
+// 记录活动为用户发放的每一张优惠券。TriggerKey 标识一次触发（例如某门店的首次连接、第 N 次到店），
+// 与活动和用户组成唯一索引，同一条件并发触发时只发放一次
+type CampaignIssue struct {
+	IssueID      uint64    `gorm:"primaryKey;autoIncrement;comment:主键ID"`
+	CampaignID   uint      `gorm:"not null;uniqueIndex:idx_campaign_issue_trigger,priority:1;comment:活动ID"`
+	UserUnionID  string    `gorm:"type:varchar(64);not null;uniqueIndex:idx_campaign_issue_trigger,priority:2;comment:用户UnionID"`
+	TriggerKey   string    `gorm:"type:varchar(64);not null;uniqueIndex:idx_campaign_issue_trigger,priority:3;comment:触发标识"`
+	StoreID      uint      `gorm:"not null;comment:门店ID"`
+	ScanLogID    uint64    `gorm:"not null;index;comment:触发发放的扫码日志ID"`
+	CouponLogID  uint64    `gorm:"not null;comment:领取日志ID"`
+	UserCouponID uint64    `gorm:"not null;comment:发放的用户优惠券ID"`
+	CreatedAt    time.Time `gorm:"comment:发放时间"`
+}
+
+func (CampaignIssue) TableName() string {
+	return "campaign_issue"
+}
+
+// AllModels 返回所有需要同步表结构的模型
+func AllModels() []any {
+	return []any{
+		&Store{},
+		&WifiConfig{},
+		&UserProfile{},
+		&ScanLog{},
+		&Coupon{},
+		&CouponLog{},
+		&UserCoupon{},
+		&CouponStockBucket{},
+		&CouponCodeBatch{},
+		&CouponCode{},
+		&CouponStoreScope{},
+		&CouponBlackoutDate{},
+		&CouponRedemption{},
+		&AppConfig{},
+		&AppKey{},
+		&WifiRelease{},
+		&ConnectSession{},
+		&QrCode{},
+		&JobLease{},
+		&Campaign{},
+		&CampaignIssue{},
+	}
+}
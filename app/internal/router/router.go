@@ -2,7 +2,9 @@ package router
 
 import (
 	v1 "app/internal/api/v1"
+	"app/internal/service"
 	"app/pkg/security"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,6 +24,9 @@ func SetupRouter() *gin.Engine {
 	// 3. 可以添加其他全局中间件，例如 CORS 等
 	// r.Use(middlewares.Cors())
 
+	// 从 app_config 表加载各调用方的独立密钥，并缓存一分钟
+	security.SetCredentialProvider(security.NewCachedCredentialProvider(&service.AppConfigService{}, time.Minute))
+
 	// API V1 路由组
 	apiV1 := r.Group("/api/v1")
 
@@ -36,106 +41,169 @@ func SetupRouter() *gin.Engine {
 		couponHandler := v1.NewCouponHandler()
 		couponLogHandler := v1.NewCouponLogHandler()
 		statsHandler := v1.NewStatsHandler()
+		appKeyHandler := v1.NewAppKeyHandler()
+		qrCodeHandler := v1.NewQrCodeHandler()
+		userCouponHandler := v1.NewUserCouponHandler()
+		campaignHandler := v1.NewCampaignHandler()
+
+		// 路由权限声明：每个路由都必须声明允许访问的角色。
+		// 门店运营角色的门店范围限制在各 Handler 中按门店ID校验。
+		adminOnly := security.Allow(security.RolePlatformAdmin)
+		operators := security.Allow(security.RolePlatformAdmin, security.RoleStoreOperator)
+		miniProgram := security.Allow(security.RolePlatformAdmin, security.RoleMiniProgram)
+		everyone := security.Allow(security.RolePlatformAdmin, security.RoleStoreOperator, security.RoleMiniProgram)
+		// 用户相关的接口：小程序必须携带用户令牌，操作的用户以令牌为准
+		withUser := security.UserIdentity()
 
 		// 门店相关路由
 		stores := apiV1.Group("/stores")
 		{
-			stores.POST("/with-wifi", storeHandler.CreateStoreWithWifi)
-			stores.POST("/", storeHandler.CreateStore)
-			stores.GET("/:storeId", storeHandler.GetStore)
-			stores.GET("/", storeHandler.GetStores)
-			stores.PUT("/:storeId", storeHandler.UpdateStore)
-			stores.DELETE("/:storeId", storeHandler.DeleteStore)
+			stores.POST("/with-wifi", adminOnly, storeHandler.CreateStoreWithWifi)
+			stores.POST("/", adminOnly, storeHandler.CreateStore)
+			stores.GET("/:storeId", everyone, storeHandler.GetStore)
+			stores.GET("/", everyone, storeHandler.GetStores)
+			stores.PUT("/:storeId", operators, storeHandler.UpdateStore)
+			stores.DELETE("/:storeId", adminOnly, storeHandler.DeleteStore)
+			stores.POST("/:storeId/restore", adminOnly, storeHandler.RestoreStore) // 恢复已删除的门店
 			// 细分更新接口
-			stores.PATCH("/:storeId/status", storeHandler.UpdateStoreStatus)     // 更新门店状态
-			stores.PATCH("/:storeId/phone", storeHandler.UpdateStorePhone)       // 更新门店电话
-			stores.PATCH("/:storeId/location", storeHandler.UpdateStoreLocation) // 更新门店位置
+			stores.PATCH("/:storeId/status", operators, storeHandler.UpdateStoreStatus)     // 更新门店状态
+			stores.PATCH("/:storeId/phone", operators, storeHandler.UpdateStorePhone)       // 更新门店电话
+			stores.PATCH("/:storeId/location", operators, storeHandler.UpdateStoreLocation) // 更新门店位置
 			// 关联路由：查询门店下的WIFI
-			stores.GET("/:storeId/wifis", wifiHandler.GetWifiConfigsByStore)
+			stores.GET("/:storeId/wifis", everyone, wifiHandler.GetWifiConfigsByStore)
 			// 关联路由：查询门店的每日扫码量
-			stores.GET("/:storeId/scans/daily-count", scanLogHandler.GetDailyScanCountByStore)
+			stores.GET("/:storeId/scans/daily-count", operators, scanLogHandler.GetDailyScanCountByStore)
 		}
 
 		// WIFI 配置相关路由
 		wifis := apiV1.Group("/wifis")
 		{
-			wifis.POST("", wifiHandler.CreateWifiConfig)       // 新增WIFI配置
-			wifis.GET("/:id", wifiHandler.GetWifiConfig)       // 查询单个WIFI配置详情
-			wifis.PUT("/:id", wifiHandler.UpdateWifiConfig)    // 更新WIFI配置
-			wifis.DELETE("/:id", wifiHandler.DeleteWifiConfig) // 删除WIFI配置
+			wifis.POST("", operators, wifiHandler.CreateWifiConfig)                    // 新增WIFI配置
+			wifis.GET("/:id", everyone, wifiHandler.GetWifiConfig)                     // 查询单个WIFI配置详情
+			wifis.PUT("/:id", operators, wifiHandler.UpdateWifiConfig)                 // 更新WIFI配置
+			wifis.DELETE("/:id", operators, wifiHandler.DeleteWifiConfig)              // 删除WIFI配置
+			wifis.POST("/:id/restore", operators, wifiHandler.RestoreWifiConfig)       // 恢复已删除的WIFI配置
+			wifis.POST("/:id/connect", miniProgram, withUser, wifiHandler.ConnectWifi) // 凭扫码日志获取WIFI密码
 		}
 
 		// 用户信息相关路由
 		users := apiV1.Group("/users")
 		{
-			users.POST("/", userHandler.CreateOrUpdateUser)            // 创建或更新用户档案
-			users.GET("/", userHandler.GetUser)                        // 根据 UnionID, OpenID 或手机号获取用户详情
-			users.POST("/bind-phone", userHandler.BindPhoneNumber)     // 用户绑定手机号
-			users.POST("/unbind-phone", userHandler.UnbindPhoneNumber) // 用户解绑手机号
-			users.GET("/scan-history", userHandler.GetUserScanHistory) // 查询用户扫码门店历史
+			users.POST("/login", miniProgram, userHandler.Login)                              // 用户登录，签发用户令牌
+			users.POST("/", miniProgram, withUser, userHandler.CreateOrUpdateUser)            // 创建或更新用户档案
+			users.GET("/", miniProgram, withUser, userHandler.GetUser)                        // 根据 UnionID, OpenID 或手机号获取用户详情
+			users.POST("/bind-phone", miniProgram, withUser, userHandler.BindPhoneNumber)     // 用户绑定手机号
+			users.POST("/unbind-phone", miniProgram, withUser, userHandler.UnbindPhoneNumber) // 用户解绑手机号
+			users.GET("/scan-history", miniProgram, withUser, userHandler.GetUserScanHistory) // 查询用户扫码门店历史
+			users.GET("/coupons", miniProgram, withUser, userCouponHandler.GetUserCoupons)    // 查询用户券包
+			users.GET("/coupons/:id", miniProgram, withUser, userCouponHandler.GetUserCoupon) // 查询券包中的一张优惠券
 		}
 
 		// 扫码日志相关路由
 		scanLogs := apiV1.Group("/scan-logs")
 		{
-			scanLogs.POST("/", scanLogHandler.CreateScanLog)                   // 记录用户扫码连接日志
-			scanLogs.GET("/", scanLogHandler.GetScanLogs)                      // 查询扫码日志列表
-			scanLogs.PUT("/:logId/result", scanLogHandler.UpdateScanLogResult) // 更新扫码日志连接结果
-			scanLogs.GET("/stats/daily-count/:storeId", scanLogHandler.GetDailyScanCountByStore)
-			scanLogs.GET("/failed", scanLogHandler.GetFailedScanLogs) // 查询扫码连接失败日志
-			scanLogs.GET("/user", scanLogHandler.GetUserScanLogs)     // 查询指定用户的扫码历史
+			scanLogs.POST("/", miniProgram, withUser, scanLogHandler.CreateScanLog)                      // 记录用户扫码连接日志
+			scanLogs.GET("/", operators, scanLogHandler.GetScanLogs)                                     // 查询扫码日志列表
+			scanLogs.PUT("/:logId/result", miniProgram, withUser, scanLogHandler.UpdateScanLogResult)    // 更新扫码日志连接结果
+			scanLogs.POST("/:logId/disconnect", miniProgram, withUser, scanLogHandler.DisconnectScanLog) // 断开WIFI连接，释放占用的连接数
+			scanLogs.GET("/stats/daily-count/:storeId", operators, scanLogHandler.GetDailyScanCountByStore)
+			scanLogs.GET("/failed", operators, scanLogHandler.GetFailedScanLogs)         // 查询扫码连接失败日志
+			scanLogs.GET("/user", miniProgram, withUser, scanLogHandler.GetUserScanLogs) // 查询指定用户的扫码历史
 		}
 
 		// 优惠券路由
 		coupons := apiV1.Group("/coupons")
 		{
-			coupons.POST("/", couponHandler.CreateCoupon)
-			coupons.POST("/batch", couponHandler.CreateBatchCoupons)
-			coupons.GET("/available-for-user", couponHandler.GetAvailableCouponsForUser)
-			coupons.GET("/store", couponHandler.GetCouponsByStore) // 查询门店可用优惠券列表
-			coupons.GET("/:id", couponHandler.GetCoupon)
-			coupons.GET("/", couponHandler.GetCoupons)
-			coupons.PUT("/:id", couponHandler.UpdateCoupon)
-			coupons.DELETE("/:id", couponHandler.DeleteCoupon)
+			coupons.POST("/", operators, couponHandler.CreateCoupon)
+			coupons.POST("/batch", operators, couponHandler.CreateBatchCoupons)
+			coupons.GET("/available-for-user", everyone, withUser, couponHandler.GetAvailableCouponsForUser)
+			coupons.GET("/store", everyone, couponHandler.GetCouponsByStore)   // 查询门店可用优惠券列表
+			coupons.POST("/redeem", operators, userCouponHandler.RedeemCoupon) // 按订单核销用户优惠券（收银端调用）
+			coupons.POST("/refund", operators, userCouponHandler.RefundCoupon) // 订单退款时退还优惠券
+			coupons.GET("/:id", everyone, couponHandler.GetCoupon)
+			coupons.POST("/:id/quote", everyone, couponHandler.QuoteCoupon) // 试算订单的抵扣金额
+			coupons.GET("/", everyone, couponHandler.GetCoupons)
+			coupons.PUT("/:id", operators, couponHandler.UpdateCoupon)
+			coupons.DELETE("/:id", operators, couponHandler.DeleteCoupon)
+			coupons.POST("/:id/restore", operators, couponHandler.RestoreCoupon) // 恢复已删除的优惠券
 			// 细分的优惠券更新接口
-			coupons.PATCH("/:id/validity", couponHandler.UpdateCouponValidity) // 更新有效期
-			coupons.PATCH("/:id/limit", couponHandler.UpdateCouponLimit)       // 更新使用限制
-			coupons.PATCH("/:id/quantity", couponHandler.UpdateCouponQuantity) // 更新发行量
-			coupons.PATCH("/:id/store", couponHandler.UpdateCouponStore)       // 更新适用门店
-			coupons.PATCH("/:id/status", couponHandler.UpdateCouponStatus)     // 更新优惠券状态
+			coupons.PATCH("/:id/validity", operators, couponHandler.UpdateCouponValidity)          // 更新有效期
+			coupons.PATCH("/:id/limit", operators, couponHandler.UpdateCouponLimit)                // 更新使用限制
+			coupons.PATCH("/:id/quantity", operators, couponHandler.UpdateCouponQuantity)          // 更新发行量
+			coupons.PATCH("/:id/stock-buckets", adminOnly, couponHandler.UpdateCouponStockBuckets) // 设置库存分桶
+			coupons.POST("/:id/codes", operators, couponHandler.GenerateCouponCodes)               // 批量生成券码
+			coupons.GET("/:id/codes/export", operators, couponHandler.ExportCouponCodes)           // 导出券码
+			coupons.PATCH("/:id/store", operators, couponHandler.UpdateCouponStore)                // 更新适用门店
+			coupons.GET("/:id/rules", everyone, couponHandler.GetCouponRules)                      // 查询适用范围和可用时段
+			coupons.PATCH("/:id/scopes", operators, couponHandler.UpdateCouponScopes)              // 更新适用范围
+			coupons.PATCH("/:id/schedule", operators, couponHandler.UpdateCouponSchedule)          // 更新可用时段
+			coupons.PATCH("/:id/status", operators, couponHandler.UpdateCouponStatus)              // 更新优惠券状态
 		}
 
 		// 优惠券日志路由
 		couponLogs := apiV1.Group("/coupon-logs")
 		{
-			couponLogs.POST("/", couponLogHandler.CreateCouponLog)
-			couponLogs.GET("/", couponLogHandler.GetCouponLogs)
-			couponLogs.GET("/claim", couponLogHandler.GetCouponClaimLogs) // 查询优惠券领取记录
-			couponLogs.GET("/use", couponLogHandler.GetCouponUseLogs)     // 查询优惠券核销使用记录
+			couponLogs.POST("/", everyone, withUser, couponLogHandler.CreateCouponLog)
+			couponLogs.GET("/", operators, couponLogHandler.GetCouponLogs)
+			couponLogs.GET("/claim", operators, couponLogHandler.GetCouponClaimLogs) // 查询优惠券领取记录
+			couponLogs.GET("/use", operators, couponLogHandler.GetCouponUseLogs)     // 查询优惠券核销使用记录
 		}
 
 		// 数据统计与报表路由
 		stats := apiV1.Group("/stats")
 		{
-			stats.GET("/stores", statsHandler.GetStoreStats)
-			stats.GET("/wifi-usage", statsHandler.GetWifiUsageStats)
-			stats.GET("/user-behavior", statsHandler.GetUserBehaviorStats)
-			stats.GET("/coupons", statsHandler.GetCouponStats)
-			stats.GET("/popular-wifi", statsHandler.GetPopularWifi)                    // 最受欢迎WIFI统计
-			stats.GET("/scan-time-distribution", statsHandler.GetScanTimeDistribution) // 扫码时段分布统计
+			stats.GET("/stores", adminOnly, statsHandler.GetStoreStats)
+			stats.GET("/wifi-usage", operators, statsHandler.GetWifiUsageStats)
+			stats.GET("/user-behavior", adminOnly, statsHandler.GetUserBehaviorStats)
+			stats.GET("/coupons", operators, statsHandler.GetCouponStats)
+			stats.GET("/popular-wifi", operators, statsHandler.GetPopularWifi)                    // 最受欢迎WIFI统计
+			stats.GET("/scan-time-distribution", operators, statsHandler.GetScanTimeDistribution) // 扫码时段分布统计
 		}
 
 		// WIFI配置路由
 		wifi := apiV1.Group("/wifi-configs")
 		{
-			wifi.POST("/", wifiHandler.CreateWifiConfig)
-			wifi.POST("/batch", wifiHandler.CreateBatchWifiConfigs)
-			wifi.GET("/type", wifiHandler.GetWifiConfigsByStoreAndType) // 查询门店特定类型的WIFI配置
-			wifi.GET("/:id", wifiHandler.GetWifiConfig)
-			wifi.GET("/store/:storeId", wifiHandler.GetWifiConfigsByStore)
-			wifi.PUT("/:id", wifiHandler.UpdateWifiConfig)
-			wifi.DELETE("/:id", wifiHandler.DeleteWifiConfig)         // 删除单个WIFI配置
-			wifi.DELETE("/batch", wifiHandler.DeleteBatchWifiConfigs) // 批量删除WIFI配置
+			wifi.POST("/", operators, wifiHandler.CreateWifiConfig)
+			wifi.POST("/batch", operators, wifiHandler.CreateBatchWifiConfigs)
+			wifi.GET("/type", everyone, wifiHandler.GetWifiConfigsByStoreAndType) // 查询门店特定类型的WIFI配置
+			wifi.GET("/:id", everyone, wifiHandler.GetWifiConfig)
+			wifi.GET("/store/:storeId", everyone, wifiHandler.GetWifiConfigsByStore)
+			wifi.PUT("/:id", operators, wifiHandler.UpdateWifiConfig)
+			wifi.DELETE("/:id", operators, wifiHandler.DeleteWifiConfig)              // 删除单个WIFI配置
+			wifi.DELETE("/batch", operators, wifiHandler.DeleteBatchWifiConfigs)      // 批量删除WIFI配置
+			wifi.POST("/:id/restore", operators, wifiHandler.RestoreWifiConfig)       // 恢复已删除的WIFI配置
+			wifi.POST("/:id/connect", miniProgram, withUser, wifiHandler.ConnectWifi) // 凭扫码日志获取WIFI密码
+		}
+
+		// 门店二维码路由
+		qrCodes := apiV1.Group("/qrcodes")
+		{
+			qrCodes.POST("", operators, qrCodeHandler.CreateQrCode)
+			qrCodes.GET("", operators, qrCodeHandler.GetQrCodes)
+			qrCodes.GET("/:id", everyone, qrCodeHandler.GetQrCode) // 小程序扫码后查询二维码关联的门店、WIFI和优惠券
+			qrCodes.PUT("/:id", operators, qrCodeHandler.UpdateQrCode)
+			qrCodes.DELETE("/:id", operators, qrCodeHandler.DeleteQrCode)
+			qrCodes.GET("/:id/image", operators, qrCodeHandler.RenderQrCode) // 生成 PNG 或 SVG 图片
+		}
+
+		// 营销活动路由，用户连接WIFI成功时按活动规则自动发放优惠券
+		campaigns := apiV1.Group("/campaigns")
+		{
+			campaigns.POST("", operators, campaignHandler.CreateCampaign)
+			campaigns.GET("", operators, campaignHandler.GetCampaigns)
+			campaigns.GET("/:id", operators, campaignHandler.GetCampaign)
+			campaigns.PUT("/:id", operators, campaignHandler.UpdateCampaign)
+			campaigns.DELETE("/:id", operators, campaignHandler.DeleteCampaign)
+		}
+
+		// 平台管理路由，仅限平台管理员
+		admin := apiV1.Group("/admin", adminOnly)
+		{
+			// 调用方加密密钥轮换
+			admin.GET("/apps/:appId/keys", appKeyHandler.ListKeys)
+			admin.POST("/apps/:appId/keys", appKeyHandler.CreateKey)
+			admin.PATCH("/apps/:appId/keys/:keyId/promote", appKeyHandler.PromoteKey) // 设为当前密钥
+			admin.PATCH("/apps/:appId/keys/:keyId/retire", appKeyHandler.RetireKey)   // 退役密钥
 		}
 
 		// 您可以在此继续添加其他资源的路由
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"app/internal/models"
+	"app/pkg/database"
+	"app/pkg/security"
+
+	"gorm.io/gorm"
+)
+
+// AppConfigService 提供了 API 调用方凭证相关的业务逻辑。
+// 它实现了 security.CredentialProvider 接口，从 app_config 表中加载调用方的密钥。
+type AppConfigService struct{}
+
+// GetCredential 根据 AppID 从 app_config 表加载调用方凭证
+func (s *AppConfigService) GetCredential(appID string) (*security.Credential, error) {
+	var app models.AppConfig
+	err := database.DB.WithContext(context.Background()).Where("app_id = ?", appID).First(&app).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, security.ErrCredentialNotFound
+		}
+		return nil, fmt.Errorf("查询调用方凭证失败: %w", err)
+	}
+
+	if app.Status != 1 {
+		return nil, security.ErrCredentialDisabled
+	}
+
+	if app.SignSecret == "" {
+		return nil, fmt.Errorf("调用方 %s 未配置签名密钥", appID)
+	}
+
+	if err := security.ValidateRole(app.Role, app.StoreID); err != nil {
+		return nil, fmt.Errorf("调用方 %s 的角色配置无效: %w", appID, err)
+	}
+
+	keys, err := s.loadKeyring(&app)
+	if err != nil {
+		return nil, fmt.Errorf("调用方 %s 的密钥配置无效: %w", appID, err)
+	}
+
+	return &security.Credential{
+		AppID:   app.AppID,
+		AppName: app.AppName,
+		Role:    app.Role,
+		StoreID: app.StoreID,
+		SignKey: []byte(app.SignSecret),
+		Keys:    keys,
+	}, nil
+}
+
+// loadKeyring 加载调用方未退役的加密密钥并构建密钥环。
+// app_config.encrypt_secret 作为不带 kid 的旧版密钥加入密钥环，在首次轮换前它就是当前密钥；
+// 首次轮换时它被迁移为 app_key 中的旧版密钥（见 AppKeyService.PromoteKey），
+// 之后仍以空 kid 解密旧客户端的请求，直到宽限期结束或被退役。
+func (s *AppConfigService) loadKeyring(app *models.AppConfig) (*security.Keyring, error) {
+	var rows []models.AppKey
+	if err := database.DB.WithContext(context.Background()).
+		Where("app_id = ? AND status <> ?", app.AppID, security.KeyStatusRetired).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	keys := make([]security.Key, 0, len(rows)+1)
+	hasCurrent := false
+	for _, row := range rows {
+		secret, err := hex.DecodeString(row.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("密钥 %s 解码失败: %w", row.KeyID, err)
+		}
+		if row.Status == security.KeyStatusCurrent {
+			hasCurrent = true
+		}
+		id := row.KeyID
+		if row.Legacy {
+			// 旧客户端的信封中不带 kid
+			id = ""
+		}
+		keys = append(keys, security.Key{
+			ID:         id,
+			Secret:     secret,
+			Status:     row.Status,
+			GraceUntil: row.GraceUntil,
+		})
+	}
+
+	if app.EncryptSecret != "" {
+		status := security.KeyStatusCurrent
+		if hasCurrent {
+			status = security.KeyStatusActive
+		}
+		keys = append(keys, security.Key{Secret: []byte(app.EncryptSecret), Status: status})
+	}
+
+	return security.NewKeyring(keys)
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"app/config"
+	"app/internal/models"
+	"app/pkg/database"
+	"app/pkg/security"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrKeyNotPromotable 表示只有可用状态的密钥才能被设为当前密钥
+	ErrKeyNotPromotable = errors.New("只有可用状态的密钥才能设为当前密钥")
+	// ErrRetireCurrentKey 表示不能直接退役当前密钥
+	ErrRetireCurrentKey = errors.New("不能退役当前密钥，请先将其他密钥设为当前密钥")
+)
+
+// AppKeyService 提供了调用方加密密钥轮换相关的业务逻辑
+type AppKeyService struct{}
+
+// ListKeys 查询调用方的全部密钥（不包含密钥内容）
+func (s *AppKeyService) ListKeys(appID string) ([]models.AppKey, error) {
+	var keys []models.AppKey
+	err := database.DB.WithContext(context.Background()).
+		Where("app_id = ?", appID).
+		Order("created_at DESC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// CreateKeyInput 定义了新增密钥的输入
+type CreateKeyInput struct {
+	KeyBits int `json:"key_bits" binding:"omitempty,oneof=128 192 256"` // 密钥长度，默认 256
+}
+
+// CreateKey 为调用方生成一个新的可用密钥。
+// 新密钥只用于解密，需要在分发给客户端后再通过 PromoteKey 设为当前密钥。
+// 返回的十六进制密钥内容只会在此时返回一次。
+func (s *AppKeyService) CreateKey(appID string, input *CreateKeyInput) (*models.AppKey, string, error) {
+	keyBits := input.KeyBits
+	if keyBits == 0 {
+		keyBits = 256
+	}
+
+	secret := make([]byte, keyBits/8)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("生成密钥失败: %w", err)
+	}
+	keyID, err := newKeyID()
+	if err != nil {
+		return nil, "", err
+	}
+	key := models.AppKey{
+		KeyID:  keyID,
+		AppID:  appID,
+		Secret: hex.EncodeToString(secret),
+		Status: security.KeyStatusActive,
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 确认调用方存在
+		var app models.AppConfig
+		if err := tx.Where("app_id = ?", appID).First(&app).Error; err != nil {
+			return err
+		}
+		return tx.Create(&key).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	security.InvalidateCredential(appID)
+	return &key, key.Secret, nil
+}
+
+// newKeyID 生成形如 k20260101-1a2b3c4d 的密钥ID
+func newKeyID() (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("生成密钥ID失败: %w", err)
+	}
+	return fmt.Sprintf("k%s-%s", time.Now().Format("20060102"), hex.EncodeToString(suffix)), nil
+}
+
+// PromoteKey 将指定密钥设为当前密钥。
+// 原当前密钥降级为可用状态，并在配置的宽限期内继续用于解密旧客户端的请求。
+// 首次轮换时 app_config.encrypt_secret 同样迁移为带宽限期的旧版密钥，并从调用方配置中清除。
+func (s *AppKeyService) PromoteKey(appID, keyID string) (*models.AppKey, error) {
+	var key models.AppKey
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定调用方的全部密钥，防止并发轮换产生多个当前密钥
+		var keys []models.AppKey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("app_id = ?", appID).Find(&keys).Error; err != nil {
+			return err
+		}
+
+		found := false
+		for _, k := range keys {
+			if k.KeyID == keyID {
+				key = k
+				found = true
+				break
+			}
+		}
+		if !found {
+			return gorm.ErrRecordNotFound
+		}
+		if key.Status == security.KeyStatusCurrent {
+			return nil
+		}
+		if key.Status != security.KeyStatusActive {
+			return ErrKeyNotPromotable
+		}
+
+		graceUntil := time.Now().Add(time.Duration(config.Cfg.Security.KeyGraceHours) * time.Hour)
+		if err := tx.Model(&models.AppKey{}).
+			Where("app_id = ? AND status = ?", appID, security.KeyStatusCurrent).
+			Updates(map[string]interface{}{"status": security.KeyStatusActive, "grace_until": graceUntil}).Error; err != nil {
+			return fmt.Errorf("降级原当前密钥失败: %w", err)
+		}
+
+		if err := migrateLegacyKey(tx, appID, graceUntil); err != nil {
+			return fmt.Errorf("迁移旧版密钥失败: %w", err)
+		}
+
+		key.Status = security.KeyStatusCurrent
+		key.GraceUntil = nil
+		return tx.Model(&key).Updates(map[string]interface{}{"status": key.Status, "grace_until": nil}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	security.InvalidateCredential(appID)
+	return &key, nil
+}
+
+// migrateLegacyKey 将 app_config.encrypt_secret 迁移为 app_key 中的旧版密钥并清除原字段。
+// 迁移后的密钥为可用状态，宽限期与被降级的当前密钥相同，之后可以像其他密钥一样退役。
+func migrateLegacyKey(tx *gorm.DB, appID string, graceUntil time.Time) error {
+	var app models.AppConfig
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("app_id = ?", appID).First(&app).Error; err != nil {
+		return err
+	}
+	if app.EncryptSecret == "" {
+		return nil
+	}
+
+	keyID, err := newKeyID()
+	if err != nil {
+		return err
+	}
+	legacy := models.AppKey{
+		KeyID:      keyID,
+		AppID:      appID,
+		Secret:     hex.EncodeToString([]byte(app.EncryptSecret)),
+		Status:     security.KeyStatusActive,
+		GraceUntil: &graceUntil,
+		Legacy:     true,
+	}
+	if err := tx.Create(&legacy).Error; err != nil {
+		return err
+	}
+	return tx.Model(&app).Update("encrypt_secret", "").Error
+}
+
+// RetireKey 立即退役指定密钥，退役后使用该密钥加密的请求将被拒绝
+func (s *AppKeyService) RetireKey(appID, keyID string) (*models.AppKey, error) {
+	var key models.AppKey
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("app_id = ? AND key_id = ?", appID, keyID).First(&key).Error; err != nil {
+			return err
+		}
+		if key.Status == security.KeyStatusCurrent {
+			return ErrRetireCurrentKey
+		}
+
+		key.Status = security.KeyStatusRetired
+		return tx.Model(&key).Update("status", key.Status).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	security.InvalidateCredential(appID)
+	return &key, nil
+}
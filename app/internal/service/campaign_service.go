@@ -0,0 +1,512 @@
+package service
+
+import (
+	"app/internal/models"
+	"app/pkg/database"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// defaultCampaignWithinDays 是 FIRST_IN_DAYS 活动未指定天数时的默认值
+const defaultCampaignWithinDays = 30
+
+var (
+	// ErrInvalidCampaignTrigger 表示活动的触发条件缺少必要的参数
+	ErrInvalidCampaignTrigger = errors.New("活动触发条件无效：NTH_VISIT 需要到店次数，FIRST_IN_DAYS 需要天数，QR_CODE 需要二维码类型或二维码ID")
+	// ErrInvalidCampaignPeriod 表示活动的结束时间早于开始时间
+	ErrInvalidCampaignPeriod = errors.New("活动结束时间必须晚于开始时间")
+	// ErrCampaignCouponMismatch 表示发放的优惠券不存在或不适用于活动的门店
+	ErrCampaignCouponMismatch = errors.New("优惠券不存在或不适用于活动的门店")
+	// ErrCampaignPlatformCoupon 表示门店运营试图在门店活动中发放全平台通用的优惠券
+	ErrCampaignPlatformCoupon = errors.New("只有平台管理员可以在门店活动中发放全平台通用的优惠券")
+	// ErrCampaignQrCodeMismatch 表示触发活动的二维码不存在或不属于活动的门店
+	ErrCampaignQrCodeMismatch = errors.New("二维码不存在或不属于活动的门店")
+	// ErrCampaignBudgetExhausted 表示活动预算已用完
+	ErrCampaignBudgetExhausted = errors.New("活动优惠券已发完")
+
+	// errCampaignAlreadyIssued 表示同一触发条件已经发放过，并发触发时出现
+	errCampaignAlreadyIssued = errors.New("活动已发放")
+)
+
+// CampaignService 提供了营销活动相关的业务逻辑：活动规则的管理，以及用户连接WIFI成功时按规则自动发放优惠券
+type CampaignService struct{}
+
+// parseCampaignTime 解析活动时间，格式为 "2006-01-02 15:04:05"，空字符串表示不限
+func parseCampaignTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("无效的时间格式: %w", err)
+	}
+	return &t, nil
+}
+
+// validateCampaign 校验活动的触发条件、时间和关联的优惠券、二维码。
+// 门店活动可以发放该门店的优惠券，allowPlatformCoupon 为 true（平台管理员操作）时也可以发放适用范围包含该门店的平台优惠券；
+// 全部门店的活动只能发放全部门店通用（没有适用范围）的优惠券
+func validateCampaign(tx *gorm.DB, campaign *models.Campaign, allowPlatformCoupon bool) error {
+	switch campaign.TriggerType {
+	case models.CampaignTriggerNthVisit:
+		if campaign.VisitCount < 1 {
+			return ErrInvalidCampaignTrigger
+		}
+	case models.CampaignTriggerFirstInDays:
+		if campaign.WithinDays < 1 {
+			return ErrInvalidCampaignTrigger
+		}
+	case models.CampaignTriggerQrCode:
+		if campaign.QrCodeType == "" && campaign.QrCodeID == "" {
+			return ErrInvalidCampaignTrigger
+		}
+	}
+	if campaign.StartTime != nil && campaign.EndTime != nil && !campaign.EndTime.After(*campaign.StartTime) {
+		return ErrInvalidCampaignPeriod
+	}
+
+	var coupon models.Coupon
+	err := tx.Select("coupon_id", "store_id").First(&coupon, campaign.CouponID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrCampaignCouponMismatch
+	}
+	if err != nil {
+		return err
+	}
+	// 活动的门店必须在优惠券的适用范围内，否则发放时每次都会领取失败
+	var store *models.Store
+	if campaign.StoreID != nil {
+		if store, err = loadStoreRegion(tx, *campaign.StoreID); err != nil {
+			return err
+		}
+	}
+	var count int64
+	if err := couponStoreFilter(tx.Model(&models.Coupon{}), store).
+		Where("coupon_id = ?", coupon.CouponID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrCampaignCouponMismatch
+	}
+	if coupon.StoreID == nil && campaign.StoreID != nil && !allowPlatformCoupon {
+		// 全平台通用的优惠券由平台承担成本，门店运营不能在自己的活动中发放
+		return ErrCampaignPlatformCoupon
+	}
+
+	if campaign.TriggerType == models.CampaignTriggerQrCode && campaign.QrCodeID != "" {
+		qrQuery := tx.Model(&models.QrCode{}).Where("qr_code_id = ?", campaign.QrCodeID)
+		if campaign.StoreID != nil {
+			qrQuery = qrQuery.Where("store_id = ?", *campaign.StoreID)
+		}
+		if err := qrQuery.Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrCampaignQrCodeMismatch
+		}
+	}
+	return nil
+}
+
+// CreateCampaignInput 定义了创建营销活动的输入
+type CreateCampaignInput struct {
+	CampaignName string `json:"campaign_name" binding:"required,max=100"`
+	StoreID      *uint  `json:"store_id"` // 为空表示全部门店，只有平台管理员可以创建
+	TriggerType  string `json:"trigger_type" binding:"required,oneof=FIRST_CONNECT NTH_VISIT FIRST_IN_DAYS QR_CODE"`
+	VisitCount   int    `json:"visit_count" binding:"gte=0"`                                          // NTH_VISIT：第几次到店时发放
+	WithinDays   int    `json:"within_days" binding:"gte=0"`                                          // FIRST_IN_DAYS：最近多少天内首次到店时发放，默认 30
+	QrCodeType   string `json:"qr_code_type" binding:"omitempty,oneof=STORE EVENT POSTER DESK OTHER"` // QR_CODE：限定二维码类型
+	QrCodeID     string `json:"qr_code_id"`                                                           // QR_CODE：限定二维码
+	CouponID     uint   `json:"coupon_id" binding:"required"`
+	Budget       int    `json:"budget" binding:"gte=0"` // 最多发放的优惠券数量，0 表示不限
+	StartTime    string `json:"start_time"`             // "2006-01-02 15:04:05"，为空表示立即开始
+	EndTime      string `json:"end_time"`               // 为空表示长期有效
+	Remark       string `json:"remark" binding:"max=255"`
+
+	AllowPlatformCoupon bool `json:"-"` // 是否允许门店活动发放全平台通用的优惠券，由调用方按角色设置，只有平台管理员可以
+}
+
+// CreateCampaign 创建一个营销活动，创建后立即启用
+func (s *CampaignService) CreateCampaign(input *CreateCampaignInput) (*models.Campaign, error) {
+	startTime, err := parseCampaignTime(input.StartTime)
+	if err != nil {
+		return nil, err
+	}
+	endTime, err := parseCampaignTime(input.EndTime)
+	if err != nil {
+		return nil, err
+	}
+
+	campaign := models.Campaign{
+		CampaignName: input.CampaignName,
+		StoreID:      input.StoreID,
+		TriggerType:  input.TriggerType,
+		CouponID:     input.CouponID,
+		Budget:       input.Budget,
+		StartTime:    startTime,
+		EndTime:      endTime,
+		Status:       1,
+		Remark:       input.Remark,
+	}
+	// 只保留触发条件用到的参数
+	switch campaign.TriggerType {
+	case models.CampaignTriggerNthVisit:
+		campaign.VisitCount = input.VisitCount
+	case models.CampaignTriggerFirstInDays:
+		campaign.WithinDays = input.WithinDays
+		if campaign.WithinDays == 0 {
+			campaign.WithinDays = defaultCampaignWithinDays
+		}
+	case models.CampaignTriggerQrCode:
+		campaign.QrCodeType = input.QrCodeType
+		campaign.QrCodeID = input.QrCodeID
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := validateCampaign(tx, &campaign, input.AllowPlatformCoupon); err != nil {
+			return err
+		}
+		return tx.Create(&campaign).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+// GetCampaignByID 根据ID获取营销活动
+func (s *CampaignService) GetCampaignByID(id uint) (*models.Campaign, error) {
+	var campaign models.Campaign
+	err := database.DB.WithContext(context.Background()).First(&campaign, id).Error
+	return &campaign, err
+}
+
+// GetCampaignsInput 定义了查询营销活动列表的输入
+type GetCampaignsInput struct {
+	StoreID     *uint  `form:"store_id"`
+	TriggerType string `form:"trigger_type"`
+	Status      *int8  `form:"status"`
+	Page        int    `form:"page"`
+	PageSize    int    `form:"pageSize"`
+}
+
+// GetCampaigns 查询营销活动列表（分页和过滤）
+func (s *CampaignService) GetCampaigns(input *GetCampaignsInput) ([]models.Campaign, int64, error) {
+	var campaigns []models.Campaign
+	var total int64
+
+	db := database.DB.WithContext(context.Background()).Model(&models.Campaign{})
+	if input.StoreID != nil {
+		db = db.Where("store_id = ?", *input.StoreID)
+	}
+	if input.TriggerType != "" {
+		db = db.Where("trigger_type = ?", input.TriggerType)
+	}
+	if input.Status != nil {
+		db = db.Where("status = ?", *input.Status)
+	}
+
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if input.Page <= 0 {
+		input.Page = 1
+	}
+	if input.PageSize <= 0 {
+		input.PageSize = 10
+	}
+	offset := (input.Page - 1) * input.PageSize
+
+	err := db.Order("created_at DESC").Offset(offset).Limit(input.PageSize).Find(&campaigns).Error
+	return campaigns, total, err
+}
+
+// UpdateCampaignInput 定义了更新营销活动的输入，活动的门店和触发条件类型不能修改
+type UpdateCampaignInput struct {
+	CampaignName string  `json:"campaign_name" binding:"max=100"`
+	VisitCount   *int    `json:"visit_count"`
+	WithinDays   *int    `json:"within_days"`
+	QrCodeType   *string `json:"qr_code_type" binding:"omitempty,oneof='' STORE EVENT POSTER DESK OTHER"`
+	QrCodeID     *string `json:"qr_code_id"`
+	CouponID     *uint   `json:"coupon_id"`
+	Budget       *int    `json:"budget" binding:"omitempty,gte=0"` // 低于已发放数量时不再发放
+	StartTime    *string `json:"start_time"`                       // 空字符串表示不限
+	EndTime      *string `json:"end_time"`
+	Status       *int8   `json:"status" binding:"omitempty,oneof=0 1"`
+	Remark       *string `json:"remark"`
+
+	AllowPlatformCoupon bool `json:"-"` // 是否允许修改发放全平台通用优惠券的门店活动的优惠券或预算，由调用方按角色设置，只有平台管理员可以
+}
+
+// UpdateCampaign 更新一个营销活动
+func (s *CampaignService) UpdateCampaign(id uint, input *UpdateCampaignInput) (*models.Campaign, error) {
+	var campaign models.Campaign
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&campaign, id).Error; err != nil {
+			return err
+		}
+
+		if input.CampaignName != "" {
+			campaign.CampaignName = input.CampaignName
+		}
+		if input.VisitCount != nil && campaign.TriggerType == models.CampaignTriggerNthVisit {
+			campaign.VisitCount = *input.VisitCount
+		}
+		if input.WithinDays != nil && campaign.TriggerType == models.CampaignTriggerFirstInDays {
+			campaign.WithinDays = *input.WithinDays
+		}
+		if input.QrCodeType != nil && campaign.TriggerType == models.CampaignTriggerQrCode {
+			campaign.QrCodeType = *input.QrCodeType
+		}
+		if input.QrCodeID != nil && campaign.TriggerType == models.CampaignTriggerQrCode {
+			campaign.QrCodeID = *input.QrCodeID
+		}
+		// 只在修改优惠券或预算时校验能否发放全平台通用的优惠券，门店运营仍可以停用平台管理员为其门店创建的活动
+		allowPlatformCoupon := input.AllowPlatformCoupon || (input.CouponID == nil && input.Budget == nil)
+		if input.CouponID != nil {
+			campaign.CouponID = *input.CouponID
+		}
+		if input.Budget != nil {
+			campaign.Budget = *input.Budget
+		}
+		if input.StartTime != nil {
+			startTime, err := parseCampaignTime(*input.StartTime)
+			if err != nil {
+				return err
+			}
+			campaign.StartTime = startTime
+		}
+		if input.EndTime != nil {
+			endTime, err := parseCampaignTime(*input.EndTime)
+			if err != nil {
+				return err
+			}
+			campaign.EndTime = endTime
+		}
+		if input.Status != nil {
+			campaign.Status = *input.Status
+		}
+		if input.Remark != nil {
+			campaign.Remark = *input.Remark
+		}
+
+		if err := validateCampaign(tx, &campaign, allowPlatformCoupon); err != nil {
+			return err
+		}
+		// 已发放数量由发放流程原子地维护，不随活动的其他字段一起保存
+		return tx.Omit("issued_count").Save(&campaign).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+// DeleteCampaign 软删除一个营销活动，已发放的优惠券不受影响
+func (s *CampaignService) DeleteCampaign(id uint) error {
+	result := database.DB.Delete(&models.Campaign{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CampaignReward 是连接WIFI成功时一个活动的发放结果
+type CampaignReward struct {
+	CampaignID   uint               `json:"campaign_id"`
+	CampaignName string             `json:"campaign_name"`
+	CouponID     uint               `json:"coupon_id"`
+	Issued       bool               `json:"issued"`
+	UserCoupon   *models.UserCoupon `json:"user_coupon,omitempty"` // 发放成功时为用户获得的优惠券
+	Reason       string             `json:"reason,omitempty"`      // 满足条件但未发放的原因，例如优惠券已领完或已达到领取上限
+}
+
+// visitHistory 是用户此前在门店连接WIFI成功的记录汇总，不包括本次连接
+type visitHistory struct {
+	Days            int64      // 连接成功的自然日数，即到店次数
+	LastConnectedAt *time.Time // 最近一次连接成功的时间，从未连接成功时为空
+}
+
+// newVisitHistory 汇总连接成功的时间，按 loc 时区的自然日计算到店次数。
+// loc 应与 campaignTriggerKey 判断当天是否已到店所用的时区相同，不使用数据库会话的时区
+func newVisitHistory(connectedAt []time.Time, loc *time.Location) *visitHistory {
+	var history visitHistory
+	days := make(map[string]bool)
+	for _, t := range connectedAt {
+		days[t.In(loc).Format(time.DateOnly)] = true
+		if history.LastConnectedAt == nil || t.After(*history.LastConnectedAt) {
+			history.LastConnectedAt = &t
+		}
+	}
+	history.Days = int64(len(days))
+	return &history
+}
+
+// loadVisitHistory 汇总用户此前在门店连接WIFI成功的记录，到店次数按 loc 时区的自然日计算。
+// 从主库读取，避免从库延迟导致刚刚上报的连接被遗漏
+func loadVisitHistory(scanLog *models.ScanLog, loc *time.Location) (*visitHistory, error) {
+	var connectedAt []time.Time
+	err := database.DB.Clauses(dbresolver.Write).Model(&models.ScanLog{}).
+		Where("store_id = ? AND user_union_id = ? AND success_flag = ? AND log_id <> ?",
+			scanLog.StoreID, scanLog.UserUnionID, true, scanLog.LogID).
+		Pluck("scan_time", &connectedAt).Error
+	if err != nil {
+		return nil, err
+	}
+	return newVisitHistory(connectedAt, loc), nil
+}
+
+// campaignTriggerKey 判断本次连接是否满足活动的触发条件，满足时返回标识这次触发的键。
+// 键中包含门店，全部门店的活动在每个门店分别触发；同一个键对同一用户只发放一次
+func campaignTriggerKey(campaign *models.Campaign, scanLog *models.ScanLog, history *visitHistory, now time.Time) (string, bool) {
+	switch campaign.TriggerType {
+	case models.CampaignTriggerFirstConnect:
+		if history.LastConnectedAt == nil {
+			return fmt.Sprintf("first:%d", scanLog.StoreID), true
+		}
+	case models.CampaignTriggerNthVisit:
+		// 同一天多次连接算作一次到店，只在当天第一次连接时计数
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		visitedToday := history.LastConnectedAt != nil && !history.LastConnectedAt.Before(today)
+		if !visitedToday && history.Days+1 == int64(campaign.VisitCount) {
+			return fmt.Sprintf("visit:%d:%d", scanLog.StoreID, campaign.VisitCount), true
+		}
+	case models.CampaignTriggerFirstInDays:
+		if history.LastConnectedAt == nil || history.LastConnectedAt.Before(now.AddDate(0, 0, -campaign.WithinDays)) {
+			return fmt.Sprintf("days:%d:%s", scanLog.StoreID, now.Format("20060102")), true
+		}
+	case models.CampaignTriggerQrCode:
+		if scanLog.QrCodeType == "" && scanLog.QrCodeID == "" {
+			return "", false
+		}
+		if (campaign.QrCodeType == "" || campaign.QrCodeType == scanLog.QrCodeType) &&
+			(campaign.QrCodeID == "" || campaign.QrCodeID == scanLog.QrCodeID) {
+			return fmt.Sprintf("scan:%d", scanLog.LogID), true
+		}
+	}
+	return "", false
+}
+
+// issueCampaignRewards 在用户连接WIFI成功后按适用于门店的活动规则发放优惠券，返回满足触发条件的活动的发放结果。
+// 每个活动在独立的事务中发放，一个活动发放失败不影响其他活动，也不影响连接结果的上报
+func issueCampaignRewards(scanLog *models.ScanLog) []CampaignReward {
+	if scanLog.UserUnionID == "" {
+		return nil
+	}
+
+	now := time.Now()
+	var campaigns []models.Campaign
+	err := database.DB.Clauses(dbresolver.Write).
+		Where("status = ? AND (store_id IS NULL OR store_id = ?)", 1, scanLog.StoreID).
+		Where("(start_time IS NULL OR start_time <= ?) AND (end_time IS NULL OR end_time > ?)", now, now).
+		Where("budget = 0 OR issued_count < budget"). // 预算已用完的活动不再尝试领取，发放时仍以扣减预算的条件更新为准
+		Order("campaign_id").
+		Find(&campaigns).Error
+	if err != nil {
+		log.Printf("ERROR: 查询营销活动失败: %v", err)
+		return nil
+	}
+	if len(campaigns) == 0 {
+		return nil
+	}
+
+	history, err := loadVisitHistory(scanLog, now.Location())
+	if err != nil {
+		log.Printf("ERROR: 查询用户 %s 在门店 %d 的到店记录失败: %v", scanLog.UserUnionID, scanLog.StoreID, err)
+		return nil
+	}
+
+	var rewards []CampaignReward
+	for i := range campaigns {
+		campaign := &campaigns[i]
+		key, ok := campaignTriggerKey(campaign, scanLog, history, now)
+		if !ok {
+			continue
+		}
+
+		userCoupon, err := issueCampaignCoupon(campaign, scanLog, key)
+		if errors.Is(err, errCampaignAlreadyIssued) {
+			continue
+		}
+		reward := CampaignReward{
+			CampaignID:   campaign.CampaignID,
+			CampaignName: campaign.CampaignName,
+			CouponID:     campaign.CouponID,
+			Issued:       err == nil,
+			UserCoupon:   userCoupon,
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrCampaignBudgetExhausted), errors.Is(err, ErrCouponSoldOut),
+			errors.Is(err, ErrClaimLimitReached), errors.Is(err, ErrCouponDisabled), errors.Is(err, ErrCouponOutOfPeriod),
+			errors.Is(err, ErrCouponStoreMismatch):
+			reward.Reason = err.Error()
+		default:
+			log.Printf("ERROR: 活动 %d 为用户 %s 发放优惠券失败: %v", campaign.CampaignID, scanLog.UserUnionID, err)
+			reward.Reason = "发放失败"
+		}
+		rewards = append(rewards, reward)
+	}
+	return rewards
+}
+
+// issueCampaignCoupon 在事务中为一次触发发放活动的优惠券：通过与用户领取相同的流程领取优惠券，记录发放，最后扣减活动预算。
+// 同一触发键已经发放过时返回 errCampaignAlreadyIssued，预算用完时返回 ErrCampaignBudgetExhausted，领取失败时返回领取的错误
+func issueCampaignCoupon(campaign *models.Campaign, scanLog *models.ScanLog, key string) (*models.UserCoupon, error) {
+	var userCoupon *models.UserCoupon
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		storeID := scanLog.StoreID
+		receiveLog, err := claimCoupon(tx, &LogActionInput{
+			CouponID:    campaign.CouponID,
+			UserUnionID: scanLog.UserUnionID,
+			StoreID:     &storeID,
+		}, fmt.Sprintf("活动「%s」自动发放", campaign.CampaignName))
+		if err != nil {
+			return err
+		}
+		userCoupon = receiveLog.UserCoupon
+
+		issue := models.CampaignIssue{
+			CampaignID:   campaign.CampaignID,
+			UserUnionID:  scanLog.UserUnionID,
+			TriggerKey:   key,
+			StoreID:      scanLog.StoreID,
+			ScanLogID:    scanLog.LogID,
+			CouponLogID:  receiveLog.LogID,
+			UserCouponID: userCoupon.UserCouponID,
+		}
+		if err := tx.Create(&issue).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return errCampaignAlreadyIssued
+			}
+			return err
+		}
+
+		// 扣减预算放在最后，缩短活动行的锁定时间
+		res := tx.Model(&models.Campaign{}).
+			Where("campaign_id = ? AND (budget = 0 OR issued_count < budget)", campaign.CampaignID).
+			UpdateColumn("issued_count", gorm.Expr("issued_count + 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrCampaignBudgetExhausted
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return userCoupon, nil
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"app/internal/models"
+	"testing"
+	"time"
+)
+
+// cst 是测试使用的门店时区
+var cst = time.FixedZone("CST", 8*3600)
+
+func TestCampaignTriggerKey(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 30, 0, 0, cst)
+	// at 返回相对 now 的第 days 天 hour:minute 的时间
+	at := func(days, hour, minute int) *time.Time {
+		v := time.Date(now.Year(), now.Month(), now.Day()+days, hour, minute, 0, 0, cst)
+		return &v
+	}
+	scanLog := &models.ScanLog{LogID: 99, StoreID: 7, QrCodeType: "DESK", QrCodeID: "qr-1"}
+
+	tests := []struct {
+		name     string
+		campaign models.Campaign
+		history  visitHistory
+		wantKey  string
+		wantOK   bool
+	}{
+		// FIRST_CONNECT
+		{"首次连接", models.Campaign{TriggerType: models.CampaignTriggerFirstConnect},
+			visitHistory{}, "first:7", true},
+		{"此前连接过不是首次连接", models.Campaign{TriggerType: models.CampaignTriggerFirstConnect},
+			visitHistory{Days: 1, LastConnectedAt: at(-30, 10, 0)}, "", false},
+		{"当天已连接过不是首次连接", models.Campaign{TriggerType: models.CampaignTriggerFirstConnect},
+			visitHistory{Days: 1, LastConnectedAt: at(0, 8, 0)}, "", false},
+
+		// NTH_VISIT
+		{"首次到店即第 1 次", models.Campaign{TriggerType: models.CampaignTriggerNthVisit, VisitCount: 1},
+			visitHistory{}, "visit:7:1", true},
+		{"第 3 次到店", models.Campaign{TriggerType: models.CampaignTriggerNthVisit, VisitCount: 3},
+			visitHistory{Days: 2, LastConnectedAt: at(-1, 20, 0)}, "visit:7:3", true},
+		{"第 2 次到店不满足第 3 次", models.Campaign{TriggerType: models.CampaignTriggerNthVisit, VisitCount: 3},
+			visitHistory{Days: 1, LastConnectedAt: at(-1, 20, 0)}, "", false},
+		{"第 4 次到店不满足第 3 次", models.Campaign{TriggerType: models.CampaignTriggerNthVisit, VisitCount: 3},
+			visitHistory{Days: 3, LastConnectedAt: at(-1, 20, 0)}, "", false},
+		{"当天再次连接不计为新的到店", models.Campaign{TriggerType: models.CampaignTriggerNthVisit, VisitCount: 3},
+			visitHistory{Days: 2, LastConnectedAt: at(0, 0, 0)}, "", false},
+		{"前一天深夜连接不算当天", models.Campaign{TriggerType: models.CampaignTriggerNthVisit, VisitCount: 3},
+			visitHistory{Days: 2, LastConnectedAt: at(-1, 23, 59)}, "visit:7:3", true},
+
+		// FIRST_IN_DAYS
+		{"从未到店", models.Campaign{TriggerType: models.CampaignTriggerFirstInDays, WithinDays: 30},
+			visitHistory{}, "days:7:20260310", true},
+		{"超过天数未到店", models.Campaign{TriggerType: models.CampaignTriggerFirstInDays, WithinDays: 30},
+			visitHistory{Days: 4, LastConnectedAt: at(-31, 9, 0)}, "days:7:20260310", true},
+		{"恰好在天数边界上", models.Campaign{TriggerType: models.CampaignTriggerFirstInDays, WithinDays: 30},
+			visitHistory{Days: 4, LastConnectedAt: at(-30, 9, 30)}, "", false},
+		{"天数内到过店", models.Campaign{TriggerType: models.CampaignTriggerFirstInDays, WithinDays: 30},
+			visitHistory{Days: 4, LastConnectedAt: at(-29, 9, 0)}, "", false},
+		{"当天已到过店", models.Campaign{TriggerType: models.CampaignTriggerFirstInDays, WithinDays: 1},
+			visitHistory{Days: 1, LastConnectedAt: at(0, 8, 0)}, "", false},
+
+		// QR_CODE
+		{"二维码类型匹配", models.Campaign{TriggerType: models.CampaignTriggerQrCode, QrCodeType: "DESK"},
+			visitHistory{Days: 5, LastConnectedAt: at(0, 8, 0)}, "scan:99", true},
+		{"二维码不匹配", models.Campaign{TriggerType: models.CampaignTriggerQrCode, QrCodeID: "qr-2"},
+			visitHistory{}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := campaignTriggerKey(&tt.campaign, scanLog, &tt.history, now)
+			if key != tt.wantKey || ok != tt.wantOK {
+				t.Errorf("campaignTriggerKey() = (%q, %v)，应为 (%q, %v)", key, ok, tt.wantKey, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCampaignTriggerKeyWithoutQrCode(t *testing.T) {
+	campaign := models.Campaign{TriggerType: models.CampaignTriggerQrCode, QrCodeType: "DESK"}
+	if key, ok := campaignTriggerKey(&campaign, &models.ScanLog{LogID: 1, StoreID: 7}, &visitHistory{}, time.Now()); ok {
+		t.Errorf("没有扫码的连接触发了二维码活动: %q", key)
+	}
+}
+
+func TestNewVisitHistory(t *testing.T) {
+	utc := func(day, hour int) time.Time { return time.Date(2026, 3, day, hour, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name      string
+		times     []time.Time
+		loc       *time.Location
+		wantDays  int64
+		wantLast  time.Time
+		wantEmpty bool
+	}{
+		{"没有连接记录", nil, cst, 0, time.Time{}, true},
+		{"同一天多次连接算一次", []time.Time{utc(1, 2), utc(1, 5), utc(1, 9)}, cst, 1, utc(1, 9), false},
+		// UTC 3 月 1 日 15 点和 17 点分别是 CST 3 月 1 日 23 点和 3 月 2 日 1 点
+		{"按门店时区跨过零点算两天", []time.Time{utc(1, 15), utc(1, 17)}, cst, 2, utc(1, 17), false},
+		{"按 UTC 计算是同一天", []time.Time{utc(1, 15), utc(1, 17)}, time.UTC, 1, utc(1, 17), false},
+		{"记录无序时取最近一次", []time.Time{utc(3, 1), utc(5, 1), utc(4, 1)}, cst, 3, utc(5, 1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := newVisitHistory(tt.times, tt.loc)
+			if history.Days != tt.wantDays {
+				t.Errorf("Days = %d，应为 %d", history.Days, tt.wantDays)
+			}
+			switch {
+			case tt.wantEmpty && history.LastConnectedAt != nil:
+				t.Errorf("LastConnectedAt = %v，应为空", *history.LastConnectedAt)
+			case !tt.wantEmpty && (history.LastConnectedAt == nil || !history.LastConnectedAt.Equal(tt.wantLast)):
+				t.Errorf("LastConnectedAt = %v，应为 %v", history.LastConnectedAt, tt.wantLast)
+			}
+		})
+	}
+}
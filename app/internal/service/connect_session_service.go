@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"app/config"
+	"app/internal/models"
+	"app/pkg/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 会话超时关闭时写入扫码日志的失败原因
+const (
+	ConnectTimeoutReasonCode    = "SESSION_TIMEOUT"
+	ConnectTimeoutReasonMessage = "连接会话超时，未上报连接结果"
+)
+
+var (
+	// ErrInvalidConnectTicket 表示连接票据与扫码日志不匹配
+	ErrInvalidConnectTicket = errors.New("无效的连接票据")
+	// ErrConnectSessionClosed 表示连接会话已上报过结果
+	ErrConnectSessionClosed = errors.New("连接会话已结束")
+	// ErrConnectSessionTimedOut 表示连接会话已超时，需要重新扫码
+	ErrConnectSessionTimedOut = errors.New("连接会话已超时，请重新扫码")
+	// ErrCredentialNotIssued 表示尚未获取WIFI密码就上报了连接成功
+	ErrCredentialNotIssued = errors.New("尚未获取WIFI密码，不能上报连接成功")
+	// ErrNotConnected 表示该扫码日志没有连接成功，无需断开
+	ErrNotConnected = errors.New("该扫码日志没有连接成功的记录")
+)
+
+// ConnectSessionService 提供了扫码连接会话相关的业务逻辑。
+// 创建扫码日志时同时创建会话并签发连接票据，获取WIFI密码和上报连接结果都必须出示该票据。
+type ConnectSessionService struct{}
+
+// hashConnectTicket 返回连接票据的摘要，数据库中只保存摘要
+func hashConnectTicket(ticket string) string {
+	sum := sha256.Sum256([]byte(ticket))
+	return hex.EncodeToString(sum[:])
+}
+
+// openConnectSession 在事务中为扫码日志创建连接会话，返回票据明文及其过期时间
+func openConnectSession(tx *gorm.DB, scanLog *models.ScanLog) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(buf)
+	expiresAt := time.Now().Add(config.Cfg.Security.ConnectSessionTimeout)
+
+	session := models.ConnectSession{
+		LogID:       scanLog.LogID,
+		TicketHash:  hashConnectTicket(ticket),
+		StoreID:     scanLog.StoreID,
+		UserUnionID: scanLog.UserUnionID,
+		Status:      models.ConnectSessionOpen,
+		ExpiresAt:   expiresAt,
+	}
+	if err := tx.Create(&session).Error; err != nil {
+		return "", time.Time{}, err
+	}
+	return ticket, expiresAt, nil
+}
+
+// findConnectSession 在事务中锁定扫码日志对应的连接会话并校验票据，不校验会话状态。
+// userUnionID 不为空时会话必须属于该用户，否则与不存在一样返回 gorm.ErrRecordNotFound。
+func findConnectSession(tx *gorm.DB, logID uint64, userUnionID, ticket string) (*models.ConnectSession, error) {
+	var session models.ConnectSession
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("log_id = ?", logID)
+	if userUnionID != "" {
+		query = query.Where("user_union_id = ?", userUnionID)
+	}
+	if err := query.First(&session).Error; err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(session.TicketHash), []byte(hashConnectTicket(ticket))) != 1 {
+		return nil, ErrInvalidConnectTicket
+	}
+	return &session, nil
+}
+
+// lockConnectSession 在事务中锁定扫码日志对应的连接会话，并校验票据以及会话仍在进行中
+func lockConnectSession(tx *gorm.DB, logID uint64, userUnionID, ticket string) (*models.ConnectSession, error) {
+	session, err := findConnectSession(tx, logID, userUnionID, ticket)
+	if err != nil {
+		return nil, err
+	}
+	switch session.Status {
+	case models.ConnectSessionOpen, models.ConnectSessionCredentialIssued:
+	case models.ConnectSessionTimedOut:
+		return nil, ErrConnectSessionTimedOut
+	default:
+		return nil, ErrConnectSessionClosed
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrConnectSessionTimedOut
+	}
+	return session, nil
+}
+
+// countActiveConnections 统计每个WIFI当前占用的连接数。
+// 占用包括连接成功且未断开、未超过占用时长的会话，以及已获取密码、正在连接的会话。
+func countActiveConnections(db *gorm.DB, wifiIDs []uint) (map[uint]int, error) {
+	counts := make(map[uint]int, len(wifiIDs))
+	if len(wifiIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		WifiID uint
+		Count  int
+	}
+	now := time.Now()
+	err := db.Model(&models.ConnectSession{}).
+		Select("wifi_id, count(*) as count").
+		Where("wifi_id IN ?", wifiIDs).
+		Where("(status = ? AND expires_at > ?) OR (status = ? AND connected_until > ?)",
+			models.ConnectSessionCredentialIssued, now, models.ConnectSessionSucceeded, now).
+		Group("wifi_id").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.WifiID] = row.Count
+	}
+	return counts, nil
+}
+
+// CloseTimedOutSessions 关闭已超时但仍未上报结果的连接会话，并将对应的扫码日志记为连接失败。
+// 每次最多处理 batchSize 个会话，返回关闭的数量。多个实例同时执行时会跳过已被其他实例锁定的会话。
+func (s *ConnectSessionService) CloseTimedOutSessions(batchSize int) (int, error) {
+	var closed int
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var sessions []models.ConnectSession
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Select("session_id", "log_id").
+			Where("status IN ? AND expires_at < ?", []string{models.ConnectSessionOpen, models.ConnectSessionCredentialIssued}, now).
+			Limit(batchSize).
+			Find(&sessions).Error; err != nil {
+			return err
+		}
+		if len(sessions) == 0 {
+			return nil
+		}
+
+		sessionIDs := make([]uint64, len(sessions))
+		logIDs := make([]uint64, len(sessions))
+		for i, session := range sessions {
+			sessionIDs[i] = session.SessionID
+			logIDs[i] = session.LogID
+		}
+
+		if err := tx.Model(&models.ConnectSession{}).
+			Where("session_id IN ?", sessionIDs).
+			Updates(map[string]interface{}{"status": models.ConnectSessionTimedOut, "closed_at": now}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ScanLog{}).
+			Where("log_id IN ?", logIDs).
+			UpdateColumns(map[string]interface{}{
+				"success_flag":        false,
+				"fail_reason_code":    ConnectTimeoutReasonCode,
+				"fail_reason_message": ConnectTimeoutReasonMessage,
+			}).Error; err != nil {
+			return err
+		}
+		closed = len(sessions)
+		return nil
+	})
+	return closed, err
+}
+
+// StartSweeper 启动后台任务，每隔 interval 关闭一次超时的连接会话，ctx 取消后退出
+func (s *ConnectSessionService) StartSweeper(ctx context.Context, interval time.Duration) {
+	const batchSize = 500
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			for {
+				closed, err := s.CloseTimedOutSessions(batchSize)
+				if err != nil {
+					log.Printf("ERROR: 关闭超时的连接会话失败: %v", err)
+					break
+				}
+				if closed > 0 {
+					log.Printf("已关闭 %d 个超时的连接会话", closed)
+				}
+				if closed < batchSize {
+					break
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"app/config"
+	"app/internal/models"
+	"app/pkg/database"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+// 本包的测试需要设置 GIN_MODE=test，使用测试环境的默认配置而不是加载配置文件：
+//
+//	GIN_MODE=test go test ./internal/service
+//
+// 领券的并发测试还需要一个可写的 MySQL 数据库，通过环境变量 WIFICITY_TEST_DSN 指定，未设置时跳过：
+//
+//	GIN_MODE=test WIFICITY_TEST_DSN='user:pass@tcp(127.0.0.1:3306)/wifi_city_test?charset=utf8mb4&parseTime=True&loc=Local' \
+//		go test ./internal/service -run TestReceiveCoupon -bench ReceiveCoupon -v
+//
+// 测试会同步表结构，创建的优惠券和领取记录在结束时删除。
+
+var testDBOnce sync.Once
+
+// setupTestDB 连接 WIFICITY_TEST_DSN 指定的数据库，未设置时跳过测试
+func setupTestDB(tb testing.TB) {
+	dsn := os.Getenv("WIFICITY_TEST_DSN")
+	if dsn == "" {
+		tb.Skip("未设置 WIFICITY_TEST_DSN，跳过需要数据库的测试")
+	}
+	testDBOnce.Do(func() {
+		config.Cfg.Database.Master.DSN = dsn
+		config.Cfg.Database.Slaves = []config.DBSource{{DSN: dsn}}
+		config.Cfg.Database.Settings.MaxOpenConns = 64
+		config.Cfg.Database.Settings.MaxIdleConns = 64
+		database.Init()
+		database.DB.Logger = logger.Discard
+		database.Migrate(models.AllModels()...)
+	})
+}
+
+// createTestCoupon 创建一个正在生效的测试优惠券，测试结束时删除它和相关的记录
+func createTestCoupon(tb testing.TB, totalQuantity, limitPerUser int) *models.Coupon {
+	now := time.Now()
+	coupon := models.Coupon{
+		CouponName:        "并发领取测试",
+		CouponCode:        fmt.Sprintf("T%d", now.UnixNano()),
+		CouponType:        "CASH",
+		Value:             5,
+		UsageLimitPerUser: limitPerUser,
+		TotalQuantity:     totalQuantity,
+		StartTime:         now.Add(-time.Hour),
+		EndTime:           now.Add(time.Hour),
+		Status:            1,
+	}
+	if err := database.DB.Create(&coupon).Error; err != nil {
+		tb.Fatalf("创建测试优惠券失败: %v", err)
+	}
+	tb.Cleanup(func() {
+		id := coupon.CouponID
+		database.DB.Where("coupon_id = ?", id).Delete(&models.UserCoupon{})
+		database.DB.Where("coupon_id = ?", id).Delete(&models.CouponLog{})
+		database.DB.Where("coupon_id = ?", id).Delete(&models.CouponStockBucket{})
+		database.DB.Unscoped().Delete(&models.Coupon{}, id)
+	})
+	return &coupon
+}
+
+// claimConcurrently 以 workers 个并发请求领取优惠券，第 i 个请求的用户为 users 个测试用户中的第 i % users 个，
+// 返回成功的次数。除已领完和已达领取上限以外的错误都会使测试失败。
+func claimConcurrently(t *testing.T, coupon *models.Coupon, workers, users int) int64 {
+	s := &CouponLogService{}
+	var succeeded int64
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			_, err := s.CreateCouponLog(&LogActionInput{
+				CouponID:    coupon.CouponID,
+				UserUnionID: fmt.Sprintf("claim-test-%d-%d", coupon.CouponID, i%users),
+				ActionType:  "RECEIVE",
+			})
+			switch {
+			case err == nil:
+				atomic.AddInt64(&succeeded, 1)
+			case errors.Is(err, ErrCouponSoldOut), errors.Is(err, ErrClaimLimitReached):
+			default:
+				t.Errorf("领取失败: %v", err)
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return succeeded
+}
+
+// assertClaims 校验领取记录：用户优惠券和成功的领取日志都等于 want，且每个用户最多领取 limitPerUser 张
+func assertClaims(t *testing.T, coupon *models.Coupon, want int64, limitPerUser int) {
+	var userCoupons, receiveLogs, overLimit int64
+	database.DB.Model(&models.UserCoupon{}).Where("coupon_id = ?", coupon.CouponID).Count(&userCoupons)
+	database.DB.Model(&models.CouponLog{}).
+		Where("coupon_id = ? AND action_type = 'RECEIVE' AND status = 1", coupon.CouponID).
+		Count(&receiveLogs)
+	database.DB.Raw(`SELECT count(*) FROM (SELECT user_union_id FROM user_coupon WHERE coupon_id = ?
+		GROUP BY user_union_id HAVING count(*) > ?) t`, coupon.CouponID, limitPerUser).Scan(&overLimit)
+
+	if userCoupons != want {
+		t.Errorf("用户优惠券数量 = %d, 期望 %d", userCoupons, want)
+	}
+	if receiveLogs != want {
+		t.Errorf("领取日志数量 = %d, 期望 %d", receiveLogs, want)
+	}
+	if overLimit != 0 {
+		t.Errorf("%d 个用户超过了每人限领数量 %d", overLimit, limitPerUser)
+	}
+}
+
+func TestReceiveCouponConcurrentNoOverIssue(t *testing.T) {
+	setupTestDB(t)
+
+	const (
+		stock   = 100
+		workers = 3000
+		users   = 1000 // 每个用户并发领取 3 次，限领 2 张
+		limit   = 2
+	)
+	coupon := createTestCoupon(t, stock, limit)
+
+	if got := claimConcurrently(t, coupon, workers, users); got != stock {
+		t.Errorf("成功领取 %d 次, 期望 %d", got, stock)
+	}
+	var issued int
+	database.DB.Model(&models.Coupon{}).Where("coupon_id = ?", coupon.CouponID).Pluck("issued_quantity", &issued)
+	if issued != stock {
+		t.Errorf("issued_quantity = %d, 期望 %d", issued, stock)
+	}
+	assertClaims(t, coupon, stock, limit)
+}
+
+func TestReceiveCouponConcurrentStockBuckets(t *testing.T) {
+	setupTestDB(t)
+
+	const (
+		stock   = 100
+		buckets = 8
+		workers = 3000
+		users   = 3000
+	)
+	coupon := createTestCoupon(t, stock, 1)
+	if _, err := (&CouponService{}).UpdateCouponStockBuckets(coupon.CouponID, buckets); err != nil {
+		t.Fatalf("设置库存分桶失败: %v", err)
+	}
+
+	if got := claimConcurrently(t, coupon, workers, users); got != stock {
+		t.Errorf("成功领取 %d 次, 期望 %d", got, stock)
+	}
+	assertClaims(t, coupon, stock, 1)
+
+	// 取消分桶后各分桶的发行量合并到优惠券
+	merged, err := (&CouponService{}).UpdateCouponStockBuckets(coupon.CouponID, 0)
+	if err != nil {
+		t.Fatalf("取消库存分桶失败: %v", err)
+	}
+	if merged.IssuedQuantity != stock {
+		t.Errorf("合并后 issued_quantity = %d, 期望 %d", merged.IssuedQuantity, stock)
+	}
+}
+
+// BenchmarkReceiveCoupon 比较不分桶和分桶时同一优惠券的并发领取吞吐量
+func BenchmarkReceiveCoupon(b *testing.B) {
+	setupTestDB(b)
+
+	for _, buckets := range []int{0, 16} {
+		b.Run(fmt.Sprintf("buckets=%d", buckets), func(b *testing.B) {
+			coupon := createTestCoupon(b, 1_000_000_000, 0)
+			if buckets > 0 {
+				if _, err := (&CouponService{}).UpdateCouponStockBuckets(coupon.CouponID, buckets); err != nil {
+					b.Fatalf("设置库存分桶失败: %v", err)
+				}
+			}
+			s := &CouponLogService{}
+			var n int64
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_, err := s.CreateCouponLog(&LogActionInput{
+						CouponID:    coupon.CouponID,
+						UserUnionID: fmt.Sprintf("claim-bench-%d", atomic.AddInt64(&n, 1)),
+						ActionType:  "RECEIVE",
+					})
+					if err != nil {
+						b.Errorf("领取失败: %v", err)
+					}
+				}
+			})
+		})
+	}
+}
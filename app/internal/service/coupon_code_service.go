@@ -0,0 +1,262 @@
+package service
+
+import (
+	"app/internal/models"
+	"app/pkg/couponcode"
+	"app/pkg/database"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// couponCodeInsertBatch 是批量写入券码时每条 INSERT 语句的行数
+	couponCodeInsertBatch = 1000
+	// couponCodeMaxRounds 是生成券码时因冲突重新生成的最大轮数
+	couponCodeMaxRounds = 20
+)
+
+var (
+	// ErrCodePoolExceedsStock 表示券码数量超过了优惠券的总发行量
+	ErrCodePoolExceedsStock = errors.New("券码数量不能超过优惠券的总发行量")
+	// ErrCodeSpaceExhausted 表示券码冲突过多，字母表或长度不足以生成足够的券码
+	ErrCodeSpaceExhausted = errors.New("券码冲突过多，请使用更长的券码或更大的字母表")
+	// ErrInvalidCouponCode 表示券码的校验字符不正确，通常是输入有误
+	ErrInvalidCouponCode = errors.New("券码校验失败，请检查是否输入有误")
+)
+
+// GenerateCouponCodesInput 定义了批量生成券码的输入
+type GenerateCouponCodesInput struct {
+	Quantity int    `json:"quantity" binding:"required,min=1,max=100000"` // 生成数量
+	Prefix   string `json:"prefix"`                                       // 券码前缀，最多 8 个数字或大写字母
+	Alphabet string `json:"alphabet"`                                     // 随机部分的字母表，为空时使用默认字母表（去掉 0、1、I、O 的数字和大写字母）
+	Length   int    `json:"length"`                                       // 随机部分的长度，8 到 32，默认 12
+}
+
+// GenerateCouponCodes 为优惠券批量生成券码并开启券码池，之后领取该优惠券时从券码池分配券码。
+// 券码写入时跳过与已有券码冲突的行并补充生成，直到达到指定的数量。限量发行的优惠券的券码总数（不含已作废的券码）不能超过总发行量，
+// 退款退回库存时作废的券码可以由新生成的券码补充。
+func (s *CouponService) GenerateCouponCodes(couponID uint, input *GenerateCouponCodesInput) (*models.CouponCodeBatch, error) {
+	generator, err := couponcode.New(input.Alphabet, input.Prefix, input.Length)
+	if err != nil {
+		return nil, err
+	}
+
+	var batch models.CouponCodeBatch
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var coupon models.Coupon
+		if err := tx.First(&coupon, couponID).Error; err != nil {
+			return err
+		}
+
+		batch = models.CouponCodeBatch{
+			CouponID: couponID,
+			Prefix:   generator.Prefix(),
+			Alphabet: generator.Alphabet(),
+			Length:   generator.Length(),
+			Quantity: input.Quantity,
+		}
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+
+		if err := insertCouponCodes(tx, generator, &batch); err != nil {
+			return err
+		}
+
+		// 锁定优惠券后再统计券码总数，并发生成的批次依次校验，不会超过总发行量
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, couponID).Error; err != nil {
+			return err
+		}
+		if coupon.TotalQuantity > 0 {
+			var total int64
+			if err := tx.Model(&models.CouponCode{}).Where("coupon_id = ? AND voided_at IS NULL", couponID).Count(&total).Error; err != nil {
+				return err
+			}
+			if total > int64(coupon.TotalQuantity) {
+				return ErrCodePoolExceedsStock
+			}
+		}
+		return tx.Model(&coupon).UpdateColumn("code_pool", true).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// insertCouponCodes 生成并写入批次的全部券码。
+// 每轮生成尚缺的数量，批量写入时忽略与已有券码冲突的行，按实际写入的行数计算下一轮的数量。
+func insertCouponCodes(tx *gorm.DB, generator *couponcode.Generator, batch *models.CouponCodeBatch) error {
+	remaining := batch.Quantity
+	for round := 0; remaining > 0; round++ {
+		if round == couponCodeMaxRounds {
+			return ErrCodeSpaceExhausted
+		}
+
+		for remaining > 0 {
+			n := min(remaining, couponCodeInsertBatch)
+			seen := make(map[string]bool, n)
+			rows := make([]models.CouponCode, 0, n)
+			for len(rows) < n {
+				code, err := generator.Generate()
+				if err != nil {
+					return err
+				}
+				if seen[code] {
+					continue
+				}
+				seen[code] = true
+				rows = append(rows, models.CouponCode{CouponID: batch.CouponID, BatchID: batch.BatchID, Code: code})
+			}
+
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows)
+			if res.Error != nil {
+				return res.Error
+			}
+			remaining -= int(res.RowsAffected)
+			if int(res.RowsAffected) < n {
+				// 有冲突的行，进入下一轮补充生成
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// assignPooledCode 在领取事务中为用户锁定券码池中一个未分配的券码，券码已分配完时返回 ErrCouponSoldOut。
+// 并发的领取会跳过彼此锁定的券码，不会在同一行上等待。
+func assignPooledCode(tx *gorm.DB, couponID uint) (*models.CouponCode, error) {
+	var code models.CouponCode
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("coupon_id = ? AND user_coupon_id IS NULL", couponID).
+		Order("code_id").
+		Take(&code).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCouponSoldOut
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// voidPooledCode 在退款事务中作废分配给用户优惠券的券码，返回是否作废了券码（优惠券没有开启券码池时不作废）。
+// 券码仍印在已退还的用户优惠券上，不能再分配给其他用户，作废后不再计入券码总数，退回的库存可以通过补充生成券码领取
+func voidPooledCode(tx *gorm.DB, userCouponID uint64, now time.Time) (bool, error) {
+	res := tx.Model(&models.CouponCode{}).
+		Where("user_coupon_id = ? AND voided_at IS NULL", userCouponID).
+		UpdateColumn("voided_at", now)
+	return res.RowsAffected > 0, res.Error
+}
+
+// couponCodeLookupError 返回按券码找不到用户优惠券时的错误：券码符合某个批次的格式但校验字符不正确时返回 ErrInvalidCouponCode，
+// 提示用户检查输入；否则返回 gorm.ErrRecordNotFound
+func couponCodeLookupError(tx *gorm.DB, code string) error {
+	var batches []models.CouponCodeBatch
+	if err := tx.Where("? LIKE CONCAT(prefix, '%')", code).Find(&batches).Error; err != nil {
+		return err
+	}
+	var matched bool
+	for _, batch := range batches {
+		generator, err := couponcode.New(batch.Alphabet, batch.Prefix, batch.Length)
+		if err != nil || len(code) != generator.CodeLength() {
+			continue
+		}
+		if generator.Valid(code) {
+			return gorm.ErrRecordNotFound
+		}
+		matched = true
+	}
+	if matched {
+		return ErrInvalidCouponCode
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// ExportCouponCodesInput 定义了导出券码的输入
+type ExportCouponCodesInput struct {
+	BatchID *uint  `form:"batch_id"`                                                   // 只导出指定批次
+	Status  string `form:"status" binding:"omitempty,oneof=available assigned voided"` // available: 未分配；assigned: 已分配；voided: 已作废
+}
+
+// ExportedCouponCodes 是导出的券码文件
+type ExportedCouponCodes struct {
+	CouponID    uint   `json:"coupon_id"`
+	Count       int    `json:"count"`        // 导出的券码数量
+	ContentType string `json:"content_type"` // 文件的 MIME 类型
+	File        []byte `json:"file"`         // CSV 文件内容，JSON 中为 base64 编码
+}
+
+// ExportCouponCodes 将优惠券的券码导出为 CSV 文件，列依次为券码、批次ID、状态、用户优惠券ID、分配时间和生成时间
+func (s *CouponService) ExportCouponCodes(couponID uint, input *ExportCouponCodesInput) (*ExportedCouponCodes, error) {
+	var coupon models.Coupon
+	if err := database.DB.Unscoped().Select("coupon_id").First(&coupon, couponID).Error; err != nil {
+		return nil, err
+	}
+
+	query := database.DB.Model(&models.CouponCode{}).Where("coupon_id = ?", couponID)
+	if input.BatchID != nil {
+		query = query.Where("batch_id = ?", *input.BatchID)
+	}
+	switch input.Status {
+	case "available":
+		query = query.Where("user_coupon_id IS NULL")
+	case "assigned":
+		query = query.Where("user_coupon_id IS NOT NULL AND voided_at IS NULL")
+	case "voided":
+		query = query.Where("voided_at IS NOT NULL")
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"code", "batch_id", "status", "user_coupon_id", "assigned_at", "created_at"})
+	var count int
+	var codes []models.CouponCode
+	err := query.Order("code_id").FindInBatches(&codes, couponCodeInsertBatch, func(tx *gorm.DB, _ int) error {
+		for _, code := range codes {
+			status, userCouponID, assignedAt := "available", "", ""
+			if code.UserCouponID != nil {
+				status = "assigned"
+				userCouponID = strconv.FormatUint(*code.UserCouponID, 10)
+			}
+			if code.VoidedAt != nil {
+				status = "voided"
+			}
+			if code.AssignedAt != nil {
+				assignedAt = code.AssignedAt.Format(time.DateTime)
+			}
+			if err := w.Write([]string{
+				code.Code,
+				strconv.FormatUint(uint64(code.BatchID), 10),
+				status,
+				userCouponID,
+				assignedAt,
+				code.CreatedAt.Format(time.DateTime),
+			}); err != nil {
+				return err
+			}
+		}
+		count += len(codes)
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+
+	return &ExportedCouponCodes{
+		CouponID:    couponID,
+		Count:       count,
+		ContentType: "text/csv",
+		File:        buf.Bytes(),
+	}, nil
+}
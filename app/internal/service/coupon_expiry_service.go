@@ -0,0 +1,221 @@
+package service
+
+import (
+	"app/internal/models"
+	"app/pkg/database"
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// couponExpiryJob 是过期优惠券处理任务的租约名称
+	couponExpiryJob = "coupon_expiry"
+	// couponExpiryLeaseTTL 是租约的有效期，每处理完一批续期一次
+	couponExpiryLeaseTTL = 2 * time.Minute
+)
+
+// CouponExpiryService 负责处理过期的优惠券：将过了结束时间的优惠券标记为已过期（状态 2），
+// 将过期未使用的用户优惠券标记为 EXPIRED，并为每一条记录写入 EXPIRE 日志。
+// 状态变更和日志在同一事务中完成，重复执行不会重复记录。
+type CouponExpiryService struct{}
+
+// ExpiryProgress 是一次过期处理的进度
+type ExpiryProgress struct {
+	Coupons     int64 // 标记为已过期的优惠券数量
+	UserCoupons int64 // 标记为已过期的用户优惠券数量
+}
+
+// ExpireCoupons 将最多 batchSize 个已过结束时间的启用状态优惠券标记为已过期，并为每个优惠券记录一条 EXPIRE 日志，返回处理的数量。
+// 多个实例同时执行时会跳过已被其他实例锁定的优惠券。
+func (s *CouponExpiryService) ExpireCoupons(batchSize int) (int, error) {
+	var expired int
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var coupons []models.Coupon
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Select("coupon_id", "store_id").
+			Where("status = ? AND end_time <= ?", 1, now).
+			Order("coupon_id").
+			Limit(batchSize).
+			Find(&coupons).Error; err != nil {
+			return err
+		}
+		if len(coupons) == 0 {
+			return nil
+		}
+
+		couponIDs := make([]uint, len(coupons))
+		logs := make([]models.CouponLog, len(coupons))
+		for i, coupon := range coupons {
+			couponIDs[i] = coupon.CouponID
+			logs[i] = models.CouponLog{
+				CouponID:   coupon.CouponID,
+				StoreID:    coupon.StoreID,
+				ActionType: "EXPIRE",
+				ActionTime: now,
+				Status:     1,
+				Remark:     "优惠券已过结束时间",
+			}
+		}
+		if err := tx.Model(&models.Coupon{}).Where("coupon_id IN ?", couponIDs).Update("status", 2).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&logs).Error; err != nil {
+			return err
+		}
+		expired = len(coupons)
+		return nil
+	})
+	return expired, err
+}
+
+// ExpireUserCoupons 将最多 batchSize 张已过期的未使用用户优惠券标记为 EXPIRED，并为每张券记录一条关联领取日志的 EXPIRE 日志，返回处理的数量。
+// 多个实例同时执行时会跳过已被其他实例锁定的券，正在核销的券也会被跳过，留到下一批处理。
+func (s *CouponExpiryService) ExpireUserCoupons(batchSize int) (int, error) {
+	var expired int
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var userCoupons []models.UserCoupon
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Select("user_coupon_id", "coupon_id", "user_union_id", "store_id", "code", "receive_log_id").
+			Where("status = ? AND expires_at <= ?", models.UserCouponUnused, now).
+			Order("expires_at").
+			Limit(batchSize).
+			Find(&userCoupons).Error; err != nil {
+			return err
+		}
+		if len(userCoupons) == 0 {
+			return nil
+		}
+
+		ids := make([]uint64, len(userCoupons))
+		logs := make([]models.CouponLog, len(userCoupons))
+		for i, userCoupon := range userCoupons {
+			ids[i] = userCoupon.UserCouponID
+			receiveLogID := userCoupon.ReceiveLogID
+			logs[i] = models.CouponLog{
+				CouponID:     userCoupon.CouponID,
+				UserUnionID:  userCoupon.UserUnionID,
+				StoreID:      userCoupon.StoreID,
+				ActionType:   "EXPIRE",
+				ActionTime:   now,
+				Status:       1,
+				Remark:       "券码 " + userCoupon.Code + " 过期未使用",
+				RelatedLogID: &receiveLogID,
+			}
+		}
+		if err := tx.Model(&models.UserCoupon{}).
+			Where("user_coupon_id IN ?", ids).
+			Update("status", models.UserCouponExpired).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&logs).Error; err != nil {
+			return err
+		}
+		expired = len(userCoupons)
+		return nil
+	})
+	return expired, err
+}
+
+// RunExpiry 分批处理所有过期的优惠券和用户优惠券，直到没有待处理的记录。
+// 每处理完一批调用一次 renew，renew 返回 false 时停止处理。
+func (s *CouponExpiryService) RunExpiry(batchSize int, renew func(ExpiryProgress) bool) (ExpiryProgress, error) {
+	var progress ExpiryProgress
+	steps := []struct {
+		expire  func(int) (int, error)
+		counter *int64
+	}{
+		{s.ExpireCoupons, &progress.Coupons},
+		{s.ExpireUserCoupons, &progress.UserCoupons},
+	}
+	for _, step := range steps {
+		for {
+			n, err := step.expire(batchSize)
+			*step.counter += int64(n)
+			if err != nil {
+				return progress, err
+			}
+			if n == 0 {
+				break
+			}
+			if !renew(progress) {
+				return progress, nil
+			}
+			if n < batchSize {
+				break
+			}
+		}
+	}
+	return progress, nil
+}
+
+// StartScheduler 启动后台任务，每隔 interval 处理一次过期的优惠券，ctx 取消后退出。
+// 多个实例同时运行时，通过数据库租约保证同一时间只有一个实例执行，持有租约的实例宕机后由其他实例接手。
+func (s *CouponExpiryService) StartScheduler(ctx context.Context, interval time.Duration, batchSize int) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			s.runOnce(ctx, batchSize)
+		}
+	}()
+}
+
+// runOnce 获取租约并执行一次过期处理，进度写入日志和租约记录
+func (s *CouponExpiryService) runOnce(ctx context.Context, batchSize int) {
+	acquired, err := acquireJobLease(couponExpiryJob, couponExpiryLeaseTTL)
+	if err != nil {
+		log.Printf("ERROR: 获取过期优惠券处理任务的租约失败: %v", err)
+		return
+	}
+	if !acquired {
+		return
+	}
+	defer func() {
+		if err := releaseJobLease(couponExpiryJob); err != nil {
+			log.Printf("ERROR: 释放过期优惠券处理任务的租约失败: %v", err)
+		}
+	}()
+
+	startedAt := time.Now()
+	if err := recordJobRun(couponExpiryJob, startedAt, nil, 0, nil); err != nil {
+		log.Printf("ERROR: 记录过期优惠券处理进度失败: %v", err)
+	}
+
+	progress, runErr := s.RunExpiry(batchSize, func(p ExpiryProgress) bool {
+		log.Printf("过期优惠券处理中: 已处理 %d 个优惠券、%d 张用户优惠券", p.Coupons, p.UserCoupons)
+		if ctx.Err() != nil {
+			return false
+		}
+		if err := recordJobRun(couponExpiryJob, startedAt, nil, p.Coupons+p.UserCoupons, nil); err != nil {
+			log.Printf("ERROR: 记录过期优惠券处理进度失败: %v", err)
+		}
+		// 续期失败说明租约已被其他实例接手，停止处理
+		renewed, err := acquireJobLease(couponExpiryJob, couponExpiryLeaseTTL)
+		if err != nil {
+			log.Printf("ERROR: 续期过期优惠券处理任务的租约失败: %v", err)
+		}
+		return renewed
+	})
+
+	finishedAt := time.Now()
+	if runErr != nil {
+		log.Printf("ERROR: 处理过期优惠券失败: %v", runErr)
+	} else if progress.Coupons > 0 || progress.UserCoupons > 0 {
+		log.Printf("过期优惠券处理完成: %d 个优惠券、%d 张用户优惠券已过期，耗时 %s",
+			progress.Coupons, progress.UserCoupons, finishedAt.Sub(startedAt).Round(time.Millisecond))
+	}
+	if err := recordJobRun(couponExpiryJob, startedAt, &finishedAt, progress.Coupons+progress.UserCoupons, runErr); err != nil {
+		log.Printf("ERROR: 记录过期优惠券处理进度失败: %v", err)
+	}
+}
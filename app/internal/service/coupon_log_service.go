@@ -9,7 +9,15 @@ import (
 	"time"
 
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrUseRequiresRedeem 表示核销优惠券必须通过核销接口完成
+	ErrUseRequiresRedeem = errors.New("核销优惠券请使用 POST /coupons/redeem 接口")
+	// ErrRefundRequiresRefund 表示退还优惠券必须通过退款接口完成
+	ErrRefundRequiresRefund = errors.New("退还优惠券请使用 POST /coupons/refund 接口")
+	// ErrCouponOutOfPeriod 表示当前时间不在优惠券的领取时间内
+	ErrCouponOutOfPeriod = errors.New("优惠券不在可用时间内")
 )
 
 // CouponLogService 提供了优惠券日志相关的业务逻辑
@@ -18,7 +26,7 @@ type CouponLogService struct{}
 // LogActionInput 定义了记录优惠券日志的通用输入
 type LogActionInput struct {
 	CouponID       uint     `json:"coupon_id" binding:"required"`
-	UserUnionID    string   `json:"user_union_id" binding:"required"`
+	UserUnionID    string   `json:"user_union_id"` // 携带用户令牌时可省略
 	StoreID        *uint    `json:"store_id"`
 	ActionType     string   `json:"action_type" binding:"required,oneof=ISSUE RECEIVE USE EXPIRE REFUND"`
 	OrderID        *string  `json:"order_id"`
@@ -32,8 +40,16 @@ func (s *CouponLogService) CreateCouponLog(input *LogActionInput) (*models.Coupo
 	if input.ActionType == "RECEIVE" {
 		return s.receiveCoupon(input)
 	}
+	// 核销需要校验用户的券和订单，不能直接记录日志
+	if input.ActionType == "USE" {
+		return nil, ErrUseRequiresRedeem
+	}
+	// 退款需要关联原核销记录并返还用户的券
+	if input.ActionType == "REFUND" {
+		return nil, ErrRefundRequiresRefund
+	}
 
-	// 对于其他操作类型 (ISSUE, USE, EXPIRE, REFUND)，暂时只记录日志
+	// 对于其他操作类型 (ISSUE, EXPIRE)，暂时只记录日志
 	log := models.CouponLog{
 		CouponID:       input.CouponID,
 		UserUnionID:    input.UserUnionID,
@@ -65,71 +81,130 @@ func (s *CouponLogService) receiveCoupon(input *LogActionInput) (*models.CouponL
 
 	// 使用 GORM 的事务来确保数据一致性
 	err := database.DB.Transaction(func(tx *gorm.DB) error {
-		var coupon models.Coupon
-		var userLogCount int64
-
-		// 1. 锁定并查找优惠券信息
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, input.CouponID).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return errors.New("优惠券不存在")
-			}
-			return fmt.Errorf("查询优惠券失败: %w", err)
-		}
+		var err error
+		log, err = claimCoupon(tx, input, "用户成功领取")
+		return err
+	})
 
-		// 2. 校验优惠券状态和有效期
-		if coupon.Status != 1 {
-			return errors.New("优惠券已禁用")
-		}
-		now := time.Now()
-		if now.Before(coupon.StartTime) || now.After(coupon.EndTime) {
-			return errors.New("优惠券不在可用时间内")
-		}
+	if err != nil {
+		return nil, err
+	}
 
-		// 3. 校验库存
-		if coupon.TotalQuantity > 0 && coupon.IssuedQuantity >= coupon.TotalQuantity {
-			return errors.New("优惠券已领完")
-		}
+	return log, nil
+}
 
-		// 4. 校验用户领取限制
-		if coupon.UsageLimitPerUser > 0 {
-			tx.Model(&models.CouponLog{}).
-				Where("user_union_id = ? AND coupon_id = ? AND action_type = 'RECEIVE' AND status = 1", input.UserUnionID, input.CouponID).
-				Count(&userLogCount)
-			if userLogCount >= int64(coupon.UsageLimitPerUser) {
-				return errors.New("已达到该优惠券的领取上限")
-			}
+// claimCoupon 在事务中为用户领取一张优惠券：记录 RECEIVE 日志、生成用户优惠券并扣减库存，remark 为领取日志的备注。
+// 领取过程不锁定优惠券：每人限领数量由 user_coupon 的 (coupon_id, user_union_id, claim_seq) 唯一索引保证，
+// 库存在事务的最后一步以条件更新原子地扣减（或扣减某个库存分桶），热门优惠券的并发领取不会在同一行上长时间排队。
+// 指定了领取门店时，门店必须在优惠券的适用范围内。用户主动领取和活动自动发放都通过这里完成。
+func claimCoupon(tx *gorm.DB, input *LogActionInput, remark string) (*models.CouponLog, error) {
+	var coupon models.Coupon
+
+	// 1. 查找优惠券信息
+	if err := tx.First(&coupon, input.CouponID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("优惠券不存在")
 		}
+		return nil, fmt.Errorf("查询优惠券失败: %w", err)
+	}
 
-		// 5. 创建领取日志
-		log = &models.CouponLog{
-			CouponID:    input.CouponID,
-			UserUnionID: input.UserUnionID,
-			StoreID:     input.StoreID,
-			ActionType:  "RECEIVE",
-			ActionTime:  now,
-			Status:      1,
-			Remark:      "用户成功领取",
-		}
-		if err := tx.Create(log).Error; err != nil {
-			return fmt.Errorf("创建领取日志失败: %w", err)
-		}
+	// 2. 校验优惠券状态和有效期
+	if coupon.Status != 1 {
+		return nil, ErrCouponDisabled
+	}
+	now := time.Now()
+	if now.Before(coupon.StartTime) || now.After(coupon.EndTime) {
+		return nil, ErrCouponOutOfPeriod
+	}
+	// 在门店领取时门店必须在优惠券的适用范围内；可用时段限制的是核销，不影响领取
+	if err := checkCouponStoreScope(tx, &coupon, input.StoreID); err != nil {
+		return nil, err
+	}
 
-		// 6. 更新优惠券已发行数量
-		coupon.IssuedQuantity++
-		if err := tx.Save(&coupon).Error; err != nil {
-			return fmt.Errorf("更新优惠券数量失败: %w", err)
-		}
+	// 3. 创建领取日志
+	log := &models.CouponLog{
+		CouponID:    input.CouponID,
+		UserUnionID: input.UserUnionID,
+		StoreID:     input.StoreID,
+		ActionType:  "RECEIVE",
+		ActionTime:  now,
+		Status:      1,
+		Remark:      remark,
+	}
+	if err := tx.Create(log).Error; err != nil {
+		return nil, fmt.Errorf("创建领取日志失败: %w", err)
+	}
 
-		return nil
-	})
+	// 4. 开启券码池的优惠券为用户分配一个券码
+	var pooled *models.CouponCode
+	if coupon.CodePool {
+		var err error
+		if pooled, err = assignPooledCode(tx, coupon.CouponID); err != nil {
+			return nil, err
+		}
+	}
 
+	// 5. 生成用户优惠券，限领时占用一个领取序号
+	var code string
+	if pooled != nil {
+		code = pooled.Code
+	}
+	userCoupon, err := claimUserCoupon(tx, &coupon, log, code)
 	if err != nil {
 		return nil, err
 	}
+	if pooled != nil {
+		if err := tx.Model(pooled).Updates(map[string]interface{}{
+			"user_coupon_id": userCoupon.UserCouponID,
+			"assigned_at":    now,
+		}).Error; err != nil {
+			return nil, fmt.Errorf("分配券码失败: %w", err)
+		}
+	}
+	log.UserCoupon = userCoupon
+	if log.StoreID != nil {
+		if err := adjustStoreCounter(tx, *log.StoreID, storeCounterCouponIssued, 1); err != nil {
+			return nil, fmt.Errorf("更新门店优惠券领取数量失败: %w", err)
+		}
+	}
 
+	// 6. 扣减库存，放在最后以缩短热点行的锁定时间
+	if err := takeCouponStock(tx, &coupon); err != nil {
+		return nil, err
+	}
 	return log, nil
 }
 
+// claimUserCoupon 为领取日志生成用户优惠券。
+// 限领时依次尝试用户尚未占用的领取序号，序号被并发的领取占用时唯一索引冲突，改用下一个序号，序号超过限领数量时返回 ErrClaimLimitReached。
+// 已有的领取次数按成功的 RECEIVE 日志统计，以兼容生成用户优惠券之前的领取记录。code 为从券码池分配的券码，为空时随机生成。
+func claimUserCoupon(tx *gorm.DB, coupon *models.Coupon, log *models.CouponLog, code string) (*models.UserCoupon, error) {
+	if coupon.UsageLimitPerUser <= 0 {
+		userCoupon, err := createUserCoupon(tx, coupon, log, nil, code)
+		if err != nil {
+			return nil, fmt.Errorf("创建用户优惠券失败: %w", err)
+		}
+		return userCoupon, nil
+	}
+
+	var received int64
+	if err := tx.Model(&models.CouponLog{}).
+		Where("user_union_id = ? AND coupon_id = ? AND action_type = 'RECEIVE' AND status = 1 AND log_id <> ?", log.UserUnionID, coupon.CouponID, log.LogID).
+		Count(&received).Error; err != nil {
+		return nil, fmt.Errorf("统计领取次数失败: %w", err)
+	}
+	for seq := int(received) + 1; seq <= coupon.UsageLimitPerUser; seq++ {
+		userCoupon, err := createUserCoupon(tx, coupon, log, &seq, code)
+		if err == nil {
+			return userCoupon, nil
+		}
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, fmt.Errorf("创建用户优惠券失败: %w", err)
+		}
+	}
+	return nil, ErrClaimLimitReached
+}
+
 // GetCouponLogsInput 定义了查询优惠券日志的输入
 type GetCouponLogsInput struct {
 	UserUnionID *string `form:"user_union_id"`
@@ -0,0 +1,418 @@
+package service
+
+import (
+	"app/internal/models"
+	"app/pkg/database"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// couponTimeLayout 是每日可用时段的时间格式
+	couponTimeLayout = "15:04"
+	// couponDateLayout 是不可用日期的格式
+	couponDateLayout = "2006-01-02"
+)
+
+var (
+	// ErrCouponStoreExclusive 表示门店专属的优惠券不能设置适用范围
+	ErrCouponStoreExclusive = errors.New("门店专属的优惠券不能设置适用范围，请先将适用门店改为全平台")
+	// ErrInvalidCouponScope 表示适用范围中的门店不存在或地区不完整
+	ErrInvalidCouponScope = errors.New("适用范围无效：门店必须存在，地区必须指定省份")
+	// ErrInvalidCouponSchedule 表示可用时段或不可用日期的格式无效
+	ErrInvalidCouponSchedule = errors.New("可用时段无效：星期为 1 到 7，时间格式为 HH:MM 且开始和结束时间必须同时指定且不相同，日期格式为 YYYY-MM-DD")
+	// ErrCouponOutsideUsableTime 表示当前不在优惠券的可用星期或时段内
+	ErrCouponOutsideUsableTime = errors.New("当前不在优惠券的可用时段内")
+	// ErrCouponBlackoutDate 表示当天是优惠券的不可用日期
+	ErrCouponBlackoutDate = errors.New("优惠券今日不可用")
+)
+
+// weekdayBit 返回 t 的星期在 UsableWeekdays 中对应的位，第 0 位为周一
+func weekdayBit(t time.Time) uint8 {
+	return 1 << ((int(t.Weekday()) + 6) % 7)
+}
+
+// withinCouponTime 判断 HH:MM 格式的时间是否在优惠券的每日可用时段内，结束时间早于开始时间时时段跨过零点
+func withinCouponTime(coupon *models.Coupon, hm string) bool {
+	start, end := coupon.UsableTimeStart, coupon.UsableTimeEnd
+	if start == "" {
+		return true
+	}
+	if start < end {
+		return hm >= start && hm < end
+	}
+	return hm >= start || hm < end
+}
+
+// couponScheduleFilter 过滤 now 时按可用星期、每日时段和不可用日期可以使用的优惠券
+func couponScheduleFilter(db *gorm.DB, now time.Time) *gorm.DB {
+	hm := now.Format(couponTimeLayout)
+	return db.Where("usable_weekdays = 0 OR usable_weekdays & ? <> 0", weekdayBit(now)).
+		Where("usable_time_start = '' OR "+
+			"(usable_time_start < usable_time_end AND ? >= usable_time_start AND ? < usable_time_end) OR "+
+			"(usable_time_start > usable_time_end AND (? >= usable_time_start OR ? < usable_time_end))", hm, hm, hm, hm).
+		Where("NOT EXISTS (SELECT 1 FROM coupon_blackout_date bd WHERE bd.coupon_id = coupon.coupon_id AND bd.blackout_date = ?)",
+			now.Format(couponDateLayout))
+}
+
+// couponStoreFilter 过滤适用于门店的优惠券：该门店专属的优惠券，以及未限定单一门店且没有适用范围或适用范围包含该门店的优惠券。
+// store 为 nil 时只保留全部门店通用的优惠券
+func couponStoreFilter(db *gorm.DB, store *models.Store) *gorm.DB {
+	if store == nil {
+		return db.Where("store_id IS NULL AND NOT EXISTS (SELECT 1 FROM coupon_store_scope sc WHERE sc.coupon_id = coupon.coupon_id)")
+	}
+	return db.Where("store_id = ? OR (store_id IS NULL AND ("+
+		"NOT EXISTS (SELECT 1 FROM coupon_store_scope sc WHERE sc.coupon_id = coupon.coupon_id) OR "+
+		"EXISTS (SELECT 1 FROM coupon_store_scope sc WHERE sc.coupon_id = coupon.coupon_id AND ("+
+		"(sc.scope_type = 'STORE' AND sc.store_id = ?) OR "+
+		"(sc.scope_type = 'PROVINCE' AND sc.province = ?) OR "+
+		"(sc.scope_type = 'CITY' AND sc.province = ? AND sc.city = ?)))))",
+		store.StoreID, store.StoreID, store.Province, store.Province, store.City)
+}
+
+// loadStoreRegion 查询门店所在的省份和城市，用于匹配优惠券的适用范围。门店不存在时只按门店ID匹配
+func loadStoreRegion(db *gorm.DB, storeID uint) (*models.Store, error) {
+	store := models.Store{StoreID: storeID}
+	err := db.Select("store_id", "province", "city").Take(&store, storeID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return &store, nil
+}
+
+// checkCouponStoreScope 校验优惠券是否适用于门店：门店专属的优惠券只能在该门店使用，其他优惠券的门店必须在适用范围内。
+// storeID 为 nil 时不校验。领取和核销都需要校验，可用时段只在核销时校验
+func checkCouponStoreScope(tx *gorm.DB, coupon *models.Coupon, storeID *uint) error {
+	if storeID == nil {
+		return nil
+	}
+	if coupon.StoreID != nil {
+		if *coupon.StoreID != *storeID {
+			return ErrCouponStoreMismatch
+		}
+		return nil
+	}
+
+	store, err := loadStoreRegion(tx, *storeID)
+	if err != nil {
+		return err
+	}
+	var count int64
+	if err := couponStoreFilter(tx.Model(&models.Coupon{}).Unscoped(), store).
+		Where("coupon_id = ?", coupon.CouponID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrCouponStoreMismatch
+	}
+	return nil
+}
+
+// checkCouponRules 校验优惠券的适用范围和可用时段：storeID 不为空时门店必须在适用范围内，now 必须在可用的星期和时段内且不是不可用日期
+func checkCouponRules(tx *gorm.DB, coupon *models.Coupon, storeID *uint, now time.Time) error {
+	if err := checkCouponStoreScope(tx, coupon, storeID); err != nil {
+		return err
+	}
+
+	if coupon.UsableWeekdays != 0 && coupon.UsableWeekdays&weekdayBit(now) == 0 {
+		return ErrCouponOutsideUsableTime
+	}
+	if !withinCouponTime(coupon, now.Format(couponTimeLayout)) {
+		return ErrCouponOutsideUsableTime
+	}
+	var blackout int64
+	if err := tx.Model(&models.CouponBlackoutDate{}).
+		Where("coupon_id = ? AND blackout_date = ?", coupon.CouponID, now.Format(couponDateLayout)).
+		Count(&blackout).Error; err != nil {
+		return err
+	}
+	if blackout > 0 {
+		return ErrCouponBlackoutDate
+	}
+	return nil
+}
+
+// clearCouponScopes 在事务中删除优惠券的适用范围。优惠券改为门店专属时调用，
+// 避免之后再改回全平台时旧的适用范围重新生效
+func clearCouponScopes(tx *gorm.DB, couponID uint) error {
+	return tx.Where("coupon_id = ?", couponID).Delete(&models.CouponStoreScope{}).Error
+}
+
+// CouponRegion 是适用范围中的一个地区，City 为空时表示整个省份
+type CouponRegion struct {
+	Province string `json:"province" binding:"required,max=64"`
+	City     string `json:"city" binding:"max=64"`
+}
+
+// CouponSchedule 是优惠券的可用星期、每日时段和不可用日期，领取不受限制，只能在可用时段内核销
+type CouponSchedule struct {
+	Weekdays      []int    `json:"weekdays"`       // 可用的星期，1 为周一，7 为周日，为空表示不限
+	TimeStart     string   `json:"time_start"`     // 每日可用开始时间 HH:MM，为空表示全天可用
+	TimeEnd       string   `json:"time_end"`       // 每日可用结束时间 HH:MM（不含），早于开始时间表示跨过零点
+	BlackoutDates []string `json:"blackout_dates"` // 今天及以后的不可用日期 YYYY-MM-DD
+	UsableNow     bool     `json:"usable_now"`     // 当前是否在可用时段内
+}
+
+// couponWeekdays 将 UsableWeekdays 的位转换为星期列表，1 为周一，7 为周日
+func couponWeekdays(mask uint8) []int {
+	weekdays := []int{}
+	for day := 1; day <= 7; day++ {
+		if mask&(1<<(day-1)) != 0 {
+			weekdays = append(weekdays, day)
+		}
+	}
+	return weekdays
+}
+
+// loadCouponSchedules 批量查询优惠券在 now 时的可用时段，按优惠券ID返回
+func loadCouponSchedules(db *gorm.DB, coupons []models.Coupon, now time.Time) (map[uint]*CouponSchedule, error) {
+	schedules := make(map[uint]*CouponSchedule, len(coupons))
+	if len(coupons) == 0 {
+		return schedules, nil
+	}
+	ids := make([]uint, len(coupons))
+	for i := range coupons {
+		coupon := &coupons[i]
+		ids[i] = coupon.CouponID
+		schedules[coupon.CouponID] = &CouponSchedule{
+			Weekdays:      couponWeekdays(coupon.UsableWeekdays),
+			TimeStart:     coupon.UsableTimeStart,
+			TimeEnd:       coupon.UsableTimeEnd,
+			BlackoutDates: []string{},
+			UsableNow: (coupon.UsableWeekdays == 0 || coupon.UsableWeekdays&weekdayBit(now) != 0) &&
+				withinCouponTime(coupon, now.Format(couponTimeLayout)),
+		}
+	}
+
+	today := now.Format(couponDateLayout)
+	var dates []models.CouponBlackoutDate
+	if err := db.Where("coupon_id IN ? AND blackout_date >= ?", ids, today).
+		Order("coupon_id, blackout_date").
+		Find(&dates).Error; err != nil {
+		return nil, err
+	}
+	for _, date := range dates {
+		schedule := schedules[date.CouponID]
+		value := date.BlackoutDate.Format(couponDateLayout)
+		schedule.BlackoutDates = append(schedule.BlackoutDates, value)
+		if value == today {
+			schedule.UsableNow = false
+		}
+	}
+	return schedules, nil
+}
+
+// CouponRules 是优惠券的适用范围和可用时段
+type CouponRules struct {
+	CouponID      uint           `json:"coupon_id"`
+	StoreID       *uint          `json:"store_id"`       // 门店专属的优惠券只能在该门店使用，适用范围不生效
+	StoreIDs      []uint         `json:"store_ids"`      // 适用的门店，与地区满足任意一个即可
+	Regions       []CouponRegion `json:"regions"`        // 适用的地区
+	Weekdays      []int          `json:"weekdays"`       // 可用的星期，1 为周一，7 为周日，为空表示不限
+	TimeStart     string         `json:"time_start"`     // 每日可用开始时间 HH:MM，为空表示全天可用
+	TimeEnd       string         `json:"time_end"`       // 每日可用结束时间 HH:MM（不含），早于开始时间表示跨过零点
+	BlackoutDates []string       `json:"blackout_dates"` // 不可用日期 YYYY-MM-DD
+}
+
+// loadCouponRules 查询优惠券的适用范围和可用时段
+func loadCouponRules(db *gorm.DB, coupon *models.Coupon) (*CouponRules, error) {
+	rules := CouponRules{
+		CouponID:      coupon.CouponID,
+		StoreID:       coupon.StoreID,
+		StoreIDs:      []uint{},
+		Regions:       []CouponRegion{},
+		Weekdays:      couponWeekdays(coupon.UsableWeekdays),
+		TimeStart:     coupon.UsableTimeStart,
+		TimeEnd:       coupon.UsableTimeEnd,
+		BlackoutDates: []string{},
+	}
+
+	var scopes []models.CouponStoreScope
+	if err := db.Where("coupon_id = ?", coupon.CouponID).Order("scope_id").Find(&scopes).Error; err != nil {
+		return nil, err
+	}
+	for _, scope := range scopes {
+		if scope.ScopeType == models.CouponScopeStore && scope.StoreID != nil {
+			rules.StoreIDs = append(rules.StoreIDs, *scope.StoreID)
+		} else {
+			rules.Regions = append(rules.Regions, CouponRegion{Province: scope.Province, City: scope.City})
+		}
+	}
+
+	var dates []models.CouponBlackoutDate
+	if err := db.Where("coupon_id = ?", coupon.CouponID).Order("blackout_date").Find(&dates).Error; err != nil {
+		return nil, err
+	}
+	for _, date := range dates {
+		rules.BlackoutDates = append(rules.BlackoutDates, date.BlackoutDate.Format(couponDateLayout))
+	}
+	return &rules, nil
+}
+
+// GetCouponRules 查询优惠券的适用范围和可用时段
+func (s *CouponService) GetCouponRules(id uint) (*CouponRules, error) {
+	var coupon models.Coupon
+	if err := database.DB.First(&coupon, id).Error; err != nil {
+		return nil, err
+	}
+	return loadCouponRules(database.DB, &coupon)
+}
+
+// UpdateCouponScopesInput 定义了更新优惠券适用范围的输入，门店和地区均为空时全部门店通用
+type UpdateCouponScopesInput struct {
+	StoreIDs []uint         `json:"store_ids" binding:"max=1000"`
+	Regions  []CouponRegion `json:"regions" binding:"max=100,dive"`
+}
+
+// UpdateCouponScopes 替换优惠券的适用范围，只能用于未限定单一门店的优惠券
+func (s *CouponService) UpdateCouponScopes(id uint, input *UpdateCouponScopesInput) (*CouponRules, error) {
+	var rules *CouponRules
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var coupon models.Coupon
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, id).Error; err != nil {
+			return err
+		}
+		if coupon.StoreID != nil && (len(input.StoreIDs) > 0 || len(input.Regions) > 0) {
+			return ErrCouponStoreExclusive
+		}
+
+		var scopes []models.CouponStoreScope
+		seenStores := make(map[uint]bool)
+		for _, storeID := range input.StoreIDs {
+			if seenStores[storeID] {
+				continue
+			}
+			seenStores[storeID] = true
+			scopes = append(scopes, models.CouponStoreScope{CouponID: id, ScopeType: models.CouponScopeStore, StoreID: &storeID})
+		}
+		if len(seenStores) > 0 {
+			var count int64
+			ids := make([]uint, 0, len(seenStores))
+			for storeID := range seenStores {
+				ids = append(ids, storeID)
+			}
+			if err := tx.Model(&models.Store{}).Where("store_id IN ?", ids).Count(&count).Error; err != nil {
+				return err
+			}
+			if count != int64(len(ids)) {
+				return ErrInvalidCouponScope
+			}
+		}
+		seenRegions := make(map[CouponRegion]bool)
+		for _, region := range input.Regions {
+			if region.Province == "" {
+				return ErrInvalidCouponScope
+			}
+			if seenRegions[region] {
+				continue
+			}
+			seenRegions[region] = true
+			scope := models.CouponStoreScope{CouponID: id, ScopeType: models.CouponScopeProvince, Province: region.Province}
+			if region.City != "" {
+				scope.ScopeType = models.CouponScopeCity
+				scope.City = region.City
+			}
+			scopes = append(scopes, scope)
+		}
+
+		if err := tx.Where("coupon_id = ?", id).Delete(&models.CouponStoreScope{}).Error; err != nil {
+			return err
+		}
+		if len(scopes) > 0 {
+			if err := tx.Create(&scopes).Error; err != nil {
+				return err
+			}
+		}
+
+		var err error
+		rules, err = loadCouponRules(tx, &coupon)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// UpdateCouponScheduleInput 定义了更新优惠券可用时段的输入，替换原有的设置
+type UpdateCouponScheduleInput struct {
+	Weekdays      []int    `json:"weekdays" binding:"max=7,dive,min=1,max=7"` // 1 为周一，7 为周日，为空表示不限
+	TimeStart     string   `json:"time_start"`                                // HH:MM，与结束时间同时为空表示全天可用
+	TimeEnd       string   `json:"time_end"`                                  // HH:MM（不含），早于开始时间表示跨过零点，例如 22:00 到 02:00
+	BlackoutDates []string `json:"blackout_dates" binding:"max=366"`          // 不可用日期 YYYY-MM-DD
+}
+
+// UpdateCouponSchedule 替换优惠券的可用星期、每日时段和不可用日期
+func (s *CouponService) UpdateCouponSchedule(id uint, input *UpdateCouponScheduleInput) (*CouponRules, error) {
+	var weekdays uint8
+	for _, day := range input.Weekdays {
+		if day < 1 || day > 7 {
+			return nil, ErrInvalidCouponSchedule
+		}
+		weekdays |= 1 << (day - 1)
+	}
+	if (input.TimeStart == "") != (input.TimeEnd == "") {
+		return nil, ErrInvalidCouponSchedule
+	}
+	if input.TimeStart != "" {
+		start, err := time.Parse(couponTimeLayout, input.TimeStart)
+		if err != nil {
+			return nil, ErrInvalidCouponSchedule
+		}
+		end, err := time.Parse(couponTimeLayout, input.TimeEnd)
+		if err != nil || start.Equal(end) {
+			return nil, ErrInvalidCouponSchedule
+		}
+		// 统一为两位数的格式，数据库中按字符串比较
+		input.TimeStart, input.TimeEnd = start.Format(couponTimeLayout), end.Format(couponTimeLayout)
+	}
+	// 同一日期只记录一次
+	dates := make(map[string]time.Time)
+	for _, value := range input.BlackoutDates {
+		date, err := time.ParseInLocation(couponDateLayout, value, time.Local)
+		if err != nil {
+			return nil, ErrInvalidCouponSchedule
+		}
+		dates[date.Format(couponDateLayout)] = date
+	}
+
+	var rules *CouponRules
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var coupon models.Coupon
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, id).Error; err != nil {
+			return err
+		}
+
+		coupon.UsableWeekdays = weekdays
+		coupon.UsableTimeStart = input.TimeStart
+		coupon.UsableTimeEnd = input.TimeEnd
+		if err := tx.Model(&coupon).Select("usable_weekdays", "usable_time_start", "usable_time_end").Updates(&coupon).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("coupon_id = ?", id).Delete(&models.CouponBlackoutDate{}).Error; err != nil {
+			return err
+		}
+		if len(dates) > 0 {
+			rows := make([]models.CouponBlackoutDate, 0, len(dates))
+			for _, date := range dates {
+				rows = append(rows, models.CouponBlackoutDate{CouponID: id, BlackoutDate: date})
+			}
+			if err := tx.Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+
+		var err error
+		rules, err = loadCouponRules(tx, &coupon)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"app/internal/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWeekdayBit(t *testing.T) {
+	tests := []struct {
+		date string
+		want uint8
+	}{
+		{"2026-03-09", 1 << 0}, // 周一
+		{"2026-03-10", 1 << 1}, // 周二
+		{"2026-03-11", 1 << 2}, // 周三
+		{"2026-03-12", 1 << 3}, // 周四
+		{"2026-03-13", 1 << 4}, // 周五
+		{"2026-03-14", 1 << 5}, // 周六
+		{"2026-03-15", 1 << 6}, // 周日
+		{"2026-03-16", 1 << 0}, // 下一个周一
+	}
+	for _, tt := range tests {
+		day, err := time.ParseInLocation(couponDateLayout, tt.date, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := weekdayBit(day); got != tt.want {
+			t.Errorf("weekdayBit(%s %s) = %07b，应为 %07b", tt.date, day.Weekday(), got, tt.want)
+		}
+	}
+}
+
+func TestCouponWeekdays(t *testing.T) {
+	tests := []struct {
+		mask uint8
+		want []int
+	}{
+		{0, []int{}},
+		{1 << 0, []int{1}},
+		{1<<5 | 1<<6, []int{6, 7}},
+		{0x7f, []int{1, 2, 3, 4, 5, 6, 7}},
+	}
+	for _, tt := range tests {
+		if got := couponWeekdays(tt.mask); !slices.Equal(got, tt.want) {
+			t.Errorf("couponWeekdays(%07b) = %v，应为 %v", tt.mask, got, tt.want)
+		}
+	}
+	// 每个星期的位与 weekdayBit 一致
+	monday := time.Date(2026, 3, 9, 12, 0, 0, 0, time.Local)
+	for i := range 7 {
+		day := monday.AddDate(0, 0, i)
+		if got := couponWeekdays(weekdayBit(day)); !slices.Equal(got, []int{i + 1}) {
+			t.Errorf("%s 的星期为 %v，应为 [%d]", day.Weekday(), got, i+1)
+		}
+	}
+}
+
+func TestWithinCouponTime(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end string
+		hm         string
+		want       bool
+	}{
+		{"全天可用", "", "", "03:00", true},
+
+		{"白天时段内", "09:00", "18:00", "12:30", true},
+		{"包含开始时间", "09:00", "18:00", "09:00", true},
+		{"不含结束时间", "09:00", "18:00", "18:00", false},
+		{"开始之前", "09:00", "18:00", "08:59", false},
+		{"结束之后", "09:00", "18:00", "23:00", false},
+
+		{"跨零点：开始时间", "22:00", "02:00", "22:00", true},
+		{"跨零点：零点前", "22:00", "02:00", "23:59", true},
+		{"跨零点：零点", "22:00", "02:00", "00:00", true},
+		{"跨零点：零点后", "22:00", "02:00", "01:59", true},
+		{"跨零点：不含结束时间", "22:00", "02:00", "02:00", false},
+		{"跨零点：白天", "22:00", "02:00", "12:00", false},
+		{"跨零点：开始之前", "22:00", "02:00", "21:59", false},
+
+		{"到零点结束", "18:00", "00:00", "23:59", true},
+		{"到零点结束：不含零点", "18:00", "00:00", "00:00", false},
+		{"从零点开始", "00:00", "06:00", "00:00", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coupon := models.Coupon{UsableTimeStart: tt.start, UsableTimeEnd: tt.end}
+			if got := withinCouponTime(&coupon, tt.hm); got != tt.want {
+				t.Errorf("withinCouponTime(%s-%s, %s) = %v，应为 %v", tt.start, tt.end, tt.hm, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"app/internal/models"
 	"app/pkg/database"
+	"app/pkg/pricing"
 	"context"
 	"errors"
 	"fmt"
@@ -17,18 +18,19 @@ type CouponService struct{}
 
 // CreateCouponInput 定义了创建优惠券的输入
 type CreateCouponInput struct {
-	CouponName        string  `json:"coupon_name" binding:"required"`
-	CouponCode        string  `json:"coupon_code"`
-	CouponType        string  `json:"coupon_type" binding:"required"`
-	Value             float64 `json:"value" binding:"required"`
-	MinPurchaseAmount float64 `json:"min_purchase_amount"`
-	UsageLimitPerUser int     `json:"usage_limit_per_user"`
-	TotalQuantity     int     `json:"total_quantity"`
-	StartTime         string  `json:"start_time" binding:"required"` // "2006-01-02 15:04:05"
-	EndTime           string  `json:"end_time" binding:"required"`
-	ValidityDays      int     `json:"validity_days"`
-	StoreID           *uint   `json:"store_id"`
-	Description       string  `json:"description"`
+	CouponName         string  `json:"coupon_name" binding:"required"`
+	CouponCode         string  `json:"coupon_code"`
+	CouponType         string  `json:"coupon_type" binding:"required"`
+	Value              float64 `json:"value" binding:"gte=0"` // 按类型校验：DISCOUNT 为 (0, 10) 的折扣，CASH 必须大于 0，SHIPPING 为 0 表示运费全免
+	MinPurchaseAmount  float64 `json:"min_purchase_amount"`
+	MaxDeductionAmount float64 `json:"max_deduction_amount"` // 最高抵扣金额，0 表示不限
+	UsageLimitPerUser  int     `json:"usage_limit_per_user"`
+	TotalQuantity      int     `json:"total_quantity"`
+	StartTime          string  `json:"start_time" binding:"required"` // "2006-01-02 15:04:05"
+	EndTime            string  `json:"end_time" binding:"required"`
+	ValidityDays       int     `json:"validity_days"`
+	StoreID            *uint   `json:"store_id"`
+	Description        string  `json:"description"`
 }
 
 // CreateCoupon 创建一个新的优惠券。
@@ -45,19 +47,23 @@ func (s *CouponService) CreateCoupon(input *CreateCouponInput) (*models.Coupon,
 	}
 
 	coupon := models.Coupon{
-		CouponName:        input.CouponName,
-		CouponCode:        input.CouponCode,
-		CouponType:        input.CouponType,
-		Value:             input.Value,
-		MinPurchaseAmount: input.MinPurchaseAmount,
-		UsageLimitPerUser: input.UsageLimitPerUser,
-		TotalQuantity:     input.TotalQuantity,
-		StartTime:         startTime,
-		EndTime:           endTime,
-		ValidityDays:      input.ValidityDays,
-		StoreID:           input.StoreID,
-		Description:       input.Description,
-		Status:            1, // 默认启用
+		CouponName:         input.CouponName,
+		CouponCode:         input.CouponCode,
+		CouponType:         input.CouponType,
+		Value:              input.Value,
+		MinPurchaseAmount:  input.MinPurchaseAmount,
+		MaxDeductionAmount: input.MaxDeductionAmount,
+		UsageLimitPerUser:  input.UsageLimitPerUser,
+		TotalQuantity:      input.TotalQuantity,
+		StartTime:          startTime,
+		EndTime:            endTime,
+		ValidityDays:       input.ValidityDays,
+		StoreID:            input.StoreID,
+		Description:        input.Description,
+		Status:             1, // 默认启用
+	}
+	if err := couponRule(&coupon).Validate(); err != nil {
+		return nil, err
 	}
 
 	err = database.DB.Transaction(func(tx *gorm.DB) error {
@@ -87,20 +93,24 @@ func (s *CouponService) CreateBatchCoupons(inputs []*CreateCouponInput) ([]model
 		}
 
 		coupon := models.Coupon{
-			CouponName:        input.CouponName,
-			CouponCode:        input.CouponCode,
-			CouponType:        input.CouponType,
-			Value:             input.Value,
-			MinPurchaseAmount: input.MinPurchaseAmount,
-			UsageLimitPerUser: input.UsageLimitPerUser,
-			TotalQuantity:     input.TotalQuantity,
-			IssuedQuantity:    0,
-			StartTime:         startTime,
-			EndTime:           endTime,
-			ValidityDays:      input.ValidityDays,
-			StoreID:           input.StoreID,
-			Description:       input.Description,
-			Status:            1, // 默认为启用
+			CouponName:         input.CouponName,
+			CouponCode:         input.CouponCode,
+			CouponType:         input.CouponType,
+			Value:              input.Value,
+			MinPurchaseAmount:  input.MinPurchaseAmount,
+			MaxDeductionAmount: input.MaxDeductionAmount,
+			UsageLimitPerUser:  input.UsageLimitPerUser,
+			TotalQuantity:      input.TotalQuantity,
+			IssuedQuantity:     0,
+			StartTime:          startTime,
+			EndTime:            endTime,
+			ValidityDays:       input.ValidityDays,
+			StoreID:            input.StoreID,
+			Description:        input.Description,
+			Status:             1, // 默认为启用
+		}
+		if err := couponRule(&coupon).Validate(); err != nil {
+			return nil, fmt.Errorf("优惠券 '%s': %w", input.CouponName, err)
 		}
 		couponsToCreate = append(couponsToCreate, coupon)
 	}
@@ -123,8 +133,23 @@ func (s *CouponService) CreateBatchCoupons(inputs []*CreateCouponInput) ([]model
 // GetCouponByID 根据ID获取优惠券详情
 func (s *CouponService) GetCouponByID(id uint) (*models.Coupon, error) {
 	var coupon models.Coupon
-	err := database.DB.WithContext(context.Background()).First(&coupon, id).Error
-	return &coupon, err
+	if err := database.DB.WithContext(context.Background()).First(&coupon, id).Error; err != nil {
+		return &coupon, err
+	}
+	coupons := []models.Coupon{coupon}
+	err := loadBucketIssuedQuantity(database.DB, coupons)
+	return &coupons[0], err
+}
+
+// GetCouponByIDWithDeleted 根据ID获取优惠券，包括已删除的优惠券
+func (s *CouponService) GetCouponByIDWithDeleted(id uint) (*models.Coupon, error) {
+	var coupon models.Coupon
+	if err := database.DB.WithContext(context.Background()).Unscoped().First(&coupon, id).Error; err != nil {
+		return &coupon, err
+	}
+	coupons := []models.Coupon{coupon}
+	err := loadBucketIssuedQuantity(database.DB, coupons)
+	return &coupons[0], err
 }
 
 // GetCouponsInput 定义了查询优惠券的输入
@@ -133,6 +158,8 @@ type GetCouponsInput struct {
 	Status   *int8 `form:"status"`
 	Page     int   `form:"page"`
 	PageSize int   `form:"pageSize"`
+
+	IncludeDeleted bool `form:"include_deleted"` // 是否包含已删除的优惠券
 }
 
 // GetCoupons 查询优惠券列表
@@ -141,6 +168,9 @@ func (s *CouponService) GetCoupons(input *GetCouponsInput) ([]models.Coupon, int
 	var total int64
 
 	db := database.DB.WithContext(context.Background()).Model(&models.Coupon{})
+	if input.IncludeDeleted {
+		db = db.Unscoped()
+	}
 	if input.StoreID != nil {
 		db = db.Where("store_id = ? OR store_id IS NULL", *input.StoreID) // 门店券或平台通用券
 	}
@@ -160,21 +190,27 @@ func (s *CouponService) GetCoupons(input *GetCouponsInput) ([]models.Coupon, int
 	}
 	offset := (input.Page - 1) * input.PageSize
 
-	err := db.Order("created_at DESC").Offset(offset).Limit(input.PageSize).Find(&coupons).Error
-	return coupons, total, err
+	if err := db.Order("created_at DESC").Offset(offset).Limit(input.PageSize).Find(&coupons).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := loadBucketIssuedQuantity(database.DB, coupons); err != nil {
+		return nil, 0, err
+	}
+	return coupons, total, nil
 }
 
 // UpdateCouponInput 定义了更新优惠券的输入
 type UpdateCouponInput struct {
-	CouponName        string   `json:"coupon_name"`
-	Description       string   `json:"description"`
-	MinPurchaseAmount *float64 `json:"min_purchase_amount"`
-	TotalQuantity     *int     `json:"total_quantity"`
-	Status            *int8    `json:"status"`
-	StartTime         *string  `json:"start_time,omitempty"` // "2006-01-02 15:04:05"
-	EndTime           *string  `json:"end_time,omitempty"`
-	UsageLimitPerUser *int     `json:"usage_limit_per_user"`
-	StoreID           *uint    `json:"store_id"`
+	CouponName         string   `json:"coupon_name"`
+	Description        string   `json:"description"`
+	MinPurchaseAmount  *float64 `json:"min_purchase_amount" binding:"omitempty,gte=0"`
+	MaxDeductionAmount *float64 `json:"max_deduction_amount" binding:"omitempty,gte=0"`
+	TotalQuantity      *int     `json:"total_quantity"`
+	Status             *int8    `json:"status"`
+	StartTime          *string  `json:"start_time,omitempty"` // "2006-01-02 15:04:05"
+	EndTime            *string  `json:"end_time,omitempty"`
+	UsageLimitPerUser  *int     `json:"usage_limit_per_user"`
+	StoreID            *uint    `json:"store_id"`
 }
 
 // UpdateCoupon 更新指定的优惠券信息
@@ -207,7 +243,19 @@ func (s *CouponService) UpdateCoupon(id uint, input *UpdateCouponInput) (*models
 	if input.MinPurchaseAmount != nil {
 		updates["min_purchase_amount"] = *input.MinPurchaseAmount
 	}
+	if input.MaxDeductionAmount != nil {
+		updates["max_deduction_amount"] = *input.MaxDeductionAmount
+	}
+	// 总发行量的校验与 UpdateCouponQuantity 相同：分桶后剩余库存保存在各分桶中，不能直接修改
 	if input.TotalQuantity != nil {
+		if coupon.StockBuckets > 0 {
+			tx.Rollback()
+			return nil, ErrCouponStockSharded
+		}
+		if *input.TotalQuantity < coupon.IssuedQuantity {
+			tx.Rollback()
+			return nil, ErrCouponTotalBelowIssued
+		}
 		updates["total_quantity"] = *input.TotalQuantity
 	}
 	if input.Status != nil {
@@ -216,9 +264,13 @@ func (s *CouponService) UpdateCoupon(id uint, input *UpdateCouponInput) (*models
 	if input.UsageLimitPerUser != nil {
 		updates["usage_limit_per_user"] = *input.UsageLimitPerUser
 	}
-	// 特别处理 store_id，因为它可能被设为 null
+	// 特别处理 store_id，因为它可能被设为 null；改为门店专属时清除原有的适用范围
 	if input.StoreID != nil {
 		updates["store_id"] = input.StoreID
+		if err := clearCouponScopes(tx, coupon.CouponID); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("清除优惠券适用范围失败: %w", err)
+		}
 	}
 
 	// 处理时间格式
@@ -260,14 +312,20 @@ func (s *CouponService) UpdateCoupon(id uint, input *UpdateCouponInput) (*models
 
 // GetAvailableCouponsForUserInput 定义了查询用户可领取优惠券的输入
 type GetAvailableCouponsForUserInput struct {
-	UserID   string `form:"user_id" binding:"required"`
+	UserID   string `form:"user_id"`  // 用户UnionID，携带用户令牌时可省略
 	StoreID  *uint  `form:"store_id"` // 可选，用于筛选特定门店的优惠券
 	Page     int    `form:"page"`
 	PageSize int    `form:"pageSize"`
 }
 
-// GetAvailableCouponsForUser 查询指定用户可领取的优惠券列表
-func (s *CouponService) GetAvailableCouponsForUser(input *GetAvailableCouponsForUserInput) ([]models.Coupon, int64, error) {
+// AvailableCoupon 是用户可领取的优惠券，附带可用时段：领取不受可用时段限制，领取后只能在可用时段内核销
+type AvailableCoupon struct {
+	models.Coupon
+	Schedule *CouponSchedule `json:"schedule"`
+}
+
+// GetAvailableCouponsForUser 查询指定用户可领取的优惠券列表，包括当前不在可用时段内的优惠券，并返回每个优惠券的可用时段
+func (s *CouponService) GetAvailableCouponsForUser(input *GetAvailableCouponsForUserInput) ([]AvailableCoupon, int64, error) {
 	var availableCoupons []models.Coupon
 	var total int64
 
@@ -275,14 +333,20 @@ func (s *CouponService) GetAvailableCouponsForUser(input *GetAvailableCouponsFor
 
 	// 基础查询条件：启用、在有效期内、有库存
 	baseQuery := database.DB.Model(&models.Coupon{}).
-		Where("status = 1 AND ? BETWEEN start_time AND end_time AND (total_quantity = 0 OR issued_quantity < total_quantity)", now)
+		Where("status = 1 AND ? BETWEEN start_time AND end_time", now).
+		Where("total_quantity = 0 OR (stock_buckets = 0 AND issued_quantity < total_quantity) OR " +
+			"(stock_buckets > 0 AND EXISTS (SELECT 1 FROM coupon_stock_bucket b WHERE b.coupon_id = coupon.coupon_id AND b.issued < b.quantity))")
 
-	// 门店筛选条件：全平台通用券 或 特定门店券
+	// 门店筛选条件：该门店专属的券，或适用范围包含该门店的券
 	if input.StoreID != nil {
-		baseQuery = baseQuery.Where("store_id IS NULL OR store_id = ?", *input.StoreID)
+		store, err := loadStoreRegion(database.DB, *input.StoreID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("查询门店失败: %w", err)
+		}
+		baseQuery = couponStoreFilter(baseQuery, store)
 	} else {
 		// 如果不提供 store_id，通常只返回全平台通用券
-		baseQuery = baseQuery.Where("store_id IS NULL")
+		baseQuery = couponStoreFilter(baseQuery, nil)
 	}
 
 	// 核心逻辑：过滤掉用户已达领取上限的优惠券
@@ -305,8 +369,19 @@ func (s *CouponService) GetAvailableCouponsForUser(input *GetAvailableCouponsFor
 	if err := finalQuery.Find(&availableCoupons).Error; err != nil {
 		return nil, 0, fmt.Errorf("查询可领取优惠券列表失败: %w", err)
 	}
+	if err := loadBucketIssuedQuantity(database.DB, availableCoupons); err != nil {
+		return nil, 0, fmt.Errorf("查询优惠券已发行数量失败: %w", err)
+	}
+	schedules, err := loadCouponSchedules(database.DB, availableCoupons, now)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询优惠券可用时段失败: %w", err)
+	}
 
-	return availableCoupons, total, nil
+	result := make([]AvailableCoupon, len(availableCoupons))
+	for i, coupon := range availableCoupons {
+		result[i] = AvailableCoupon{Coupon: coupon, Schedule: schedules[coupon.CouponID]}
+	}
+	return result, total, nil
 }
 
 // DeleteCoupon 软删除一张优惠券
@@ -324,6 +399,34 @@ func (s *CouponService) DeleteCoupon(id uint) error {
 	return err
 }
 
+// RestoreCoupon 恢复一张已删除的优惠券，门店专属的优惠券要求所属门店未被删除。优惠券未被删除时直接返回。
+func (s *CouponService) RestoreCoupon(id uint) (*models.Coupon, error) {
+	var coupon models.Coupon
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, id).Error; err != nil {
+			return err
+		}
+		if !coupon.DeletedAt.Valid {
+			return nil
+		}
+		if coupon.StoreID != nil {
+			if err := checkStoreNotDeleted(tx, *coupon.StoreID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Unscoped().Model(&coupon).UpdateColumn("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		coupon.DeletedAt = gorm.DeletedAt{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
 // UpdateCouponValidityInput 定义更新优惠券有效期的输入
 type UpdateCouponValidityInput struct {
 	StartTime    string `json:"start_time"`    // 格式: "2006-01-02 15:04:05"
@@ -375,8 +478,9 @@ func (s *CouponService) UpdateCouponValidity(id uint, input *UpdateCouponValidit
 
 // UpdateCouponLimitInput 定义更新优惠券使用限制的输入
 type UpdateCouponLimitInput struct {
-	MinPurchaseAmount *float64 `json:"min_purchase_amount"`  // 最低消费金额
-	UsageLimitPerUser *int     `json:"usage_limit_per_user"` // 每个用户可领取的最大数量
+	MinPurchaseAmount  *float64 `json:"min_purchase_amount" binding:"omitempty,gte=0"`  // 最低消费金额
+	MaxDeductionAmount *float64 `json:"max_deduction_amount" binding:"omitempty,gte=0"` // 最高抵扣金额，0 表示不限
+	UsageLimitPerUser  *int     `json:"usage_limit_per_user"`                           // 每个用户可领取的最大数量
 }
 
 // UpdateCouponLimit 仅更新优惠券的使用限制
@@ -393,6 +497,9 @@ func (s *CouponService) UpdateCouponLimit(id uint, input *UpdateCouponLimitInput
 		if input.MinPurchaseAmount != nil {
 			coupon.MinPurchaseAmount = *input.MinPurchaseAmount
 		}
+		if input.MaxDeductionAmount != nil {
+			coupon.MaxDeductionAmount = *input.MaxDeductionAmount
+		}
 
 		if input.UsageLimitPerUser != nil {
 			coupon.UsageLimitPerUser = *input.UsageLimitPerUser
@@ -420,15 +527,20 @@ func (s *CouponService) UpdateCouponQuantity(id uint, input *UpdateCouponQuantit
 	var coupon models.Coupon
 
 	err := database.DB.Transaction(func(tx *gorm.DB) error {
-		// 先查询
-		if err := tx.First(&coupon, id).Error; err != nil {
+		// 先查询并锁定，避免与修改分桶数量并发执行
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, id).Error; err != nil {
 			return err
 		}
 
+		// 分桶后剩余库存保存在各分桶中，需要先取消分桶
+		if coupon.StockBuckets > 0 {
+			return ErrCouponStockSharded
+		}
+
 		// 更新发行量
 		if input.TotalQuantity != nil {
 			if *input.TotalQuantity < coupon.IssuedQuantity {
-				return fmt.Errorf("总发行量不能小于已发行数量")
+				return ErrCouponTotalBelowIssued
 			}
 			coupon.TotalQuantity = *input.TotalQuantity
 		}
@@ -456,7 +568,7 @@ type UpdateCouponStoreInput struct {
 	StoreID *uint `json:"store_id"` // 使用指针可将null传入表示全平台适用
 }
 
-// UpdateCouponStore 仅更新优惠券的适用门店
+// UpdateCouponStore 仅更新优惠券的适用门店。改为门店专属时清除优惠券的适用范围，之后改回全平台时全部门店通用，需要重新设置适用范围
 func (s *CouponService) UpdateCouponStore(id uint, input *UpdateCouponStoreInput) (*models.Coupon, error) {
 	var coupon models.Coupon
 
@@ -477,7 +589,12 @@ func (s *CouponService) UpdateCouponStore(id uint, input *UpdateCouponStoreInput
 			}
 		}
 
-		// 更新适用门店
+		// 更新适用门店，改为门店专属时清除原有的适用范围
+		if input.StoreID != nil {
+			if err := clearCouponScopes(tx, coupon.CouponID); err != nil {
+				return err
+			}
+		}
 		coupon.StoreID = input.StoreID
 
 		// 保存
@@ -527,11 +644,17 @@ func (s *CouponService) GetCouponsByStore(input *GetCouponsByStoreInput) ([]mode
 	var coupons []models.Coupon
 	var total int64
 
-	// 查询状态为正常、且未过期的优惠券（特定门店的或全平台通用的）
+	store, err := loadStoreRegion(database.DB, input.StoreID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询门店失败: %w", err)
+	}
+
+	// 查询状态为正常、且未过期的优惠券（该门店专属的或适用范围包含该门店的），并且当前在可用时段内
+	now := time.Now()
 	query := database.DB.Model(&models.Coupon{}).
 		Where("status = ?", 1).
-		Where("end_time > ?", time.Now()).
-		Where("(store_id IS NULL OR store_id = ?)", input.StoreID)
+		Where("end_time > ?", now)
+	query = couponScheduleFilter(couponStoreFilter(query, store), now)
 
 	// 计算总数
 	if err := query.Count(&total).Error; err != nil {
@@ -551,6 +674,56 @@ func (s *CouponService) GetCouponsByStore(input *GetCouponsByStoreInput) ([]mode
 	if err := query.Find(&coupons).Error; err != nil {
 		return nil, 0, fmt.Errorf("查询门店优惠券列表失败: %w", err)
 	}
+	if err := loadBucketIssuedQuantity(database.DB, coupons); err != nil {
+		return nil, 0, fmt.Errorf("查询优惠券已发行数量失败: %w", err)
+	}
 
 	return coupons, total, nil
 }
+
+// couponRule 返回优惠券的计价规则
+func couponRule(coupon *models.Coupon) pricing.Rule {
+	return pricing.Rule{
+		Type:               coupon.CouponType,
+		Value:              coupon.Value,
+		MinPurchaseAmount:  coupon.MinPurchaseAmount,
+		MaxDeductionAmount: coupon.MaxDeductionAmount,
+	}
+}
+
+// checkCouponUsable 校验优惠券在 now 时是否可以在指定门店使用：必须已启用、未删除、已到生效时间，门店专属的优惠券只能在该门店使用，
+// 其他优惠券的门店必须在适用范围内，并且 now 在可用的星期和时段内、不是不可用日期。
+// storeID 为 nil 时不校验门店。
+func checkCouponUsable(tx *gorm.DB, coupon *models.Coupon, storeID *uint, now time.Time) error {
+	if coupon.Status != 1 || coupon.DeletedAt.Valid {
+		return ErrCouponDisabled
+	}
+	if now.Before(coupon.StartTime) {
+		return ErrCouponNotStarted
+	}
+	return checkCouponRules(tx, coupon, storeID, now)
+}
+
+// QuoteCouponInput 定义了试算优惠券抵扣金额的输入
+type QuoteCouponInput struct {
+	StoreID     *uint          `json:"store_id"`                     // 下单门店ID，不为空时校验优惠券是否适用于该门店
+	Items       []pricing.Item `json:"items"`                        // 商品明细，可选
+	Subtotal    float64        `json:"subtotal" binding:"gte=0"`     // 商品小计（不含运费），有商品明细时可省略
+	ShippingFee float64        `json:"shipping_fee" binding:"gte=0"` // 运费
+}
+
+// QuoteCoupon 按优惠券规则试算订单的抵扣金额，不领取也不核销优惠券
+func (s *CouponService) QuoteCoupon(id uint, input *QuoteCouponInput) (*pricing.Quote, error) {
+	var coupon models.Coupon
+	if err := database.DB.First(&coupon, id).Error; err != nil {
+		return nil, err
+	}
+	if err := checkCouponUsable(database.DB, &coupon, input.StoreID, time.Now()); err != nil {
+		return nil, err
+	}
+	return pricing.Calculate(couponRule(&coupon), pricing.Order{
+		Items:       input.Items,
+		Subtotal:    input.Subtotal,
+		ShippingFee: input.ShippingFee,
+	})
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"app/internal/models"
+	"app/pkg/database"
+	"errors"
+	"math/rand/v2"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxStockBuckets 是每个优惠券最多的库存分桶数量
+const maxStockBuckets = 64
+
+var (
+	// ErrCouponSoldOut 表示优惠券已领完
+	ErrCouponSoldOut = errors.New("优惠券已领完")
+	// ErrClaimLimitReached 表示用户已达到该优惠券的领取上限
+	ErrClaimLimitReached = errors.New("已达到该优惠券的领取上限")
+	// ErrInvalidStockBuckets 表示库存分桶数量超出范围
+	ErrInvalidStockBuckets = errors.New("库存分桶数量必须在 0 到 64 之间")
+	// ErrCouponStockUnlimited 表示不限量的优惠券不需要分桶
+	ErrCouponStockUnlimited = errors.New("不限发行量的优惠券不能分桶")
+	// ErrCouponStockSharded 表示优惠券的库存已分桶，需要先取消分桶才能修改发行量
+	ErrCouponStockSharded = errors.New("优惠券库存已分桶，请先取消分桶再修改发行量")
+	// ErrCouponTotalBelowIssued 表示新的总发行量小于已发行数量
+	ErrCouponTotalBelowIssued = errors.New("总发行量不能小于已发行数量")
+)
+
+// takeCouponStock 在事务中为一次领取扣减优惠券的库存，库存不足时返回 ErrCouponSoldOut。
+// 不分桶时以条件更新原子地增加 issued_quantity，不需要事先锁定优惠券；
+// 分桶时从随机的分桶开始依次尝试，优惠券本身的行不会被修改，同一优惠券的并发领取分散到不同的分桶上。
+// 这一步会锁定被修改的行直到事务结束，因此应作为领取事务的最后一步执行。
+// 与修改分桶数量并发执行时可能返回 ErrCouponSoldOut，但不会超发。
+func takeCouponStock(tx *gorm.DB, coupon *models.Coupon) error {
+	if coupon.StockBuckets == 0 || coupon.TotalQuantity == 0 {
+		res := tx.Model(&models.Coupon{}).
+			Where("coupon_id = ? AND stock_buckets = 0 AND (total_quantity = 0 OR issued_quantity < total_quantity)", coupon.CouponID).
+			UpdateColumn("issued_quantity", gorm.Expr("issued_quantity + 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrCouponSoldOut
+		}
+		return nil
+	}
+
+	for _, bucketNo := range stockBucketProbeOrder(rand.IntN(coupon.StockBuckets), coupon.StockBuckets) {
+		res := tx.Model(&models.CouponStockBucket{}).
+			Where("coupon_id = ? AND bucket_no = ? AND issued < quantity", coupon.CouponID, bucketNo).
+			UpdateColumn("issued", gorm.Expr("issued + 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 1 {
+			return nil
+		}
+	}
+	return ErrCouponSoldOut
+}
+
+// returnCouponStock 在事务中将一张券退回优惠券的库存，返回是否退回成功（已发行数量为 0 时无法退回）。
+// 分桶时优先退回到有已发行数量的分桶；分桶中的发行量已合并到优惠券时，减少优惠券的已发行数量并将库存加到 0 号分桶。
+func returnCouponStock(tx *gorm.DB, couponID uint) (bool, error) {
+	var coupon models.Coupon
+	if err := tx.Unscoped().Select("coupon_id", "stock_buckets").First(&coupon, couponID).Error; err != nil {
+		return false, err
+	}
+
+	if coupon.StockBuckets > 0 {
+		var bucket models.CouponStockBucket
+		err := tx.Where("coupon_id = ? AND issued > 0", couponID).Order("bucket_no").Take(&bucket).Error
+		if err == nil {
+			res := tx.Model(&models.CouponStockBucket{}).
+				Where("coupon_id = ? AND bucket_no = ? AND issued > 0", couponID, bucket.BucketNo).
+				UpdateColumn("issued", gorm.Expr("issued - 1"))
+			return res.RowsAffected == 1, res.Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, err
+		}
+	}
+
+	res := tx.Unscoped().Model(&models.Coupon{}).
+		Where("coupon_id = ? AND issued_quantity > 0", couponID).
+		UpdateColumn("issued_quantity", gorm.Expr("issued_quantity - 1"))
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+	if coupon.StockBuckets > 0 {
+		if err := tx.Model(&models.CouponStockBucket{}).
+			Where("coupon_id = ? AND bucket_no = 0", couponID).
+			UpdateColumn("quantity", gorm.Expr("quantity + 1")).Error; err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// stockBucketProbeOrder 返回领取时依次尝试的分桶序号：从 start 号分桶开始，每个分桶恰好尝试一次
+func stockBucketProbeOrder(start, n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = (start + i) % n
+	}
+	return order
+}
+
+// splitStockBuckets 将 remaining 张剩余库存平均拆分到 n 个分桶中，不能整除时前面的分桶各多分一张
+func splitStockBuckets(couponID uint, remaining, n int) []models.CouponStockBucket {
+	buckets := make([]models.CouponStockBucket, n)
+	for i := range buckets {
+		buckets[i] = models.CouponStockBucket{CouponID: couponID, BucketNo: i, Quantity: remaining / n}
+		if i < remaining%n {
+			buckets[i].Quantity++
+		}
+	}
+	return buckets
+}
+
+// foldBuckets 将各分桶已发行的数量从分桶的库存中扣除并清零，返回合并的已发行数量。
+// 合并前后各分桶的剩余库存（quantity - issued）不变
+func foldBuckets(buckets []models.CouponStockBucket) int {
+	var issued int
+	for i := range buckets {
+		issued += buckets[i].Issued
+		buckets[i].Quantity -= buckets[i].Issued
+		buckets[i].Issued = 0
+	}
+	return issued
+}
+
+// foldStockBuckets 在事务中将各分桶已发行的数量合并到优惠券的 issued_quantity，并相应减少分桶的库存，剩余库存不变。
+// 调用方需要已锁定优惠券的行。
+func foldStockBuckets(tx *gorm.DB, coupon *models.Coupon) error {
+	var buckets []models.CouponStockBucket
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("coupon_id = ?", coupon.CouponID).
+		Order("bucket_no").
+		Find(&buckets).Error; err != nil {
+		return err
+	}
+	issued := foldBuckets(buckets)
+	if issued == 0 {
+		return nil
+	}
+
+	for _, bucket := range buckets {
+		if err := tx.Model(&models.CouponStockBucket{}).
+			Where("coupon_id = ? AND bucket_no = ?", bucket.CouponID, bucket.BucketNo).
+			UpdateColumns(map[string]any{"quantity": bucket.Quantity, "issued": 0}).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Model(&models.Coupon{}).
+		Where("coupon_id = ?", coupon.CouponID).
+		UpdateColumn("issued_quantity", gorm.Expr("issued_quantity + ?", issued)).Error; err != nil {
+		return err
+	}
+	coupon.IssuedQuantity += issued
+	return nil
+}
+
+// loadBucketIssuedQuantity 将分桶中已发行的数量加到 coupons 的 IssuedQuantity 上，
+// 使返回给调用方的已发行数量包括分桶模式下各分桶的领取。只修改内存中的值，修改后的优惠券不能再保存到数据库
+func loadBucketIssuedQuantity(db *gorm.DB, coupons []models.Coupon) error {
+	var ids []uint
+	for _, coupon := range coupons {
+		if coupon.StockBuckets > 0 {
+			ids = append(ids, coupon.CouponID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var buckets []models.CouponStockBucket
+	if err := db.Select("coupon_id", "issued").Where("coupon_id IN ? AND issued > 0", ids).Find(&buckets).Error; err != nil {
+		return err
+	}
+	issued := make(map[uint]int, len(ids))
+	for _, bucket := range buckets {
+		issued[bucket.CouponID] += bucket.Issued
+	}
+	for i := range coupons {
+		coupons[i].IssuedQuantity += issued[coupons[i].CouponID]
+	}
+	return nil
+}
+
+// UpdateCouponStockBuckets 将优惠券的剩余库存平均拆分到 buckets 个分桶中，buckets 为 0 时取消分桶。
+// 已分桶的优惠券会先将各分桶已发行的数量合并到 issued_quantity，再按新的数量重新拆分。
+func (s *CouponService) UpdateCouponStockBuckets(id uint, buckets int) (*models.Coupon, error) {
+	if buckets < 0 || buckets > maxStockBuckets {
+		return nil, ErrInvalidStockBuckets
+	}
+
+	var coupon models.Coupon
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, id).Error; err != nil {
+			return err
+		}
+		if buckets > 0 && coupon.TotalQuantity == 0 {
+			return ErrCouponStockUnlimited
+		}
+
+		if coupon.StockBuckets > 0 {
+			if err := foldStockBuckets(tx, &coupon); err != nil {
+				return err
+			}
+			if err := tx.Where("coupon_id = ?", coupon.CouponID).Delete(&models.CouponStockBucket{}).Error; err != nil {
+				return err
+			}
+		}
+
+		if buckets > 0 {
+			remaining := max(coupon.TotalQuantity-coupon.IssuedQuantity, 0)
+			rows := splitStockBuckets(coupon.CouponID, remaining, buckets)
+			if err := tx.Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+
+		coupon.StockBuckets = buckets
+		return tx.Model(&coupon).UpdateColumn("stock_buckets", buckets).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
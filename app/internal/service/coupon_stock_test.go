@@ -0,0 +1,183 @@
+package service
+
+import (
+	"app/internal/models"
+	"slices"
+	"testing"
+)
+
+// bucketQuantities 返回各分桶分配到的库存
+func bucketQuantities(buckets []models.CouponStockBucket) []int {
+	quantities := make([]int, len(buckets))
+	for i, bucket := range buckets {
+		quantities[i] = bucket.Quantity
+	}
+	return quantities
+}
+
+// bucketIssued 返回各分桶已发行数量之和
+func bucketIssued(buckets []models.CouponStockBucket) int {
+	var issued int
+	for _, bucket := range buckets {
+		issued += bucket.Issued
+	}
+	return issued
+}
+
+// bucketRemaining 返回各分桶剩余库存之和
+func bucketRemaining(buckets []models.CouponStockBucket) int {
+	var remaining int
+	for _, bucket := range buckets {
+		remaining += bucket.Quantity - bucket.Issued
+	}
+	return remaining
+}
+
+// takeBucket 按 takeCouponStock 的条件更新在内存中扣减一张库存，返回扣减的分桶序号
+func takeBucket(buckets []models.CouponStockBucket, start int) (int, bool) {
+	for _, bucketNo := range stockBucketProbeOrder(start, len(buckets)) {
+		if buckets[bucketNo].Issued < buckets[bucketNo].Quantity {
+			buckets[bucketNo].Issued++
+			return bucketNo, true
+		}
+	}
+	return 0, false
+}
+
+func TestSplitStockBuckets(t *testing.T) {
+	tests := []struct {
+		name      string
+		remaining int
+		n         int
+		want      []int
+	}{
+		{"整除", 12, 4, []int{3, 3, 3, 3}},
+		{"余数分给前面的分桶", 10, 3, []int{4, 3, 3}},
+		{"库存少于分桶数量", 2, 4, []int{1, 1, 0, 0}},
+		{"没有剩余库存", 0, 2, []int{0, 0}},
+		{"只有一个分桶", 7, 1, []int{7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buckets := splitStockBuckets(42, tt.remaining, tt.n)
+			if got := bucketQuantities(buckets); !slices.Equal(got, tt.want) {
+				t.Errorf("splitStockBuckets(%d, %d) = %v，应为 %v", tt.remaining, tt.n, got, tt.want)
+			}
+			for i, bucket := range buckets {
+				if bucket.CouponID != 42 || bucket.BucketNo != i || bucket.Issued != 0 {
+					t.Errorf("第 %d 个分桶为 %+v", i, bucket)
+				}
+			}
+		})
+	}
+}
+
+func TestStockBucketProbeOrder(t *testing.T) {
+	tests := []struct {
+		start, n int
+		want     []int
+	}{
+		{0, 1, []int{0}},
+		{0, 4, []int{0, 1, 2, 3}},
+		{2, 4, []int{2, 3, 0, 1}},
+		{3, 4, []int{3, 0, 1, 2}},
+	}
+	for _, tt := range tests {
+		if got := stockBucketProbeOrder(tt.start, tt.n); !slices.Equal(got, tt.want) {
+			t.Errorf("stockBucketProbeOrder(%d, %d) = %v，应为 %v", tt.start, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestFoldBuckets(t *testing.T) {
+	tests := []struct {
+		name       string
+		quantities []int
+		issued     []int
+		want       int
+		wantQty    []int
+	}{
+		{"没有领取", []int{3, 3}, []int{0, 0}, 0, []int{3, 3}},
+		{"部分领取", []int{4, 3, 3}, []int{1, 3, 0}, 4, []int{3, 0, 3}},
+		{"全部领完", []int{2, 2}, []int{2, 2}, 4, []int{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buckets := make([]models.CouponStockBucket, len(tt.quantities))
+			for i := range buckets {
+				buckets[i] = models.CouponStockBucket{BucketNo: i, Quantity: tt.quantities[i], Issued: tt.issued[i]}
+			}
+			remaining := bucketRemaining(buckets)
+			if got := bucketIssued(buckets); got != tt.want {
+				t.Errorf("bucketIssued() = %d，应为 %d", got, tt.want)
+			}
+
+			if got := foldBuckets(buckets); got != tt.want {
+				t.Errorf("foldBuckets() = %d，应为 %d", got, tt.want)
+			}
+			if got := bucketQuantities(buckets); !slices.Equal(got, tt.wantQty) {
+				t.Errorf("合并后各分桶的库存为 %v，应为 %v", got, tt.wantQty)
+			}
+			if got := bucketIssued(buckets); got != 0 {
+				t.Errorf("合并后分桶已发行数量为 %d，应为 0", got)
+			}
+			if got := bucketRemaining(buckets); got != remaining {
+				t.Errorf("合并后剩余库存为 %d，应为 %d", got, remaining)
+			}
+		})
+	}
+}
+
+// TestStockBucketsLifecycle 模拟分桶、领取、重新分桶和取消分桶，校验已发行数量和剩余库存始终与总发行量一致
+func TestStockBucketsLifecycle(t *testing.T) {
+	const total = 10
+	issuedQuantity := 3 // 分桶前已发行的数量
+
+	// 分桶：剩余库存拆分到 3 个分桶
+	buckets := splitStockBuckets(1, total-issuedQuantity, 3)
+	check := func(step string, wantIssued int) {
+		t.Helper()
+		issued := issuedQuantity + bucketIssued(buckets)
+		if issued != wantIssued {
+			t.Errorf("%s: 已发行数量为 %d，应为 %d", step, issued, wantIssued)
+		}
+		if remaining := bucketRemaining(buckets); issued+remaining != total {
+			t.Errorf("%s: 已发行 %d 加剩余 %d 不等于总发行量 %d", step, issued, remaining, total)
+		}
+	}
+	check("分桶后", 3)
+
+	// 领取：从不同的分桶开始尝试，领完剩余的 7 张后不能再领取
+	for i := range total - 3 {
+		if _, ok := takeBucket(buckets, i%len(buckets)); !ok {
+			t.Fatalf("第 %d 次领取失败，库存应当充足", i+1)
+		}
+	}
+	check("领完后", total)
+	if bucketNo, ok := takeBucket(buckets, 0); ok {
+		t.Fatalf("库存已领完时仍从 %d 号分桶领取成功", bucketNo)
+	}
+
+	// 重新分桶：已发行数量合并到优惠券，剩余库存（为 0）重新拆分
+	issuedQuantity += foldBuckets(buckets)
+	check("合并后", total)
+	buckets = splitStockBuckets(1, total-issuedQuantity, 2)
+	check("重新分桶后", total)
+	if _, ok := takeBucket(buckets, 1); ok {
+		t.Fatal("重新分桶后不应有剩余库存")
+	}
+}
+
+func TestStockBucketsTakeSkipsFullBuckets(t *testing.T) {
+	buckets := []models.CouponStockBucket{
+		{BucketNo: 0, Quantity: 2, Issued: 2},
+		{BucketNo: 1, Quantity: 1, Issued: 1},
+		{BucketNo: 2, Quantity: 3, Issued: 1},
+	}
+	for start := range buckets {
+		taken := slices.Clone(buckets)
+		if bucketNo, ok := takeBucket(taken, start); !ok || bucketNo != 2 {
+			t.Errorf("从 %d 号分桶开始领取: 扣减了 %d 号分桶（%v），应扣减 2 号分桶", start, bucketNo, ok)
+		}
+	}
+}
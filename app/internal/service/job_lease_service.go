@@ -0,0 +1,75 @@
+package service
+
+import (
+	"app/internal/models"
+	"app/pkg/database"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// instanceID 标识当前服务实例，用作后台任务租约的持有者
+var instanceID = newInstanceID()
+
+// newInstanceID 生成 "主机名-进程号-随机数" 形式的实例标识，同一主机上的多个进程也互不相同
+func newInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+// acquireJobLease 尝试获取或续期后台任务的租约，租约在 ttl 后过期。
+// 租约不存在、已过期或已由当前实例持有时返回 true；由其他实例持有且未过期时返回 false。
+func acquireJobLease(jobName string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	lease := models.JobLease{JobName: jobName, Owner: instanceID, ExpiresAt: now.Add(ttl)}
+	res := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&lease)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return true, nil
+	}
+
+	res = database.DB.Model(&models.JobLease{}).
+		Where("job_name = ? AND (owner = ? OR expires_at < ?)", jobName, instanceID, now).
+		Updates(map[string]interface{}{"owner": instanceID, "expires_at": now.Add(ttl)})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// releaseJobLease 释放当前实例持有的租约，让其他实例无需等待租约过期即可接手
+func releaseJobLease(jobName string) error {
+	return database.DB.Model(&models.JobLease{}).
+		Where("job_name = ? AND owner = ?", jobName, instanceID).
+		Update("expires_at", time.Now()).Error
+}
+
+// recordJobRun 记录当前实例最近一次执行任务的进度，finishedAt 为 nil 表示仍在执行
+func recordJobRun(jobName string, startedAt time.Time, finishedAt *time.Time, processed int64, runErr error) error {
+	var errMsg string
+	if runErr != nil {
+		errMsg = runErr.Error()
+		if r := []rune(errMsg); len(r) > 255 {
+			errMsg = string(r[:255])
+		}
+	}
+	return database.DB.Model(&models.JobLease{}).
+		Where("job_name = ? AND owner = ?", jobName, instanceID).
+		Updates(map[string]interface{}{
+			"last_started_at":  startedAt,
+			"last_finished_at": finishedAt,
+			"last_processed":   processed,
+			"last_error":       errMsg,
+		}).Error
+}
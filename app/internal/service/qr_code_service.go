@@ -0,0 +1,349 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // 支持 JPEG 格式的 logo
+	_ "image/png"
+	"os"
+	"strings"
+
+	"app/config"
+	"app/internal/models"
+	"app/pkg/database"
+	"app/pkg/qrcode"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrQrCodeNotFound 表示扫码日志中的二维码ID未登记
+	ErrQrCodeNotFound = errors.New("二维码不存在")
+	// ErrQrCodeStoreMismatch 表示二维码不属于扫码日志中的门店
+	ErrQrCodeStoreMismatch = errors.New("二维码不属于该门店")
+	// ErrQrCodeDisabled 表示二维码已停用
+	ErrQrCodeDisabled = errors.New("二维码已停用")
+	// ErrQrCodeWifiMismatch 表示关联的WIFI配置不存在或不属于二维码所在门店
+	ErrQrCodeWifiMismatch = errors.New("WIFI配置不存在或不属于该门店")
+	// ErrQrCodeCouponMismatch 表示关联的优惠券不存在或不适用于二维码所在门店
+	ErrQrCodeCouponMismatch = errors.New("优惠券不存在或不适用于该门店")
+	// ErrQrCodeLogoUnavailable 表示服务端未配置 logo
+	ErrQrCodeLogoUnavailable = errors.New("服务端未配置二维码 logo")
+)
+
+// 二维码图片尺寸限制（像素）
+const (
+	defaultQrCodeImageSize = 512
+	minQrCodeImageSize     = 64
+	maxQrCodeImageSize     = 2048
+)
+
+// QrCodeService 提供了门店二维码相关的业务逻辑
+type QrCodeService struct{}
+
+// newQrCodeID 生成一个随机的二维码ID：16 位小写字母和数字
+func newQrCodeID() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf)), nil
+}
+
+// validateQrCodeRefs 校验二维码关联的WIFI配置和优惠券是否属于同一门店，
+// 优惠券可以是该门店的，也可以是全部门店通用的
+func validateQrCodeRefs(tx *gorm.DB, storeID uint, wifiID, couponID *uint) error {
+	if wifiID != nil {
+		var count int64
+		if err := tx.Model(&models.WifiConfig{}).Where("wifi_id = ? AND store_id = ?", *wifiID, storeID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrQrCodeWifiMismatch
+		}
+	}
+	if couponID != nil {
+		var count int64
+		if err := tx.Model(&models.Coupon{}).
+			Where("coupon_id = ? AND (store_id = ? OR store_id IS NULL)", *couponID, storeID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrQrCodeCouponMismatch
+		}
+	}
+	return nil
+}
+
+// CreateQrCodeInput 定义了登记二维码的输入
+type CreateQrCodeInput struct {
+	StoreID    uint   `json:"store_id" binding:"required"`
+	QrCodeType string `json:"qr_code_type" binding:"omitempty,oneof=STORE EVENT POSTER DESK OTHER"` // 默认为 STORE
+	Name       string `json:"name" binding:"required"`
+	WifiID     *uint  `json:"wifi_id"`
+	CouponID   *uint  `json:"coupon_id"`
+	Remark     string `json:"remark"`
+}
+
+// CreateQrCode 登记一个新的二维码，二维码ID由服务端生成
+func (s *QrCodeService) CreateQrCode(input *CreateQrCodeInput) (*models.QrCode, error) {
+	id, err := newQrCodeID()
+	if err != nil {
+		return nil, err
+	}
+	qrCode := models.QrCode{
+		QrCodeID:   id,
+		StoreID:    input.StoreID,
+		QrCodeType: input.QrCodeType,
+		Name:       input.Name,
+		WifiID:     input.WifiID,
+		CouponID:   input.CouponID,
+		Status:     1, // 默认启用
+		Remark:     input.Remark,
+	}
+	if qrCode.QrCodeType == "" {
+		qrCode.QrCodeType = "STORE"
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := validateQrCodeRefs(tx, qrCode.StoreID, qrCode.WifiID, qrCode.CouponID); err != nil {
+			return err
+		}
+		return tx.Create(&qrCode).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &qrCode, nil
+}
+
+// GetQrCodeByID 根据ID获取二维码详情
+func (s *QrCodeService) GetQrCodeByID(id string) (*models.QrCode, error) {
+	var qrCode models.QrCode
+	err := database.DB.WithContext(context.Background()).Where("qr_code_id = ?", id).First(&qrCode).Error
+	return &qrCode, err
+}
+
+// GetQrCodesInput 定义了查询二维码列表的输入
+type GetQrCodesInput struct {
+	StoreID    uint   `form:"store_id"`
+	QrCodeType string `form:"qr_code_type"`
+	Status     *int8  `form:"status"`
+	Page       int    `form:"page"`
+	PageSize   int    `form:"pageSize"`
+}
+
+// GetQrCodes 查询二维码列表（分页和过滤）
+func (s *QrCodeService) GetQrCodes(input *GetQrCodesInput) ([]models.QrCode, int64, error) {
+	var qrCodes []models.QrCode
+	var total int64
+
+	db := database.DB.WithContext(context.Background()).Model(&models.QrCode{})
+	if input.StoreID != 0 {
+		db = db.Where("store_id = ?", input.StoreID)
+	}
+	if input.QrCodeType != "" {
+		db = db.Where("qr_code_type = ?", input.QrCodeType)
+	}
+	if input.Status != nil {
+		db = db.Where("status = ?", *input.Status)
+	}
+
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if input.Page <= 0 {
+		input.Page = 1
+	}
+	if input.PageSize <= 0 {
+		input.PageSize = 10
+	}
+	offset := (input.Page - 1) * input.PageSize
+
+	err := db.Order("created_at DESC").Offset(offset).Limit(input.PageSize).Find(&qrCodes).Error
+	return qrCodes, total, err
+}
+
+// UpdateQrCodeInput 定义了更新二维码的输入，二维码所属门店不能修改
+type UpdateQrCodeInput struct {
+	QrCodeType string  `json:"qr_code_type" binding:"omitempty,oneof=STORE EVENT POSTER DESK OTHER"`
+	Name       string  `json:"name"`
+	WifiID     *uint   `json:"wifi_id"`   // 为 0 表示解除关联
+	CouponID   *uint   `json:"coupon_id"` // 为 0 表示解除关联
+	Status     *int8   `json:"status"`
+	Remark     *string `json:"remark"`
+}
+
+// UpdateQrCode 更新一个已登记的二维码
+func (s *QrCodeService) UpdateQrCode(id string, input *UpdateQrCodeInput) (*models.QrCode, error) {
+	var qrCode models.QrCode
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("qr_code_id = ?", id).First(&qrCode).Error; err != nil {
+			return err
+		}
+
+		if input.QrCodeType != "" {
+			qrCode.QrCodeType = input.QrCodeType
+		}
+		if input.Name != "" {
+			qrCode.Name = input.Name
+		}
+		if input.WifiID != nil {
+			qrCode.WifiID = input.WifiID
+			if *input.WifiID == 0 {
+				qrCode.WifiID = nil
+			}
+		}
+		if input.CouponID != nil {
+			qrCode.CouponID = input.CouponID
+			if *input.CouponID == 0 {
+				qrCode.CouponID = nil
+			}
+		}
+		if input.Status != nil {
+			qrCode.Status = *input.Status
+		}
+		if input.Remark != nil {
+			qrCode.Remark = *input.Remark
+		}
+
+		if err := validateQrCodeRefs(tx, qrCode.StoreID, qrCode.WifiID, qrCode.CouponID); err != nil {
+			return err
+		}
+		return tx.Save(&qrCode).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &qrCode, nil
+}
+
+// DeleteQrCode 删除一个二维码，已有扫码日志中的二维码ID保持不变
+func (s *QrCodeService) DeleteQrCode(id string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("qr_code_id = ?", id).Delete(&models.QrCode{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// QrCodeContent 返回编码在二维码中的内容
+func QrCodeContent(id string) string {
+	prefix := config.Cfg.QRCode.ContentURLPrefix
+	if prefix == "" {
+		scheme := "http"
+		if config.Cfg.Server.UseHTTPS {
+			scheme = "https"
+		}
+		prefix = fmt.Sprintf("%s://%s/q/", scheme, config.Cfg.Server.Domain)
+	}
+	return prefix + id
+}
+
+// RenderQrCodeInput 定义了渲染二维码图片的输入
+type RenderQrCodeInput struct {
+	Format string `form:"format" binding:"omitempty,oneof=png svg"` // 默认为 png
+	Size   int    `form:"size"`                                     // 图片边长（像素），默认 512，范围 64 到 2048
+	Margin int    `form:"margin" binding:"omitempty,min=0,max=16"`  // 静区宽度（模块数），默认 4，最大 16
+	Logo   bool   `form:"logo"`                                     // 是否在中心叠加服务端配置的 logo
+}
+
+// RenderedQrCode 是渲染后的二维码图片
+type RenderedQrCode struct {
+	QrCodeID    string `json:"qr_code_id"`
+	Content     string `json:"content"`      // 编码在二维码中的内容
+	Format      string `json:"format"`       // png 或 svg
+	ContentType string `json:"content_type"` // 图片的 MIME 类型
+	Image       []byte `json:"image"`        // 图片内容，JSON 中为 base64 编码
+}
+
+// loadQrCodeLogo 读取服务端配置的 logo 图片
+func loadQrCodeLogo() (image.Image, error) {
+	path := config.Cfg.QRCode.LogoPath
+	if path == "" {
+		return nil, ErrQrCodeLogoUnavailable
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取二维码 logo 失败: %w", err)
+	}
+	logo, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解析二维码 logo 失败: %w", err)
+	}
+	return logo, nil
+}
+
+// RenderQrCode 将二维码渲染为 PNG 或 SVG 图片
+func (s *QrCodeService) RenderQrCode(id string, input *RenderQrCodeInput) (*RenderedQrCode, error) {
+	qrCode, err := s.GetQrCodeByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := qrcode.Options{Size: input.Size, Margin: input.Margin}
+	if opts.Size == 0 {
+		opts.Size = defaultQrCodeImageSize
+	}
+	opts.Size = min(max(opts.Size, minQrCodeImageSize), maxQrCodeImageSize)
+
+	// 叠加 logo 会遮挡部分模块，使用最高纠错等级
+	level := qrcode.Medium
+	if input.Logo {
+		if opts.Logo, err = loadQrCodeLogo(); err != nil {
+			return nil, err
+		}
+		level = qrcode.High
+	}
+
+	content := QrCodeContent(qrCode.QrCodeID)
+	code, err := qrcode.Encode([]byte(content), level)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := &RenderedQrCode{QrCodeID: qrCode.QrCodeID, Content: content, Format: input.Format}
+	var buf bytes.Buffer
+	if rendered.Format == "svg" {
+		rendered.ContentType = "image/svg+xml"
+		err = code.SVG(&buf, opts)
+	} else {
+		rendered.Format, rendered.ContentType = "png", "image/png"
+		err = code.PNG(&buf, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rendered.Image = buf.Bytes()
+	return rendered, nil
+}
+
+// checkScanQrCode 校验扫码日志中的二维码已登记、处于启用状态并且属于该门店
+func checkScanQrCode(tx *gorm.DB, storeID uint, qrCodeID string) (*models.QrCode, error) {
+	var qrCode models.QrCode
+	if err := tx.Where("qr_code_id = ?", qrCodeID).First(&qrCode).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrQrCodeNotFound
+		}
+		return nil, err
+	}
+	if qrCode.StoreID != storeID {
+		return nil, ErrQrCodeStoreMismatch
+	}
+	if qrCode.Status != 1 {
+		return nil, ErrQrCodeDisabled
+	}
+	return &qrCode, nil
+}
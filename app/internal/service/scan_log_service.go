@@ -1,6 +1,7 @@
 package service
 
 import (
+	"app/config"
 	"app/internal/models"
 	"app/pkg/database"
 	"context"
@@ -16,15 +17,15 @@ type ScanLogService struct{}
 // CreateScanLogInput 定义了记录扫码日志的输入
 type CreateScanLogInput struct {
 	StoreID            uint    `json:"store_id" binding:"required"`
-	UserUnionID        string  `json:"user_union_id" binding:"required"`
+	UserUnionID        string  `json:"user_union_id"` // 携带用户令牌时可省略
 	DeviceInfo         string  `json:"device_info"`
 	IPAddress          string  `json:"ip_address"`
 	NetworkType        string  `json:"network_type"`
 	LocationLat        float64 `json:"location_lat"`
 	LocationLng        float64 `json:"location_lng"`
 	MiniProgramVersion string  `json:"mini_program_version"`
-	QrCodeType         string  `json:"qr_code_type"`
-	QrCodeID           string  `json:"qr_code_id"`
+	QrCodeType         string  `json:"qr_code_type"` // 携带二维码ID时以登记的二维码类型为准
+	QrCodeID           string  `json:"qr_code_id"`   // 必须是已登记并属于该门店的二维码
 	SystemInfo         string  `json:"system_info"`
 	Brand              string  `json:"brand"`
 	Model              string  `json:"model"`
@@ -32,7 +33,8 @@ type CreateScanLogInput struct {
 	Referer            string  `json:"referer"`
 }
 
-// CreateScanLog 创建一条新的扫码日志
+// CreateScanLog 创建一条新的扫码日志。
+// 携带二维码ID时，二维码必须已登记、处于启用状态并且属于该门店。
 func (s *ScanLogService) CreateScanLog(input *CreateScanLogInput) (*models.ScanLog, error) {
 	log := models.ScanLog{
 		StoreID:            input.StoreID,
@@ -52,8 +54,28 @@ func (s *ScanLogService) CreateScanLog(input *CreateScanLogInput) (*models.ScanL
 		Referer:            input.Referer,
 	}
 
+	// 同时创建连接会话，签发的票据用于后续获取WIFI密码和上报连接结果
 	err := database.DB.Transaction(func(tx *gorm.DB) error {
-		return tx.Create(&log).Error
+		if log.QrCodeID != "" {
+			qrCode, err := checkScanQrCode(tx, log.StoreID, log.QrCodeID)
+			if err != nil {
+				return err
+			}
+			log.QrCodeType = qrCode.QrCodeType
+		}
+		if err := tx.Create(&log).Error; err != nil {
+			return err
+		}
+		if err := adjustStoreCounter(tx, log.StoreID, storeCounterScan, 1); err != nil {
+			return err
+		}
+		ticket, expiresAt, err := openConnectSession(tx, &log)
+		if err != nil {
+			return err
+		}
+		log.ConnectTicket = ticket
+		log.ConnectTicketExpiresAt = &expiresAt
+		return nil
 	})
 	if err != nil {
 		return nil, err
@@ -108,6 +130,7 @@ func (s *ScanLogService) GetScanLogs(input *GetScanLogsInput) ([]models.ScanLog,
 
 // UpdateScanLogResultInput 定义了更新扫码日志结果的输入
 type UpdateScanLogResultInput struct {
+	Ticket            string `json:"ticket" binding:"required"` // 创建扫码日志时签发的连接票据
 	SuccessFlag       bool   `json:"success_flag"`
 	FailReasonCode    string `json:"fail_reason_code,omitempty"`
 	FailReasonMessage string `json:"fail_reason_message,omitempty"`
@@ -116,8 +139,11 @@ type UpdateScanLogResultInput struct {
 	WifiSignal        int8   `json:"wifi_signal,omitempty"`
 }
 
-// UpdateScanLogResult 更新扫码日志的连接结果
-func (s *ScanLogService) UpdateScanLogResult(logID uint64, input *UpdateScanLogResultInput) error {
+// UpdateScanLogResult 更新扫码日志的连接结果，并结束对应的连接会话。
+// 必须出示创建扫码日志时签发的连接票据，上报连接成功前必须已经获取过WIFI密码。
+// userUnionID 不为空时只能更新该用户的日志，日志不属于该用户时与不存在一样返回 gorm.ErrRecordNotFound。
+// 连接成功时按营销活动规则自动发放优惠券，返回满足触发条件的活动的发放结果；活动发放失败不影响连接结果的上报。
+func (s *ScanLogService) UpdateScanLogResult(logID uint64, userUnionID string, input *UpdateScanLogResultInput) ([]CampaignReward, error) {
 	updateData := map[string]interface{}{
 		"success_flag":        input.SuccessFlag,
 		"fail_reason_code":    input.FailReasonCode,
@@ -127,7 +153,30 @@ func (s *ScanLogService) UpdateScanLogResult(logID uint64, input *UpdateScanLogR
 		"wifi_signal":         input.WifiSignal,
 	}
 
-	return database.DB.Transaction(func(tx *gorm.DB) error {
+	var scanLog models.ScanLog
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		session, err := lockConnectSession(tx, logID, userUnionID, input.Ticket)
+		if err != nil {
+			return err
+		}
+		if input.SuccessFlag && session.Status != models.ConnectSessionCredentialIssued {
+			return ErrCredentialNotIssued
+		}
+
+		// 连接成功后开始占用WIFI连接数，直到主动断开或超过占用时长
+		now := time.Now()
+		sessionUpdates := map[string]interface{}{
+			"status":    models.ConnectSessionFailed,
+			"closed_at": now,
+		}
+		if input.SuccessFlag {
+			sessionUpdates["status"] = models.ConnectSessionSucceeded
+			sessionUpdates["connected_until"] = now.Add(config.Cfg.Security.WifiConnectionTTL)
+		}
+		if err := tx.Model(session).Updates(sessionUpdates).Error; err != nil {
+			return err
+		}
+
 		result := tx.Model(&models.ScanLog{}).Where("log_id = ?", logID).UpdateColumns(updateData)
 		if result.Error != nil {
 			return result.Error
@@ -135,8 +184,48 @@ func (s *ScanLogService) UpdateScanLogResult(logID uint64, input *UpdateScanLogR
 		if result.RowsAffected == 0 {
 			return gorm.ErrRecordNotFound
 		}
+		// 每个会话只能上报一次结果，因此连接成功次数不会重复累加
+		if input.SuccessFlag {
+			if err := adjustStoreCounter(tx, session.StoreID, storeCounterSuccessScan, 1); err != nil {
+				return err
+			}
+			return tx.First(&scanLog, logID).Error
+		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !input.SuccessFlag {
+		return nil, nil
+	}
+	return issueCampaignRewards(&scanLog), nil
+}
+
+// DisconnectInput 定义了断开WIFI连接的输入
+type DisconnectInput struct {
+	Ticket string `json:"ticket" binding:"required"` // 创建扫码日志时签发的连接票据
+}
+
+// Disconnect 记录用户已断开WIFI连接，提前释放占用的连接数。重复断开不会报错。
+// userUnionID 不为空时只能操作该用户的日志，日志不属于该用户时与不存在一样返回 gorm.ErrRecordNotFound。
+func (s *ScanLogService) Disconnect(logID uint64, userUnionID string, input *DisconnectInput) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		session, err := findConnectSession(tx, logID, userUnionID, input.Ticket)
+		if err != nil {
+			return err
+		}
+		if session.Status != models.ConnectSessionSucceeded {
+			return ErrNotConnected
+		}
+
+		now := time.Now()
+		if session.ConnectedUntil == nil || session.ConnectedUntil.Before(now) {
+			return nil
+		}
+		return tx.Model(session).Update("connected_until", now).Error
+	})
 }
 
 // DailyScanCountResult 定义了每日扫码量的返回结构
@@ -224,7 +313,7 @@ func (s *ScanLogService) GetFailedScanLogs(input *GetFailedScanLogsInput) ([]mod
 
 // GetUserScanLogsInput 定义获取用户扫码日志的输入参数
 type GetUserScanLogsInput struct {
-	UserUnionID string  `form:"user_union_id" binding:"required"`
+	UserUnionID string  `form:"user_union_id"` // 携带用户令牌时可省略
 	SuccessFlag *bool   `form:"success_flag"`
 	StartDate   *string `form:"start_date"` // 格式: YYYY-MM-DD
 	EndDate     *string `form:"end_date"`   // 格式: YYYY-MM-DD
@@ -75,6 +75,8 @@ func (s *StatsService) GetStoreStats() (any, error) {
 type WifiTotalUsageStats struct {
 	TotalConnections      int64   `json:"total_connections"`
 	SuccessfulConnections int64   `json:"successful_connections"`
+	TimedOutConnections   int64   `json:"timed_out_connections"` // 超时未上报结果而被自动关闭的连接
+	PendingConnections    int64   `json:"pending_connections"`   // 连接会话尚未结束，不计入成功率
 	SuccessRate           float64 `json:"success_rate"`
 }
 
@@ -114,8 +116,29 @@ func (s *StatsService) GetWifiUsageStats(storeID *uint) (any, error) {
 	if err := query.Where("success_flag = ?", 1).Count(&stats.SuccessfulConnections).Error; err != nil {
 		return nil, err
 	}
-	if stats.TotalConnections > 0 {
-		stats.SuccessRate = float64(stats.SuccessfulConnections) / float64(stats.TotalConnections)
+
+	// 连接会话尚未结束的扫码还没有结果，不计入成功率
+	sessionQuery := db.Model(&models.ConnectSession{})
+	if storeID != nil {
+		sessionQuery = sessionQuery.Where("store_id = ?", *storeID)
+	}
+	var sessionCounts []struct {
+		Status string
+		Count  int64
+	}
+	if err := sessionQuery.Select("status, count(*) as count").Group("status").Find(&sessionCounts).Error; err != nil {
+		return nil, err
+	}
+	for _, sc := range sessionCounts {
+		switch sc.Status {
+		case models.ConnectSessionOpen, models.ConnectSessionCredentialIssued:
+			stats.PendingConnections += sc.Count
+		case models.ConnectSessionTimedOut:
+			stats.TimedOutConnections += sc.Count
+		}
+	}
+	if finished := stats.TotalConnections - stats.PendingConnections; finished > 0 {
+		stats.SuccessRate = float64(stats.SuccessfulConnections) / float64(finished)
 	}
 
 	// 2. 按加密类型统计 (需要关联 wifi_config 表，此处简化为直接从 scan_log 中获取，实际情况可能需要调整)
@@ -262,6 +285,7 @@ type CouponOverallStats struct {
 	TotalUsed     int64   `json:"total_used"`     // 总使用
 	UsageRate     float64 `json:"usage_rate"`     // 核销率
 	TotalDeducted float64 `json:"total_deducted"` // 总抵扣金额
+	TotalExpired  int64   `json:"total_expired"`  // 领取后过期未使用
 }
 
 // CouponStatsByType 定义了按类型统计的结果
@@ -269,6 +293,7 @@ type CouponStatsByType struct {
 	CouponType string `json:"coupon_type"`
 	Issued     int64  `json:"issued"`
 	Used       int64  `json:"used"`
+	Expired    int64  `json:"expired"`
 }
 
 // GetCouponStats 用于获取优惠券相关的统计数据
@@ -303,7 +328,7 @@ func (s *StatsService) GetCouponStats(input *GetCouponStatsInput) (any, error) {
 	if input.StoreID != nil {
 		usedQuery = usedQuery.Where("store_id = ?", *input.StoreID)
 	}
-	if err := usedQuery.Where("action_type = 'USE'").Count(&overall.TotalUsed).Error; err != nil {
+	if err := usedQuery.Where("action_type = 'USE' AND status = 1").Count(&overall.TotalUsed).Error; err != nil {
 		return nil, err
 	}
 
@@ -318,7 +343,21 @@ func (s *StatsService) GetCouponStats(input *GetCouponStatsInput) (any, error) {
 	if input.StoreID != nil {
 		deductedQuery = deductedQuery.Where("store_id = ?", *input.StoreID)
 	}
-	if err := deductedQuery.Where("action_type = 'USE'").Select("sum(amount_deducted)").Scan(&overall.TotalDeducted).Error; err != nil {
+	if err := deductedQuery.Where("action_type = 'USE' AND status = 1").Select("sum(amount_deducted)").Scan(&overall.TotalDeducted).Error; err != nil {
+		return nil, err
+	}
+	// 过期处理任务为每张过期未使用的用户优惠券记录一条关联领取日志的 EXPIRE 日志，优惠券本身过期的日志不关联领取日志
+	expiredQuery := db.Model(&models.CouponLog{})
+	if input.StartDate != "" {
+		expiredQuery = expiredQuery.Where("action_time >= ?", input.StartDate)
+	}
+	if input.EndDate != "" {
+		expiredQuery = expiredQuery.Where("action_time < ?", input.EndDate+" 23:59:59")
+	}
+	if input.StoreID != nil {
+		expiredQuery = expiredQuery.Where("store_id = ?", *input.StoreID)
+	}
+	if err := expiredQuery.Where("action_type = 'EXPIRE' AND related_log_id IS NOT NULL").Count(&overall.TotalExpired).Error; err != nil {
 		return nil, err
 	}
 	if overall.TotalIssued > 0 {
@@ -346,15 +385,20 @@ func (s *StatsService) GetCouponStats(input *GetCouponStatsInput) (any, error) {
 		usedSubQuery = usedSubQuery.Where("action_time < ?", input.EndDate+" 23:59:59")
 	}
 
-	if err := db.Table("coupon").
+	byTypeQuery := db.Table("coupon")
+	if input.StoreID != nil {
+		byTypeQuery = byTypeQuery.Where("coupon.store_id = ?", *input.StoreID)
+	}
+	if err := byTypeQuery.
 		Select(`
 			coupon_type,
 			(SELECT count(*) FROM coupon_log WHERE coupon_log.coupon_id = coupon.coupon_id AND coupon_log.action_type = 'RECEIVE') as issued,
-			(SELECT count(*) FROM coupon_log WHERE coupon_log.coupon_id = coupon.coupon_id AND coupon_log.action_type = 'USE') as used
+			(SELECT count(*) FROM coupon_log WHERE coupon_log.coupon_id = coupon.coupon_id AND coupon_log.action_type = 'USE' AND coupon_log.status = 1) as used,
+			(SELECT count(*) FROM coupon_log WHERE coupon_log.coupon_id = coupon.coupon_id AND coupon_log.action_type = 'EXPIRE' AND coupon_log.related_log_id IS NOT NULL) as expired
 		`).
 		Group("coupon_type").
 		Find(&byType).Error; err != nil {
-		// 注意: 上面的SQL没有加入时间范围和门店筛选，因为它比较复杂。
+		// 注意: 上面的SQL没有加入时间范围筛选，因为它比较复杂。
 		// 在实际生产中，可能需要更精细的SQL或数据仓库来处理这类复杂聚合。
 		// 此处为了演示，我们先用一个简化的全局统计。
 	}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"app/internal/models"
+	"app/pkg/database"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 门店计数器对应的 store 表字段
+const (
+	storeCounterWifi         = "wifi_count"
+	storeCounterScan         = "scan_count"
+	storeCounterSuccessScan  = "success_scan_count"
+	storeCounterCouponIssued = "coupon_issued_count"
+)
+
+// StoreCounterService 提供了门店计数器（WIFI数量、扫码次数、连接成功次数、优惠券领取数量）的修复功能。
+// 计数器平时由各写操作在同一事务中增减，只有数据不一致时才需要重新计算。
+type StoreCounterService struct{}
+
+// adjustStoreCounter 在事务中将门店的计数器增加 delta（可以为负数），不更新 updated_at。
+// 已删除的门店同样会被更新，恢复后计数器仍然准确。
+func adjustStoreCounter(tx *gorm.DB, storeID uint, column string, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	return tx.Unscoped().Model(&models.Store{}).
+		Where("store_id = ?", storeID).
+		UpdateColumn(column, gorm.Expr(column+" + ?", delta)).Error
+}
+
+// storeCountRow 是按门店分组计数的查询结果
+type storeCountRow struct {
+	StoreID uint
+	Count   int64
+}
+
+// countByStore 按门店统计 query 中的记录数
+func countByStore(query *gorm.DB, storeIDs []uint) (map[uint]int64, error) {
+	var rows []storeCountRow
+	if err := query.Select("store_id, count(*) as count").
+		Where("store_id IN ?", storeIDs).
+		Group("store_id").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.StoreID] = row.Count
+	}
+	return counts, nil
+}
+
+// RecomputeStoreCounters 根据 wifi_config、scan_log 和 coupon_log 重新计算一批门店（包括已删除的门店）的计数器，返回被修正的门店数量。
+// 已删除的WIFI配置不计入 wifi_count。
+// 门店行在统计前被锁定，与之并发的写操作会等待重新计算完成后再增减计数器，因此结果不会被覆盖。
+func (s *StoreCounterService) RecomputeStoreCounters(storeIDs []uint) (int, error) {
+	if len(storeIDs) == 0 {
+		return 0, nil
+	}
+
+	var fixed int
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var stores []models.Store
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("store_id", "wifi_count", "scan_count", "success_scan_count", "coupon_issued_count").
+			Where("store_id IN ?", storeIDs).
+			Order("store_id").
+			Find(&stores).Error; err != nil {
+			return err
+		}
+
+		wifiCounts, err := countByStore(tx.Model(&models.WifiConfig{}), storeIDs)
+		if err != nil {
+			return fmt.Errorf("统计WIFI数量失败: %w", err)
+		}
+		scanCounts, err := countByStore(tx.Model(&models.ScanLog{}), storeIDs)
+		if err != nil {
+			return fmt.Errorf("统计扫码次数失败: %w", err)
+		}
+		successCounts, err := countByStore(tx.Model(&models.ScanLog{}).Where("success_flag = ?", true), storeIDs)
+		if err != nil {
+			return fmt.Errorf("统计连接成功次数失败: %w", err)
+		}
+		couponCounts, err := countByStore(tx.Model(&models.CouponLog{}).Where("action_type = ? AND status = 1", "RECEIVE"), storeIDs)
+		if err != nil {
+			return fmt.Errorf("统计优惠券领取数量失败: %w", err)
+		}
+
+		for _, store := range stores {
+			id := store.StoreID
+			if int64(store.WifiCount) == wifiCounts[id] && store.ScanCount == scanCounts[id] &&
+				store.SuccessScanCount == successCounts[id] && store.CouponIssuedCount == couponCounts[id] {
+				continue
+			}
+			if err := tx.Unscoped().Model(&models.Store{}).Where("store_id = ?", id).UpdateColumns(map[string]interface{}{
+				storeCounterWifi:         wifiCounts[id],
+				storeCounterScan:         scanCounts[id],
+				storeCounterSuccessScan:  successCounts[id],
+				storeCounterCouponIssued: couponCounts[id],
+			}).Error; err != nil {
+				return err
+			}
+			fixed++
+		}
+		return nil
+	})
+	return fixed, err
+}
+
+// RecomputeAllStoreCounters 分批重新计算所有门店的计数器，每批最多 batchSize 个门店，返回被修正的门店数量
+func (s *StoreCounterService) RecomputeAllStoreCounters(batchSize int) (int, error) {
+	var fixed int
+	var lastID uint
+	for {
+		var storeIDs []uint
+		if err := database.DB.Unscoped().Model(&models.Store{}).
+			Where("store_id > ?", lastID).
+			Order("store_id").
+			Limit(batchSize).
+			Pluck("store_id", &storeIDs).Error; err != nil {
+			return fixed, err
+		}
+		if len(storeIDs) == 0 {
+			return fixed, nil
+		}
+
+		n, err := s.RecomputeStoreCounters(storeIDs)
+		fixed += n
+		if err != nil {
+			return fixed, err
+		}
+		lastID = storeIDs[len(storeIDs)-1]
+	}
+}
@@ -4,11 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"app/internal/models"
 	"app/pkg/database"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrStoreDeleted 表示所属门店已被删除，需要先恢复门店
+	ErrStoreDeleted = errors.New("所属门店已删除，请先恢复门店")
 )
 
 // StoreService 提供了门店相关的业务逻辑
@@ -88,6 +95,8 @@ type GetStoresInput struct {
 	Latitude  float64 `form:"lat"`
 	Longitude float64 `form:"lng"`
 	Radius    float64 `form:"radius"` // 半径，单位：公里
+
+	IncludeDeleted bool `form:"include_deleted"` // 是否包含已删除的门店
 }
 
 // GetStores 获取门店列表，支持分页、区域筛选和附近查询
@@ -96,6 +105,9 @@ func (s *StoreService) GetStores(input *GetStoresInput) ([]models.Store, int64,
 	var total int64
 
 	query := database.DB.Model(&models.Store{})
+	if input.IncludeDeleted {
+		query = query.Unscoped()
+	}
 
 	// 区域筛选
 	if input.Province != "" {
@@ -226,23 +238,79 @@ func (s *StoreService) UpdateStore(id uint, input *UpdateStoreInput) (*models.St
 	return &store, nil
 }
 
-// DeleteStore 从数据库中删除一个门店。
-// 它在一个事务中完成操作。
+// DeleteStore 软删除一个门店。
+// 门店的WIFI配置和该门店专属的优惠券在同一事务中以相同的删除时间一并软删除，恢复门店时一并恢复；
+// 扫码日志和优惠券日志保持不变，仍然关联到已删除的门店。
 func (s *StoreService) DeleteStore(id uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var store models.Store
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("store_id").First(&store, id).Error; err != nil {
+			return err
+		}
+
+		deletedAt := time.Now()
+		wifis := tx.Model(&models.WifiConfig{}).Where("store_id = ?", id).UpdateColumn("deleted_at", deletedAt)
+		if wifis.Error != nil {
+			return wifis.Error
+		}
+		if err := tx.Model(&models.Coupon{}).Where("store_id = ?", id).UpdateColumn("deleted_at", deletedAt).Error; err != nil {
+			return err
+		}
+		if err := adjustStoreCounter(tx, id, storeCounterWifi, -int(wifis.RowsAffected)); err != nil {
+			return err
+		}
+		return tx.Model(&store).UpdateColumn("deleted_at", deletedAt).Error
+	})
+}
+
+// RestoreStore 恢复一个已删除的门店，以及删除门店时一并删除的WIFI配置和优惠券。
+// 在删除门店之前就已单独删除的WIFI配置和优惠券不会被恢复。门店未被删除时直接返回该门店。
+func (s *StoreService) RestoreStore(id uint) (*models.Store, error) {
+	var store models.Store
 	err := database.DB.Transaction(func(tx *gorm.DB) error {
-		// 执行删除操作
-		result := tx.Delete(&models.Store{}, id)
-		if result.Error != nil {
-			return result.Error
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&store, id).Error; err != nil {
+			return err
 		}
-		// 如果未找到记录，GORM v2的Delete不会返回ErrRecordNotFound，而是返回RowsAffected=0。
-		// 我们需要检查受影响的行数来确定记录是否存在。
-		if result.RowsAffected == 0 {
-			return gorm.ErrRecordNotFound // 手动返回记录未找到的错误
+		if !store.DeletedAt.Valid {
+			return nil
 		}
+
+		deletedAt := store.DeletedAt.Time
+		wifis := tx.Unscoped().Model(&models.WifiConfig{}).
+			Where("store_id = ? AND deleted_at = ?", id, deletedAt).
+			UpdateColumn("deleted_at", nil)
+		if wifis.Error != nil {
+			return wifis.Error
+		}
+		if err := tx.Unscoped().Model(&models.Coupon{}).
+			Where("store_id = ? AND deleted_at = ?", id, deletedAt).
+			UpdateColumn("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&store).UpdateColumn("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := adjustStoreCounter(tx, id, storeCounterWifi, int(wifis.RowsAffected)); err != nil {
+			return err
+		}
+
+		store.DeletedAt = gorm.DeletedAt{}
+		store.WifiCount += int(wifis.RowsAffected)
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
 
+// checkStoreNotDeleted 在事务中确认门店存在且未被删除，用于恢复WIFI配置和优惠券之前的检查
+func checkStoreNotDeleted(tx *gorm.DB, storeID uint) error {
+	var store models.Store
+	err := tx.Select("store_id").First(&store, storeID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrStoreDeleted
+	}
 	return err
 }
 
@@ -277,13 +345,10 @@ func (s *StoreService) CreateStoreWithWifi(input *CreateStoreWithWifiInput) (*mo
 		// 2. 如果有WIFI配置，则创建它们
 		if len(input.Wifis) > 0 {
 			for _, wifiInput := range input.Wifis {
-				wifi := models.WifiConfig{
-					StoreID:           store.StoreID, // 关联到刚刚创建的门店ID
-					SSID:              wifiInput.SSID,
-					PasswordEncrypted: wifiInput.PasswordEncrypted,
-					EncryptionType:    wifiInput.EncryptionType,
-					WifiType:          wifiInput.WifiType,
-					MaxConnections:    wifiInput.MaxConnections,
+				// 关联到刚刚创建的门店ID
+				wifi, err := newWifiConfig(store.StoreID, &wifiInput)
+				if err != nil {
+					return err
 				}
 				if err := tx.Create(&wifi).Error; err != nil {
 					// 事务将回滚
@@ -0,0 +1,436 @@
+package service
+
+import (
+	"app/internal/models"
+	"app/pkg/couponcode"
+	"app/pkg/database"
+	"app/pkg/pricing"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrUserCouponUsed 表示用户优惠券已经被使用
+	ErrUserCouponUsed = errors.New("该优惠券已使用")
+	// ErrUserCouponExpired 表示用户优惠券已过期
+	ErrUserCouponExpired = errors.New("该优惠券已过期")
+	// ErrUserCouponRefunded 表示用户优惠券已被退还
+	ErrUserCouponRefunded = errors.New("该优惠券已退还")
+	// ErrCouponDisabled 表示优惠券已被禁用或删除
+	ErrCouponDisabled = errors.New("优惠券已禁用")
+	// ErrCouponNotStarted 表示优惠券尚未到生效时间
+	ErrCouponNotStarted = errors.New("优惠券尚未生效")
+	// ErrCouponStoreMismatch 表示门店专属的优惠券不能在其他门店使用
+	ErrCouponStoreMismatch = errors.New("该优惠券不适用于此门店")
+	// ErrMinPurchaseNotMet 表示订单金额未达到优惠券的最低消费金额
+	ErrMinPurchaseNotMet = pricing.ErrMinPurchaseNotMet
+	// ErrOrderAlreadyRedeemed 表示该订单已经核销过其他优惠券
+	ErrOrderAlreadyRedeemed = errors.New("该订单已使用过其他优惠券")
+	// ErrOrderRefunded 表示该订单核销的优惠券已经退款，不能再次核销
+	ErrOrderRefunded = errors.New("该订单的优惠券已退款，不能再次核销")
+	// ErrRedemptionRefunded 表示该订单核销的优惠券已经退款，不能重复退款
+	ErrRedemptionRefunded = errors.New("该订单的优惠券已退款")
+	// ErrInvalidCouponValue 表示优惠券的类型或面值配置无效，无法计算抵扣金额
+	ErrInvalidCouponValue = pricing.ErrInvalidRule
+	// ErrInvalidOrder 表示订单金额与商品明细不一致或为负数
+	ErrInvalidOrder = pricing.ErrInvalidOrder
+)
+
+// UserCouponService 提供了用户券包相关的业务逻辑
+type UserCouponService struct{}
+
+// newUserCouponCode 生成一个随机的券码（16 位大写字母和数字）
+func newUserCouponCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf), nil
+}
+
+// userCouponExpiresAt 计算券实例的过期时间：优惠券结束时间与领取时间加有效天数中较早者
+func userCouponExpiresAt(coupon *models.Coupon, receivedAt time.Time) time.Time {
+	expiresAt := coupon.EndTime
+	if coupon.ValidityDays > 0 {
+		if t := receivedAt.AddDate(0, 0, coupon.ValidityDays); t.Before(expiresAt) {
+			expiresAt = t
+		}
+	}
+	return expiresAt
+}
+
+// createUserCoupon 在领取优惠券的事务中为用户生成券实例，claimSeq 为用户领取该优惠券的序号，不限领时为 nil；
+// code 为从券码池分配的券码，为空时随机生成
+func createUserCoupon(tx *gorm.DB, coupon *models.Coupon, log *models.CouponLog, claimSeq *int, code string) (*models.UserCoupon, error) {
+	if code == "" {
+		var err error
+		if code, err = newUserCouponCode(); err != nil {
+			return nil, err
+		}
+	}
+	userCoupon := models.UserCoupon{
+		CouponID:     coupon.CouponID,
+		UserUnionID:  log.UserUnionID,
+		StoreID:      log.StoreID,
+		Code:         code,
+		Status:       models.UserCouponUnused,
+		ClaimSeq:     claimSeq,
+		ReceiveLogID: log.LogID,
+		ReceivedAt:   log.ActionTime,
+		ExpiresAt:    userCouponExpiresAt(coupon, log.ActionTime),
+	}
+	if err := tx.Create(&userCoupon).Error; err != nil {
+		return nil, err
+	}
+	return &userCoupon, nil
+}
+
+// markExpired 将已过期但数据库中仍为未使用的券显示为已过期
+func markExpired(userCoupon *models.UserCoupon, now time.Time) {
+	if userCoupon.Status == models.UserCouponUnused && !userCoupon.ExpiresAt.After(now) {
+		userCoupon.Status = models.UserCouponExpired
+	}
+}
+
+// withCoupon 预加载券实例所属的优惠券，优惠券被删除后仍然返回
+func withCoupon(db *gorm.DB) *gorm.DB {
+	return db.Preload("Coupon", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	})
+}
+
+// GetUserCouponsInput 定义了查询用户券包的输入
+type GetUserCouponsInput struct {
+	UserUnionID string `form:"user_union_id"` // 携带用户令牌时可省略
+	Status      string `form:"status" binding:"omitempty,oneof=UNUSED USED EXPIRED REFUNDED"`
+	CouponID    *uint  `form:"coupon_id"`
+	StoreID     *uint  `form:"store_id"` // 领取门店
+	Page        int    `form:"page"`
+	PageSize    int    `form:"pageSize"`
+}
+
+// GetUserCoupons 查询用户券包，按领取时间倒序。
+// 已过期但尚未被更新状态的未使用券按已过期处理，状态筛选同样以此为准。
+func (s *UserCouponService) GetUserCoupons(input *GetUserCouponsInput) ([]models.UserCoupon, int64, error) {
+	var userCoupons []models.UserCoupon
+	var total int64
+	now := time.Now()
+
+	db := database.DB.WithContext(context.Background()).Model(&models.UserCoupon{}).
+		Where("user_union_id = ?", input.UserUnionID)
+	switch input.Status {
+	case models.UserCouponUnused:
+		db = db.Where("status = ? AND expires_at > ?", models.UserCouponUnused, now)
+	case models.UserCouponExpired:
+		db = db.Where("(status = ? OR (status = ? AND expires_at <= ?))", models.UserCouponExpired, models.UserCouponUnused, now)
+	case "":
+	default:
+		db = db.Where("status = ?", input.Status)
+	}
+	if input.CouponID != nil {
+		db = db.Where("coupon_id = ?", *input.CouponID)
+	}
+	if input.StoreID != nil {
+		db = db.Where("store_id = ?", *input.StoreID)
+	}
+
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if input.Page <= 0 {
+		input.Page = 1
+	}
+	if input.PageSize <= 0 {
+		input.PageSize = 10
+	}
+	offset := (input.Page - 1) * input.PageSize
+
+	if err := withCoupon(db).Order("received_at DESC, user_coupon_id DESC").Offset(offset).Limit(input.PageSize).Find(&userCoupons).Error; err != nil {
+		return nil, 0, err
+	}
+	for i := range userCoupons {
+		markExpired(&userCoupons[i], now)
+	}
+	return userCoupons, total, nil
+}
+
+// GetUserCoupon 查询用户的一张券，券不属于该用户时与不存在一样返回 gorm.ErrRecordNotFound
+func (s *UserCouponService) GetUserCoupon(id uint64, userUnionID string) (*models.UserCoupon, error) {
+	var userCoupon models.UserCoupon
+	err := withCoupon(database.DB.WithContext(context.Background())).
+		Where("user_union_id = ?", userUnionID).
+		First(&userCoupon, id).Error
+	if err != nil {
+		return nil, err
+	}
+	markExpired(&userCoupon, time.Now())
+	return &userCoupon, nil
+}
+
+// RedeemCouponInput 定义了核销用户优惠券的输入
+type RedeemCouponInput struct {
+	UserCouponID uint64         `json:"user_coupon_id"`                       // 用户优惠券ID，与券码二选一
+	Code         string         `json:"code"`                                 // 券码，与用户优惠券ID二选一
+	UserUnionID  string         `json:"user_union_id"`                        // 不为空时只能核销该用户的券
+	StoreID      uint           `json:"store_id" binding:"required"`          // 核销门店ID
+	OrderID      string         `json:"order_id" binding:"required,max=64"`   // 订单ID，同一门店的同一订单只能核销一张优惠券
+	OrderAmount  float64        `json:"order_amount" binding:"required,gt=0"` // 商品小计（不含运费）
+	ShippingFee  float64        `json:"shipping_fee" binding:"gte=0"`         // 运费，运费券按运费抵扣
+	Items        []pricing.Item `json:"items"`                                // 商品明细，可选，提供时合计必须与商品小计一致
+}
+
+// RedeemCouponResult 是核销优惠券的结果
+type RedeemCouponResult struct {
+	Redemption *models.CouponRedemption `json:"redemption"`
+	Quote      *pricing.Quote           `json:"quote,omitempty"` // 本次核销的计算明细，重复提交时为空
+	Replayed   bool                     `json:"replayed"`        // 同一订单重复提交时为 true，返回首次核销的结果
+}
+
+// RedeemCoupon 在事务中校验并核销一张用户优惠券，同时记录 USE 日志和核销记录。
+// 校验券的归属、状态和有效期，优惠券的状态、生效时间、适用门店、可用时段和最低消费金额，并按优惠券类型计算抵扣金额。
+// 同一门店的同一订单重复核销同一张券时直接返回首次核销的结果；核销其他券时返回 ErrOrderAlreadyRedeemed。
+func (s *UserCouponService) RedeemCoupon(input *RedeemCouponInput) (*RedeemCouponResult, error) {
+	var result RedeemCouponResult
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. 锁定用户优惠券，同一张券的并发核销串行执行
+		var userCoupon models.UserCoupon
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		if input.UserCouponID != 0 {
+			query = query.Where("user_coupon_id = ?", input.UserCouponID)
+		} else {
+			// 线下手工输入的券码可能带有空格、连字符或小写字母
+			query = query.Where("code = ?", couponcode.Normalize(input.Code))
+		}
+		if input.UserUnionID != "" {
+			query = query.Where("user_union_id = ?", input.UserUnionID)
+		}
+		if err := query.First(&userCoupon).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) && input.UserCouponID == 0 {
+				return couponCodeLookupError(tx, couponcode.Normalize(input.Code))
+			}
+			return err
+		}
+
+		// 2. 同一订单重复提交时返回首次核销的结果
+		var existing models.CouponRedemption
+		err := tx.Where("store_id = ? AND order_id = ?", input.StoreID, input.OrderID).Take(&existing).Error
+		if err == nil {
+			if existing.RefundedAt != nil {
+				return ErrOrderRefunded
+			}
+			if existing.UserCouponID != userCoupon.UserCouponID {
+				return ErrOrderAlreadyRedeemed
+			}
+			result = RedeemCouponResult{Redemption: &existing, Replayed: true}
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// 3. 校验券的状态和有效期
+		now := time.Now()
+		switch userCoupon.Status {
+		case models.UserCouponUsed:
+			return ErrUserCouponUsed
+		case models.UserCouponRefunded:
+			return ErrUserCouponRefunded
+		case models.UserCouponExpired:
+			return ErrUserCouponExpired
+		}
+		if !userCoupon.ExpiresAt.After(now) {
+			return ErrUserCouponExpired
+		}
+
+		// 4. 校验优惠券规则并计算抵扣金额
+		var coupon models.Coupon
+		if err := tx.Unscoped().First(&coupon, userCoupon.CouponID).Error; err != nil {
+			return err
+		}
+		storeID := input.StoreID
+		if err := checkCouponUsable(tx, &coupon, &storeID, now); err != nil {
+			return err
+		}
+		quote, err := pricing.Calculate(couponRule(&coupon), pricing.Order{
+			Items:       input.Items,
+			Subtotal:    input.OrderAmount,
+			ShippingFee: input.ShippingFee,
+		})
+		if err != nil {
+			return err
+		}
+
+		// 5. 记录核销日志和核销记录，并将券标记为已使用
+		log := models.CouponLog{
+			CouponID:       coupon.CouponID,
+			UserUnionID:    userCoupon.UserUnionID,
+			StoreID:        &storeID,
+			ActionType:     "USE",
+			ActionTime:     now,
+			OrderID:        input.OrderID,
+			AmountDeducted: quote.Deduction,
+			Status:         1,
+			Remark:         "核销券码 " + userCoupon.Code,
+		}
+		if err := tx.Create(&log).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&userCoupon).Updates(map[string]interface{}{
+			"status":   models.UserCouponUsed,
+			"used_at":  now,
+			"order_id": input.OrderID,
+		}).Error; err != nil {
+			return err
+		}
+
+		redemption := models.CouponRedemption{
+			StoreID:        input.StoreID,
+			OrderID:        input.OrderID,
+			UserCouponID:   userCoupon.UserCouponID,
+			CouponID:       coupon.CouponID,
+			UserUnionID:    userCoupon.UserUnionID,
+			OrderAmount:    quote.Subtotal,
+			AmountDeducted: quote.Deduction,
+			CouponLogID:    log.LogID,
+		}
+		if err := tx.Create(&redemption).Error; err != nil {
+			// 同一订单并发核销不同的券时，唯一索引保证只有一个成功
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return ErrOrderAlreadyRedeemed
+			}
+			return err
+		}
+		result = RedeemCouponResult{Redemption: &redemption, Quote: quote}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RefundCouponInput 定义了订单退款时退还优惠券的输入
+type RefundCouponInput struct {
+	StoreID      uint   `json:"store_id" binding:"required"`        // 核销门店ID
+	OrderID      string `json:"order_id" binding:"required,max=64"` // 核销时的订单ID
+	RestoreStock bool   `json:"restore_stock"`                      // 券已过期无法返还给用户时，是否将其退回优惠券库存
+	Remark       string `json:"remark" binding:"max=255"`
+}
+
+// RefundCouponResult 是退还优惠券的结果
+type RefundCouponResult struct {
+	RefundLog     *models.CouponLog        `json:"refund_log"`
+	Redemption    *models.CouponRedemption `json:"redemption"`
+	UserCoupon    *models.UserCoupon       `json:"user_coupon"`
+	Restored      bool                     `json:"restored"`       // 券是否已返还给用户（恢复为未使用）
+	StockRestored bool                     `json:"stock_restored"` // 是否已退回优惠券库存
+	CodeVoided    bool                     `json:"code_voided"`    // 退回库存时是否作废了券码池分配的券码，需要补充生成券码才能领取退回的库存
+}
+
+// RefundCoupon 在事务中撤销订单的优惠券核销：记录关联原核销日志的 REFUND 日志，将核销日志标记为已撤销，并标记核销记录的退款时间。
+// 券仍在有效期内时恢复为未使用，返还给用户；否则标记为已退还，此时可以按 RestoreStock 将其退回优惠券库存。
+// 退回库存时券码池分配给该券的券码随之作废，不计入券码总数。
+// 同一订单只能退款一次，重复退款返回 ErrRedemptionRefunded。
+func (s *UserCouponService) RefundCoupon(input *RefundCouponInput) (*RefundCouponResult, error) {
+	var result RefundCouponResult
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 1. 锁定核销记录，同一订单的并发退款串行执行
+		var redemption models.CouponRedemption
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("store_id = ? AND order_id = ?", input.StoreID, input.OrderID).
+			Take(&redemption).Error; err != nil {
+			return err
+		}
+		if redemption.RefundedAt != nil {
+			return ErrRedemptionRefunded
+		}
+
+		var userCoupon models.UserCoupon
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&userCoupon, redemption.UserCouponID).Error; err != nil {
+			return err
+		}
+
+		// 2. 记录退款日志，关联原核销日志
+		now := time.Now()
+		storeID := input.StoreID
+		remark := input.Remark
+		if remark == "" {
+			remark = "订单退款，退还券码 " + userCoupon.Code
+		}
+		refundLog := models.CouponLog{
+			CouponID:       redemption.CouponID,
+			UserUnionID:    redemption.UserUnionID,
+			StoreID:        &storeID,
+			ActionType:     "REFUND",
+			ActionTime:     now,
+			OrderID:        redemption.OrderID,
+			AmountDeducted: redemption.AmountDeducted,
+			Status:         1,
+			Remark:         remark,
+			RelatedLogID:   &redemption.CouponLogID,
+		}
+		if err := tx.Create(&refundLog).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.CouponLog{}).
+			Where("log_id = ?", redemption.CouponLogID).
+			Update("status", models.CouponLogReversed).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&redemption).Updates(map[string]interface{}{
+			"refunded_at":   now,
+			"refund_log_id": refundLog.LogID,
+		}).Error; err != nil {
+			return err
+		}
+		redemption.RefundedAt, redemption.RefundLogID = &now, &refundLog.LogID
+
+		// 3. 券仍在有效期内时返还给用户，否则标记为已退还
+		restored := userCoupon.ExpiresAt.After(now)
+		updates := map[string]interface{}{"status": models.UserCouponRefunded}
+		userCoupon.Status = models.UserCouponRefunded
+		if restored {
+			updates = map[string]interface{}{"status": models.UserCouponUnused, "used_at": nil, "order_id": ""}
+			userCoupon.Status, userCoupon.UsedAt, userCoupon.OrderID = models.UserCouponUnused, nil, ""
+		}
+		if err := tx.Model(&models.UserCoupon{}).Where("user_coupon_id = ?", userCoupon.UserCouponID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		// 4. 券没有返还给用户时，按需退回优惠券库存；返还给用户的券仍然占用库存。
+		// 券码仍属于已退还的券，不能释放给其他用户，退回库存时作废
+		var stockRestored, codeVoided bool
+		if input.RestoreStock && !restored {
+			var err error
+			if stockRestored, err = returnCouponStock(tx, redemption.CouponID); err != nil {
+				return err
+			}
+			if stockRestored {
+				if codeVoided, err = voidPooledCode(tx, userCoupon.UserCouponID, now); err != nil {
+					return err
+				}
+			}
+		}
+
+		result = RefundCouponResult{
+			RefundLog:     &refundLog,
+			Redemption:    &redemption,
+			UserCoupon:    &userCoupon,
+			Restored:      restored,
+			StockRestored: stockRestored,
+			CodeVoided:    codeVoided,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -17,7 +17,7 @@ type UserProfileService struct{}
 
 // CreateOrUpdateUserInput 定义了创建或更新用户时的输入
 type CreateOrUpdateUserInput struct {
-	UserUnionID     string `json:"user_union_id" binding:"required"`
+	UserUnionID     string `json:"user_union_id"` // 携带用户令牌时可省略
 	OpenID          string `json:"open_id"`
 	WechatNickname  string `json:"wechat_nickname"`
 	WechatAvatarURL string `json:"wechat_avatar_url"`
@@ -89,6 +89,29 @@ func (s *UserProfileService) GetUserByOpenID(openID string) (*models.UserProfile
 	return &user, err
 }
 
+// GetOrCreateUserByOpenID 按 OpenID 查找用户档案，不存在时创建一个新档案。
+// 小程序未绑定微信开放平台时没有 UnionID，首次登录的用户以 OpenID 作为档案的 UnionID。
+// 调用方必须已经通过微信校验该 OpenID。
+func (s *UserProfileService) GetOrCreateUserByOpenID(openID string) (*models.UserProfile, error) {
+	var user models.UserProfile
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("open_id = ? OR user_union_id = ?", openID, openID).First(&user).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		user = models.UserProfile{UserUnionID: openID, OpenID: openID}
+		return tx.Create(&user).Error
+	})
+	if err != nil {
+		// 同一用户并发首次登录时，档案可能已由另一个请求创建
+		if existing, findErr := s.GetUserByOpenID(openID); findErr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
 // GetUserByPhone 根据手机号获取用户详情
 func (s *UserProfileService) GetUserByPhone(phone string) (*models.UserProfile, error) {
 	var user models.UserProfile
@@ -155,7 +178,7 @@ func (s *UserProfileService) UnbindPhoneNumber(unionID string) (*models.UserProf
 
 // GetUserScanHistoryInput 定义了获取用户扫码历史的输入参数
 type GetUserScanHistoryInput struct {
-	UserUnionID string `form:"user_union_id" binding:"required"`
+	UserUnionID string `form:"user_union_id"` // 携带用户令牌时可省略
 	Page        int    `form:"page"`
 	PageSize    int    `form:"pageSize"`
 	StartDate   string `form:"start_date"` // 格式: YYYY-MM-DD
@@ -1,46 +1,183 @@
 package service
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"app/config"
 	"app/internal/models"
 	"app/pkg/database"
+	"app/pkg/security"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+const (
+	// wifiPasswordPurpose 是WIFI密码静态加密时绑定的用途
+	wifiPasswordPurpose = "wifi_config.password"
+	// defaultWifiMaxConnections 是创建WIFI配置时未指定最大连接数时使用的值
+	defaultWifiMaxConnections = 50
+)
+
+var (
+	// ErrWifiNotForCustomer 表示该WIFI不对顾客开放，不能下发密码
+	ErrWifiNotForCustomer = errors.New("该WIFI不对顾客开放")
+	// ErrStoreInactive 表示门店不存在或已停用
+	ErrStoreInactive = errors.New("门店不存在或已停用")
+	// ErrScanLogNotFound 表示扫码日志不存在或不属于当前用户
+	ErrScanLogNotFound = errors.New("扫码日志不存在")
+	// ErrScanLogStoreMismatch 表示扫码日志与WIFI不属于同一门店
+	ErrScanLogStoreMismatch = errors.New("扫码日志与WIFI不属于同一门店")
+	// ErrWifiAlreadyReleased 表示该扫码日志已经获取过WIFI密码
+	ErrWifiAlreadyReleased = errors.New("该扫码日志已获取过WIFI密码，请重新扫码")
+)
+
+// WifiAvailability 描述了一个WIFI当前的连接占用情况
+type WifiAvailability struct {
+	WifiID            uint   `json:"wifi_id"`
+	SSID              string `json:"ssid"`
+	ActiveConnections int    `json:"active_connections"`
+	MaxConnections    int    `json:"max_connections"` // 0 表示不限制
+}
+
+// WifiFullError 表示WIFI的连接数已满，Alternatives 为同一门店中仍有空位的其他顾客WIFI
+type WifiFullError struct {
+	Alternatives []WifiAvailability
+}
+
+func (e *WifiFullError) Error() string {
+	if len(e.Alternatives) > 0 {
+		return "该WIFI连接数已满，请连接门店的其他WIFI"
+	}
+	return "该WIFI连接数已满，请稍后再试"
+}
+
 // WifiConfigService 提供了 WIFI 配置相关的业务逻辑
 type WifiConfigService struct{}
 
 // CreateWifiConfigInput 定义了创建 WIFI 配置的输入
 type CreateWifiConfigInput struct {
-	StoreID           uint   `json:"store_id" binding:"required"`
-	SSID              string `json:"ssid" binding:"required"`
-	PasswordEncrypted string `json:"password_encrypted" binding:"required"`
-	EncryptionType    string `json:"encryption_type"`
-	WifiType          string `json:"wifi_type"`
-	MaxConnections    int    `json:"max_connections"`
+	StoreID        uint   `json:"store_id" binding:"required"`
+	SSID           string `json:"ssid" binding:"required"`
+	Password       string `json:"password" binding:"required_without=PasswordEncrypted"` // WIFI密码明文，由服务端加密保存
+	EncryptionType string `json:"encryption_type"`
+	WifiType       string `json:"wifi_type"`
+	MaxConnections *int   `json:"max_connections" binding:"omitempty,min=0"` // 0 表示不限制，不传时为 50
+	// Deprecated: 旧版客户端使用的字段名，与 password 含义相同，仅在 password 为空时使用
+	PasswordEncrypted string `json:"password_encrypted"`
+}
+
+// password 返回提交的WIFI密码，兼容旧版客户端的 password_encrypted 字段
+func (in *CreateWifiConfigInput) password() string {
+	return cmp.Or(in.Password, in.PasswordEncrypted)
+}
+
+// sealWifiPassword 使用服务端主密钥对WIFI密码进行信封加密，并写入配置
+func sealWifiPassword(wifiConfig *models.WifiConfig, password string) error {
+	sealed, err := security.SealSecret(wifiPasswordPurpose, []byte(password))
+	if err != nil {
+		return fmt.Errorf("加密WIFI密码失败: %w", err)
+	}
+	wifiConfig.PasswordEncrypted = sealed.Ciphertext
+	wifiConfig.PasswordDataKey = sealed.DataKey
+	wifiConfig.PasswordKeyID = sealed.KeyID
+	return nil
+}
+
+// openWifiPassword 解密WIFI密码。
+// 服务端加密之前保存的旧数据没有主密钥指纹，按客户端提交的原值返回，由 SealLegacyWifiPasswords 或下发时重新加密。
+func openWifiPassword(wifiConfig *models.WifiConfig) (string, error) {
+	if wifiConfig.PasswordKeyID == "" {
+		return wifiConfig.PasswordEncrypted, nil
+	}
+	password, err := security.OpenSecret(wifiPasswordPurpose, &security.SealedSecret{
+		Ciphertext: wifiConfig.PasswordEncrypted,
+		DataKey:    wifiConfig.PasswordDataKey,
+		KeyID:      wifiConfig.PasswordKeyID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("解密WIFI密码失败: %w", err)
+	}
+	return string(password), nil
+}
+
+// resealWifiPassword 加密保存服务端加密之前保存的明文WIFI密码，只更新密码相关的列
+func resealWifiPassword(tx *gorm.DB, wifiConfig *models.WifiConfig, password string) error {
+	if err := sealWifiPassword(wifiConfig, password); err != nil {
+		return err
+	}
+	return tx.Unscoped().Model(wifiConfig).UpdateColumns(map[string]any{
+		"password_encrypted": wifiConfig.PasswordEncrypted,
+		"password_data_key":  wifiConfig.PasswordDataKey,
+		"password_key_id":    wifiConfig.PasswordKeyID,
+	}).Error
+}
+
+// SealLegacyWifiPasswords 加密所有服务端加密之前保存的明文WIFI密码（包括已删除的WIFI配置），返回处理的数量。
+// 每批锁定 batchSize 条记录并跳过其他实例正在处理的记录，可以在多个实例启动时同时执行
+func (s *WifiConfigService) SealLegacyWifiPasswords(batchSize int) (int, error) {
+	var total int
+	for {
+		var n int
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			var wifiConfigs []models.WifiConfig
+			if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("password_key_id = '' OR password_key_id IS NULL").
+				Limit(batchSize).
+				Find(&wifiConfigs).Error; err != nil {
+				return err
+			}
+			for i := range wifiConfigs {
+				if err := resealWifiPassword(tx, &wifiConfigs[i], wifiConfigs[i].PasswordEncrypted); err != nil {
+					return err
+				}
+			}
+			n = len(wifiConfigs)
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// newWifiConfig 根据输入构建WIFI配置，密码在此加密
+func newWifiConfig(storeID uint, input *CreateWifiConfigInput) (models.WifiConfig, error) {
+	wifiConfig := models.WifiConfig{
+		StoreID:        storeID,
+		SSID:           input.SSID,
+		EncryptionType: input.EncryptionType,
+		WifiType:       input.WifiType,
+		MaxConnections: defaultWifiMaxConnections,
+	}
+	if input.MaxConnections != nil {
+		wifiConfig.MaxConnections = *input.MaxConnections
+	}
+	err := sealWifiPassword(&wifiConfig, input.password())
+	return wifiConfig, err
 }
 
 // CreateWifiConfig 创建一个新的 WIFI 配置
 // 它在一个事务中完成此操作。
 func (s *WifiConfigService) CreateWifiConfig(input *CreateWifiConfigInput) (*models.WifiConfig, error) {
-	wifiConfig := models.WifiConfig{
-		StoreID:           input.StoreID,
-		SSID:              input.SSID,
-		PasswordEncrypted: input.PasswordEncrypted,
-		EncryptionType:    input.EncryptionType,
-		WifiType:          input.WifiType,
-		MaxConnections:    input.MaxConnections,
+	wifiConfig, err := newWifiConfig(input.StoreID, input)
+	if err != nil {
+		return nil, err
 	}
 
-	err := database.DB.Transaction(func(tx *gorm.DB) error {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(&wifiConfig).Error; err != nil {
 			return err
 		}
-		// 可以在此事务中添加其他相关操作，例如更新门店的wifi_count字段
-		return nil
+		return adjustStoreCounter(tx, wifiConfig.StoreID, storeCounterWifi, 1)
 	})
 
 	if err != nil {
@@ -54,20 +191,25 @@ func (s *WifiConfigService) CreateBatchWifiConfigs(inputs []*CreateWifiConfigInp
 	var createdConfigs []models.WifiConfig
 
 	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		storeWifiCount := make(map[uint]int)
 		for _, input := range inputs {
-			config := models.WifiConfig{
-				StoreID:           input.StoreID,
-				SSID:              input.SSID,
-				PasswordEncrypted: input.PasswordEncrypted,
-				EncryptionType:    input.EncryptionType,
-				WifiType:          input.WifiType,
-				MaxConnections:    input.MaxConnections,
+			config, err := newWifiConfig(input.StoreID, input)
+			if err != nil {
+				return err
 			}
 			if err := tx.Create(&config).Error; err != nil {
 				// 如果任何一个创建失败，则回滚整个事务
 				return fmt.Errorf("创建WIFI配置 '%s' 失败: %w", input.SSID, err)
 			}
 			createdConfigs = append(createdConfigs, config)
+			storeWifiCount[config.StoreID]++
+		}
+
+		// 更新每个门店的WIFI数量
+		for storeID, count := range storeWifiCount {
+			if err := adjustStoreCounter(tx, storeID, storeCounterWifi, count); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
@@ -87,10 +229,45 @@ func (s *WifiConfigService) GetWifiConfigByID(id uint) (*models.WifiConfig, erro
 	return &wifiConfig, err
 }
 
-// GetWifiConfigsByStoreID 根据门店ID获取所有WIFI配置
-func (s *WifiConfigService) GetWifiConfigsByStoreID(storeID uint) ([]models.WifiConfig, error) {
+// GetWifiConfigsByStoreID 根据门店ID获取所有WIFI配置，并附带当前占用的连接数。
+// includeDeleted 为 true 时包含已删除的WIFI配置。
+func (s *WifiConfigService) GetWifiConfigsByStoreID(storeID uint, includeDeleted bool) ([]models.WifiConfig, error) {
 	var wifiConfigs []models.WifiConfig
-	err := database.DB.WithContext(context.Background()).Where("store_id = ?", storeID).Find(&wifiConfigs).Error
+	db := database.DB.WithContext(context.Background())
+	query := db.Where("store_id = ?", storeID)
+	if includeDeleted {
+		query = query.Unscoped()
+	}
+	if err := query.Find(&wifiConfigs).Error; err != nil {
+		return nil, err
+	}
+
+	wifiIDs := make([]uint, len(wifiConfigs))
+	for i, wifi := range wifiConfigs {
+		wifiIDs[i] = wifi.WifiID
+	}
+	counts, err := countActiveConnections(db, wifiIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range wifiConfigs {
+		active := counts[wifiConfigs[i].WifiID]
+		wifiConfigs[i].ActiveConnections = &active
+	}
+	return wifiConfigs, nil
+}
+
+// GetWifiConfigByIDWithDeleted 根据ID获取WIFI配置，包括已删除的WIFI配置
+func (s *WifiConfigService) GetWifiConfigByIDWithDeleted(id uint) (*models.WifiConfig, error) {
+	var wifiConfig models.WifiConfig
+	err := database.DB.WithContext(context.Background()).Unscoped().First(&wifiConfig, id).Error
+	return &wifiConfig, err
+}
+
+// GetWifiConfigsByIDs 根据ID列表批量获取WIFI配置，不存在的ID会被忽略
+func (s *WifiConfigService) GetWifiConfigsByIDs(ids []uint) ([]models.WifiConfig, error) {
+	var wifiConfigs []models.WifiConfig
+	err := database.DB.WithContext(context.Background()).Where("wifi_id IN ?", ids).Find(&wifiConfigs).Error
 	return wifiConfigs, err
 }
 
@@ -118,11 +295,13 @@ func (s *WifiConfigService) GetWifiConfigsByStoreAndType(input *GetWifiConfigsBy
 
 // UpdateWifiConfigInput 定义了更新WIFI配置的输入
 type UpdateWifiConfigInput struct {
-	SSID              string `json:"ssid"`
+	SSID           string `json:"ssid"`
+	Password       string `json:"password"` // 为空表示不修改密码
+	EncryptionType string `json:"encryption_type"`
+	WifiType       string `json:"wifi_type"`
+	MaxConnections *int   `json:"max_connections" binding:"omitempty,min=0"` // 0 表示不限制
+	// Deprecated: 旧版客户端使用的字段名，与 password 含义相同，仅在 password 为空时使用
 	PasswordEncrypted string `json:"password_encrypted"`
-	EncryptionType    string `json:"encryption_type"`
-	WifiType          string `json:"wifi_type"`
-	MaxConnections    *int   `json:"max_connections"`
 }
 
 // UpdateWifiConfig 更新一个已存在的WIFI配置
@@ -139,8 +318,10 @@ func (s *WifiConfigService) UpdateWifiConfig(id uint, input *UpdateWifiConfigInp
 		if input.SSID != "" {
 			wifiConfig.SSID = input.SSID
 		}
-		if input.PasswordEncrypted != "" {
-			wifiConfig.PasswordEncrypted = input.PasswordEncrypted
+		if password := cmp.Or(input.Password, input.PasswordEncrypted); password != "" {
+			if err := sealWifiPassword(&wifiConfig, password); err != nil {
+				return err
+			}
 		}
 		if input.EncryptionType != "" {
 			wifiConfig.EncryptionType = input.EncryptionType
@@ -165,29 +346,55 @@ func (s *WifiConfigService) UpdateWifiConfig(id uint, input *UpdateWifiConfigInp
 	return &wifiConfig, nil
 }
 
-// DeleteWifiConfig 删除一个WIFI配置
+// DeleteWifiConfig 软删除一个WIFI配置
 // 在事务中执行。
 func (s *WifiConfigService) DeleteWifiConfig(id uint) error {
 	err := database.DB.Transaction(func(tx *gorm.DB) error {
-		result := tx.Delete(&models.WifiConfig{}, id)
-		if result.Error != nil {
-			return result.Error
+		var wifiConfig models.WifiConfig
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("wifi_id", "store_id").First(&wifiConfig, id).Error; err != nil {
+			return err
 		}
-		if result.RowsAffected == 0 {
-			return gorm.ErrRecordNotFound
+		if err := tx.Delete(&models.WifiConfig{}, id).Error; err != nil {
+			return err
 		}
-		return nil
+		return adjustStoreCounter(tx, wifiConfig.StoreID, storeCounterWifi, -1)
 	})
 	return err
 }
 
-// DeleteBatchWifiConfigs 批量删除多个WIFI配置
+// RestoreWifiConfig 恢复一个已删除的WIFI配置，所属门店必须未被删除。WIFI配置未被删除时直接返回。
+func (s *WifiConfigService) RestoreWifiConfig(id uint) (*models.WifiConfig, error) {
+	var wifiConfig models.WifiConfig
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&wifiConfig, id).Error; err != nil {
+			return err
+		}
+		if !wifiConfig.DeletedAt.Valid {
+			return nil
+		}
+		if err := checkStoreNotDeleted(tx, wifiConfig.StoreID); err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Model(&wifiConfig).UpdateColumn("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		wifiConfig.DeletedAt = gorm.DeletedAt{}
+		return adjustStoreCounter(tx, wifiConfig.StoreID, storeCounterWifi, 1)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &wifiConfig, nil
+}
+
+// DeleteBatchWifiConfigs 批量软删除多个WIFI配置
 func (s *WifiConfigService) DeleteBatchWifiConfigs(ids []uint) error {
 	// 使用事务确保数据一致性
 	return database.DB.Transaction(func(tx *gorm.DB) error {
 		// 查询这些WIFI配置关联的门店信息
 		var wifiConfigs []models.WifiConfig
-		if err := tx.Where("wifi_id IN ?", ids).Find(&wifiConfigs).Error; err != nil {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("wifi_id IN ?", ids).Find(&wifiConfigs).Error; err != nil {
 			return err
 		}
 
@@ -204,13 +411,171 @@ func (s *WifiConfigService) DeleteBatchWifiConfigs(ids []uint) error {
 
 		// 更新每个门店的WIFI数量
 		for storeID, count := range storeWifiCount {
-			if count != 0 {
-				if err := tx.Exec("UPDATE store SET wifi_count = wifi_count + ? WHERE store_id = ?", count, storeID).Error; err != nil {
+			if err := adjustStoreCounter(tx, storeID, storeCounterWifi, count); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ConnectWifiInput 定义了获取WIFI连接凭证的输入
+type ConnectWifiInput struct {
+	LogID  uint64 `json:"log_id" binding:"required"` // 本次扫码创建的扫码日志ID
+	Ticket string `json:"ticket" binding:"required"` // 创建扫码日志时签发的连接票据
+}
+
+// WifiCredential 是下发给用户的WIFI连接凭证
+type WifiCredential struct {
+	WifiID         uint   `json:"wifi_id"`
+	SSID           string `json:"ssid"`
+	Password       string `json:"password"`
+	EncryptionType string `json:"encryption_type"`
+	LogID          uint64 `json:"log_id"`
+	// 上报连接结果的截止时间，获取密码后重新计时
+	ReportExpiresAt time.Time `json:"report_expires_at"`
+}
+
+// ReleaseWifiCredentialInput 定义了下发WIFI连接凭证所需的上下文
+type ReleaseWifiCredentialInput struct {
+	WifiID      uint
+	LogID       uint64
+	Ticket      string
+	UserUnionID string // 已认证的用户，扫码日志必须属于该用户
+	AppID       string
+	IPAddress   string
+}
+
+// ReleaseWifiCredential 向用户下发解密后的WIFI密码。
+// 只有正常营业门店的顾客WIFI才能下发，并且必须出示该用户在同一门店扫码时签发的、仍然有效的连接票据，
+// 每个连接会话只能下发一次，下发记录保存在 wifi_release 表中。
+// WIFI 的连接数已满时返回 *WifiFullError，其中列出同一门店仍有空位的其他顾客WIFI。
+func (s *WifiConfigService) ReleaseWifiCredential(input *ReleaseWifiCredentialInput) (*WifiCredential, error) {
+	var wifiConfig models.WifiConfig
+	var password string
+	var reportExpiresAt time.Time
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定WIFI配置，使同一个WIFI的连接数检查串行执行
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&wifiConfig, input.WifiID).Error; err != nil {
+			return err
+		}
+		if wifiConfig.WifiType != "CUSTOMER" {
+			return ErrWifiNotForCustomer
+		}
+
+		var store models.Store
+		if err := tx.Select("store_id", "status").First(&store, wifiConfig.StoreID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrStoreInactive
+			}
+			return err
+		}
+		if store.Status != 1 {
+			return ErrStoreInactive
+		}
+
+		// 锁定连接会话，避免同一个会话被并发下发多次
+		session, err := lockConnectSession(tx, input.LogID, input.UserUnionID, input.Ticket)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrScanLogNotFound
+			}
+			return err
+		}
+		if session.StoreID != wifiConfig.StoreID {
+			return ErrScanLogStoreMismatch
+		}
+		if session.Status != models.ConnectSessionOpen {
+			return ErrWifiAlreadyReleased
+		}
+
+		if wifiConfig.MaxConnections > 0 {
+			counts, err := countActiveConnections(tx, []uint{wifiConfig.WifiID})
+			if err != nil {
+				return err
+			}
+			if counts[wifiConfig.WifiID] >= wifiConfig.MaxConnections {
+				alternatives, err := availableCustomerWifis(tx, wifiConfig.StoreID, wifiConfig.WifiID)
+				if err != nil {
 					return err
 				}
+				return &WifiFullError{Alternatives: alternatives}
 			}
 		}
 
-		return nil
+		// 先解密再登记，解密失败时不留下下发记录
+		if password, err = openWifiPassword(&wifiConfig); err != nil {
+			return err
+		}
+		if wifiConfig.PasswordKeyID == "" {
+			// 服务端加密之前保存的旧数据，下发时顺便加密保存
+			if err := resealWifiPassword(tx, &wifiConfig, password); err != nil {
+				return err
+			}
+		}
+		// 上报连接结果单独计时，获取密码较慢时不占用上报的时间
+		reportExpiresAt = time.Now().Add(config.Cfg.Security.ConnectReportTimeout)
+		if err := tx.Model(session).Updates(map[string]interface{}{
+			"status":     models.ConnectSessionCredentialIssued,
+			"wifi_id":    wifiConfig.WifiID,
+			"expires_at": reportExpiresAt,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.WifiRelease{
+			LogID:       session.LogID,
+			WifiID:      wifiConfig.WifiID,
+			StoreID:     wifiConfig.StoreID,
+			UserUnionID: input.UserUnionID,
+			AppID:       input.AppID,
+			IPAddress:   input.IPAddress,
+		}).Error
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &WifiCredential{
+		WifiID:          wifiConfig.WifiID,
+		SSID:            wifiConfig.SSID,
+		Password:        password,
+		EncryptionType:  wifiConfig.EncryptionType,
+		LogID:           input.LogID,
+		ReportExpiresAt: reportExpiresAt,
+	}, nil
+}
+
+// availableCustomerWifis 返回门店中除 excludeID 以外仍有空位的顾客WIFI
+func availableCustomerWifis(tx *gorm.DB, storeID, excludeID uint) ([]WifiAvailability, error) {
+	var wifiConfigs []models.WifiConfig
+	if err := tx.Select("wifi_id", "ssid", "max_connections").
+		Where("store_id = ? AND wifi_type = ? AND wifi_id <> ?", storeID, "CUSTOMER", excludeID).
+		Find(&wifiConfigs).Error; err != nil {
+		return nil, err
+	}
+
+	wifiIDs := make([]uint, len(wifiConfigs))
+	for i, wifi := range wifiConfigs {
+		wifiIDs[i] = wifi.WifiID
+	}
+	counts, err := countActiveConnections(tx, wifiIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	alternatives := []WifiAvailability{}
+	for _, wifi := range wifiConfigs {
+		active := counts[wifi.WifiID]
+		if wifi.MaxConnections > 0 && active >= wifi.MaxConnections {
+			continue
+		}
+		alternatives = append(alternatives, WifiAvailability{
+			WifiID:            wifi.WifiID,
+			SSID:              wifi.SSID,
+			ActiveConnections: active,
+			MaxConnections:    wifi.MaxConnections,
+		})
+	}
+	return alternatives, nil
 }
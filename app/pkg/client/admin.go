@@ -0,0 +1,60 @@
+package client
+
+import (
+	"app/internal/models"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// 平台管理接口，仅限平台管理员 (platform_admin) 使用
+
+// CreatedKey 是新建的加密密钥，Secret 为十六进制编码的密钥明文，只在创建时返回一次
+type CreatedKey struct {
+	Key    models.AppKey `json:"key"`
+	Secret string        `json:"secret"`
+}
+
+// ListAppKeys 列出调用方的全部加密密钥
+func (c *Client) ListAppKeys(ctx context.Context, appID string) ([]models.AppKey, error) {
+	var out struct {
+		Keys []models.AppKey `json:"keys"`
+	}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/admin/apps/%s/keys", url.PathEscape(appID)), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Keys, nil
+}
+
+// CreateAppKey 为调用方创建一个新的加密密钥，keyBits 为 0 时使用服务端默认长度
+func (c *Client) CreateAppKey(ctx context.Context, appID string, keyBits int) (*CreatedKey, error) {
+	var in any
+	if keyBits > 0 {
+		in = map[string]int{"key_bits": keyBits}
+	}
+	var created CreatedKey
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/admin/apps/%s/keys", url.PathEscape(appID)), nil, in, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// PromoteAppKey 将指定密钥设为调用方的当前密钥
+func (c *Client) PromoteAppKey(ctx context.Context, appID, keyID string) (*models.AppKey, error) {
+	return c.updateAppKey(ctx, appID, keyID, "promote")
+}
+
+// RetireAppKey 退役调用方的指定密钥
+func (c *Client) RetireAppKey(ctx context.Context, appID, keyID string) (*models.AppKey, error) {
+	return c.updateAppKey(ctx, appID, keyID, "retire")
+}
+
+func (c *Client) updateAppKey(ctx context.Context, appID, keyID, action string) (*models.AppKey, error) {
+	var key models.AppKey
+	path := fmt.Sprintf("/admin/apps/%s/keys/%s/%s", url.PathEscape(appID), url.PathEscape(keyID), action)
+	if err := c.do(ctx, http.MethodPatch, path, nil, nil, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"app/internal/models"
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// CreateCampaignInput 是创建营销活动的请求参数
+type CreateCampaignInput struct {
+	CampaignName string `json:"campaign_name"`
+	StoreID      *uint  `json:"store_id,omitempty"`     // 为空表示全部门店，仅平台管理员
+	TriggerType  string `json:"trigger_type"`           // FIRST_CONNECT, NTH_VISIT, FIRST_IN_DAYS 或 QR_CODE
+	VisitCount   int    `json:"visit_count,omitempty"`  // NTH_VISIT：第几次到店时发放
+	WithinDays   int    `json:"within_days,omitempty"`  // FIRST_IN_DAYS：最近多少天内首次到店时发放，默认 30
+	QrCodeType   string `json:"qr_code_type,omitempty"` // QR_CODE：限定二维码类型
+	QrCodeID     string `json:"qr_code_id,omitempty"`   // QR_CODE：限定二维码
+	CouponID     uint   `json:"coupon_id"`              // 门店活动发放全平台通用的优惠券仅平台管理员
+	Budget       int    `json:"budget,omitempty"`       // 最多发放的优惠券数量，0 表示不限
+	StartTime    string `json:"start_time,omitempty"`   // 格式: "2006-01-02 15:04:05"
+	EndTime      string `json:"end_time,omitempty"`
+	Remark       string `json:"remark,omitempty"`
+}
+
+// GetCampaignsInput 是查询营销活动列表的参数
+type GetCampaignsInput struct {
+	StoreID     *uint  `form:"store_id"`
+	TriggerType string `form:"trigger_type"`
+	Status      *int8  `form:"status"`
+	Page        int    `form:"page"`
+	PageSize    int    `form:"pageSize"`
+}
+
+// CampaignList 是营销活动列表的查询结果
+type CampaignList struct {
+	Campaigns []models.Campaign `json:"campaigns"`
+	Total     int64             `json:"total"`
+}
+
+// UpdateCampaignInput 是更新营销活动的请求参数，空字段不更新
+type UpdateCampaignInput struct {
+	CampaignName string  `json:"campaign_name,omitempty"`
+	VisitCount   *int    `json:"visit_count,omitempty"`
+	WithinDays   *int    `json:"within_days,omitempty"`
+	QrCodeType   *string `json:"qr_code_type,omitempty"`
+	QrCodeID     *string `json:"qr_code_id,omitempty"`
+	CouponID     *uint   `json:"coupon_id,omitempty"`
+	Budget       *int    `json:"budget,omitempty"`
+	StartTime    *string `json:"start_time,omitempty"` // 空字符串表示不限
+	EndTime      *string `json:"end_time,omitempty"`
+	Status       *int8   `json:"status,omitempty"` // 0 停用，1 启用
+	Remark       *string `json:"remark,omitempty"`
+}
+
+// CampaignReward 是连接WIFI成功时一个活动的发放结果
+type CampaignReward struct {
+	CampaignID   uint               `json:"campaign_id"`
+	CampaignName string             `json:"campaign_name"`
+	CouponID     uint               `json:"coupon_id"`
+	Issued       bool               `json:"issued"`
+	UserCoupon   *models.UserCoupon `json:"user_coupon,omitempty"`
+	Reason       string             `json:"reason,omitempty"` // 未发放的原因
+}
+
+// CreateCampaign 创建营销活动
+func (c *Client) CreateCampaign(ctx context.Context, input *CreateCampaignInput) (*models.Campaign, error) {
+	var campaign models.Campaign
+	if err := c.do(ctx, http.MethodPost, "/campaigns", nil, input, &campaign); err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+// GetCampaigns 查询营销活动列表
+func (c *Client) GetCampaigns(ctx context.Context, input *GetCampaignsInput) (*CampaignList, error) {
+	var list CampaignList
+	if err := c.do(ctx, http.MethodGet, "/campaigns", encodeQuery(input), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetCampaign 查询营销活动详情
+func (c *Client) GetCampaign(ctx context.Context, id uint) (*models.Campaign, error) {
+	var campaign models.Campaign
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/campaigns/%d", id), nil, nil, &campaign); err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+// UpdateCampaign 更新营销活动
+func (c *Client) UpdateCampaign(ctx context.Context, id uint, input *UpdateCampaignInput) (*models.Campaign, error) {
+	var campaign models.Campaign
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/campaigns/%d", id), nil, input, &campaign); err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+// DeleteCampaign 删除营销活动
+func (c *Client) DeleteCampaign(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/campaigns/%d", id), nil, nil, nil)
+}
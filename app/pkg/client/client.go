@@ -0,0 +1,177 @@
+// Package client 是 wifiCity API 的 Go 客户端。
+//
+// 客户端按协议版本 4 对每个请求进行签名，加密请求体并解密响应，
+// 调用方只需要提供调用方标识和密钥即可使用带类型的接口方法。
+//
+// 本包只依赖 models 和 protocol 包，不会加载服务端配置或连接数据库，
+// 因此可以在集成测试和命令行工具中直接使用。
+package client
+
+import (
+	"app/pkg/protocol"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// APIError 表示服务端返回的错误响应
+type APIError struct {
+	StatusCode int    // HTTP 状态码
+	Message    string // 服务端返回的错误信息
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("请求失败 (HTTP %d): %s", e.StatusCode, e.Message)
+}
+
+// Client 是 wifiCity API 的客户端，可以被多个 goroutine 并发使用
+type Client struct {
+	baseURL    string
+	signer     protocol.Signer
+	httpClient *http.Client
+	userToken  string
+}
+
+// Option 用于定制 Client
+type Option func(*Client)
+
+// WithHTTPClient 指定发送请求使用的 http.Client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithKeyID 指定密钥ID (kid)，使用密钥轮换创建的密钥时必须设置
+func WithKeyID(keyID string) Option {
+	return func(c *Client) {
+		c.signer.KeyID = keyID
+	}
+}
+
+// WithAESKeyBits 指定派生的 AES 密钥长度，必须与服务端的 aes_key_bits 配置一致
+func WithAESKeyBits(bits int) Option {
+	return func(c *Client) {
+		c.signer.AESKeyBits = bits
+	}
+}
+
+// New 创建一个客户端。
+// baseURL 为服务地址，例如 "https://api.example.com"；appID 和 secret 为调用方标识和主密钥。
+func New(baseURL, appID string, secret []byte, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		signer:     protocol.Signer{AppID: appID, Secret: secret},
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithUser 返回一个代表指定终端用户发送请求的客户端副本，
+// 请求会通过 X-User-Token 请求头携带 Login 签发的用户令牌
+func (c *Client) WithUser(token string) *Client {
+	clone := *c
+	clone.userToken = token
+	return &clone
+}
+
+// errorBody 是服务端错误响应的结构，与 security.ErrorResponse 一致
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// do 发送一个已签名的请求。
+// path 为 /api/v1 之后的路径，in 非空时序列化为请求体，out 非空时用于接收解密后的响应。
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	endpoint := c.baseURL + "/api/v1" + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	var plaintext []byte
+	if in != nil {
+		if plaintext, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("无法序列化请求体: %w", err)
+		}
+	}
+	if c.userToken != "" {
+		req.Header.Set("X-User-Token", c.userToken)
+	}
+	signed, err := c.signer.Sign(req, plaintext)
+	if err != nil {
+		return fmt.Errorf("无法签名请求: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("无法读取响应: %w", err)
+	}
+	if resp.StatusCode == http.StatusNoContent || len(body) == 0 {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		}
+		return nil
+	}
+
+	decrypted, err := c.open(resp, body, signed)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var e errorBody
+		if err := json.Unmarshal(decrypted, &e); err != nil || e.Error == "" {
+			e.Error = string(decrypted)
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: e.Error}
+	}
+	if out != nil {
+		if err := json.Unmarshal(decrypted, out); err != nil {
+			return fmt.Errorf("无法解析响应: %w", err)
+		}
+	}
+	return nil
+}
+
+// open 解密响应信封。服务端处于调试明文模式时，响应原样返回。
+func (c *Client) open(resp *http.Response, body []byte, signed *protocol.SignedRequest) ([]byte, error) {
+	if resp.Header.Get(protocol.DebugPlaintextHeader) == "1" {
+		return body, nil
+	}
+
+	var envelope protocol.EncryptedData
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Data == "" {
+		// 认证失败等在中间件中产生的错误不加密
+		var e errorBody
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return nil, &APIError{StatusCode: resp.StatusCode, Message: e.Error}
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: "无法识别的响应: " + string(body)}
+	}
+	if envelope.KID != c.signer.KeyID {
+		return nil, fmt.Errorf("响应使用了密钥 %q 加密，客户端使用的是 %q，请更新为当前密钥", envelope.KID, c.signer.KeyID)
+	}
+	decrypted, err := c.signer.Open(signed, &envelope)
+	if err != nil {
+		return nil, fmt.Errorf("无法解密响应: %w", err)
+	}
+	return decrypted, nil
+}
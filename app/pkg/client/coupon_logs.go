@@ -0,0 +1,77 @@
+package client
+
+import (
+	"app/internal/models"
+	"context"
+	"net/http"
+)
+
+// LogActionInput 是记录优惠券操作的请求参数
+type LogActionInput struct {
+	CouponID       uint     `json:"coupon_id"`
+	UserUnionID    string   `json:"user_union_id"`
+	StoreID        *uint    `json:"store_id,omitempty"`
+	ActionType     string   `json:"action_type"` // ISSUE, RECEIVE, USE, EXPIRE, REFUND
+	OrderID        *string  `json:"order_id,omitempty"`
+	AmountDeducted *float64 `json:"amount_deducted,omitempty"`
+	Remark         string   `json:"remark,omitempty"`
+}
+
+// GetCouponLogsInput 是查询优惠券日志的参数
+type GetCouponLogsInput struct {
+	UserUnionID *string `form:"user_union_id"`
+	CouponID    *uint   `form:"coupon_id"`
+	StoreID     *uint   `form:"store_id"`
+	ActionType  *string `form:"action_type"`
+	Page        int     `form:"page"`
+	PageSize    int     `form:"pageSize"`
+}
+
+// GetCouponActionLogsInput 是查询优惠券领取或核销记录的参数
+type GetCouponActionLogsInput struct {
+	CouponID    *uint   `form:"coupon_id"`
+	UserUnionID *string `form:"user_union_id"`
+	StoreID     *uint   `form:"store_id"`
+	StartDate   *string `form:"start_date"` // 格式: YYYY-MM-DD
+	EndDate     *string `form:"end_date"`   // 格式: YYYY-MM-DD
+	Page        int     `form:"page"`
+	PageSize    int     `form:"pageSize"`
+}
+
+// CouponLogList 是优惠券日志列表的查询结果
+type CouponLogList struct {
+	Logs  []models.CouponLog `json:"logs"`
+	Total int64              `json:"total"`
+}
+
+// CreateCouponLog 记录一次优惠券操作（发放、领取、核销等）
+func (c *Client) CreateCouponLog(ctx context.Context, input *LogActionInput) (*models.CouponLog, error) {
+	var log models.CouponLog
+	if err := c.do(ctx, http.MethodPost, "/coupon-logs/", nil, input, &log); err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
+// GetCouponLogs 分页查询优惠券日志
+func (c *Client) GetCouponLogs(ctx context.Context, input *GetCouponLogsInput) (*CouponLogList, error) {
+	return c.getCouponLogs(ctx, "/coupon-logs/", input)
+}
+
+// GetCouponClaimLogs 查询优惠券领取记录
+func (c *Client) GetCouponClaimLogs(ctx context.Context, input *GetCouponActionLogsInput) (*CouponLogList, error) {
+	return c.getCouponLogs(ctx, "/coupon-logs/claim", input)
+}
+
+// GetCouponUseLogs 查询优惠券核销记录
+func (c *Client) GetCouponUseLogs(ctx context.Context, input *GetCouponActionLogsInput) (*CouponLogList, error) {
+	return c.getCouponLogs(ctx, "/coupon-logs/use", input)
+}
+
+func (c *Client) getCouponLogs(ctx context.Context, path string, input any) (*CouponLogList, error) {
+	var list CouponLogList
+	if err := c.do(ctx, http.MethodGet, path, encodeQuery(input), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
@@ -0,0 +1,398 @@
+package client
+
+import (
+	"app/internal/models"
+	"app/pkg/pricing"
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// CreateCouponInput 是创建优惠券的请求参数
+type CreateCouponInput struct {
+	CouponName         string  `json:"coupon_name"`
+	CouponCode         string  `json:"coupon_code,omitempty"`
+	CouponType         string  `json:"coupon_type"`
+	Value              float64 `json:"value"`
+	MinPurchaseAmount  float64 `json:"min_purchase_amount,omitempty"`
+	MaxDeductionAmount float64 `json:"max_deduction_amount,omitempty"` // 最高抵扣金额，0 表示不限
+	UsageLimitPerUser  int     `json:"usage_limit_per_user,omitempty"`
+	TotalQuantity      int     `json:"total_quantity,omitempty"`
+	StartTime          string  `json:"start_time"` // 格式: "2006-01-02 15:04:05"
+	EndTime            string  `json:"end_time"`
+	ValidityDays       int     `json:"validity_days,omitempty"`
+	StoreID            *uint   `json:"store_id,omitempty"`
+	Description        string  `json:"description,omitempty"`
+}
+
+// GetCouponsInput 是查询优惠券列表的参数
+type GetCouponsInput struct {
+	StoreID  *uint `form:"store_id"`
+	Status   *int8 `form:"status"`
+	Page     int   `form:"page"`
+	PageSize int   `form:"pageSize"`
+
+	IncludeDeleted bool `form:"include_deleted"` // 是否包含已删除的优惠券
+}
+
+// UpdateCouponInput 是更新优惠券的请求参数，空字段不更新
+type UpdateCouponInput struct {
+	CouponName         string   `json:"coupon_name,omitempty"`
+	Description        string   `json:"description,omitempty"`
+	MinPurchaseAmount  *float64 `json:"min_purchase_amount,omitempty"`
+	MaxDeductionAmount *float64 `json:"max_deduction_amount,omitempty"`
+	TotalQuantity      *int     `json:"total_quantity,omitempty"`
+	Status             *int8    `json:"status,omitempty"`
+	StartTime          *string  `json:"start_time,omitempty"` // 格式: "2006-01-02 15:04:05"
+	EndTime            *string  `json:"end_time,omitempty"`
+	UsageLimitPerUser  *int     `json:"usage_limit_per_user,omitempty"`
+	StoreID            *uint    `json:"store_id,omitempty"`
+}
+
+// GetAvailableCouponsForUserInput 是查询用户可领取优惠券的参数
+type GetAvailableCouponsForUserInput struct {
+	UserID   string `form:"user_id"`
+	StoreID  *uint  `form:"store_id"`
+	Page     int    `form:"page"`
+	PageSize int    `form:"pageSize"`
+}
+
+// GetCouponsByStoreInput 是查询门店可用优惠券的参数
+type GetCouponsByStoreInput struct {
+	StoreID  uint `form:"store_id"`
+	Page     int  `form:"page"`
+	PageSize int  `form:"pageSize"`
+}
+
+// UpdateCouponValidityInput 是更新优惠券有效期的请求参数
+type UpdateCouponValidityInput struct {
+	StartTime    string `json:"start_time,omitempty"` // 格式: "2006-01-02 15:04:05"
+	EndTime      string `json:"end_time,omitempty"`
+	ValidityDays *int   `json:"validity_days,omitempty"`
+}
+
+// UpdateCouponLimitInput 是更新优惠券使用限制的请求参数
+type UpdateCouponLimitInput struct {
+	MinPurchaseAmount  *float64 `json:"min_purchase_amount,omitempty"`
+	MaxDeductionAmount *float64 `json:"max_deduction_amount,omitempty"`
+	UsageLimitPerUser  *int     `json:"usage_limit_per_user,omitempty"`
+}
+
+// UpdateCouponQuantityInput 是更新优惠券发行量的请求参数
+type UpdateCouponQuantityInput struct {
+	TotalQuantity  *int `json:"total_quantity,omitempty"`
+	IssuedQuantity *int `json:"issued_quantity,omitempty"`
+}
+
+// CouponList 是优惠券列表的查询结果
+type CouponList struct {
+	Coupons []models.Coupon `json:"coupons"`
+	Total   int64           `json:"total"`
+}
+
+// CreateCoupon 创建优惠券
+func (c *Client) CreateCoupon(ctx context.Context, input *CreateCouponInput) (*models.Coupon, error) {
+	var coupon models.Coupon
+	if err := c.do(ctx, http.MethodPost, "/coupons/", nil, input, &coupon); err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// CreateBatchCoupons 批量创建优惠券
+func (c *Client) CreateBatchCoupons(ctx context.Context, inputs []*CreateCouponInput) ([]models.Coupon, error) {
+	var out struct {
+		Coupons []models.Coupon `json:"coupons"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/coupons/batch", nil, inputs, &out); err != nil {
+		return nil, err
+	}
+	return out.Coupons, nil
+}
+
+// GetCoupon 查询单个优惠券
+func (c *Client) GetCoupon(ctx context.Context, id uint) (*models.Coupon, error) {
+	var coupon models.Coupon
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/coupons/%d", id), nil, nil, &coupon); err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// GetCoupons 分页查询优惠券
+func (c *Client) GetCoupons(ctx context.Context, input *GetCouponsInput) (*CouponList, error) {
+	var list CouponList
+	if err := c.do(ctx, http.MethodGet, "/coupons/", encodeQuery(input), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// CouponSchedule 是优惠券的可用时段，领取后只能在可用时段内核销
+type CouponSchedule struct {
+	Weekdays      []int    `json:"weekdays"`       // 1 为周一，7 为周日，为空表示不限
+	TimeStart     string   `json:"time_start"`     // HH:MM，为空表示全天可用
+	TimeEnd       string   `json:"time_end"`       // HH:MM（不含）
+	BlackoutDates []string `json:"blackout_dates"` // 今天及以后的不可用日期
+	UsableNow     bool     `json:"usable_now"`
+}
+
+// AvailableCoupon 是用户可领取的优惠券及其可用时段
+type AvailableCoupon struct {
+	models.Coupon
+	Schedule *CouponSchedule `json:"schedule"`
+}
+
+// AvailableCouponList 是用户可领取优惠券的查询结果
+type AvailableCouponList struct {
+	Coupons []AvailableCoupon `json:"coupons"`
+	Total   int64             `json:"total"`
+}
+
+// GetAvailableCouponsForUser 查询用户可领取的优惠券，包括当前不在可用时段内的优惠券
+func (c *Client) GetAvailableCouponsForUser(ctx context.Context, input *GetAvailableCouponsForUserInput) (*AvailableCouponList, error) {
+	var list AvailableCouponList
+	if err := c.do(ctx, http.MethodGet, "/coupons/available-for-user", encodeQuery(input), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetCouponsByStore 查询门店可用的优惠券
+func (c *Client) GetCouponsByStore(ctx context.Context, input *GetCouponsByStoreInput) (*CouponList, error) {
+	var list CouponList
+	if err := c.do(ctx, http.MethodGet, "/coupons/store", encodeQuery(input), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// UpdateCoupon 更新优惠券
+func (c *Client) UpdateCoupon(ctx context.Context, id uint, input *UpdateCouponInput) (*models.Coupon, error) {
+	return c.patchCoupon(ctx, http.MethodPut, id, "", input)
+}
+
+// DeleteCoupon 软删除优惠券
+func (c *Client) DeleteCoupon(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/coupons/%d", id), nil, nil, nil)
+}
+
+// RestoreCoupon 恢复已删除的优惠券
+func (c *Client) RestoreCoupon(ctx context.Context, id uint) (*models.Coupon, error) {
+	var coupon models.Coupon
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/coupons/%d/restore", id), nil, nil, &coupon); err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// UpdateCouponValidity 更新优惠券有效期
+func (c *Client) UpdateCouponValidity(ctx context.Context, id uint, input *UpdateCouponValidityInput) (*models.Coupon, error) {
+	return c.patchCoupon(ctx, http.MethodPatch, id, "/validity", input)
+}
+
+// UpdateCouponLimit 更新优惠券使用限制
+func (c *Client) UpdateCouponLimit(ctx context.Context, id uint, input *UpdateCouponLimitInput) (*models.Coupon, error) {
+	return c.patchCoupon(ctx, http.MethodPatch, id, "/limit", input)
+}
+
+// UpdateCouponQuantity 更新优惠券发行量
+func (c *Client) UpdateCouponQuantity(ctx context.Context, id uint, input *UpdateCouponQuantityInput) (*models.Coupon, error) {
+	return c.patchCoupon(ctx, http.MethodPatch, id, "/quantity", input)
+}
+
+// UpdateCouponStore 更新优惠券适用门店，storeID 为 nil 表示全平台适用；改为特定门店时服务端清除优惠券的适用范围
+func (c *Client) UpdateCouponStore(ctx context.Context, id uint, storeID *uint) (*models.Coupon, error) {
+	in := map[string]*uint{"store_id": storeID}
+	return c.patchCoupon(ctx, http.MethodPatch, id, "/store", in)
+}
+
+// UpdateCouponStatus 更新优惠券状态
+func (c *Client) UpdateCouponStatus(ctx context.Context, id uint, status int8) (*models.Coupon, error) {
+	in := map[string]int8{"status": status}
+	return c.patchCoupon(ctx, http.MethodPatch, id, "/status", in)
+}
+
+// UpdateCouponStockBuckets 将优惠券的剩余库存拆分到 buckets 个分桶中，0 表示取消分桶（仅平台管理员）
+func (c *Client) UpdateCouponStockBuckets(ctx context.Context, id uint, buckets int) (*models.Coupon, error) {
+	in := map[string]int{"buckets": buckets}
+	return c.patchCoupon(ctx, http.MethodPatch, id, "/stock-buckets", in)
+}
+
+// GenerateCouponCodesInput 是批量生成券码的请求参数
+type GenerateCouponCodesInput struct {
+	Quantity int    `json:"quantity"`
+	Prefix   string `json:"prefix,omitempty"`   // 最多 8 个数字或大写字母
+	Alphabet string `json:"alphabet,omitempty"` // 为空时使用默认字母表
+	Length   int    `json:"length,omitempty"`   // 随机部分的长度，默认 12
+}
+
+// GenerateCouponCodes 为优惠券批量生成券码并开启券码池
+func (c *Client) GenerateCouponCodes(ctx context.Context, id uint, input *GenerateCouponCodesInput) (*models.CouponCodeBatch, error) {
+	var batch models.CouponCodeBatch
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/coupons/%d/codes", id), nil, input, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// ExportCouponCodesInput 是导出券码的查询参数
+type ExportCouponCodesInput struct {
+	BatchID *uint  `form:"batch_id"`
+	Status  string `form:"status"` // available、assigned 或 voided，为空时导出全部
+}
+
+// ExportedCouponCodes 是导出的券码文件
+type ExportedCouponCodes struct {
+	CouponID    uint   `json:"coupon_id"`
+	Count       int    `json:"count"`
+	ContentType string `json:"content_type"`
+	File        []byte `json:"file"` // CSV 文件内容
+}
+
+// ExportCouponCodes 将优惠券的券码导出为 CSV 文件
+func (c *Client) ExportCouponCodes(ctx context.Context, id uint, input *ExportCouponCodesInput) (*ExportedCouponCodes, error) {
+	var exported ExportedCouponCodes
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/coupons/%d/codes/export", id), encodeQuery(input), nil, &exported); err != nil {
+		return nil, err
+	}
+	return &exported, nil
+}
+
+// CouponRegion 是适用范围中的一个地区，City 为空时表示整个省份
+type CouponRegion struct {
+	Province string `json:"province"`
+	City     string `json:"city,omitempty"`
+}
+
+// CouponRules 是优惠券的适用范围和可用时段
+type CouponRules struct {
+	CouponID      uint           `json:"coupon_id"`
+	StoreID       *uint          `json:"store_id"`
+	StoreIDs      []uint         `json:"store_ids"`
+	Regions       []CouponRegion `json:"regions"`
+	Weekdays      []int          `json:"weekdays"`   // 1 为周一，7 为周日
+	TimeStart     string         `json:"time_start"` // HH:MM
+	TimeEnd       string         `json:"time_end"`   // HH:MM（不含）
+	BlackoutDates []string       `json:"blackout_dates"`
+}
+
+// UpdateCouponScopesInput 是更新优惠券适用范围的请求参数，均为空时全部门店通用
+type UpdateCouponScopesInput struct {
+	StoreIDs []uint         `json:"store_ids"`
+	Regions  []CouponRegion `json:"regions"`
+}
+
+// UpdateCouponScheduleInput 是更新优惠券可用时段的请求参数
+type UpdateCouponScheduleInput struct {
+	Weekdays      []int    `json:"weekdays"`
+	TimeStart     string   `json:"time_start"`
+	TimeEnd       string   `json:"time_end"`
+	BlackoutDates []string `json:"blackout_dates"` // YYYY-MM-DD
+}
+
+// GetCouponRules 查询优惠券的适用范围和可用时段
+func (c *Client) GetCouponRules(ctx context.Context, id uint) (*CouponRules, error) {
+	return c.couponRules(ctx, http.MethodGet, id, "/rules", nil)
+}
+
+// UpdateCouponScopes 替换优惠券的适用门店和地区
+func (c *Client) UpdateCouponScopes(ctx context.Context, id uint, input *UpdateCouponScopesInput) (*CouponRules, error) {
+	return c.couponRules(ctx, http.MethodPatch, id, "/scopes", input)
+}
+
+// UpdateCouponSchedule 替换优惠券的可用星期、每日时段和不可用日期
+func (c *Client) UpdateCouponSchedule(ctx context.Context, id uint, input *UpdateCouponScheduleInput) (*CouponRules, error) {
+	return c.couponRules(ctx, http.MethodPatch, id, "/schedule", input)
+}
+
+// couponRules 发送优惠券适用规则的请求并返回最新的规则
+func (c *Client) couponRules(ctx context.Context, method string, id uint, suffix string, in any) (*CouponRules, error) {
+	var rules CouponRules
+	if err := c.do(ctx, method, fmt.Sprintf("/coupons/%d%s", id, suffix), nil, in, &rules); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// patchCoupon 发送更新单个优惠券的请求并返回更新后的优惠券
+func (c *Client) patchCoupon(ctx context.Context, method string, id uint, suffix string, in any) (*models.Coupon, error) {
+	var coupon models.Coupon
+	if err := c.do(ctx, method, fmt.Sprintf("/coupons/%d%s", id, suffix), nil, in, &coupon); err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// RedeemCouponInput 是核销用户优惠券的请求参数，UserCouponID 和 Code 二选一
+type RedeemCouponInput struct {
+	UserCouponID uint64         `json:"user_coupon_id,omitempty"`
+	Code         string         `json:"code,omitempty"`
+	UserUnionID  string         `json:"user_union_id,omitempty"` // 不为空时只能核销该用户的券
+	StoreID      uint           `json:"store_id"`
+	OrderID      string         `json:"order_id"`     // 同一门店的同一订单只能核销一张优惠券，重复提交返回首次核销的结果
+	OrderAmount  float64        `json:"order_amount"` // 商品小计（不含运费）
+	ShippingFee  float64        `json:"shipping_fee,omitempty"`
+	Items        []pricing.Item `json:"items,omitempty"`
+}
+
+// RedeemCouponResult 是核销优惠券的结果
+type RedeemCouponResult struct {
+	Redemption *models.CouponRedemption `json:"redemption"`
+	Quote      *pricing.Quote           `json:"quote,omitempty"` // 计算明细，重复提交时为空
+	Replayed   bool                     `json:"replayed"`        // 同一订单重复提交时为 true
+}
+
+// RedeemCoupon 按订单核销一张用户优惠券，返回抵扣金额。
+// 仅平台管理员和门店运营（限所属门店）可以调用，小程序不能自行核销。
+func (c *Client) RedeemCoupon(ctx context.Context, input *RedeemCouponInput) (*RedeemCouponResult, error) {
+	var result RedeemCouponResult
+	if err := c.do(ctx, http.MethodPost, "/coupons/redeem", nil, input, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RefundCouponInput 是订单退款时退还优惠券的请求参数
+type RefundCouponInput struct {
+	StoreID      uint   `json:"store_id"`
+	OrderID      string `json:"order_id"`
+	RestoreStock bool   `json:"restore_stock,omitempty"` // 券已过期无法返还给用户时，将其退回优惠券库存
+	Remark       string `json:"remark,omitempty"`
+}
+
+// RefundCouponResult 是退还优惠券的结果
+type RefundCouponResult struct {
+	RefundLog     *models.CouponLog        `json:"refund_log"`
+	Redemption    *models.CouponRedemption `json:"redemption"`
+	UserCoupon    *models.UserCoupon       `json:"user_coupon"`
+	Restored      bool                     `json:"restored"`       // 券是否已返还给用户
+	StockRestored bool                     `json:"stock_restored"` // 是否已退回优惠券库存
+	CodeVoided    bool                     `json:"code_voided"`    // 是否作废了券码池分配的券码
+}
+
+// RefundCoupon 撤销订单的优惠券核销，同一订单只能退款一次
+func (c *Client) RefundCoupon(ctx context.Context, input *RefundCouponInput) (*RefundCouponResult, error) {
+	var result RefundCouponResult
+	if err := c.do(ctx, http.MethodPost, "/coupons/refund", nil, input, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// QuoteCouponInput 是试算优惠券抵扣金额的请求参数
+type QuoteCouponInput struct {
+	StoreID     *uint          `json:"store_id,omitempty"` // 不为空时校验优惠券是否适用于该门店
+	Items       []pricing.Item `json:"items,omitempty"`
+	Subtotal    float64        `json:"subtotal,omitempty"` // 商品小计（不含运费），有商品明细时可省略
+	ShippingFee float64        `json:"shipping_fee,omitempty"`
+}
+
+// QuoteCoupon 按优惠券规则试算订单的抵扣金额和应付金额
+func (c *Client) QuoteCoupon(ctx context.Context, id uint, input *QuoteCouponInput) (*pricing.Quote, error) {
+	var quote pricing.Quote
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/coupons/%d/quote", id), nil, input, &quote); err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
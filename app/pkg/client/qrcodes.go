@@ -0,0 +1,115 @@
+package client
+
+import (
+	"app/internal/models"
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// CreateQrCodeInput 是登记二维码的请求参数
+type CreateQrCodeInput struct {
+	StoreID    uint   `json:"store_id"`
+	QrCodeType string `json:"qr_code_type,omitempty"` // STORE, EVENT, POSTER, DESK 或 OTHER，默认为 STORE
+	Name       string `json:"name"`
+	WifiID     *uint  `json:"wifi_id,omitempty"`
+	CouponID   *uint  `json:"coupon_id,omitempty"`
+	Remark     string `json:"remark,omitempty"`
+}
+
+// GetQrCodesInput 是查询二维码列表的参数
+type GetQrCodesInput struct {
+	StoreID    uint   `form:"store_id"`
+	QrCodeType string `form:"qr_code_type"`
+	Status     *int8  `form:"status"`
+	Page       int    `form:"page"`
+	PageSize   int    `form:"pageSize"`
+}
+
+// QrCodeList 是二维码列表的查询结果
+type QrCodeList struct {
+	QrCodes []models.QrCode `json:"qr_codes"`
+	Total   int64           `json:"total"`
+}
+
+// UpdateQrCodeInput 是更新二维码的请求参数，空字段不更新
+type UpdateQrCodeInput struct {
+	QrCodeType string  `json:"qr_code_type,omitempty"`
+	Name       string  `json:"name,omitempty"`
+	WifiID     *uint   `json:"wifi_id,omitempty"`   // 为 0 表示解除关联
+	CouponID   *uint   `json:"coupon_id,omitempty"` // 为 0 表示解除关联
+	Status     *int8   `json:"status,omitempty"`
+	Remark     *string `json:"remark,omitempty"`
+}
+
+// RenderQrCodeInput 是生成二维码图片的参数
+type RenderQrCodeInput struct {
+	Format string `form:"format"` // png 或 svg，默认为 png
+	Size   int    `form:"size"`   // 图片边长（像素），默认 512
+	Margin int    `form:"margin"` // 静区宽度（模块数），默认 4，最大 16
+	Logo   bool   `form:"logo"`   // 是否在中心叠加服务端配置的 logo
+}
+
+// RenderedQrCode 是生成的二维码图片
+type RenderedQrCode struct {
+	QrCodeID    string `json:"qr_code_id"`
+	Content     string `json:"content"`
+	Format      string `json:"format"`
+	ContentType string `json:"content_type"`
+	Image       []byte `json:"image"`
+}
+
+// qrCodePath 返回二维码资源的路径
+func qrCodePath(id string, suffix string) string {
+	return "/qrcodes/" + url.PathEscape(id) + suffix
+}
+
+// CreateQrCode 登记二维码
+func (c *Client) CreateQrCode(ctx context.Context, input *CreateQrCodeInput) (*models.QrCode, error) {
+	var qrCode models.QrCode
+	if err := c.do(ctx, http.MethodPost, "/qrcodes", nil, input, &qrCode); err != nil {
+		return nil, err
+	}
+	return &qrCode, nil
+}
+
+// GetQrCodes 查询二维码列表
+func (c *Client) GetQrCodes(ctx context.Context, input *GetQrCodesInput) (*QrCodeList, error) {
+	var list QrCodeList
+	if err := c.do(ctx, http.MethodGet, "/qrcodes", encodeQuery(input), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetQrCode 查询二维码详情
+func (c *Client) GetQrCode(ctx context.Context, id string) (*models.QrCode, error) {
+	var qrCode models.QrCode
+	if err := c.do(ctx, http.MethodGet, qrCodePath(id, ""), nil, nil, &qrCode); err != nil {
+		return nil, err
+	}
+	return &qrCode, nil
+}
+
+// UpdateQrCode 更新二维码
+func (c *Client) UpdateQrCode(ctx context.Context, id string, input *UpdateQrCodeInput) (*models.QrCode, error) {
+	var qrCode models.QrCode
+	if err := c.do(ctx, http.MethodPut, qrCodePath(id, ""), nil, input, &qrCode); err != nil {
+		return nil, err
+	}
+	return &qrCode, nil
+}
+
+// DeleteQrCode 删除二维码
+func (c *Client) DeleteQrCode(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, qrCodePath(id, ""), nil, nil, nil)
+}
+
+// RenderQrCode 生成二维码的 PNG 或 SVG 图片
+func (c *Client) RenderQrCode(ctx context.Context, id string, input *RenderQrCodeInput) (*RenderedQrCode, error) {
+	var rendered RenderedQrCode
+	if err := c.do(ctx, http.MethodGet, qrCodePath(id, "/image"), encodeQuery(input), nil, &rendered); err != nil {
+		return nil, err
+	}
+	return &rendered, nil
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// encodeQuery 按结构体字段的 form 标签将查询参数编码为 url.Values。
+// 值为 nil 的指针和零值的非指针字段会被忽略，与服务端未传参数时的默认行为一致。
+func encodeQuery(v any) url.Values {
+	values := url.Values{}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return values
+	}
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return values
+		}
+		rv = rv.Elem()
+	}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		name := rt.Field(i).Tag.Get("form")
+		if name == "" || name == "-" {
+			continue
+		}
+		field := rv.Field(i)
+		if field.Kind() == reflect.Pointer {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		} else if field.IsZero() {
+			continue
+		}
+		values.Set(name, formatValue(field))
+	}
+	return values
+}
+
+// formatValue 将基础类型的值格式化为查询参数字符串
+func formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
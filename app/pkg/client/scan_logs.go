@@ -0,0 +1,148 @@
+package client
+
+import (
+	"app/internal/models"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// CreateScanLogInput 是记录扫码日志的请求参数
+type CreateScanLogInput struct {
+	StoreID            uint    `json:"store_id"`
+	UserUnionID        string  `json:"user_union_id"`
+	DeviceInfo         string  `json:"device_info,omitempty"`
+	IPAddress          string  `json:"ip_address,omitempty"`
+	NetworkType        string  `json:"network_type,omitempty"`
+	LocationLat        float64 `json:"location_lat,omitempty"`
+	LocationLng        float64 `json:"location_lng,omitempty"`
+	MiniProgramVersion string  `json:"mini_program_version,omitempty"`
+	QrCodeType         string  `json:"qr_code_type,omitempty"`
+	QrCodeID           string  `json:"qr_code_id,omitempty"`
+	SystemInfo         string  `json:"system_info,omitempty"`
+	Brand              string  `json:"brand,omitempty"`
+	Model              string  `json:"model,omitempty"`
+	PagePath           string  `json:"page_path,omitempty"`
+	Referer            string  `json:"referer,omitempty"`
+}
+
+// GetScanLogsInput 是查询扫码日志列表的参数
+type GetScanLogsInput struct {
+	StoreID     uint   `form:"store_id"`
+	UserUnionID string `form:"user_union_id"`
+	SuccessFlag *bool  `form:"success_flag"`
+	Page        int    `form:"page"`
+	PageSize    int    `form:"pageSize"`
+}
+
+// UpdateScanLogResultInput 是更新扫码连接结果的请求参数
+type UpdateScanLogResultInput struct {
+	Ticket            string `json:"ticket"` // 创建扫码日志时返回的 ConnectTicket
+	SuccessFlag       bool   `json:"success_flag"`
+	FailReasonCode    string `json:"fail_reason_code,omitempty"`
+	FailReasonMessage string `json:"fail_reason_message,omitempty"`
+	WifiSSID          string `json:"wifi_ssid,omitempty"`
+	WifiMac           string `json:"wifi_mac,omitempty"`
+	WifiSignal        int8   `json:"wifi_signal,omitempty"`
+}
+
+// GetFailedScanLogsInput 是查询连接失败日志的参数
+type GetFailedScanLogsInput struct {
+	StoreID        *uint   `form:"store_id"`
+	UserUnionID    *string `form:"user_union_id"`
+	FailReasonCode *string `form:"fail_reason_code"`
+	StartDate      *string `form:"start_date"` // 格式: YYYY-MM-DD
+	EndDate        *string `form:"end_date"`   // 格式: YYYY-MM-DD
+	Page           int     `form:"page"`
+	PageSize       int     `form:"pageSize"`
+}
+
+// GetUserScanLogsInput 是查询指定用户扫码日志的参数
+type GetUserScanLogsInput struct {
+	UserUnionID string  `form:"user_union_id"`
+	SuccessFlag *bool   `form:"success_flag"`
+	StartDate   *string `form:"start_date"` // 格式: YYYY-MM-DD
+	EndDate     *string `form:"end_date"`   // 格式: YYYY-MM-DD
+	Page        int     `form:"page"`
+	PageSize    int     `form:"pageSize"`
+}
+
+// ScanLogList 是扫码日志列表的查询结果
+type ScanLogList struct {
+	Logs  []models.ScanLog `json:"logs"`
+	Total int64            `json:"total"`
+}
+
+// DailyScanCount 是某一天的扫码次数
+type DailyScanCount struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// CreateScanLog 记录一次扫码
+func (c *Client) CreateScanLog(ctx context.Context, input *CreateScanLogInput) (*models.ScanLog, error) {
+	var log models.ScanLog
+	if err := c.do(ctx, http.MethodPost, "/scan-logs/", nil, input, &log); err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
+// GetScanLogs 分页查询扫码日志
+func (c *Client) GetScanLogs(ctx context.Context, input *GetScanLogsInput) (*ScanLogList, error) {
+	var list ScanLogList
+	if err := c.do(ctx, http.MethodGet, "/scan-logs/", encodeQuery(input), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// UpdateScanLogResult 更新扫码日志的连接结果，连接成功时返回营销活动自动发放优惠券的结果
+func (c *Client) UpdateScanLogResult(ctx context.Context, logID uint64, input *UpdateScanLogResultInput) ([]CampaignReward, error) {
+	var out struct {
+		Rewards []CampaignReward `json:"rewards"`
+	}
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/scan-logs/%d/result", logID), nil, input, &out); err != nil {
+		return nil, err
+	}
+	return out.Rewards, nil
+}
+
+// DisconnectScanLog 上报用户已断开 WIFI 连接，提前释放占用的连接数，需要通过 WithUser 携带用户令牌
+func (c *Client) DisconnectScanLog(ctx context.Context, logID uint64, ticket string) error {
+	in := map[string]any{"ticket": ticket}
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/scan-logs/%d/disconnect", logID), nil, in, nil)
+}
+
+// GetDailyScanCountByStore 查询门店最近 days 天的每日扫码量，days 为 0 时由服务端取默认值
+func (c *Client) GetDailyScanCountByStore(ctx context.Context, storeID uint, days int) ([]DailyScanCount, error) {
+	var query url.Values
+	if days > 0 {
+		query = url.Values{"days": {strconv.Itoa(days)}}
+	}
+	var counts []DailyScanCount
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/stores/%d/scans/daily-count", storeID), query, nil, &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// GetFailedScanLogs 查询连接失败的扫码日志
+func (c *Client) GetFailedScanLogs(ctx context.Context, input *GetFailedScanLogsInput) (*ScanLogList, error) {
+	var list ScanLogList
+	if err := c.do(ctx, http.MethodGet, "/scan-logs/failed", encodeQuery(input), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetUserScanLogs 查询指定用户的扫码日志
+func (c *Client) GetUserScanLogs(ctx context.Context, input *GetUserScanLogsInput) (*ScanLogList, error) {
+	var list ScanLogList
+	if err := c.do(ctx, http.MethodGet, "/scan-logs/user", encodeQuery(input), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// StatsRangeInput 是按日期范围统计的通用参数
+type StatsRangeInput struct {
+	StoreID   *uint  `form:"store_id"`
+	StartDate string `form:"start_date"` // 格式: YYYY-MM-DD
+	EndDate   string `form:"end_date"`   // 格式: YYYY-MM-DD
+}
+
+// GetPopularWifiInput 是查询最受欢迎 WIFI 的参数
+type GetPopularWifiInput struct {
+	StoreID   *uint  `form:"store_id"`
+	StartDate string `form:"start_date"` // 格式: YYYY-MM-DD
+	EndDate   string `form:"end_date"`   // 格式: YYYY-MM-DD
+	Limit     int    `form:"limit"`
+}
+
+// StoreStats 是门店统计数据
+type StoreStats struct {
+	TotalStats struct {
+		TotalStores int64 `json:"total_stores"`
+	} `json:"total_stats"`
+	ByProvince []struct {
+		Province string `json:"province"`
+		Count    int64  `json:"count"`
+	} `json:"by_province"`
+	ByCity []struct {
+		Province string `json:"province"`
+		City     string `json:"city"`
+		Count    int64  `json:"count"`
+	} `json:"by_city"`
+}
+
+// WifiUsageStats 是 WIFI 使用统计数据
+type WifiUsageStats struct {
+	TotalUsage struct {
+		TotalConnections      int64   `json:"total_connections"`
+		SuccessfulConnections int64   `json:"successful_connections"`
+		SuccessRate           float64 `json:"success_rate"`
+	} `json:"total_usage"`
+	ByFailReason []struct {
+		FailReasonCode string `json:"fail_reason_code"`
+		Count          int64  `json:"count"`
+	} `json:"by_fail_reason"`
+	BySSID []struct {
+		SSID  string `json:"ssid"`
+		Count int64  `json:"count"`
+	} `json:"by_ssid"`
+}
+
+// UserBehaviorStats 是用户行为统计数据
+type UserBehaviorStats struct {
+	NewUsersCount      int64 `json:"new_users_count"`
+	ActiveUsersCount   int64 `json:"active_users_count"`
+	GenderDistribution []struct {
+		Gender string `json:"gender"`
+		Count  int64  `json:"count"`
+	} `json:"gender_distribution"`
+	ProvinceDistribution []struct {
+		Province string `json:"province"`
+		Count    int64  `json:"count"`
+	} `json:"province_distribution"`
+	DeviceDistribution []struct {
+		Brand string `json:"brand"`
+		Model string `json:"model"`
+		Count int64  `json:"count"`
+	} `json:"device_distribution"`
+}
+
+// CouponStats 是优惠券统计数据
+type CouponStats struct {
+	OverallStats struct {
+		TotalIssued   int64   `json:"total_issued"`
+		TotalUsed     int64   `json:"total_used"`
+		UsageRate     float64 `json:"usage_rate"`
+		TotalDeducted float64 `json:"total_deducted"`
+	} `json:"overall_stats"`
+	ByTypeStats []struct {
+		CouponType string `json:"coupon_type"`
+		Issued     int64  `json:"issued"`
+		Used       int64  `json:"used"`
+	} `json:"by_type_stats"`
+}
+
+// WifiPopularityItem 是最受欢迎 WIFI 统计中的一项
+type WifiPopularityItem struct {
+	WifiID       uint    `json:"wifi_id"`
+	WifiSSID     string  `json:"wifi_ssid"`
+	StoreID      uint    `json:"store_id"`
+	StoreName    string  `json:"store_name"`
+	ConnectCount int64   `json:"connect_count"`
+	SuccessRate  float64 `json:"success_rate"`
+}
+
+// HourlyDistribution 是某个小时的扫码统计
+type HourlyDistribution struct {
+	Hour         int   `json:"hour"`
+	ScanCount    int64 `json:"scan_count"`
+	SuccessCount int64 `json:"success_count"`
+}
+
+// GetStoreStats 获取门店统计数据
+func (c *Client) GetStoreStats(ctx context.Context) (*StoreStats, error) {
+	var stats StoreStats
+	if err := c.do(ctx, http.MethodGet, "/stats/stores", nil, nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetWifiUsageStats 获取 WIFI 使用统计数据，storeID 为 nil 时统计全平台
+func (c *Client) GetWifiUsageStats(ctx context.Context, storeID *uint) (*WifiUsageStats, error) {
+	var stats WifiUsageStats
+	query := encodeQuery(struct {
+		StoreID *uint `form:"store_id"`
+	}{storeID})
+	if err := c.do(ctx, http.MethodGet, "/stats/wifi-usage", query, nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetUserBehaviorStats 获取用户行为统计数据，input 中的 StoreID 不适用于该接口
+func (c *Client) GetUserBehaviorStats(ctx context.Context, input *StatsRangeInput) (*UserBehaviorStats, error) {
+	var stats UserBehaviorStats
+	query := encodeQuery(input)
+	query.Del("store_id")
+	if err := c.do(ctx, http.MethodGet, "/stats/user-behavior", query, nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetCouponStats 获取优惠券统计数据
+func (c *Client) GetCouponStats(ctx context.Context, input *StatsRangeInput) (*CouponStats, error) {
+	var stats CouponStats
+	if err := c.do(ctx, http.MethodGet, "/stats/coupons", encodeQuery(input), nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetPopularWifi 获取最受欢迎的 WIFI 排行
+func (c *Client) GetPopularWifi(ctx context.Context, input *GetPopularWifiInput) ([]WifiPopularityItem, error) {
+	var items []WifiPopularityItem
+	if err := c.do(ctx, http.MethodGet, "/stats/popular-wifi", encodeQuery(input), nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetScanTimeDistribution 获取按小时统计的扫码时段分布
+func (c *Client) GetScanTimeDistribution(ctx context.Context, input *StatsRangeInput) ([]HourlyDistribution, error) {
+	var items []HourlyDistribution
+	if err := c.do(ctx, http.MethodGet, "/stats/scan-time-distribution", encodeQuery(input), nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,156 @@
+package client
+
+import (
+	"app/internal/models"
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// CreateStoreInput 是创建门店的请求参数
+type CreateStoreInput struct {
+	Name      string  `json:"name"`
+	Country   string  `json:"country,omitempty"`
+	Province  string  `json:"province,omitempty"`
+	City      string  `json:"city,omitempty"`
+	District  string  `json:"district,omitempty"`
+	Address   string  `json:"address,omitempty"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	Phone     string  `json:"phone,omitempty"`
+}
+
+// CreateStoreWithWifiInput 是创建门店并同时创建 WIFI 配置的请求参数
+type CreateStoreWithWifiInput struct {
+	Store CreateStoreInput        `json:"store"`
+	Wifis []CreateWifiConfigInput `json:"wifis,omitempty"`
+}
+
+// GetStoresInput 是查询门店列表的参数
+type GetStoresInput struct {
+	Page      int     `form:"page"`
+	PageSize  int     `form:"pageSize"`
+	Province  string  `form:"province"`
+	City      string  `form:"city"`
+	District  string  `form:"district"`
+	Latitude  float64 `form:"lat"`
+	Longitude float64 `form:"lng"`
+	Radius    float64 `form:"radius"` // 半径，单位：公里
+
+	IncludeDeleted bool `form:"include_deleted"` // 是否包含已删除的门店
+}
+
+// StoreList 是门店列表的查询结果
+type StoreList struct {
+	Stores []models.Store `json:"stores"`
+	Total  int64          `json:"total"`
+}
+
+// UpdateStoreInput 是更新门店的请求参数，空字段不更新
+type UpdateStoreInput struct {
+	Name      string  `json:"name,omitempty"`
+	Country   string  `json:"country,omitempty"`
+	Province  string  `json:"province,omitempty"`
+	City      string  `json:"city,omitempty"`
+	District  string  `json:"district,omitempty"`
+	Address   string  `json:"address,omitempty"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	Phone     string  `json:"phone,omitempty"`
+	Status    *int8   `json:"status,omitempty"`
+}
+
+// UpdateStoreLocationInput 是更新门店位置的请求参数
+type UpdateStoreLocationInput struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Address   string  `json:"address,omitempty"`
+}
+
+// CreateStore 创建门店
+func (c *Client) CreateStore(ctx context.Context, input *CreateStoreInput) (*models.Store, error) {
+	var store models.Store
+	if err := c.do(ctx, http.MethodPost, "/stores/", nil, input, &store); err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
+
+// CreateStoreWithWifi 在一个事务中创建门店及其 WIFI 配置
+func (c *Client) CreateStoreWithWifi(ctx context.Context, input *CreateStoreWithWifiInput) (*models.Store, error) {
+	var store models.Store
+	if err := c.do(ctx, http.MethodPost, "/stores/with-wifi", nil, input, &store); err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
+
+// GetStore 查询单个门店
+func (c *Client) GetStore(ctx context.Context, storeID uint) (*models.Store, error) {
+	var store models.Store
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/stores/%d", storeID), nil, nil, &store); err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
+
+// GetStores 分页查询门店列表
+func (c *Client) GetStores(ctx context.Context, input *GetStoresInput) (*StoreList, error) {
+	var list StoreList
+	if err := c.do(ctx, http.MethodGet, "/stores/", encodeQuery(input), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// UpdateStore 更新门店信息
+func (c *Client) UpdateStore(ctx context.Context, storeID uint, input *UpdateStoreInput) (*models.Store, error) {
+	var store models.Store
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/stores/%d", storeID), nil, input, &store); err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
+
+// DeleteStore 软删除门店，门店的 WIFI 配置和专属优惠券一并删除
+func (c *Client) DeleteStore(ctx context.Context, storeID uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/stores/%d", storeID), nil, nil, nil)
+}
+
+// RestoreStore 恢复已删除的门店，以及删除门店时一并删除的 WIFI 配置和优惠券
+func (c *Client) RestoreStore(ctx context.Context, storeID uint) (*models.Store, error) {
+	var store models.Store
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/stores/%d/restore", storeID), nil, nil, &store); err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
+
+// UpdateStoreStatus 更新门店状态，1正常，0停用
+func (c *Client) UpdateStoreStatus(ctx context.Context, storeID uint, status int8) (*models.Store, error) {
+	var store models.Store
+	in := map[string]int8{"status": status}
+	if err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/stores/%d/status", storeID), nil, in, &store); err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
+
+// UpdateStorePhone 更新门店电话
+func (c *Client) UpdateStorePhone(ctx context.Context, storeID uint, phone string) (*models.Store, error) {
+	var store models.Store
+	in := map[string]string{"phone": phone}
+	if err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/stores/%d/phone", storeID), nil, in, &store); err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
+
+// UpdateStoreLocation 更新门店位置
+func (c *Client) UpdateStoreLocation(ctx context.Context, storeID uint, input *UpdateStoreLocationInput) (*models.Store, error) {
+	var store models.Store
+	if err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/stores/%d/location", storeID), nil, input, &store); err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
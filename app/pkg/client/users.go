@@ -0,0 +1,179 @@
+package client
+
+import (
+	"app/internal/models"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// CreateOrUpdateUserInput 是创建或更新用户档案的请求参数
+type CreateOrUpdateUserInput struct {
+	UserUnionID     string `json:"user_union_id"`
+	OpenID          string `json:"open_id,omitempty"`
+	WechatNickname  string `json:"wechat_nickname,omitempty"`
+	WechatAvatarURL string `json:"wechat_avatar_url,omitempty"`
+	PhoneNumber     string `json:"phone_number,omitempty"`
+	Gender          *int8  `json:"gender,omitempty"`
+	Language        string `json:"language,omitempty"`
+	Country         string `json:"country,omitempty"`
+	Province        string `json:"province,omitempty"`
+	City            string `json:"city,omitempty"`
+}
+
+// GetUserScanHistoryInput 是查询用户扫码门店历史的参数
+type GetUserScanHistoryInput struct {
+	UserUnionID string `form:"user_union_id"`
+	Page        int    `form:"page"`
+	PageSize    int    `form:"pageSize"`
+	StartDate   string `form:"start_date"` // 格式: YYYY-MM-DD
+	EndDate     string `form:"end_date"`   // 格式: YYYY-MM-DD
+}
+
+// UserScanHistoryItem 是用户扫码门店历史中的一条记录
+type UserScanHistoryItem struct {
+	StoreID     uint      `json:"store_id"`
+	StoreName   string    `json:"store_name"`
+	ScanTime    time.Time `json:"scan_time"`
+	SuccessFlag bool      `json:"success_flag"`
+	WifiSSID    string    `json:"wifi_ssid"`
+	DeviceInfo  string    `json:"device_info"`
+	LocationLat float64   `json:"location_lat"`
+	LocationLng float64   `json:"location_lng"`
+	NetworkType string    `json:"network_type"`
+	FailReason  string    `json:"fail_reason,omitempty"`
+}
+
+// UserScanHistory 是用户扫码门店历史的查询结果
+type UserScanHistory struct {
+	ScanHistory []UserScanHistoryItem `json:"scan_history"`
+	Total       int64                 `json:"total"`
+}
+
+// UserToken 是登录接口签发的用户令牌
+type UserToken struct {
+	UserUnionID string    `json:"user_union_id"`
+	Token       string    `json:"token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Login 使用小程序 wx.login 获取的登录凭证 code 为用户签发令牌，配合 WithUser 使用
+func (c *Client) Login(ctx context.Context, code string) (*UserToken, error) {
+	return c.login(ctx, map[string]string{"code": code})
+}
+
+// IssueUserToken 直接为指定用户签发令牌，仅平台管理员可用
+func (c *Client) IssueUserToken(ctx context.Context, unionID string) (*UserToken, error) {
+	return c.login(ctx, map[string]string{"user_union_id": unionID})
+}
+
+// login 调用登录接口并返回签发的用户令牌
+func (c *Client) login(ctx context.Context, in map[string]string) (*UserToken, error) {
+	var token UserToken
+	if err := c.do(ctx, http.MethodPost, "/users/login", nil, in, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// CreateOrUpdateUser 创建或更新用户档案
+func (c *Client) CreateOrUpdateUser(ctx context.Context, input *CreateOrUpdateUserInput) (*models.UserProfile, error) {
+	var user models.UserProfile
+	if err := c.do(ctx, http.MethodPost, "/users/", nil, input, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// getUser 按指定的查询参数获取用户详情
+func (c *Client) getUser(ctx context.Context, key, value string) (*models.UserProfile, error) {
+	var user models.UserProfile
+	if err := c.do(ctx, http.MethodGet, "/users/", url.Values{key: {value}}, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserByUnionID 根据 UnionID 获取用户详情
+func (c *Client) GetUserByUnionID(ctx context.Context, unionID string) (*models.UserProfile, error) {
+	return c.getUser(ctx, "union_id", unionID)
+}
+
+// GetUserByOpenID 根据 OpenID 获取用户详情
+func (c *Client) GetUserByOpenID(ctx context.Context, openID string) (*models.UserProfile, error) {
+	return c.getUser(ctx, "open_id", openID)
+}
+
+// GetUserByPhone 根据手机号获取用户详情
+func (c *Client) GetUserByPhone(ctx context.Context, phone string) (*models.UserProfile, error) {
+	return c.getUser(ctx, "phone", phone)
+}
+
+// BindPhoneNumber 为用户绑定手机号
+func (c *Client) BindPhoneNumber(ctx context.Context, unionID, phoneNumber, countryCode string) (*models.UserProfile, error) {
+	var user models.UserProfile
+	in := map[string]string{
+		"user_union_id":      unionID,
+		"phone_number":       phoneNumber,
+		"phone_country_code": countryCode,
+	}
+	if err := c.do(ctx, http.MethodPost, "/users/bind-phone", nil, in, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UnbindPhoneNumber 解除用户的手机号绑定
+func (c *Client) UnbindPhoneNumber(ctx context.Context, unionID string) (*models.UserProfile, error) {
+	var user models.UserProfile
+	in := map[string]string{"user_union_id": unionID}
+	if err := c.do(ctx, http.MethodPost, "/users/unbind-phone", nil, in, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserScanHistory 查询用户扫码门店历史
+func (c *Client) GetUserScanHistory(ctx context.Context, input *GetUserScanHistoryInput) (*UserScanHistory, error) {
+	var history UserScanHistory
+	if err := c.do(ctx, http.MethodGet, "/users/scan-history", encodeQuery(input), nil, &history); err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
+// GetUserCouponsInput 是查询用户券包的参数
+type GetUserCouponsInput struct {
+	UserUnionID string `form:"user_union_id"` // 通过 WithUser 携带用户令牌时可省略
+	Status      string `form:"status"`        // UNUSED, USED, EXPIRED 或 REFUNDED
+	CouponID    *uint  `form:"coupon_id"`
+	StoreID     *uint  `form:"store_id"` // 领取门店
+	Page        int    `form:"page"`
+	PageSize    int    `form:"pageSize"`
+}
+
+// UserCouponList 是用户券包的查询结果
+type UserCouponList struct {
+	Coupons []models.UserCoupon `json:"coupons"`
+	Total   int64               `json:"total"`
+}
+
+// GetUserCoupons 查询用户券包
+func (c *Client) GetUserCoupons(ctx context.Context, input *GetUserCouponsInput) (*UserCouponList, error) {
+	var list UserCouponList
+	if err := c.do(ctx, http.MethodGet, "/users/coupons", encodeQuery(input), nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetUserCoupon 查询用户券包中的一张优惠券，需要通过 WithUser 携带用户令牌
+func (c *Client) GetUserCoupon(ctx context.Context, id uint64) (*models.UserCoupon, error) {
+	var userCoupon models.UserCoupon
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/users/coupons/%d", id), nil, nil, &userCoupon); err != nil {
+		return nil, err
+	}
+	return &userCoupon, nil
+}
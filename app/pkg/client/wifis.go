@@ -0,0 +1,136 @@
+package client
+
+import (
+	"app/internal/models"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// 服务端在 /wifis 和 /wifi-configs 下注册了相同的 WIFI 配置接口，客户端统一使用 /wifi-configs。
+
+// CreateWifiConfigInput 是创建 WIFI 配置的请求参数
+type CreateWifiConfigInput struct {
+	StoreID        uint   `json:"store_id"`
+	SSID           string `json:"ssid"`
+	Password       string `json:"password"` // WIFI密码明文，由服务端加密保存
+	EncryptionType string `json:"encryption_type,omitempty"`
+	WifiType       string `json:"wifi_type,omitempty"`
+	MaxConnections *int   `json:"max_connections,omitempty"` // 0 表示不限制，为 nil 时服务端默认为 50
+}
+
+// UpdateWifiConfigInput 是更新 WIFI 配置的请求参数，空字段不更新
+type UpdateWifiConfigInput struct {
+	SSID           string `json:"ssid,omitempty"`
+	Password       string `json:"password,omitempty"`
+	EncryptionType string `json:"encryption_type,omitempty"`
+	WifiType       string `json:"wifi_type,omitempty"`
+	MaxConnections *int   `json:"max_connections,omitempty"`
+}
+
+// CreateWifiConfig 创建 WIFI 配置
+func (c *Client) CreateWifiConfig(ctx context.Context, input *CreateWifiConfigInput) (*models.WifiConfig, error) {
+	var wifi models.WifiConfig
+	if err := c.do(ctx, http.MethodPost, "/wifi-configs/", nil, input, &wifi); err != nil {
+		return nil, err
+	}
+	return &wifi, nil
+}
+
+// CreateBatchWifiConfigs 批量创建 WIFI 配置
+func (c *Client) CreateBatchWifiConfigs(ctx context.Context, inputs []*CreateWifiConfigInput) ([]models.WifiConfig, error) {
+	var out struct {
+		Configs []models.WifiConfig `json:"configs"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/wifi-configs/batch", nil, inputs, &out); err != nil {
+		return nil, err
+	}
+	return out.Configs, nil
+}
+
+// GetWifiConfig 查询单个 WIFI 配置
+func (c *Client) GetWifiConfig(ctx context.Context, id uint) (*models.WifiConfig, error) {
+	var wifi models.WifiConfig
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/wifi-configs/%d", id), nil, nil, &wifi); err != nil {
+		return nil, err
+	}
+	return &wifi, nil
+}
+
+// GetWifiConfigsByStore 查询门店下的全部 WIFI 配置，includeDeleted 为 true 时包含已删除的 WIFI 配置
+func (c *Client) GetWifiConfigsByStore(ctx context.Context, storeID uint, includeDeleted bool) ([]models.WifiConfig, error) {
+	var query url.Values
+	if includeDeleted {
+		query = url.Values{"include_deleted": {"true"}}
+	}
+	var wifis []models.WifiConfig
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/stores/%d/wifis", storeID), query, nil, &wifis); err != nil {
+		return nil, err
+	}
+	return wifis, nil
+}
+
+// GetWifiConfigsByStoreAndType 查询门店下指定类型的 WIFI 配置
+func (c *Client) GetWifiConfigsByStoreAndType(ctx context.Context, storeID uint, wifiType string) ([]models.WifiConfig, error) {
+	var wifis []models.WifiConfig
+	query := encodeQuery(struct {
+		StoreID  uint   `form:"store_id"`
+		WifiType string `form:"wifi_type"`
+	}{storeID, wifiType})
+	if err := c.do(ctx, http.MethodGet, "/wifi-configs/type", query, nil, &wifis); err != nil {
+		return nil, err
+	}
+	return wifis, nil
+}
+
+// UpdateWifiConfig 更新 WIFI 配置
+func (c *Client) UpdateWifiConfig(ctx context.Context, id uint, input *UpdateWifiConfigInput) (*models.WifiConfig, error) {
+	var wifi models.WifiConfig
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/wifi-configs/%d", id), nil, input, &wifi); err != nil {
+		return nil, err
+	}
+	return &wifi, nil
+}
+
+// DeleteWifiConfig 删除单个 WIFI 配置
+func (c *Client) DeleteWifiConfig(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/wifi-configs/%d", id), nil, nil, nil)
+}
+
+// RestoreWifiConfig 恢复已删除的 WIFI 配置，所属门店必须未被删除
+func (c *Client) RestoreWifiConfig(ctx context.Context, id uint) (*models.WifiConfig, error) {
+	var wifi models.WifiConfig
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/wifi-configs/%d/restore", id), nil, nil, &wifi); err != nil {
+		return nil, err
+	}
+	return &wifi, nil
+}
+
+// DeleteBatchWifiConfigs 批量删除 WIFI 配置
+func (c *Client) DeleteBatchWifiConfigs(ctx context.Context, ids []uint) error {
+	return c.do(ctx, http.MethodDelete, "/wifi-configs/batch", nil, ids, nil)
+}
+
+// WifiCredential 是 ConnectWifi 返回的 WIFI 连接凭证
+type WifiCredential struct {
+	WifiID         uint   `json:"wifi_id"`
+	SSID           string `json:"ssid"`
+	Password       string `json:"password"`
+	EncryptionType string `json:"encryption_type"`
+	LogID          uint64 `json:"log_id"`
+	// 上报连接结果的截止时间
+	ReportExpiresAt time.Time `json:"report_expires_at"`
+}
+
+// ConnectWifi 凭本次扫码创建的扫码日志及其连接票据获取顾客 WIFI 的密码，需要通过 WithUser 携带用户令牌
+// WIFI 连接数已满时返回 HTTP 409 的 *APIError，可通过 GetWifiConfigsByStore 查看同一门店其他 WIFI 的占用情况
+func (c *Client) ConnectWifi(ctx context.Context, wifiID uint, logID uint64, ticket string) (*WifiCredential, error) {
+	var credential WifiCredential
+	in := map[string]any{"log_id": logID, "ticket": ticket}
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/wifi-configs/%d/connect", wifiID), nil, in, &credential); err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
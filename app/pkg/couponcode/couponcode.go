@@ -0,0 +1,159 @@
+// Package couponcode 生成和校验优惠券的券码。
+//
+// 券码由前缀、随机部分和一位校验字符组成，随机部分和校验字符取自同一个字母表。
+// 随机部分使用 crypto/rand 生成，默认 12 位、32 个字符，约 60 位熵，无法被枚举猜中；
+// 校验字符按 Luhn mod N 算法计算，可以发现单个字符输错和绝大多数相邻字符颠倒，便于线下手工输入时及时提示。
+package couponcode
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+)
+
+const (
+	// DefaultAlphabet 是默认的字母表，去掉了容易混淆的 0、1、I、O
+	DefaultAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+	// DefaultLength 是随机部分的默认长度
+	DefaultLength = 12
+
+	minAlphabetSize = 16
+	minLength       = 8
+	maxLength       = 32
+	maxPrefixLength = 8
+)
+
+var (
+	// ErrInvalidAlphabet 表示字母表无效
+	ErrInvalidAlphabet = errors.New("字母表只能包含不重复的数字和大写字母，且至少 16 个字符")
+	// ErrInvalidLength 表示随机部分的长度超出范围
+	ErrInvalidLength = errors.New("券码随机部分的长度必须在 8 到 32 之间")
+	// ErrInvalidPrefix 表示前缀无效
+	ErrInvalidPrefix = errors.New("券码前缀只能包含数字和大写字母，且不超过 8 个字符")
+)
+
+// Generator 按指定的字母表、前缀和长度生成券码
+type Generator struct {
+	alphabet string
+	index    [256]int // 字符在字母表中的位置，不在字母表中为 -1
+	prefix   string
+	length   int
+}
+
+// isAlphanumeric 判断字符是否为数字或大写字母
+func isAlphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'A' && c <= 'Z'
+}
+
+// New 创建券码生成器。alphabet 为空时使用 DefaultAlphabet，length 为 0 时使用 DefaultLength，
+// 前缀和字母表中的小写字母会被转换为大写。
+func New(alphabet, prefix string, length int) (*Generator, error) {
+	if alphabet == "" {
+		alphabet = DefaultAlphabet
+	}
+	if length == 0 {
+		length = DefaultLength
+	}
+	alphabet = strings.ToUpper(alphabet)
+	prefix = strings.ToUpper(prefix)
+
+	g := &Generator{alphabet: alphabet, prefix: prefix, length: length}
+	for i := range g.index {
+		g.index[i] = -1
+	}
+	if len(alphabet) < minAlphabetSize || len(alphabet) > 36 {
+		return nil, ErrInvalidAlphabet
+	}
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		if !isAlphanumeric(c) || g.index[c] >= 0 {
+			return nil, ErrInvalidAlphabet
+		}
+		g.index[c] = i
+	}
+	if length < minLength || length > maxLength {
+		return nil, ErrInvalidLength
+	}
+	if len(prefix) > maxPrefixLength {
+		return nil, ErrInvalidPrefix
+	}
+	for i := 0; i < len(prefix); i++ {
+		if !isAlphanumeric(prefix[i]) {
+			return nil, ErrInvalidPrefix
+		}
+	}
+	return g, nil
+}
+
+// Alphabet 返回生成器使用的字母表
+func (g *Generator) Alphabet() string { return g.alphabet }
+
+// Prefix 返回生成器使用的前缀
+func (g *Generator) Prefix() string { return g.prefix }
+
+// Length 返回随机部分的长度
+func (g *Generator) Length() int { return g.length }
+
+// CodeLength 返回完整券码的长度，包括前缀和校验字符
+func (g *Generator) CodeLength() int { return len(g.prefix) + g.length + 1 }
+
+// Generate 生成一个券码
+func (g *Generator) Generate() (string, error) {
+	n := len(g.alphabet)
+	// 拒绝采样，丢弃会导致取模偏差的字节
+	limit := 256 - 256%n
+	code := make([]byte, 0, g.CodeLength())
+	code = append(code, g.prefix...)
+	buf := make([]byte, g.length*2)
+	for len(code) < len(g.prefix)+g.length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(code) < len(g.prefix)+g.length {
+				code = append(code, g.alphabet[int(b)%n])
+			}
+		}
+	}
+	code = append(code, g.alphabet[g.checkIndex(code[len(g.prefix):])])
+	return string(code), nil
+}
+
+// checkIndex 按 Luhn mod N 算法计算 body 的校验字符在字母表中的位置
+func (g *Generator) checkIndex(body []byte) int {
+	n := len(g.alphabet)
+	factor, sum := 2, 0
+	for i := len(body) - 1; i >= 0; i-- {
+		addend := factor * g.index[body[i]]
+		factor = 3 - factor
+		sum += addend/n + addend%n
+	}
+	return (n - sum%n) % n
+}
+
+// Valid 校验券码的格式和校验字符，code 应已经过 Normalize
+func (g *Generator) Valid(code string) bool {
+	if len(code) != g.CodeLength() || !strings.HasPrefix(code, g.prefix) {
+		return false
+	}
+	body := []byte(code[len(g.prefix):])
+	for _, c := range body {
+		if g.index[c] < 0 {
+			return false
+		}
+	}
+	return g.checkIndex(body[:len(body)-1]) == g.index[body[len(body)-1]]
+}
+
+// Normalize 规范化用户输入的券码：去掉空格和连字符并转换为大写
+func Normalize(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == ' ' || r == '-':
+			return -1
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return r
+	}, strings.TrimSpace(code))
+}
@@ -21,7 +21,8 @@ func Init() {
 
 	// 基础 GORM 配置
 	gormConfig := &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info), // GORM 日志配置
+		Logger:         logger.Default.LogMode(logger.Info), // GORM 日志配置
+		TranslateError: true,                                // 将唯一索引冲突等数据库错误转换为 gorm.ErrDuplicatedKey 等通用错误
 	}
 
 	// 连接主库
@@ -65,3 +66,11 @@ func Init() {
 	DB = db
 	fmt.Println("数据库连接成功并且读写分离已配置。")
 }
+
+// Migrate 根据模型定义同步数据表结构。
+// 只会新增缺失的表、列和索引，不会删除已有的列。
+func Migrate(models ...any) {
+	if err := DB.AutoMigrate(models...); err != nil {
+		log.Fatalf("无法同步数据表结构: %v", err)
+	}
+}
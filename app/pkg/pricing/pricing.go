@@ -0,0 +1,179 @@
+// Package pricing 根据优惠券规则计算订单的抵扣金额。
+//
+// 各类型优惠券的计算规则：
+//   - DISCOUNT：Value 为折扣，取值 (0, 10)，例如 8.5 表示八五折，按商品小计（不含运费）打折，抵扣金额向下取整到分；
+//   - CASH：Value 为减免金额，最多抵扣商品小计；
+//   - SHIPPING：Value 为运费减免上限，0 表示运费全免，最多抵扣运费；
+//   - GIFT：赠品券，不抵扣金额。
+//
+// 最低消费金额按商品小计判断；设置了最高抵扣金额时，抵扣金额不超过该值。
+// 金额在计算时换算为分，避免浮点误差，对外仍以元为单位。
+package pricing
+
+import (
+	"errors"
+	"math"
+)
+
+// 优惠券类型
+const (
+	TypeDiscount = "DISCOUNT"
+	TypeCash     = "CASH"
+	TypeGift     = "GIFT"
+	TypeShipping = "SHIPPING"
+)
+
+var (
+	// ErrInvalidRule 表示优惠券的类型或面值配置无效
+	ErrInvalidRule = errors.New("优惠券面值配置无效")
+	// ErrInvalidOrder 表示订单的金额或商品明细无效
+	ErrInvalidOrder = errors.New("订单金额无效")
+	// ErrMinPurchaseNotMet 表示商品小计未达到优惠券的最低消费金额
+	ErrMinPurchaseNotMet = errors.New("订单金额未达到优惠券的最低消费金额")
+)
+
+// Rule 是计算抵扣金额所需的优惠券规则
+type Rule struct {
+	Type               string
+	Value              float64
+	MinPurchaseAmount  float64 // 商品小计需达到的金额，0 表示不限
+	MaxDeductionAmount float64 // 最高抵扣金额，0 表示不限
+}
+
+// Item 是订单中的一项商品
+type Item struct {
+	SKU       string  `json:"sku"`
+	Name      string  `json:"name"`
+	UnitPrice float64 `json:"unit_price"`
+	Quantity  int     `json:"quantity"`
+}
+
+// Order 是待计算的订单
+type Order struct {
+	Items       []Item
+	Subtotal    float64 // 商品小计；有商品明细时可以为 0，由明细计算，否则必须与明细合计一致
+	ShippingFee float64
+}
+
+// Quote 是订单使用优惠券后的计算结果
+type Quote struct {
+	Subtotal          float64 `json:"subtotal"`           // 商品小计
+	ShippingFee       float64 `json:"shipping_fee"`       // 运费
+	GoodsDeduction    float64 `json:"goods_deduction"`    // 商品抵扣金额
+	ShippingDeduction float64 `json:"shipping_deduction"` // 运费抵扣金额
+	Deduction         float64 `json:"deduction"`          // 抵扣总额
+	Payable           float64 `json:"payable"`            // 应付金额
+	Capped            bool    `json:"capped"`             // 抵扣金额是否受最高抵扣金额限制
+	Gift              bool    `json:"gift"`               // 是否为赠品券
+}
+
+// toCents 将金额（元）四舍五入换算为分
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// toYuan 将分换算为元
+func toYuan(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+// Round 将金额四舍五入到分
+func Round(amount float64) float64 {
+	return toYuan(toCents(amount))
+}
+
+// Validate 校验优惠券规则是否可以用于计算
+func (r Rule) Validate() error {
+	if r.MinPurchaseAmount < 0 || r.MaxDeductionAmount < 0 {
+		return ErrInvalidRule
+	}
+	switch r.Type {
+	case TypeDiscount:
+		if r.Value <= 0 || r.Value >= 10 {
+			return ErrInvalidRule
+		}
+	case TypeCash:
+		if r.Value <= 0 {
+			return ErrInvalidRule
+		}
+	case TypeShipping:
+		if r.Value < 0 {
+			return ErrInvalidRule
+		}
+	case TypeGift:
+	default:
+		return ErrInvalidRule
+	}
+	return nil
+}
+
+// subtotalCents 返回订单的商品小计（分）
+func (o Order) subtotalCents() (int64, error) {
+	if o.Subtotal < 0 || o.ShippingFee < 0 {
+		return 0, ErrInvalidOrder
+	}
+	if len(o.Items) == 0 {
+		return toCents(o.Subtotal), nil
+	}
+
+	var sum int64
+	for _, item := range o.Items {
+		if item.UnitPrice < 0 || item.Quantity <= 0 {
+			return 0, ErrInvalidOrder
+		}
+		sum += toCents(item.UnitPrice) * int64(item.Quantity)
+	}
+	if o.Subtotal != 0 && toCents(o.Subtotal) != sum {
+		return 0, ErrInvalidOrder
+	}
+	return sum, nil
+}
+
+// Calculate 按优惠券规则计算订单的抵扣金额和应付金额
+func Calculate(rule Rule, order Order) (*Quote, error) {
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+	subtotal, err := order.subtotalCents()
+	if err != nil {
+		return nil, err
+	}
+	shippingFee := toCents(order.ShippingFee)
+	if subtotal+shippingFee <= 0 {
+		return nil, ErrInvalidOrder
+	}
+	if subtotal < toCents(rule.MinPurchaseAmount) {
+		return nil, ErrMinPurchaseNotMet
+	}
+
+	var goods, shipping int64
+	switch rule.Type {
+	case TypeDiscount:
+		// 折扣按千分比计算，8.5 折即实付 850‰，抵扣金额向下取整到分
+		rate := int64(math.Round(rule.Value * 100))
+		goods = subtotal * (1000 - rate) / 1000
+	case TypeCash:
+		goods = min(toCents(rule.Value), subtotal)
+	case TypeShipping:
+		shipping = shippingFee
+		if rule.Value > 0 {
+			shipping = min(toCents(rule.Value), shippingFee)
+		}
+	}
+
+	quote := &Quote{Gift: rule.Type == TypeGift}
+	if limit := toCents(rule.MaxDeductionAmount); limit > 0 && goods+shipping > limit {
+		// 同时存在两部分抵扣时优先保留商品抵扣；目前每种类型只会产生其中一部分
+		goods = min(goods, limit)
+		shipping = limit - goods
+		quote.Capped = true
+	}
+
+	quote.Subtotal = toYuan(subtotal)
+	quote.ShippingFee = toYuan(shippingFee)
+	quote.GoodsDeduction = toYuan(goods)
+	quote.ShippingDeduction = toYuan(shipping)
+	quote.Deduction = toYuan(goods + shipping)
+	quote.Payable = toYuan(subtotal + shippingFee - goods - shipping)
+	return quote, nil
+}
@@ -0,0 +1,175 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		order Order
+		want  Quote
+	}{
+		{
+			name:  "八五折",
+			rule:  Rule{Type: TypeDiscount, Value: 8.5},
+			order: Order{Subtotal: 100},
+			want:  Quote{Subtotal: 100, GoodsDeduction: 15, Deduction: 15, Payable: 85},
+		},
+		{
+			name:  "折扣抵扣金额向下取整到分",
+			rule:  Rule{Type: TypeDiscount, Value: 8.5},
+			order: Order{Subtotal: 33.33}, // 3333 × 150‰ = 499.95 分
+			want:  Quote{Subtotal: 33.33, GoodsDeduction: 4.99, Deduction: 4.99, Payable: 28.34},
+		},
+		{
+			name:  "折扣按千分比计算",
+			rule:  Rule{Type: TypeDiscount, Value: 8.88},
+			order: Order{Subtotal: 10}, // 1000 × 112‰ = 112 分
+			want:  Quote{Subtotal: 10, GoodsDeduction: 1.12, Deduction: 1.12, Payable: 8.88},
+		},
+		{
+			name:  "接近原价的折扣对一分钱不抵扣",
+			rule:  Rule{Type: TypeDiscount, Value: 9.99},
+			order: Order{Subtotal: 0.01},
+			want:  Quote{Subtotal: 0.01, Payable: 0.01},
+		},
+		{
+			name:  "折扣不作用于运费",
+			rule:  Rule{Type: TypeDiscount, Value: 5},
+			order: Order{Subtotal: 20, ShippingFee: 8},
+			want:  Quote{Subtotal: 20, ShippingFee: 8, GoodsDeduction: 10, Deduction: 10, Payable: 18},
+		},
+		{
+			name:  "折扣受最高抵扣金额限制",
+			rule:  Rule{Type: TypeDiscount, Value: 5, MaxDeductionAmount: 30},
+			order: Order{Subtotal: 100},
+			want:  Quote{Subtotal: 100, GoodsDeduction: 30, Deduction: 30, Payable: 70, Capped: true},
+		},
+		{
+			name:  "代金券",
+			rule:  Rule{Type: TypeCash, Value: 20},
+			order: Order{Subtotal: 100, ShippingFee: 10},
+			want:  Quote{Subtotal: 100, ShippingFee: 10, GoodsDeduction: 20, Deduction: 20, Payable: 90},
+		},
+		{
+			name:  "代金券最多抵扣商品小计",
+			rule:  Rule{Type: TypeCash, Value: 20},
+			order: Order{Subtotal: 15, ShippingFee: 6},
+			want:  Quote{Subtotal: 15, ShippingFee: 6, GoodsDeduction: 15, Deduction: 15, Payable: 6},
+		},
+		{
+			name:  "抵扣金额等于最高抵扣金额时不算受限",
+			rule:  Rule{Type: TypeCash, Value: 20, MaxDeductionAmount: 20},
+			order: Order{Subtotal: 100},
+			want:  Quote{Subtotal: 100, GoodsDeduction: 20, Deduction: 20, Payable: 80},
+		},
+		{
+			name:  "代金券受最高抵扣金额限制",
+			rule:  Rule{Type: TypeCash, Value: 20, MaxDeductionAmount: 19.99},
+			order: Order{Subtotal: 100},
+			want:  Quote{Subtotal: 100, GoodsDeduction: 19.99, Deduction: 19.99, Payable: 80.01, Capped: true},
+		},
+		{
+			name:  "面值为 0 的运费券全免运费",
+			rule:  Rule{Type: TypeShipping, Value: 0},
+			order: Order{Subtotal: 50, ShippingFee: 8},
+			want:  Quote{Subtotal: 50, ShippingFee: 8, ShippingDeduction: 8, Deduction: 8, Payable: 50},
+		},
+		{
+			name:  "运费券最多减免面值",
+			rule:  Rule{Type: TypeShipping, Value: 5},
+			order: Order{Subtotal: 50, ShippingFee: 8},
+			want:  Quote{Subtotal: 50, ShippingFee: 8, ShippingDeduction: 5, Deduction: 5, Payable: 53},
+		},
+		{
+			name:  "运费券最多抵扣运费",
+			rule:  Rule{Type: TypeShipping, Value: 10},
+			order: Order{Subtotal: 50, ShippingFee: 8},
+			want:  Quote{Subtotal: 50, ShippingFee: 8, ShippingDeduction: 8, Deduction: 8, Payable: 50},
+		},
+		{
+			name:  "免运费券受最高抵扣金额限制",
+			rule:  Rule{Type: TypeShipping, Value: 0, MaxDeductionAmount: 6},
+			order: Order{Subtotal: 50, ShippingFee: 8},
+			want:  Quote{Subtotal: 50, ShippingFee: 8, ShippingDeduction: 6, Deduction: 6, Payable: 52, Capped: true},
+		},
+		{
+			name:  "没有运费时运费券不抵扣",
+			rule:  Rule{Type: TypeShipping, Value: 0},
+			order: Order{Subtotal: 50},
+			want:  Quote{Subtotal: 50, Payable: 50},
+		},
+		{
+			name:  "赠品券不抵扣金额",
+			rule:  Rule{Type: TypeGift},
+			order: Order{Subtotal: 50, ShippingFee: 5},
+			want:  Quote{Subtotal: 50, ShippingFee: 5, Payable: 55, Gift: true},
+		},
+		{
+			name:  "商品小计恰好达到最低消费金额",
+			rule:  Rule{Type: TypeCash, Value: 10, MinPurchaseAmount: 100},
+			order: Order{Subtotal: 100},
+			want:  Quote{Subtotal: 100, GoodsDeduction: 10, Deduction: 10, Payable: 90},
+		},
+		{
+			name: "由商品明细计算小计",
+			rule: Rule{Type: TypeCash, Value: 10},
+			order: Order{Items: []Item{
+				{SKU: "a", UnitPrice: 19.99, Quantity: 3},
+				{SKU: "b", UnitPrice: 0.1, Quantity: 1},
+				{SKU: "c", UnitPrice: 0.2, Quantity: 1},
+			}},
+			want: Quote{Subtotal: 60.27, GoodsDeduction: 10, Deduction: 10, Payable: 50.27},
+		},
+		{
+			name:  "小计与明细合计一致",
+			rule:  Rule{Type: TypeCash, Value: 0.1},
+			order: Order{Subtotal: 0.3, Items: []Item{{UnitPrice: 0.1, Quantity: 1}, {UnitPrice: 0.2, Quantity: 1}}},
+			want:  Quote{Subtotal: 0.3, GoodsDeduction: 0.1, Deduction: 0.1, Payable: 0.2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Calculate(tt.rule, tt.order)
+			if err != nil {
+				t.Fatalf("Calculate() 返回错误: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("Calculate() = %+v，应为 %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		order Order
+		want  error
+	}{
+		{"折扣为 0", Rule{Type: TypeDiscount, Value: 0}, Order{Subtotal: 10}, ErrInvalidRule},
+		{"折扣为 10", Rule{Type: TypeDiscount, Value: 10}, Order{Subtotal: 10}, ErrInvalidRule},
+		{"代金券面值为 0", Rule{Type: TypeCash, Value: 0}, Order{Subtotal: 10}, ErrInvalidRule},
+		{"运费券面值为负数", Rule{Type: TypeShipping, Value: -1}, Order{Subtotal: 10}, ErrInvalidRule},
+		{"最高抵扣金额为负数", Rule{Type: TypeCash, Value: 1, MaxDeductionAmount: -1}, Order{Subtotal: 10}, ErrInvalidRule},
+		{"未知类型", Rule{Type: "POINTS", Value: 1}, Order{Subtotal: 10}, ErrInvalidRule},
+		{"差一分未达到最低消费金额", Rule{Type: TypeCash, Value: 10, MinPurchaseAmount: 100}, Order{Subtotal: 99.99}, ErrMinPurchaseNotMet},
+		{"运费不计入最低消费金额", Rule{Type: TypeCash, Value: 10, MinPurchaseAmount: 100}, Order{Subtotal: 90, ShippingFee: 20}, ErrMinPurchaseNotMet},
+		{"订单金额为 0", Rule{Type: TypeGift}, Order{}, ErrInvalidOrder},
+		{"运费为负数", Rule{Type: TypeGift}, Order{Subtotal: 10, ShippingFee: -1}, ErrInvalidOrder},
+		{"商品数量为 0", Rule{Type: TypeGift}, Order{Items: []Item{{UnitPrice: 1, Quantity: 0}}}, ErrInvalidOrder},
+		{"商品单价为负数", Rule{Type: TypeGift}, Order{Items: []Item{{UnitPrice: -1, Quantity: 1}}}, ErrInvalidOrder},
+		{"小计与明细合计不一致", Rule{Type: TypeGift}, Order{Subtotal: 10, Items: []Item{{UnitPrice: 9.99, Quantity: 1}}}, ErrInvalidOrder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Calculate(tt.rule, tt.order); !errors.Is(err, tt.want) {
+				t.Errorf("Calculate() 返回 %v，应为 %v", err, tt.want)
+			}
+		})
+	}
+}
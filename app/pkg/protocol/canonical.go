@@ -0,0 +1,141 @@
+package protocol
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// CanonicalRequest 构造协议版本 4 的签名原文，各部分以换行符分隔：
+//
+//	HTTP 方法（大写）
+//	规范化路径：按 RFC 3986 对每个路径段进行百分号编码
+//	规范化查询串：键和值分别按 RFC 3986 编码后，先按键、再按值排序，重复的键全部保留
+//	Content-Type：只取媒体类型（去掉 charset 等参数），小写并去除首尾空白，没有请求体时为空
+//	X-App-Id
+//	X-Timestamp
+//	X-Nonce
+//	请求体（即加密信封）的 SHA-256 十六进制摘要
+func CanonicalRequest(method, path, rawQuery, contentType, appID, timestamp, nonce string, body []byte) (string, error) {
+	query, err := canonicalQuery(rawQuery)
+	if err != nil {
+		return "", err
+	}
+	if len(body) == 0 {
+		contentType = ""
+	}
+	bodyHash := sha256.Sum256(body)
+
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		canonicalPath(path),
+		query,
+		canonicalContentType(contentType),
+		appID,
+		timestamp,
+		nonce,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n"), nil
+}
+
+// canonicalContentType 去掉 Content-Type 的参数部分，只保留小写的媒体类型，
+// 例如 "Application/JSON; charset=utf-8" 规范化为 "application/json"
+func canonicalContentType(contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// canonicalPath 对解码后的路径逐段进行 RFC 3986 编码，空路径视为 "/"
+func canonicalPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery 解析原始查询串，并按键、值排序后重新编码
+func canonicalQuery(rawQuery string) (string, error) {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", err
+	}
+
+	type pair struct{ key, value string }
+	pairs := make([]pair, 0, len(values))
+	for k, vs := range values {
+		encodedKey := uriEncode(k)
+		for _, v := range vs {
+			pairs = append(pairs, pair{encodedKey, uriEncode(v)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].key != pairs[j].key {
+			return pairs[i].key < pairs[j].key
+		}
+		return pairs[i].value < pairs[j].value
+	})
+
+	parts := make([]string, len(pairs))
+	for i, p := range pairs {
+		parts[i] = p.key + "=" + p.value
+	}
+	return strings.Join(parts, "&"), nil
+}
+
+// uriEncode 按 RFC 3986 对字符串进行百分号编码，只保留未保留字符 A-Z a-z 0-9 - _ . ~
+func uriEncode(s string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' {
+			b.WriteByte(ch)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[ch>>4])
+		b.WriteByte(hexDigits[ch&0x0F])
+	}
+	return b.String()
+}
+
+// LegacyStringToSign 构造协议版本 1 至 3 的签名原文：
+// 时间戳 + nonce + 方法 + 路径 [+ "?" + 按键排序的查询串（每个键只取第一个值）] [+ " " + 请求体]
+func LegacyStringToSign(method, path string, query url.Values, timestamp, nonce string, body []byte) string {
+	queryKeys := make([]string, 0, len(query))
+	for k := range query {
+		queryKeys = append(queryKeys, k)
+	}
+	sort.Strings(queryKeys)
+	var sortedQuery strings.Builder
+	for i, k := range queryKeys {
+		if i > 0 {
+			sortedQuery.WriteString("&")
+		}
+		sortedQuery.WriteString(k)
+		sortedQuery.WriteString("=")
+		sortedQuery.WriteString(query.Get(k))
+	}
+
+	var stringToSign strings.Builder
+	stringToSign.WriteString(timestamp)
+	stringToSign.WriteString(nonce)
+	stringToSign.WriteString(method)
+	stringToSign.WriteString(path)
+	if sortedQuery.Len() > 0 {
+		stringToSign.WriteString("?")
+		stringToSign.WriteString(sortedQuery.String())
+	}
+	if len(body) > 0 {
+		stringToSign.WriteString(" ")
+		stringToSign.Write(body)
+	}
+	return stringToSign.String()
+}
@@ -1,4 +1,4 @@
-package security
+package protocol
 
 import (
 	"crypto/aes"
@@ -14,14 +14,21 @@ import (
 
 // EncryptedData 结构用于封装加密后的数据
 type EncryptedData struct {
-	Data string `json:"data"` // Base64 编码的密文
-	IV   string `json:"iv"`   // Base64 编码的初始化向量
-	Tag  string `json:"tag"`  // Base64 编码的认证标签
+	Data string `json:"data"`          // Base64 编码的密文
+	IV   string `json:"iv"`            // Base64 编码的初始化向量
+	Tag  string `json:"tag"`           // Base64 编码的认证标签
+	KID  string `json:"kid,omitempty"` // 加密所用密钥的ID，为空表示旧版不带 kid 的密钥
 }
 
 // Encrypt 使用 AES-256-GCM 加密数据
 // key 必须是 16, 24, 或 32 字节
 func Encrypt(plaintext []byte, key []byte) (*EncryptedData, error) {
+	return EncryptWithAAD(plaintext, key, nil)
+}
+
+// EncryptWithAAD 使用 AES-GCM 加密数据，并将 aad 作为附加认证数据。
+// 解密时必须提供相同的 aad，否则认证失败。
+func EncryptWithAAD(plaintext []byte, key []byte, aad []byte) (*EncryptedData, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -37,7 +44,7 @@ func Encrypt(plaintext []byte, key []byte) (*EncryptedData, error) {
 		return nil, err
 	}
 
-	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
+	ciphertext := gcm.Seal(nil, nonce, plaintext, aad)
 
 	// GCM 的 Seal 方法返回的 ciphertext 已经包含了 tag，我们需要分离它们
 	tagSize := gcm.Overhead()
@@ -53,6 +60,11 @@ func Encrypt(plaintext []byte, key []byte) (*EncryptedData, error) {
 
 // Decrypt 使用 AES-256-GCM 解密数据
 func Decrypt(encryptedData *EncryptedData, key []byte) ([]byte, error) {
+	return DecryptWithAAD(encryptedData, key, nil)
+}
+
+// DecryptWithAAD 使用 AES-GCM 解密数据，aad 必须与加密时使用的附加认证数据一致
+func DecryptWithAAD(encryptedData *EncryptedData, key []byte, aad []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -84,7 +96,7 @@ func Decrypt(encryptedData *EncryptedData, key []byte) ([]byte, error) {
 	// 将密文和tag合并回gcm Open需要的格式
 	fullCiphertext := append(ciphertext, tag...)
 
-	plaintext, err := gcm.Open(nil, nonce, fullCiphertext, nil)
+	plaintext, err := gcm.Open(nil, nonce, fullCiphertext, aad)
 	if err != nil {
 		return nil, fmt.Errorf("解密失败: %w", err)
 	}
@@ -92,6 +104,18 @@ func Decrypt(encryptedData *EncryptedData, key []byte) ([]byte, error) {
 	return plaintext, nil
 }
 
+// RequestAAD 构造协议版本 3 中请求体加密信封的附加认证数据。
+// 它将密文绑定到请求方法、路径、时间戳和 nonce，防止密文被挪用到其他接口或请求。
+func RequestAAD(method, path, timestamp, nonce string) []byte {
+	return []byte("wificity-req\n" + method + "\n" + path + "\n" + timestamp + "\n" + nonce)
+}
+
+// ResponseAAD 构造协议版本 3 中响应加密信封的附加认证数据。
+// 它将响应绑定到所应答的请求，客户端使用自己发出请求时的参数即可校验。
+func ResponseAAD(method, path, timestamp, nonce string) []byte {
+	return []byte("wificity-res\n" + method + "\n" + path + "\n" + timestamp + "\n" + nonce)
+}
+
 // GenerateSignature 使用 HMAC-SHA256 生成签名
 func GenerateSignature(message string, key []byte) string {
 	mac := hmac.New(sha256.New, key)
@@ -0,0 +1,120 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Signer 是协议版本 4 的参考客户端实现，负责加密请求体、签名请求以及解密响应。
+// 服务端的 Authenticate 中间件与它使用相同的规范化规则，客户端可以直接使用或参照实现。
+type Signer struct {
+	AppID  string // 调用方标识 (X-App-Id)
+	KeyID  string // 主密钥ID (kid)，旧版不带 kid 的密钥为空
+	Secret []byte // 主密钥，签名和加密子密钥均由它派生
+
+	// AESKeyBits 为派生的 AES 密钥长度，必须与服务端的 aes_key_bits 配置一致，默认 256
+	AESKeyBits int
+
+	// Plaintext 为 true 时请求体不加密，只签名。仅用于服务端开启了调试明文模式的情况
+	Plaintext bool
+}
+
+// DebugPlaintextHeader 是调试明文模式使用的头：请求携带时表示请求体为明文，响应携带时表示响应未加密
+const DebugPlaintextHeader = "X-Debug-Plaintext"
+
+// SignedRequest 记录了一次已签名请求的参数，用于校验和解密对应的响应
+type SignedRequest struct {
+	Method    string
+	Path      string
+	Timestamp string
+	Nonce     string
+}
+
+// NewNonce 生成一个 32 位十六进制的随机 nonce
+func NewNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign 为请求设置认证相关的请求头。
+// plaintext 为请求体明文，非空时会被加密为信封并作为新的请求体，Content-Type 设为 application/json。
+func (s *Signer) Sign(req *http.Request, plaintext []byte) (*SignedRequest, error) {
+	nonce, err := NewNonce()
+	if err != nil {
+		return nil, err
+	}
+	signed := &SignedRequest{
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+		Nonce:     nonce,
+	}
+
+	var body []byte
+	if len(plaintext) > 0 && s.Plaintext {
+		body = plaintext
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(DebugPlaintextHeader, "1")
+	} else if len(plaintext) > 0 {
+		encKey, err := DeriveEncryptionKey(s.Secret, s.aesKeyBits())
+		if err != nil {
+			return nil, err
+		}
+		envelope, err := EncryptWithAAD(plaintext, encKey, RequestAAD(signed.Method, signed.Path, signed.Timestamp, signed.Nonce))
+		if err != nil {
+			return nil, err
+		}
+		envelope.KID = s.KeyID
+		if body, err = json.Marshal(envelope); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	canonical, err := CanonicalRequest(req.Method, req.URL.Path, req.URL.RawQuery,
+		req.Header.Get("Content-Type"), s.AppID, signed.Timestamp, signed.Nonce, body)
+	if err != nil {
+		return nil, err
+	}
+	signKey, err := DeriveSigningKey(s.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-App-Id", s.AppID)
+	req.Header.Set("X-Timestamp", signed.Timestamp)
+	req.Header.Set("X-Nonce", signed.Nonce)
+	req.Header.Set("X-Protocol-Version", strconv.Itoa(V4))
+	if s.KeyID != "" {
+		req.Header.Set("X-Key-Id", s.KeyID)
+	}
+	req.Header.Set("X-Signature", GenerateSignature(canonical, signKey))
+	return signed, nil
+}
+
+// Open 解密服务端返回的响应信封，并校验它确实是对 signed 请求的应答
+func (s *Signer) Open(signed *SignedRequest, envelope *EncryptedData) ([]byte, error) {
+	encKey, err := DeriveEncryptionKey(s.Secret, s.aesKeyBits())
+	if err != nil {
+		return nil, err
+	}
+	return DecryptWithAAD(envelope, encKey, ResponseAAD(signed.Method, signed.Path, signed.Timestamp, signed.Nonce))
+}
+
+func (s *Signer) aesKeyBits() int {
+	if s.AESKeyBits != 0 {
+		return s.AESKeyBits
+	}
+	return 256
+}
@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+)
+
+// 签名与加密协议版本，由请求头 X-Protocol-Version 指定，未指定时视为版本 1
+const (
+	// V1 直接使用原始密钥作为 HMAC 密钥和 AES 密钥
+	V1 = 1
+	// V2 使用 HKDF 从主密钥分别派生 HMAC 签名子密钥和 AES-GCM 加密子密钥
+	V2 = 2
+	// V3 在版本 2 的基础上，将请求方法、路径、时间戳和 nonce 绑定进 AES-GCM 的附加认证数据
+	V3 = 3
+	// V4 在版本 3 的基础上使用规范化请求 (见 CanonicalRequest) 作为签名原文，
+	// 所有请求方法（包括 PATCH）的请求体都参与签名和加密，重复的查询参数全部参与签名
+	V4 = 4
+
+	// Latest 是当前支持的最高协议版本
+	Latest = V4
+)
+
+// kdfSalt 是派生子密钥时使用的固定盐值
+var kdfSalt = []byte("wificity-api-kdf")
+
+// ParseVersion 解析请求头中的协议版本，为空时返回版本 1
+func ParseVersion(header string) (int, error) {
+	if header == "" {
+		return V1, nil
+	}
+	version, err := strconv.Atoi(header)
+	if err != nil || version < V1 || version > Latest {
+		return 0, fmt.Errorf("不支持的协议版本: %s", header)
+	}
+	return version, nil
+}
+
+// DeriveSigningKey 从主密钥派生 HMAC-SHA256 签名子密钥
+func DeriveSigningKey(master []byte) ([]byte, error) {
+	return hkdf.Key(sha256.New, master, kdfSalt, "wificity/v2/hmac-sha256", sha256.Size)
+}
+
+// DeriveEncryptionKey 从主密钥派生指定长度（128 或 256 位）的 AES-GCM 加密子密钥
+func DeriveEncryptionKey(master []byte, bits int) ([]byte, error) {
+	if bits != 128 && bits != 256 {
+		return nil, fmt.Errorf("不支持的 AES 密钥长度: %d", bits)
+	}
+	return hkdf.Key(sha256.New, master, kdfSalt, fmt.Sprintf("wificity/v2/aes-%d-gcm", bits), bits/8)
+}
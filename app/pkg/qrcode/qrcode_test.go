@@ -0,0 +1,496 @@
+package qrcode
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "重新生成 testdata 中的矩阵摘要")
+
+var levelNames = [...]string{"L", "M", "Q", "H"}
+
+// formatTable 是 ISO/IEC 18004 表 C.1 中掩码后的格式信息，按纠错等级和掩码排列
+var formatTable = [4][8]string{
+	{"111011111000100", "111001011110011", "111110110101010", "111100010011101", "110011000101111", "110001100011000", "110110001000001", "110100101110110"},
+	{"101010000010010", "101000100100101", "101111001111100", "101101101001011", "100010111111001", "100000011001110", "100111110010111", "100101010100000"},
+	{"011010101011111", "011000001101000", "011111100110001", "011101000000110", "010010010110100", "010000110000011", "010111011011010", "010101111101101"},
+	{"001011010001001", "001001110111110", "001110011100111", "001100111010000", "000011101100010", "000001001010101", "000110100001100", "000100000111011"},
+}
+
+// versionTable 是 ISO/IEC 18004 表 D.1 中的部分版本信息
+var versionTable = map[int]string{
+	7:  "000111110010010100",
+	8:  "001000010110111100",
+	9:  "001001101010011001",
+	10: "001010010011010011",
+	40: "101000110001101001",
+}
+
+func TestFormatBits(t *testing.T) {
+	for level := Low; level <= High; level++ {
+		for mask := 0; mask < 8; mask++ {
+			c := &Code{size: 21, modules: newGrid(21), function: newGrid(21)}
+			c.drawFormatBits(level, mask)
+			if got := readFormat(c); got != formatTable[level][mask] {
+				t.Errorf("%s 掩码 %d: 格式信息为 %s，应为 %s", levelNames[level], mask, got, formatTable[level][mask])
+			}
+		}
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	for version, want := range versionTable {
+		size := version*4 + 17
+		c := &Code{size: size, modules: newGrid(size), function: newGrid(size)}
+		c.drawVersion(version)
+		if got := readVersion(c); got != want {
+			t.Errorf("版本 %d: 版本信息为 %s，应为 %s", version, got, want)
+		}
+	}
+}
+
+func TestAlignmentPatternPositions(t *testing.T) {
+	tests := []struct {
+		version int
+		want    []int
+	}{
+		{1, nil},
+		{2, []int{6, 18}},
+		{6, []int{6, 34}},
+		{7, []int{6, 22, 38}},
+		{14, []int{6, 26, 46, 66}},
+		{22, []int{6, 26, 50, 74, 98}},
+		{32, []int{6, 34, 60, 86, 112, 138}},
+		{36, []int{6, 24, 50, 76, 102, 128, 154}},
+		{40, []int{6, 30, 58, 86, 114, 142, 170}},
+	}
+	for _, tt := range tests {
+		if got := alignmentPatternPositions(tt.version); !slices.Equal(got, tt.want) {
+			t.Errorf("版本 %d: 校正图形位置为 %v，应为 %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestCodewordCounts(t *testing.T) {
+	// 码字总数，ISO/IEC 18004 表 9
+	total := map[int]int{1: 26, 2: 44, 3: 70, 4: 100, 5: 134, 6: 172, 7: 196, 10: 346, 20: 1085, 40: 3706}
+	for version, want := range total {
+		if got := numRawDataModules(version) / 8; got != want {
+			t.Errorf("版本 %d: 码字总数为 %d，应为 %d", version, got, want)
+		}
+	}
+}
+
+func TestByteCapacity(t *testing.T) {
+	// 字节模式的最大字符数，ISO/IEC 18004 表 7
+	tests := []struct {
+		version int
+		want    [4]int
+	}{
+		{1, [4]int{17, 14, 11, 7}},
+		{2, [4]int{32, 26, 20, 14}},
+		{3, [4]int{53, 42, 32, 24}},
+		{4, [4]int{78, 62, 46, 34}},
+		{5, [4]int{106, 84, 60, 44}},
+		{10, [4]int{271, 213, 151, 119}},
+		{40, [4]int{2953, 2331, 1663, 1273}},
+	}
+	for _, tt := range tests {
+		for level := Low; level <= High; level++ {
+			n := tt.want[level]
+			c, err := Encode(make([]byte, n), level)
+			if err != nil {
+				t.Fatalf("版本 %d-%s: 编码 %d 字节失败: %v", tt.version, levelNames[level], n, err)
+			}
+			if got := (c.Size() - 17) / 4; got != tt.version {
+				t.Errorf("版本 %d-%s: %d 字节编码为版本 %d", tt.version, levelNames[level], n, got)
+			}
+			c, err = Encode(make([]byte, n+1), level)
+			if tt.version == 40 {
+				if err != ErrTooLong {
+					t.Errorf("版本 40-%s: %d 字节应返回 ErrTooLong，得到 %v", levelNames[level], n+1, err)
+				}
+			} else if err != nil || (c.Size()-17)/4 != tt.version+1 {
+				t.Errorf("版本 %d-%s: %d 字节应编码为下一个版本", tt.version, levelNames[level], n+1)
+			}
+		}
+	}
+}
+
+func TestReedSolomon(t *testing.T) {
+	tests := []struct {
+		name      string
+		data, ecc []byte
+	}{
+		{
+			// 1-M "HELLO WORLD"（字母数字模式）
+			name: "1-M",
+			data: []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17},
+			ecc:  []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23},
+		},
+		{
+			// 5-Q 第一组第一块
+			name: "5-Q",
+			data: []byte{67, 85, 70, 134, 87, 38, 85, 194, 119, 50, 6, 18, 6, 103, 38},
+			ecc:  []byte{213, 199, 11, 45, 115, 247, 241, 223, 229, 248, 154, 117, 154, 111, 86, 161, 111, 39},
+		},
+	}
+	for _, tt := range tests {
+		if got := reedSolomonRemainder(tt.data, reedSolomonDivisor(len(tt.ecc))); !slices.Equal(got, tt.ecc) {
+			t.Errorf("%s: 纠错码字为 %v，应为 %v", tt.name, got, tt.ecc)
+		}
+	}
+}
+
+// TestEncodeAllVersions 对每个版本和纠错等级编码容量上限的内容，用独立的解码过程校验矩阵，
+// 并与 testdata/matrices.golden 中的摘要比较，使用 -update 重新生成摘要
+func TestEncodeAllVersions(t *testing.T) {
+	golden := readGolden(t)
+	var lines []string
+	for version := 1; version <= 40; version++ {
+		for level := Low; level <= High; level++ {
+			name := fmt.Sprintf("%d-%s", version, levelNames[level])
+			n := numDataCodewords(version, level) - 2
+			if version > 9 {
+				n--
+			}
+			content := make([]byte, n)
+			for i := range content {
+				content[i] = byte(i*31 + version*7 + int(level))
+			}
+
+			c, err := Encode(content, level)
+			if err != nil {
+				t.Fatalf("%s: 编码失败: %v", name, err)
+			}
+			if got := (c.Size() - 17) / 4; got != version {
+				t.Fatalf("%s: 编码为版本 %d", name, got)
+			}
+			if err := verify(c, version, level, content); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+
+			sum := matrixDigest(c)
+			lines = append(lines, name+" "+sum)
+			if !*update && golden[name] != sum {
+				t.Errorf("%s: 矩阵摘要为 %s，与 golden 文件中的 %s 不一致", name, sum, golden[name])
+			}
+		}
+	}
+	if *update {
+		if err := os.WriteFile("testdata/matrices.golden", []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readGolden(t *testing.T) map[string]string {
+	golden := make(map[string]string)
+	if *update {
+		return golden
+	}
+	f, err := os.Open("testdata/matrices.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, sum, _ := strings.Cut(scanner.Text(), " ")
+		golden[name] = sum
+	}
+	return golden
+}
+
+// matrixDigest 返回矩阵逐行的 SHA-256 摘要，深色为 1
+func matrixDigest(c *Code) string {
+	h := sha256.New()
+	for y := 0; y < c.Size(); y++ {
+		row := make([]byte, c.Size())
+		for x := range row {
+			row[x] = '0'
+			if c.Dark(x, y) {
+				row[x] = '1'
+			}
+		}
+		h.Write(row)
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func readFormat(c *Code) string {
+	var b strings.Builder
+	for i := 14; i >= 0; i-- {
+		var x, y int
+		switch {
+		case i <= 5:
+			x, y = 8, i
+		case i == 6:
+			x, y = 8, 7
+		case i == 7:
+			x, y = 8, 8
+		case i == 8:
+			x, y = 7, 8
+		default:
+			x, y = 14-i, 8
+		}
+		b.WriteByte(moduleChar(c, x, y))
+	}
+	return b.String()
+}
+
+// readFormatCopy 读取右上角和左下角的第二份格式信息
+func readFormatCopy(c *Code) string {
+	var b strings.Builder
+	for i := 14; i >= 0; i-- {
+		if i < 8 {
+			b.WriteByte(moduleChar(c, c.size-1-i, 8))
+		} else {
+			b.WriteByte(moduleChar(c, 8, c.size-15+i))
+		}
+	}
+	return b.String()
+}
+
+func readVersion(c *Code) string {
+	var b strings.Builder
+	for i := 17; i >= 0; i-- {
+		b.WriteByte(moduleChar(c, c.size-11+i%3, i/3))
+	}
+	return b.String()
+}
+
+func moduleChar(c *Code, x, y int) byte {
+	if c.modules[y][x] {
+		return '1'
+	}
+	return '0'
+}
+
+// isFunctionModule 按标准独立计算 (x, y) 是否为功能模块，不使用编码器记录的功能模块
+func isFunctionModule(version, x, y int) bool {
+	size := version*4 + 17
+	switch {
+	case x < 9 && y < 9, x >= size-8 && y < 9, x < 9 && y >= size-8:
+		return true // 定位图形、分隔符和格式信息
+	case x == 6 || y == 6:
+		return true // 定时图形
+	case version >= 7 && ((x >= size-11 && x < size-8 && y < 6) || (y >= size-11 && y < size-8 && x < 6)):
+		return true // 版本信息
+	}
+	positions := alignmentPatternPositions(version)
+	last := len(positions) - 1
+	for i, px := range positions {
+		for j, py := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			if abs(x-px) <= 2 && abs(y-py) <= 2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verify 像解码器一样读取矩阵：校验定位图形和格式信息，去掉掩码，按块校验 Reed-Solomon 伴随式，并解出字节模式的内容
+func verify(c *Code, version int, level Level, content []byte) error {
+	size := c.Size()
+	for _, corner := range [][2]int{{0, 0}, {size - 7, 0}, {0, size - 7}} {
+		for dy := 0; dy < 7; dy++ {
+			for dx := 0; dx < 7; dx++ {
+				ring := max(abs(dx-3), abs(dy-3))
+				if c.Dark(corner[0]+dx, corner[1]+dy) != (ring != 2) {
+					return fmt.Errorf("定位图形 %v 不正确", corner)
+				}
+			}
+		}
+	}
+	for i := 8; i < size-8; i++ {
+		if c.Dark(i, 6) != (i%2 == 0) || c.Dark(6, i) != (i%2 == 0) {
+			return fmt.Errorf("定时图形在 %d 处不正确", i)
+		}
+	}
+	if !c.Dark(8, size-8) {
+		return fmt.Errorf("缺少固定的深色模块")
+	}
+
+	format := readFormat(c)
+	if format != readFormatCopy(c) {
+		return fmt.Errorf("两份格式信息不一致: %s %s", format, readFormatCopy(c))
+	}
+	mask := slices.Index(formatTable[level][:], format)
+	if mask < 0 {
+		return fmt.Errorf("格式信息 %s 不是纠错等级 %s 的有效值", format, levelNames[level])
+	}
+	if want, ok := versionTable[version]; ok && readVersion(c) != want {
+		return fmt.Errorf("版本信息为 %s，应为 %s", readVersion(c), want)
+	}
+
+	// 按之字形顺序读取数据模块并去掉掩码
+	var bits []bool
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < size; vert++ {
+			y := vert
+			if upward {
+				y = size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if !isFunctionModule(version, x, y) {
+					bits = append(bits, c.Dark(x, y) != maskBit(mask, x, y))
+				}
+			}
+		}
+	}
+	raw := make([]byte, len(bits)/8)
+	for i := range raw {
+		for j := 0; j < 8; j++ {
+			if bits[i*8+j] {
+				raw[i] |= 1 << (7 - j)
+			}
+		}
+	}
+	if len(raw) != numRawDataModules(version)/8 {
+		return fmt.Errorf("数据码字数为 %d，应为 %d", len(raw), numRawDataModules(version)/8)
+	}
+
+	// 反交错，短块在前，长块多一个数据码字
+	numBlocks := numErrorCorrectionBlocks[level][version]
+	eccLen := eccCodewordsPerBlock[level][version]
+	shortLen := len(raw) / numBlocks
+	numShort := numBlocks - len(raw)%numBlocks
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	// 数据码字
+	for i := 0; i < shortLen-eccLen+1; i++ {
+		for j := range blocks {
+			if i == shortLen-eccLen && j < numShort {
+				continue
+			}
+			blocks[j] = append(blocks[j], raw[k])
+			k++
+		}
+	}
+	// 纠错码字
+	for i := 0; i < eccLen; i++ {
+		for j := range blocks {
+			blocks[j] = append(blocks[j], raw[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for j, block := range blocks {
+		for i := 0; i < eccLen; i++ {
+			if s := evalPoly(block, gfPow(i)); s != 0 {
+				return fmt.Errorf("第 %d 块的伴随式 S%d 不为零", j, i)
+			}
+		}
+		data = append(data, block[:len(block)-eccLen]...)
+	}
+
+	// 解析字节模式
+	r := bitReader{data: data}
+	if mode := r.read(4); mode != 0x4 {
+		return fmt.Errorf("模式指示符为 %04b", mode)
+	}
+	countBits := 8
+	if version > 9 {
+		countBits = 16
+	}
+	n := r.read(countBits)
+	got := make([]byte, n)
+	for i := range got {
+		got[i] = byte(r.read(8))
+	}
+	if !slices.Equal(got, content) {
+		return fmt.Errorf("解码的内容与原文不一致")
+	}
+	return nil
+}
+
+func maskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (y+x)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (y+x)%3 == 0
+	case 4:
+		return (y/2+x/3)%2 == 0
+	case 5:
+		return (y*x)%2+(y*x)%3 == 0
+	case 6:
+		return ((y*x)%2+(y*x)%3)%2 == 0
+	default:
+		return ((y+x)%2+(y*x)%3)%2 == 0
+	}
+}
+
+// gfPow 返回 GF(2^8) 中 α 的 n 次幂，α = 2
+func gfPow(n int) byte {
+	x := 1
+	for i := 0; i < n; i++ {
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	return byte(x)
+}
+
+// evalPoly 用霍纳法则计算多项式在 x 处的值，第一个码字为最高次项系数
+func evalPoly(poly []byte, x byte) byte {
+	var y byte
+	for _, coef := range poly {
+		y = gfMul(y, x) ^ coef
+	}
+	return y
+}
+
+// gfMul 是独立于编码器实现的 GF(2^8) 乘法
+func gfMul(a, b byte) byte {
+	var p byte
+	for b != 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		carry := a&0x80 != 0
+		a <<= 1
+		if carry {
+			a ^= 0x1D
+		}
+		b >>= 1
+	}
+	return p
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) read(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		v = v<<1 | int(r.data[r.pos>>3]>>(7-r.pos&7)&1)
+		r.pos++
+	}
+	return v
+}
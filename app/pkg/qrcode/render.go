@@ -0,0 +1,144 @@
+package qrcode
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+const (
+	// DefaultMargin 是标准规定的静区宽度（模块数）
+	DefaultMargin = 4
+	// MaxMargin 是允许的最大静区宽度（模块数），避免过大的静区使图片尺寸失控
+	MaxMargin = 16
+)
+
+// Options 定义了渲染二维码图片的参数
+type Options struct {
+	Size   int         // 图片边长（像素），包含静区；不足以每个模块 1 像素时按最小尺寸渲染
+	Margin int         // 静区宽度（模块数），0 表示使用 DefaultMargin，超过 MaxMargin 时按 MaxMargin 渲染
+	Logo   image.Image // 居中叠加的 logo，为 nil 表示不叠加；logo 最多占二维码边长的 1/5
+}
+
+// layout 计算渲染布局：每个模块的像素数、二维码左上角的偏移量和图片边长
+func (c *Code) layout(opts Options) (scale, offset, imageSize int) {
+	margin := opts.Margin
+	if margin <= 0 {
+		margin = DefaultMargin
+	}
+	margin = min(margin, MaxMargin)
+	total := c.size + margin*2
+	scale = max(opts.Size/total, 1)
+	imageSize = max(opts.Size, total*scale)
+	// 无法整除时多出的像素平均分配到四周的静区
+	offset = (imageSize-total*scale)/2 + margin*scale
+	return scale, offset, imageSize
+}
+
+// logoRect 返回 logo 在图片中的位置，logo 按比例缩放到不超过二维码边长的 1/5
+func logoRect(logo image.Image, qrOffset, qrPixels int) image.Rectangle {
+	box := qrPixels / 5
+	b := logo.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 || box <= 0 {
+		return image.Rectangle{}
+	}
+	w, h := box, box
+	if b.Dx() > b.Dy() {
+		h = box * b.Dy() / b.Dx()
+	} else {
+		w = box * b.Dx() / b.Dy()
+	}
+	center := qrOffset + qrPixels/2
+	return image.Rect(center-w/2, center-h/2, center-w/2+w, center-h/2+h)
+}
+
+// Image 将二维码渲染为图片
+func (c *Code) Image(opts Options) image.Image {
+	scale, offset, imageSize := c.layout(opts)
+	img := image.NewRGBA(image.Rect(0, 0, imageSize, imageSize))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.modules[y][x] {
+				rect := image.Rect(offset+x*scale, offset+y*scale, offset+(x+1)*scale, offset+(y+1)*scale)
+				draw.Draw(img, rect, image.Black, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	if opts.Logo != nil {
+		dst := logoRect(opts.Logo, offset, c.size*scale)
+		if !dst.Empty() {
+			// logo 周围留出一个模块宽的白边，避免与相邻模块混在一起
+			draw.Draw(img, dst.Inset(-scale), image.White, image.Point{}, draw.Src)
+			drawScaled(img, dst, opts.Logo)
+		}
+	}
+	return img
+}
+
+// drawScaled 使用最近邻插值将 src 缩放后绘制到 dst 区域
+func drawScaled(img *image.RGBA, dst image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	for y := dst.Min.Y; y < dst.Max.Y; y++ {
+		sy := sb.Min.Y + (y-dst.Min.Y)*sb.Dy()/dst.Dy()
+		for x := dst.Min.X; x < dst.Max.X; x++ {
+			sx := sb.Min.X + (x-dst.Min.X)*sb.Dx()/dst.Dx()
+			// 按 alpha 与白色背景混合
+			r, g, b, a := src.At(sx, sy).RGBA()
+			blend := func(v uint32) uint8 {
+				return uint8((v + (0xFFFF - a)) >> 8)
+			}
+			img.SetRGBA(x, y, color.RGBA{R: blend(r), G: blend(g), B: blend(b), A: 0xFF})
+		}
+	}
+}
+
+// PNG 将二维码渲染为 PNG 图片
+func (c *Code) PNG(w io.Writer, opts Options) error {
+	return png.Encode(w, c.Image(opts))
+}
+
+// SVG 将二维码渲染为 SVG 图片，logo 以 PNG 格式内嵌
+func (c *Code) SVG(w io.Writer, opts Options) error {
+	scale, offset, imageSize := c.layout(opts)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		imageSize, imageSize, imageSize, imageSize)
+	fmt.Fprintf(bw, `<rect width="%d" height="%d" fill="#FFFFFF"/>`, imageSize, imageSize)
+
+	bw.WriteString(`<path fill="#000000" d="`)
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.modules[y][x] {
+				fmt.Fprintf(bw, "M%d %dh%dv%dh-%dz", offset+x*scale, offset+y*scale, scale, scale, scale)
+			}
+		}
+	}
+	bw.WriteString(`"/>`)
+
+	if opts.Logo != nil {
+		dst := logoRect(opts.Logo, offset, c.size*scale)
+		if !dst.Empty() {
+			var logo bytes.Buffer
+			if err := png.Encode(&logo, opts.Logo); err != nil {
+				return err
+			}
+			pad := dst.Inset(-scale)
+			fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="#FFFFFF"/>`, pad.Min.X, pad.Min.Y, pad.Dx(), pad.Dy())
+			fmt.Fprintf(bw, `<image x="%d" y="%d" width="%d" height="%d" preserveAspectRatio="xMidYMid meet" href="data:image/png;base64,%s"/>`,
+				dst.Min.X, dst.Min.Y, dst.Dx(), dst.Dy(), base64.StdEncoding.EncodeToString(logo.Bytes()))
+		}
+	}
+
+	bw.WriteString(`</svg>`)
+	return bw.Flush()
+}
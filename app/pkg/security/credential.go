@@ -0,0 +1,178 @@
+package security
+
+import (
+	"app/config"
+	"app/pkg/protocol"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// CredentialKey 是存储在 gin.Context 中的调用方凭证的键
+	CredentialKey = "apiCredential"
+)
+
+var (
+	// ErrCredentialNotFound 表示请求头中的 AppID 没有对应的调用方
+	ErrCredentialNotFound = errors.New("调用方不存在")
+	// ErrCredentialDisabled 表示调用方已被停用
+	ErrCredentialDisabled = errors.New("调用方已被停用")
+)
+
+// Credential 描述了一个 API 调用方及其密钥
+type Credential struct {
+	AppID   string   // 调用方标识，对应请求头 X-App-Id；为空表示使用全局密钥的旧版调用方
+	AppName string   // 调用方名称
+	Role    string   // 调用方角色，见 RolePlatformAdmin 等常量
+	StoreID uint     // 所属门店ID，门店运营角色只能操作该门店的数据
+	SignKey []byte   // HMAC 签名密钥
+	Keys    *Keyring // AES 加密密钥环
+}
+
+// CredentialProvider 定义了根据 AppID 查找调用方凭证的接口
+type CredentialProvider interface {
+	// GetCredential 返回 AppID 对应的凭证。
+	// 调用方不存在时返回 ErrCredentialNotFound，被停用时返回 ErrCredentialDisabled。
+	GetCredential(appID string) (*Credential, error)
+}
+
+// credentialProvider 是 Authenticate 中间件使用的凭证来源
+var credentialProvider CredentialProvider
+
+// SetCredentialProvider 设置 Authenticate 中间件使用的凭证来源，应在启动服务前调用
+func SetCredentialProvider(provider CredentialProvider) {
+	credentialProvider = provider
+}
+
+// legacyCredential 返回基于全局 APISecret 的旧版凭证
+func legacyCredential() (*Credential, error) {
+	secret := []byte(config.Cfg.Security.APISecret)
+	keys, err := NewKeyring([]Key{{Secret: secret, Status: KeyStatusCurrent}})
+	if err != nil {
+		return nil, err
+	}
+	role := config.Cfg.Security.LegacySecretRole
+	if role == "" {
+		role = RoleMiniProgram
+	}
+	if err := ValidateRole(role, 0); err != nil {
+		return nil, err
+	}
+	return &Credential{Role: role, SignKey: secret, Keys: keys}, nil
+}
+
+// resolveCredential 根据请求头中的 AppID 解析调用方凭证。
+// 未携带 AppID 时，仅在配置允许的情况下回退到全局密钥。
+func resolveCredential(appID string) (*Credential, error) {
+	if appID == "" {
+		if !config.Cfg.Security.AllowLegacySecret {
+			return nil, ErrCredentialNotFound
+		}
+		return legacyCredential()
+	}
+	if credentialProvider == nil {
+		return nil, ErrCredentialNotFound
+	}
+	return credentialProvider.GetCredential(appID)
+}
+
+// signingKey 返回指定协议版本下用于校验签名的密钥。
+// 版本 1 使用调用方的签名密钥；版本 2 及以上从 kid 指定（为空时为当前密钥）的主密钥派生签名子密钥。
+func (cred *Credential) signingKey(version int, kid string) ([]byte, error) {
+	if version < protocol.V2 {
+		return cred.SignKey, nil
+	}
+	key := cred.Keys.Current()
+	if kid != "" {
+		var err error
+		if key, err = cred.Keys.Lookup(kid); err != nil {
+			return nil, err
+		}
+	}
+	return protocol.DeriveSigningKey(key.Secret)
+}
+
+// CurrentCredential 返回当前请求的调用方凭证，未通过认证时返回 nil
+func CurrentCredential(c *gin.Context) *Credential {
+	if v, ok := c.Get(CredentialKey); ok {
+		if cred, ok := v.(*Credential); ok {
+			return cred
+		}
+	}
+	return nil
+}
+
+// InvalidateCredential 在调用方的密钥或状态变更后清除其凭证缓存
+func InvalidateCredential(appID string) {
+	if p, ok := credentialProvider.(interface{ Invalidate(string) }); ok {
+		p.Invalidate(appID)
+	}
+}
+
+// sealResponse 使用当前调用方的密钥环加密响应数据。
+// 请求未通过认证时（例如在认证之前出错），回退到全局密钥。
+func sealResponse(c *gin.Context, plaintext []byte) (*EncryptedData, error) {
+	if cred := CurrentCredential(c); cred != nil {
+		var aad []byte
+		if v, ok := c.Get(responseAADKey); ok {
+			aad, _ = v.([]byte)
+		}
+		return cred.Keys.Seal(plaintext, c.GetInt(ProtocolVersionKey), aad)
+	}
+	return protocol.Encrypt(plaintext, []byte(config.Cfg.Security.APISecret))
+}
+
+// CachedCredentialProvider 为另一个 CredentialProvider 提供带过期时间的内存缓存，
+// 避免每个请求都查询数据库。停用或更换密钥后，最多经过 ttl 时长生效，或调用 Invalidate 立即生效。
+type CachedCredentialProvider struct {
+	next  CredentialProvider
+	ttl   time.Duration
+	mu    sync.RWMutex
+	items map[string]cachedCredential
+}
+
+type cachedCredential struct {
+	cred    *Credential
+	err     error
+	expires time.Time
+}
+
+// NewCachedCredentialProvider 创建一个带缓存的凭证来源
+func NewCachedCredentialProvider(next CredentialProvider, ttl time.Duration) *CachedCredentialProvider {
+	return &CachedCredentialProvider{
+		next:  next,
+		ttl:   ttl,
+		items: make(map[string]cachedCredential),
+	}
+}
+
+// GetCredential 实现 CredentialProvider 接口
+func (p *CachedCredentialProvider) GetCredential(appID string) (*Credential, error) {
+	now := time.Now()
+
+	p.mu.RLock()
+	item, ok := p.items[appID]
+	p.mu.RUnlock()
+	if ok && now.Before(item.expires) {
+		return item.cred, item.err
+	}
+
+	cred, err := p.next.GetCredential(appID)
+	// 只缓存确定的结果，数据库等临时错误不缓存
+	if err == nil || errors.Is(err, ErrCredentialNotFound) || errors.Is(err, ErrCredentialDisabled) {
+		p.mu.Lock()
+		p.items[appID] = cachedCredential{cred: cred, err: err, expires: now.Add(p.ttl)}
+		p.mu.Unlock()
+	}
+	return cred, err
+}
+
+// Invalidate 使指定 AppID 的缓存立即失效
+func (p *CachedCredentialProvider) Invalidate(appID string) {
+	p.mu.Lock()
+	delete(p.items, appID)
+	p.mu.Unlock()
+}
@@ -0,0 +1,42 @@
+package security
+
+import (
+	"app/pkg/protocol"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/gin-gonic/gin"
+)
+
+// plaintextDebug 表示是否处于调试明文模式
+var plaintextDebug bool
+
+// EnablePlaintextDebug 开启调试明文模式。
+// 该模式下仍然校验签名和 nonce，但响应不再加密，客户端也可以通过请求头 X-Debug-Plaintext 发送明文请求体。
+// 只有 gin 处于 debug 模式且服务只监听本机地址 (host) 时才允许开启，否则返回错误。
+func EnablePlaintextDebug(host string) error {
+	if gin.Mode() != gin.DebugMode {
+		return errors.New("调试明文模式只能在 gin 的 debug 模式下开启")
+	}
+	if !isLoopbackHost(host) {
+		return fmt.Errorf("调试明文模式要求服务只监听本机地址，当前监听地址为 %q", host)
+	}
+	plaintextDebug = true
+	return nil
+}
+
+// isLoopbackHost 判断监听地址是否为本机回环地址
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// sendPlaintext 在调试明文模式下直接发送 JSON 响应，并通过响应头告知客户端无需解密
+func sendPlaintext(c *gin.Context, status int, data any) {
+	c.Header(protocol.DebugPlaintextHeader, "1")
+	c.JSON(status, data)
+}
@@ -0,0 +1,114 @@
+package security
+
+import (
+	"app/pkg/protocol"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 密钥状态
+const (
+	KeyStatusCurrent = "CURRENT" // 当前密钥：用于加密响应，也可用于解密请求
+	KeyStatusActive  = "ACTIVE"  // 可用密钥：仅用于解密请求（新增待启用的密钥，或宽限期内的旧密钥）
+	KeyStatusRetired = "RETIRED" // 已退役：不再接受
+)
+
+// ErrUnknownKeyID 表示加密信封中的 kid 不存在或已不可用
+var ErrUnknownKeyID = errors.New("未知或已退役的密钥ID")
+
+// Key 是密钥环中的一个加密密钥
+type Key struct {
+	ID         string     // 密钥ID (kid)，为空表示旧版不带 kid 的密钥
+	Secret     []byte     // AES 密钥，必须是 16, 24 或 32 字节
+	Status     string     // 密钥状态
+	GraceUntil *time.Time // ACTIVE 状态的旧密钥可用于解密的截止时间，为空表示不限
+}
+
+// usable 判断密钥在指定时间点是否可用于解密
+func (k *Key) usable(now time.Time) bool {
+	switch k.Status {
+	case KeyStatusCurrent:
+		return true
+	case KeyStatusActive:
+		return k.GraceUntil == nil || now.Before(*k.GraceUntil)
+	default:
+		return false
+	}
+}
+
+// Keyring 保存一个调用方的全部加密密钥。
+// 响应始终使用当前密钥加密；请求则按信封中的 kid 选择密钥解密，以便在轮换期间兼容旧密钥。
+type Keyring struct {
+	current *Key
+	keys    map[string]*Key
+}
+
+// NewKeyring 根据密钥列表创建密钥环，列表中必须有且只有一个当前密钥
+func NewKeyring(keys []Key) (*Keyring, error) {
+	ring := &Keyring{keys: make(map[string]*Key, len(keys))}
+	for i := range keys {
+		key := keys[i]
+		switch len(key.Secret) {
+		case 16, 24, 32:
+		default:
+			return nil, fmt.Errorf("密钥 %q 的长度无效", key.ID)
+		}
+		if _, exists := ring.keys[key.ID]; exists {
+			return nil, fmt.Errorf("重复的密钥ID %q", key.ID)
+		}
+		if key.Status == KeyStatusCurrent {
+			if ring.current != nil {
+				return nil, fmt.Errorf("存在多个当前密钥: %q 和 %q", ring.current.ID, key.ID)
+			}
+			ring.current = &key
+		}
+		ring.keys[key.ID] = &key
+	}
+	if ring.current == nil {
+		return nil, errors.New("密钥环中没有当前密钥")
+	}
+	return ring, nil
+}
+
+// Current 返回当前用于加密的密钥
+func (r *Keyring) Current() *Key {
+	return r.current
+}
+
+// Lookup 返回可用于解密的指定 kid 的密钥
+func (r *Keyring) Lookup(kid string) (*Key, error) {
+	key, ok := r.keys[kid]
+	if !ok || !key.usable(time.Now()) {
+		return nil, ErrUnknownKeyID
+	}
+	return key, nil
+}
+
+// Seal 按指定协议版本使用当前密钥加密数据，并在信封中记录 kid。
+// aad 为附加认证数据，协议版本 3 以下传 nil。
+func (r *Keyring) Seal(plaintext []byte, version int, aad []byte) (*EncryptedData, error) {
+	aesKey, err := encryptionKey(r.current, version)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := protocol.EncryptWithAAD(plaintext, aesKey, aad)
+	if err != nil {
+		return nil, err
+	}
+	encrypted.KID = r.current.ID
+	return encrypted, nil
+}
+
+// Open 按信封中的 kid 选择密钥，并按指定协议版本解密
+func (r *Keyring) Open(encryptedData *EncryptedData, version int, aad []byte) ([]byte, error) {
+	key, err := r.Lookup(encryptedData.KID)
+	if err != nil {
+		return nil, err
+	}
+	aesKey, err := encryptionKey(key, version)
+	if err != nil {
+		return nil, err
+	}
+	return protocol.DecryptWithAAD(encryptedData, aesKey, aad)
+}
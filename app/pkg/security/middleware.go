@@ -2,14 +2,14 @@ package security
 
 import (
 	"app/config"
+	"app/pkg/protocol"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
-	"sort"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -34,53 +34,78 @@ func Authenticate() gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "无效的时间戳格式"})
 			return
 		}
-		if time.Now().Unix()-timestamp > int64(config.Cfg.Security.TimestampWindow.Seconds()) {
+		now := time.Now().Unix()
+		if now-timestamp > int64(config.Cfg.Security.TimestampWindow.Seconds()) {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "时间戳已过期，请检查设备时间"})
 			return
 		}
+		if timestamp-now > int64(config.Cfg.Security.MaxClockSkew.Seconds()) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "时间戳超前于服务器时间，请检查设备时间"})
+			return
+		}
 
-		// 2. 构建待签名字符串
-		// 对查询参数按key进行字典排序
-		queryKeys := make([]string, 0, len(c.Request.URL.Query()))
-		for k := range c.Request.URL.Query() {
-			queryKeys = append(queryKeys, k)
+		// 解析协议版本，旧客户端不携带该请求头，按版本 1 处理
+		version, err := protocol.ParseVersion(c.GetHeader("X-Protocol-Version"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if version < config.Cfg.Security.MinProtocolVersion {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "协议版本过低，请升级客户端"})
+			return
 		}
-		sort.Strings(queryKeys)
-		var sortedQuery strings.Builder
-		for i, k := range queryKeys {
-			if i > 0 {
-				sortedQuery.WriteString("&")
+
+		// 根据 X-App-Id 解析调用方凭证
+		appID := c.GetHeader("X-App-Id")
+		cred, err := resolveCredential(appID)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrCredentialNotFound):
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "缺少或无效的调用方标识 (X-App-Id)"})
+			case errors.Is(err, ErrCredentialDisabled):
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "调用方已被停用"})
+			default:
+				log.Printf("ERROR: 无法加载调用方凭证 %q: %v", appID, err)
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "暂时无法校验调用方，请稍后重试"})
 			}
-			sortedQuery.WriteString(k)
-			sortedQuery.WriteString("=")
-			sortedQuery.WriteString(c.Request.URL.Query().Get(k))
+			return
+		}
+
+		// 获取 nonce，每个请求都必须携带一个唯一的随机串，用于防止重放
+		nonce := c.GetHeader("X-Nonce")
+		if nonce == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "缺少随机串头 (X-Nonce)"})
+			return
+		}
+		if !isValidNonce(nonce) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "无效的随机串格式"})
+			return
 		}
 
-		var bodyStr string
-		// 如果是 POST, PUT, DELETE 请求，则读取请求体
-		if c.Request.Method == "POST" || c.Request.Method == "PUT" || c.Request.Method == "DELETE" {
-			bodyBytes, err := io.ReadAll(c.Request.Body)
+		// 2. 读取请求体并构建待签名字符串
+		// 版本 4 读取所有方法的请求体；旧版本只读取 POST, PUT, DELETE 请求的请求体（与旧客户端的签名方式保持一致，
+		// PATCH 请求体不受签名保护，因此默认配置的最低协议版本为 4）
+		var bodyBytes []byte
+		if version >= protocol.V4 || c.Request.Method == "POST" || c.Request.Method == "PUT" || c.Request.Method == "DELETE" {
+			bodyBytes, err = io.ReadAll(c.Request.Body)
 			if err != nil {
 				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "无法读取请求体"})
 				return
 			}
 			// 必须将读取的body再写回去，因为 c.Request.Body 是一个只能读取一次的流
 			c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-			bodyStr = string(bodyBytes)
 		}
 
-		// 构造签名原文
-		var stringToSign strings.Builder
-		stringToSign.WriteString(timestampStr)
-		stringToSign.WriteString(c.Request.Method)
-		stringToSign.WriteString(c.Request.URL.Path)
-		if sortedQuery.Len() > 0 {
-			stringToSign.WriteString("?")
-			stringToSign.WriteString(sortedQuery.String())
-		}
-		if bodyStr != "" {
-			stringToSign.WriteString(" ")
-			stringToSign.WriteString(bodyStr)
+		var stringToSign string
+		if version >= protocol.V4 {
+			stringToSign, err = protocol.CanonicalRequest(c.Request.Method, c.Request.URL.Path, c.Request.URL.RawQuery,
+				c.GetHeader("Content-Type"), appID, timestampStr, nonce, bodyBytes)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "无效的查询参数"})
+				return
+			}
+		} else {
+			stringToSign = protocol.LegacyStringToSign(c.Request.Method, c.Request.URL.Path, c.Request.URL.Query(), timestampStr, nonce, bodyBytes)
 		}
 
 		// 3. 验证签名
@@ -89,21 +114,48 @@ func Authenticate() gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "缺少签名头 (X-Signature)"})
 			return
 		}
-		secretKey := []byte(config.Cfg.Security.APISecret)
-		if !ValidateSignature(stringToSign.String(), signature, secretKey) {
+		// 版本 2 及以上可通过 X-Key-Id 指定派生签名密钥所用的主密钥，默认为当前密钥
+		signKey, err := cred.signingKey(version, c.GetHeader("X-Key-Id"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "无效的密钥ID (X-Key-Id)"})
+			return
+		}
+		if !protocol.ValidateSignature(stringToSign, signature, signKey) {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "签名验证失败"})
 			return
 		}
 
+		// 签名通过后再登记 nonce，避免未签名的请求占用合法客户端的 nonce。
+		// nonce 需要在时间戳可被接受的整个区间内保持有效。
+		nonceTTL := config.Cfg.Security.TimestampWindow + config.Cfg.Security.MaxClockSkew
+		// nonce 按调用方隔离
+		fresh, err := nonceStore.CheckAndSet(appID+":"+nonce, nonceTTL)
+		if err != nil {
+			log.Printf("ERROR: 无法登记请求 nonce: %v", err)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "暂时无法校验请求，请稍后重试"})
+			return
+		}
+		if !fresh {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "重复的请求，随机串已被使用"})
+			return
+		}
+
 		// 4. 如果有请求体，则解密
-		if bodyStr != "" {
+		// 调试明文模式下，客户端可以声明请求体为明文，此时请求体同样经过签名校验
+		if len(bodyBytes) > 0 && plaintextDebug && c.GetHeader(protocol.DebugPlaintextHeader) == "1" {
+			c.Set(DecryptedBodyKey, bodyBytes)
+		} else if len(bodyBytes) > 0 {
 			var encryptedRequest EncryptedData
-			if err := json.Unmarshal([]byte(bodyStr), &encryptedRequest); err != nil {
+			if err := json.Unmarshal(bodyBytes, &encryptedRequest); err != nil {
 				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "无效的加密请求体格式"})
 				return
 			}
 
-			decryptedBody, err := Decrypt(&encryptedRequest, secretKey)
+			var aad []byte
+			if version >= protocol.V3 {
+				aad = protocol.RequestAAD(c.Request.Method, c.Request.URL.Path, timestampStr, nonce)
+			}
+			decryptedBody, err := cred.Keys.Open(&encryptedRequest, version, aad)
 			if err != nil {
 				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "请求体解密失败", "detail": err.Error()})
 				return
@@ -113,10 +165,33 @@ func Authenticate() gin.HandlerFunc {
 			c.Request.Body = io.NopCloser(bytes.NewBuffer(decryptedBody))
 		}
 
+		// 将调用方凭证和协议版本存入 context，供后续的 Handler 和响应加密使用
+		c.Set(CredentialKey, cred)
+		c.Set(ProtocolVersionKey, version)
+		if version >= protocol.V3 {
+			c.Set(responseAADKey, protocol.ResponseAAD(c.Request.Method, c.Request.URL.Path, timestampStr, nonce))
+		}
+		c.Header("X-Protocol-Version", strconv.Itoa(version))
+
 		c.Next()
 	}
 }
 
+// isValidNonce 校验 nonce 的格式：8 到 64 位的字母、数字、'-' 或 '_'
+func isValidNonce(nonce string) bool {
+	if len(nonce) < 8 || len(nonce) > 64 {
+		return false
+	}
+	for _, r := range nonce {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // ErrorResponse 定义了标准的错误响应结构体
 type ErrorResponse struct {
 	Error string `json:"error"`
@@ -125,10 +200,12 @@ type ErrorResponse struct {
 // sendEncryptedError 是一个内部辅助函数，用于发送一个加密后的标准错误响应。
 // 这样做可以确保即便是错误信息也不会明文传输。
 func sendEncryptedError(c *gin.Context, status int, message string) {
-	// 1. 从配置中获取API密钥
-	key := []byte(config.Cfg.Security.APISecret)
+	if plaintextDebug {
+		sendPlaintext(c, status, ErrorResponse{Error: message})
+		return
+	}
 
-	// 2. 创建标准错误结构体并序列化为JSON
+	// 1. 创建标准错误结构体并序列化为JSON
 	errorResponse := ErrorResponse{Error: message}
 	jsonBytes, err := json.Marshal(errorResponse)
 	if err != nil {
@@ -139,8 +216,8 @@ func sendEncryptedError(c *gin.Context, status int, message string) {
 		return
 	}
 
-	// 3. 加密序列化后的错误信息
-	encryptedData, err := Encrypt(jsonBytes, key)
+	// 2. 使用当前调用方的密钥加密序列化后的错误信息
+	encryptedData, err := sealResponse(c, jsonBytes)
 	if err != nil {
 		// 如果加密失败，记录日志并返回一个未加密的、最基础的错误。
 		log.Printf("CRITICAL: 无法加密标准错误响应: %v", err)
@@ -148,17 +225,20 @@ func sendEncryptedError(c *gin.Context, status int, message string) {
 		return
 	}
 
-	// 4. 发送加密后的错误信息
+	// 3. 发送加密后的错误信息
 	c.JSON(status, encryptedData)
 }
 
 // SendEncryptedResponse 是一个统一的响应发送函数。
 // 它会将任何给定的数据（无论是成功的结果还是错误信息）加密后发送给客户端。
+// 调试明文模式下直接发送明文。
 func SendEncryptedResponse(c *gin.Context, status int, data any) {
-	// 1. 从配置中获取API密钥
-	key := []byte(config.Cfg.Security.APISecret)
+	if plaintextDebug {
+		sendPlaintext(c, status, data)
+		return
+	}
 
-	// 2. 将传入的数据序列化为JSON
+	// 1. 将传入的数据序列化为JSON
 	jsonBytes, err := json.Marshal(data)
 	if err != nil {
 		log.Printf("ERROR: 无法序列化响应数据: %v", err)
@@ -167,8 +247,8 @@ func SendEncryptedResponse(c *gin.Context, status int, data any) {
 		return
 	}
 
-	// 3. 加密JSON数据
-	encryptedData, err := Encrypt(jsonBytes, key)
+	// 2. 使用当前调用方的当前密钥加密JSON数据
+	encryptedData, err := sealResponse(c, jsonBytes)
 	if err != nil {
 		log.Printf("ERROR: 无法加密响应数据: %v", err)
 		// 如果加密失败，也发送一个加密的通用服务器错误。
@@ -176,6 +256,6 @@ func SendEncryptedResponse(c *gin.Context, status int, data any) {
 		return
 	}
 
-	// 4. 发送最终的加密数据
+	// 3. 发送最终的加密数据
 	c.JSON(status, encryptedData)
 }
@@ -0,0 +1,67 @@
+package security
+
+import (
+	"sync"
+	"time"
+)
+
+// NonceStore 定义了请求 nonce 的存储接口。
+// 默认使用进程内的 MemoryNonceStore；多实例部署时可以基于 Redis 等共享存储实现该接口
+// （例如 SET key 1 NX EX ttl），并通过 SetNonceStore 注册。
+type NonceStore interface {
+	// CheckAndSet 原子地检查 nonce 是否已被使用，未使用时记录它并设置过期时间。
+	// 返回 true 表示该 nonce 是第一次出现。
+	CheckAndSet(nonce string, ttl time.Duration) (bool, error)
+}
+
+// nonceStore 是 Authenticate 中间件使用的 nonce 存储
+var nonceStore NonceStore = NewMemoryNonceStore()
+
+// SetNonceStore 替换 Authenticate 中间件使用的 nonce 存储，应在启动服务前调用
+func SetNonceStore(store NonceStore) {
+	if store != nil {
+		nonceStore = store
+	}
+}
+
+// MemoryNonceStore 是一个带过期时间的内存 nonce 存储
+type MemoryNonceStore struct {
+	mu        sync.Mutex
+	items     map[string]time.Time // nonce -> 过期时间
+	lastSweep time.Time
+}
+
+// nonceSweepInterval 定义了清理过期 nonce 的最小间隔
+const nonceSweepInterval = time.Minute
+
+// NewMemoryNonceStore 创建一个新的内存 nonce 存储
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{
+		items:     make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// CheckAndSet 实现 NonceStore 接口
+func (s *MemoryNonceStore) CheckAndSet(nonce string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 定期清理过期的 nonce，避免内存无限增长
+	if now.Sub(s.lastSweep) >= nonceSweepInterval {
+		for k, expiry := range s.items {
+			if now.After(expiry) {
+				delete(s.items, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if expiry, ok := s.items[nonce]; ok && now.Before(expiry) {
+		return false, nil
+	}
+	s.items[nonce] = now.Add(ttl)
+	return true, nil
+}
@@ -0,0 +1,32 @@
+package security
+
+import (
+	"app/config"
+	"app/pkg/protocol"
+)
+
+const (
+	// ProtocolVersionKey 是存储在 gin.Context 中的请求协议版本的键
+	ProtocolVersionKey = "apiProtocolVersion"
+	// responseAADKey 是存储在 gin.Context 中的响应附加认证数据的键
+	responseAADKey = "apiResponseAAD"
+)
+
+// EncryptedData 是请求和响应使用的加密信封，定义见 protocol 包
+type EncryptedData = protocol.EncryptedData
+
+// aesKeyBits 返回配置的 AES 密钥长度，未配置时默认 256 位
+func aesKeyBits() int {
+	if bits := config.Cfg.Security.AESKeyBits; bits != 0 {
+		return bits
+	}
+	return 256
+}
+
+// encryptionKey 返回指定协议版本下密钥实际用于 AES 加密的字节
+func encryptionKey(key *Key, version int) ([]byte, error) {
+	if version >= protocol.V2 {
+		return protocol.DeriveEncryptionKey(key.Secret, aesKeyBits())
+	}
+	return key.Secret, nil
+}
@@ -0,0 +1,94 @@
+package security
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 调用方角色
+const (
+	RolePlatformAdmin = "platform_admin" // 平台管理员：可访问全部接口和全部门店的数据
+	RoleStoreOperator = "store_operator" // 门店运营：只能管理所属门店 (StoreID) 的门店、WIFI 和优惠券
+	RoleMiniProgram   = "mini_program"   // 小程序：面向终端用户的接口，例如扫码、领券和用户档案
+)
+
+// ValidateRole 校验角色名称，以及门店运营角色必须绑定门店
+func ValidateRole(role string, storeID uint) error {
+	switch role {
+	case RolePlatformAdmin, RoleMiniProgram:
+		return nil
+	case RoleStoreOperator:
+		if storeID == 0 {
+			return fmt.Errorf("角色 %s 必须绑定门店", role)
+		}
+		return nil
+	default:
+		return fmt.Errorf("未知的调用方角色 %q", role)
+	}
+}
+
+// Allow 是一个中间件，只允许指定角色的调用方访问后续接口。
+// 必须在 Authenticate 之后使用，路由的权限声明见 router.SetupRouter。
+func Allow(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cred := CurrentCredential(c)
+		if cred == nil || !slices.Contains(roles, cred.Role) {
+			SendEncryptedResponse(c, http.StatusForbidden, ErrorResponse{Error: "无权访问该接口"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// StoreScope 返回当前调用方被限定的门店ID。
+// 门店运营角色返回其所属门店和 true；其他角色不限定门店，返回 0 和 false。
+func StoreScope(c *gin.Context) (uint, bool) {
+	cred := CurrentCredential(c)
+	if cred != nil && cred.Role == RoleStoreOperator {
+		return cred.StoreID, true
+	}
+	return 0, false
+}
+
+// HasRole 判断当前调用方是否为指定角色
+func HasRole(c *gin.Context, role string) bool {
+	cred := CurrentCredential(c)
+	return cred != nil && cred.Role == role
+}
+
+// CanViewDeleted 判断当前调用方是否可以查询已删除（软删除）的数据，只有平台管理员和门店运营可以
+func CanViewDeleted(c *gin.Context) bool {
+	return HasRole(c, RolePlatformAdmin) || HasRole(c, RoleStoreOperator)
+}
+
+// AbortForbiddenDeleted 发送一个加密的 403 响应，表示调用方无权查询已删除的数据
+func AbortForbiddenDeleted(c *gin.Context) {
+	SendEncryptedResponse(c, http.StatusForbidden, ErrorResponse{Error: "无权查询已删除的数据"})
+	c.Abort()
+}
+
+// CanAccessStore 判断当前调用方是否可以操作指定门店的数据
+func CanAccessStore(c *gin.Context, storeID uint) bool {
+	scope, scoped := StoreScope(c)
+	return !scoped || storeID == scope
+}
+
+// CanAccessOptionalStore 与 CanAccessStore 相同，但 storeID 可以为 nil。
+// nil 表示全平台数据（例如全平台通用的优惠券），只有不受门店限定的调用方可以操作。
+func CanAccessOptionalStore(c *gin.Context, storeID *uint) bool {
+	if storeID == nil {
+		_, scoped := StoreScope(c)
+		return !scoped
+	}
+	return CanAccessStore(c, *storeID)
+}
+
+// AbortForbiddenStore 发送一个加密的 403 响应，表示调用方无权操作该门店的数据
+func AbortForbiddenStore(c *gin.Context) {
+	SendEncryptedResponse(c, http.StatusForbidden, ErrorResponse{Error: "无权操作该门店的数据"})
+	c.Abort()
+}
@@ -0,0 +1,132 @@
+package security
+
+import (
+	"app/config"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrMasterKeyMismatch 表示数据是用另一个主密钥加密的，通常是主密钥配置被更改
+var ErrMasterKeyMismatch = errors.New("数据使用的主密钥与当前配置不一致")
+
+// SealedSecret 是静态加密后的敏感数据（信封加密）：
+// 数据使用随机生成的数据密钥加密，数据密钥再使用服务端主密钥加密后一并保存
+type SealedSecret struct {
+	Ciphertext string // base64(nonce || 密文 || tag)
+	DataKey    string // base64(nonce || 经主密钥加密的数据密钥 || tag)
+	KeyID      string // 主密钥指纹，用于识别主密钥是否变更
+}
+
+// masterKey 返回用于加密数据密钥的主密钥及其指纹。
+// 未单独配置时从全局 APISecret 派生，避免与请求签名共用同一个密钥。
+func masterKey() ([]byte, string, error) {
+	var key []byte
+	if secret := config.Cfg.Security.DataMasterKey; secret != "" {
+		var err error
+		if key, err = hex.DecodeString(secret); err != nil || len(key) != 32 {
+			return nil, "", errors.New("无效的 data_master_key，必须是 64 位十六进制字符串")
+		}
+	} else {
+		var err error
+		if key, err = hkdf.Key(sha256.New, []byte(config.Cfg.Security.APISecret), nil, "wificity/data-master-key", 32); err != nil {
+			return nil, "", err
+		}
+	}
+	sum := sha256.Sum256(key)
+	return key, hex.EncodeToString(sum[:8]), nil
+}
+
+// gcmSeal 使用 AES-GCM 加密，返回 nonce || 密文 || tag
+func gcmSeal(key, plaintext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// gcmOpen 解密 gcmSeal 的输出
+func gcmOpen(key, sealed, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("密文长度无效")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, aad)
+}
+
+// SealSecret 对敏感数据进行静态加密。
+// purpose 说明数据的用途（例如 "wifi_config.password"），会绑定进附加认证数据，防止密文被挪作他用。
+func SealSecret(purpose string, plaintext []byte) (*SealedSecret, error) {
+	kek, keyID, err := masterKey()
+	if err != nil {
+		return nil, err
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	ciphertext, err := gcmSeal(dataKey, plaintext, []byte(purpose))
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := gcmSeal(kek, dataKey, []byte(purpose))
+	if err != nil {
+		return nil, err
+	}
+	return &SealedSecret{
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+		DataKey:    base64.StdEncoding.EncodeToString(wrappedKey),
+		KeyID:      keyID,
+	}, nil
+}
+
+// OpenSecret 解密 SealSecret 加密的数据，purpose 必须与加密时一致
+func OpenSecret(purpose string, sealed *SealedSecret) ([]byte, error) {
+	kek, keyID, err := masterKey()
+	if err != nil {
+		return nil, err
+	}
+	if sealed.KeyID != keyID {
+		return nil, ErrMasterKeyMismatch
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(sealed.DataKey)
+	if err != nil {
+		return nil, fmt.Errorf("无效的数据密钥: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(sealed.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("无效的密文: %w", err)
+	}
+	dataKey, err := gcmOpen(kek, wrappedKey, []byte(purpose))
+	if err != nil {
+		return nil, fmt.Errorf("无法解密数据密钥: %w", err)
+	}
+	plaintext, err := gcmOpen(dataKey, ciphertext, []byte(purpose))
+	if err != nil {
+		return nil, fmt.Errorf("无法解密数据: %w", err)
+	}
+	return plaintext, nil
+}
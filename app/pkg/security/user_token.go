@@ -0,0 +1,163 @@
+package security
+
+import (
+	"app/config"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// UserTokenHeader 是携带终端用户令牌的请求头
+	UserTokenHeader = "X-User-Token"
+	// UserUnionIDKey 是存储在 gin.Context 中的已认证用户 UnionID 的键
+	UserUnionIDKey = "userUnionID"
+)
+
+var (
+	// ErrInvalidUserToken 表示用户令牌格式错误或签名无效
+	ErrInvalidUserToken = errors.New("无效的用户令牌")
+	// ErrUserTokenExpired 表示用户令牌已过期
+	ErrUserTokenExpired = errors.New("用户令牌已过期")
+)
+
+// UserClaims 是用户令牌中携带的声明
+type UserClaims struct {
+	UnionID   string `json:"uid"` // 用户 UnionID
+	AppID     string `json:"app"` // 签发令牌的调用方，令牌只能由同一调用方使用
+	IssuedAt  int64  `json:"iat"` // 签发时间 (Unix 秒)
+	ExpiresAt int64  `json:"exp"` // 过期时间 (Unix 秒)
+}
+
+// userTokenKey 返回用户令牌的签名密钥。未单独配置时从全局 APISecret 派生，避免与请求签名共用同一个密钥。
+func userTokenKey() ([]byte, error) {
+	if secret := config.Cfg.Security.UserTokenSecret; secret != "" {
+		return []byte(secret), nil
+	}
+	return hkdf.Key(sha256.New, []byte(config.Cfg.Security.APISecret), nil, "wificity/user-token", sha256.Size)
+}
+
+// IssueUserToken 为指定调用方下的用户签发一个短期令牌。
+// 令牌格式为 base64url(声明 JSON) + "." + base64url(HMAC-SHA256 签名)。
+func IssueUserToken(appID, unionID string) (string, time.Time, error) {
+	key, err := userTokenKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(config.Cfg.Security.UserTokenTTL)
+	payload, err := json.Marshal(UserClaims{
+		UnionID:   unionID,
+		AppID:     appID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encodedPayload))
+	return encodedPayload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), expiresAt, nil
+}
+
+// ParseUserToken 校验用户令牌的签名和有效期，并返回其中的声明
+func ParseUserToken(token string) (*UserClaims, error) {
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidUserToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return nil, ErrInvalidUserToken
+	}
+	key, err := userTokenKey()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encodedPayload))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, ErrInvalidUserToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidUserToken
+	}
+	var claims UserClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.UnionID == "" {
+		return nil, ErrInvalidUserToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrUserTokenExpired
+	}
+	return &claims, nil
+}
+
+// UserIdentity 是一个中间件，用于认证请求头 X-User-Token 中的终端用户令牌，并将用户 UnionID 存入 context。
+// 小程序角色访问用户相关的接口时必须携带令牌；平台管理员等后台调用方可以不携带，此时由请求参数指定用户。
+// 必须在 Authenticate 之后使用。
+func UserIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cred := CurrentCredential(c)
+		token := c.GetHeader(UserTokenHeader)
+		if token == "" {
+			if cred == nil || cred.Role == RoleMiniProgram {
+				SendEncryptedResponse(c, http.StatusUnauthorized, ErrorResponse{Error: "缺少用户令牌 (X-User-Token)"})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		claims, err := ParseUserToken(token)
+		if err != nil {
+			SendEncryptedResponse(c, http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+			c.Abort()
+			return
+		}
+		// 令牌只能由签发它的调用方使用
+		if cred == nil || claims.AppID != cred.AppID {
+			SendEncryptedResponse(c, http.StatusUnauthorized, ErrorResponse{Error: ErrInvalidUserToken.Error()})
+			c.Abort()
+			return
+		}
+		c.Set(UserUnionIDKey, claims.UnionID)
+		c.Next()
+	}
+}
+
+// CurrentUserUnionID 返回通过用户令牌认证的用户 UnionID，未携带令牌时返回空字符串
+func CurrentUserUnionID(c *gin.Context) string {
+	return c.GetString(UserUnionIDKey)
+}
+
+// ResolveUserUnionID 确定请求所操作的用户。
+// 携带了用户令牌时以令牌中的用户为准，supplied 不为空且与之不一致时拒绝；
+// 否则（后台调用方）使用请求参数中的 supplied。
+// 返回 false 时已发送错误响应。
+func ResolveUserUnionID(c *gin.Context, supplied string) (string, bool) {
+	if unionID := CurrentUserUnionID(c); unionID != "" {
+		if supplied != "" && supplied != unionID {
+			SendEncryptedResponse(c, http.StatusForbidden, ErrorResponse{Error: "无权操作其他用户的数据"})
+			return "", false
+		}
+		return unionID, true
+	}
+	if supplied == "" {
+		SendEncryptedResponse(c, http.StatusBadRequest, ErrorResponse{Error: "缺少用户 UnionID"})
+		return "", false
+	}
+	return supplied, true
+}
@@ -0,0 +1,82 @@
+package wechat
+
+import (
+	"app/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// defaultAPIBase 是微信服务端接口的默认地址
+const defaultAPIBase = "https://api.weixin.qq.com"
+
+var (
+	// ErrNotConfigured 表示未配置小程序的 AppID 和 AppSecret
+	ErrNotConfigured = errors.New("未配置微信小程序的 app_id 和 app_secret")
+	// ErrInvalidCode 表示登录凭证 code 无效、已使用或已过期
+	ErrInvalidCode = errors.New("无效的微信登录凭证")
+)
+
+// httpClient 是调用微信接口使用的 HTTP 客户端
+var httpClient = &http.Client{Timeout: 5 * time.Second}
+
+// Session 是 code2Session 接口返回的用户身份
+type Session struct {
+	OpenID  string `json:"openid"`
+	UnionID string `json:"unionid"` // 小程序未绑定到微信开放平台时为空
+}
+
+// Code2Session 使用小程序 wx.login 获取的登录凭证 code 向微信服务端换取用户的 OpenID 和 UnionID。
+// code 只能使用一次，由微信服务端校验，因此换取到的身份是可信的
+func Code2Session(ctx context.Context, code string) (*Session, error) {
+	cfg := config.Cfg.WeChat
+	if cfg.AppID == "" || cfg.AppSecret == "" {
+		return nil, ErrNotConfigured
+	}
+	base := cfg.APIBase
+	if base == "" {
+		base = defaultAPIBase
+	}
+
+	query := url.Values{}
+	query.Set("appid", cfg.AppID)
+	query.Set("secret", cfg.AppSecret)
+	query.Set("js_code", code)
+	query.Set("grant_type", "authorization_code")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/sns/jscode2session?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("调用微信登录接口失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("调用微信登录接口失败: HTTP %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Session
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("解析微信登录接口响应失败: %w", err)
+	}
+	switch result.ErrCode {
+	case 0:
+	case 40029, 40163: // code 无效、code 已被使用
+		return nil, ErrInvalidCode
+	default:
+		return nil, fmt.Errorf("微信登录接口返回错误 %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	if result.OpenID == "" {
+		return nil, ErrInvalidCode
+	}
+	return &result.Session, nil
+}